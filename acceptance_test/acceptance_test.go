@@ -137,6 +137,23 @@ var _ = Describe("Accessing the bits-service", func() {
 					Expect(response.StatusCode).To(Equal(http.StatusAccepted))
 				})
 			})
+
+			It("returns StatusForbidden when the URL was signed for GET", func() {
+				response, e := client.Do(
+					newGetRequest("https://internal.127.0.0.1.nip.io:4443/sign/packages/myguid", "the-username", "the-password"))
+				Expect(e).NotTo(HaveOccurred())
+				Expect(response.StatusCode).To(Equal(http.StatusOK))
+
+				signedUrl, e := ioutil.ReadAll(response.Body)
+				Expect(e).NotTo(HaveOccurred())
+
+				r, e := httputil.NewPutRequest(string(signedUrl), map[string]map[string]io.Reader{
+					"package": map[string]io.Reader{"somefilename": CreateZip(map[string]string{"somefile": "lalala\n\n"})},
+				})
+				Expect(e).NotTo(HaveOccurred())
+
+				Expect(client.Do(r)).To(WithTransform(GetStatusCode, Equal(http.StatusForbidden)))
+			})
 		})
 	})
 })
@@ -2,6 +2,7 @@ package bitsgo
 
 import (
 	"archive/zip"
+	"context"
 	"crypto/sha1"
 	"encoding/json"
 	"fmt"
@@ -25,6 +26,7 @@ type AppStashHandler struct {
 	minimumSize      uint64
 	maximumSize      uint64
 	metricsService   MetricsService
+	zipLimits        ZipLimits
 }
 
 func NewAppStashHandlerWithSizeThresholds(blobstore NoRedirectBlobstore, maxBodySizeLimit uint64, minimumSize uint64, maximumSize uint64, metricsService MetricsService) *AppStashHandler {
@@ -37,6 +39,12 @@ func NewAppStashHandlerWithSizeThresholds(blobstore NoRedirectBlobstore, maxBody
 	}
 }
 
+// WithZipLimits restricts uploaded entries and created bundles.
+func (handler *AppStashHandler) WithZipLimits(zipLimits ZipLimits) *AppStashHandler {
+	handler.zipLimits = zipLimits
+	return handler
+}
+
 func (handler *AppStashHandler) PostMatches(responseWriter http.ResponseWriter, request *http.Request) {
 	if !HandleBodySizeLimits(responseWriter, request, handler.maxBodySizeLimit) {
 		return
@@ -57,12 +65,16 @@ func (handler *AppStashHandler) PostMatches(responseWriter http.ResponseWriter,
 		util.FprintDescriptionAsJSON(responseWriter, "The request is semantically invalid: must be a non-empty array.")
 		return
 	}
+	if e := invalidSha1In(fingerprints); e != nil {
+		invalidIdentifier(responseWriter, request, e)
+		return
+	}
 	matchedFingerprints := []Fingerprint{} // this must not be nil, because the JSON marshaller will not marshal it correctly in case of []
 	for _, entry := range fingerprints {
 		if entry.Size < handler.minimumSize || entry.Size > handler.maximumSize {
 			continue
 		}
-		exists, e := handler.blobstore.Exists(entry.Sha1)
+		exists, e := handler.blobstore.Exists(request.Context(), entry.Sha1)
 		util.PanicOnError(e)
 		if exists {
 			matchedFingerprints = append(matchedFingerprints, entry)
@@ -84,7 +96,7 @@ func (handler *AppStashHandler) PostEntries(responseWriter http.ResponseWriter,
 	}
 	defer uploadedFile.Close()
 
-	tempZipFile, e := ioutil.TempFile("", "")
+	tempZipFile, e := ioutil.TempFile("", "bits-app-stash")
 	util.PanicOnError(e)
 	defer os.Remove(tempZipFile.Name())
 	defer tempZipFile.Close()
@@ -99,12 +111,23 @@ func (handler *AppStashHandler) PostEntries(responseWriter http.ResponseWriter,
 	}
 	defer openZipFile.Close()
 
+	e = handler.zipLimits.ValidateEntries(openZipFile.File, 0)
+	if zipLimitError, isZipLimitError := e.(*ZipLimitError); isZipLimitError {
+		zipLimitExceeded(responseWriter, request, zipLimitError)
+		return
+	}
+	sizeBudget := handler.zipLimits.NewSizeBudget()
+
 	fingerprints := []Fingerprint{} // this must not be nil, because the JSON marshaller will not marshal it correctly in case of []
 	for _, zipFileEntry := range openZipFile.File {
 		if !zipFileEntry.FileInfo().Mode().IsRegular() {
 			continue
 		}
-		sha, e := copyTo(handler.blobstore, zipFileEntry)
+		sha, e := copyTo(request.Context(), handler.blobstore, zipFileEntry, sizeBudget)
+		if zipLimitError, isZipLimitError := sizeBudget.Err().(*ZipLimitError); isZipLimitError {
+			zipLimitExceeded(responseWriter, request, zipLimitError)
+			return
+		}
 		if _, isNoSpaceLeftError := e.(*NoSpaceLeftError); isNoSpaceLeftError {
 			http.Error(responseWriter, util.DescriptionAndCodeAsJSON(500000, "Request Entity Too Large"), http.StatusInsufficientStorage)
 			return
@@ -124,21 +147,21 @@ func (handler *AppStashHandler) PostEntries(responseWriter http.ResponseWriter,
 	responseWriter.Write(receipt)
 }
 
-func copyTo(blobstore NoRedirectBlobstore, zipFileEntry *zip.File) (sha string, err error) {
+func copyTo(ctx context.Context, blobstore NoRedirectBlobstore, zipFileEntry *zip.File, sizeBudget *ZipSizeBudget) (sha string, err error) {
 	unzippedReader, e := zipFileEntry.Open()
 	if e != nil {
 		return "", errors.WithStack(e)
 	}
 	defer unzippedReader.Close()
 
-	tempZipEntryFile, e := ioutil.TempFile("", filepath.Base(zipFileEntry.Name))
+	tempZipEntryFile, e := ioutil.TempFile("", "bits-app-stash-"+filepath.Base(zipFileEntry.Name))
 	if e != nil {
 		return "", errors.WithStack(e)
 	}
 	defer os.Remove(tempZipEntryFile.Name())
 	defer tempZipEntryFile.Close()
 
-	sha, e = copyCalculatingSha(tempZipEntryFile, unzippedReader)
+	sha, e = copyCalculatingSha(tempZipEntryFile, sizeBudget.Reader(unzippedReader))
 	if e != nil {
 		return "", errors.WithStack(e)
 	}
@@ -149,7 +172,7 @@ func copyTo(blobstore NoRedirectBlobstore, zipFileEntry *zip.File) (sha string,
 	}
 	defer entryFileRead.Close()
 
-	e = blobstore.Put(sha, entryFileRead)
+	e = blobstore.Put(ctx, sha, entryFileRead)
 	if _, noSpaceLeft := e.(*NoSpaceLeftError); noSpaceLeft {
 		return "", e
 	}
@@ -225,9 +248,17 @@ func (handler *AppStashHandler) PostBundles(responseWriter http.ResponseWriter,
 		util.FprintDescriptionAsJSON(responseWriter, "The request is semantically invalid: key `%v` missing or empty", key)
 		return
 	}
+	if e := invalidSha1In(bundlesPayload); e != nil {
+		invalidIdentifier(responseWriter, request, e)
+		return
+	}
 
-	tempZipFilename, e := CreateTempZipFileFrom(bundlesPayload, zipReader, handler.minimumSize, handler.maximumSize, handler.blobstore, handler.metricsService)
+	tempZipFilename, e := CreateTempZipFileWithLimitsFrom(request.Context(), bundlesPayload, zipReader, handler.minimumSize, handler.maximumSize, handler.zipLimits, handler.blobstore, handler.metricsService)
 	if e != nil {
+		if zipLimitError, ok := e.(*ZipLimitError); ok {
+			zipLimitExceeded(responseWriter, request, zipLimitError)
+			return
+		}
 		if notFoundError, ok := e.(*NotFoundError); ok {
 			responseWriter.WriteHeader(http.StatusNotFound)
 			util.FprintDescriptionAsJSON(responseWriter, "%v not found", notFoundError.MissingKey)
@@ -256,3 +287,14 @@ func anyKeyMissingIn(bundlesPayload []Fingerprint) (bool, string) {
 	}
 	return false, ""
 }
+
+// invalidSha1In returns an error if any of the fingerprints' sha1s cannot be used as app stash key.
+func invalidSha1In(fingerprints []Fingerprint) error {
+	validator := IdentifierValidatorFor("app_stash")
+	for _, entry := range fingerprints {
+		if e := validator.Validate(entry.Sha1); e != nil {
+			return e
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package bitsgo_test
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"io"
 	"io/ioutil"
 	"math"
@@ -45,9 +46,9 @@ var _ = Describe("AppStash", func() {
 
 			BeforeEach(func() {
 				appStashHandler = bitsgo.NewAppStashHandlerWithSizeThresholds(blobstore, 0, minimumSize, maximumSize, NewMockMetricsService())
-				Expect(blobstore.Put("shaA", strings.NewReader("cached content"))).To(Succeed())
-				Expect(blobstore.Put("shaB", strings.NewReader("another cached content"))).To(Succeed())
-				Expect(blobstore.Put("shaC", strings.NewReader("yet another cached content"))).To(Succeed())
+				Expect(blobstore.Put(context.Background(), "shaA", strings.NewReader("cached content"))).To(Succeed())
+				Expect(blobstore.Put(context.Background(), "shaB", strings.NewReader("another cached content"))).To(Succeed())
+				Expect(blobstore.Put(context.Background(), "shaC", strings.NewReader("yet another cached content"))).To(Succeed())
 			})
 
 			It("matches only files where sizes are within thresholds", func() {
@@ -85,13 +86,64 @@ var _ = Describe("AppStash", func() {
 					]`))
 			})
 		})
+
+		It("rejects sha1s which are not valid app stash keys", func() {
+			appStashHandler.PostMatches(responseWriter, httptest.NewRequest(
+				"POST", "http://example.com",
+				strings.NewReader(`[{"sha1":"../packages/someguid", "fn":"filenameA", "size": 20, "mode": "644"}]`)))
+
+			Expect(responseWriter.Code).To(Equal(http.StatusBadRequest))
+			Expect(responseWriter.Body.String()).To(ContainSubstring(`"code":290010`))
+		})
+	})
+
+	Describe("PostEntries", func() {
+		postEntries := func(zipContents map[string]string) {
+			r, e := httputil.NewPutRequest("some url", map[string]map[string]io.Reader{
+				"application": map[string]io.Reader{"irrelevant": CreateZip(zipContents)},
+			})
+			Expect(e).NotTo(HaveOccurred())
+			appStashHandler.PostEntries(responseWriter, r)
+		}
+
+		It("stores all entries", func() {
+			postEntries(map[string]string{"folder/file": "content"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusCreated), responseWriter.Body.String())
+			Expect(responseWriter.Body.String()).To(ContainSubstring(`"fn":"folder/file"`))
+		})
+
+		It("rejects entries which escape the app's directory", func() {
+			postEntries(map[string]string{"../../.profile": "evil"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(responseWriter.Body.String()).To(ContainSubstring(`"code":290015`))
+		})
+
+		It("rejects zip bombs", func() {
+			appStashHandler.WithZipLimits(bitsgo.ZipLimits{MaxCompressionRatio: 100})
+
+			postEntries(map[string]string{"zeros": strings.Repeat("0", 2*1024*1024)})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(responseWriter.Body.String()).To(ContainSubstring(`"code":290013`))
+		})
+
+		It("rejects too many entries", func() {
+			appStashHandler.WithZipLimits(bitsgo.ZipLimits{MaxEntries: 1})
+
+			postEntries(map[string]string{"file1": "content", "file2": "content"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(responseWriter.Body.String()).To(ContainSubstring(`"code":290011`))
+		})
 	})
 
 	Describe("PostBundles", func() {
 
 		BeforeEach(func() {
-			Expect(blobstore.Put("shaA", strings.NewReader("cached content"))).To(Succeed())
-			Expect(blobstore.Put("shaC", strings.NewReader("another cached content"))).To(Succeed())
+			Expect(blobstore.Put(context.Background(), "shaA", strings.NewReader("cached content"))).To(Succeed())
+			Expect(blobstore.Put(context.Background(), "shaC", strings.NewReader("another cached content"))).To(Succeed())
 		})
 
 		Context("non-multipart/form-data request", func() {
@@ -118,6 +170,24 @@ var _ = Describe("AppStash", func() {
 			})
 		})
 
+		It("rejects file names which escape the bundle's directory", func() {
+			appStashHandler.PostBundles(responseWriter, httptest.NewRequest("POST", "http://example.com",
+				strings.NewReader(`[{"sha1":"shaA", "fn":"../../.profile"}]`)))
+
+			Expect(responseWriter.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(responseWriter.Body.String()).To(ContainSubstring(`"code":290015`))
+		})
+
+		It("rejects bundles exceeding the maximum uncompressed size", func() {
+			appStashHandler.WithZipLimits(bitsgo.ZipLimits{MaxUncompressedSize: 20})
+
+			appStashHandler.PostBundles(responseWriter, httptest.NewRequest("POST", "http://example.com",
+				strings.NewReader(`[{"sha1":"shaA", "fn":"file1"}, {"sha1":"shaC", "fn":"file2"}]`)))
+
+			Expect(responseWriter.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(responseWriter.Body.String()).To(ContainSubstring(`"code":290012`))
+		})
+
 		Context("multipart/form-data request", func() {
 			It("bundles all files from blobstore and from uploaded zip into zip bundle", func() {
 				_, filename, _, _ := runtime.Caller(0)
@@ -154,10 +224,10 @@ var _ = Describe("AppStash", func() {
 				VerifyZipFileEntry(zipReader, "folder/filenameC", "another cached content")
 				VerifyZipFileEntry(zipReader, "zip-folder/file-in-folder", "folder file content")
 
-				content, e := blobstore.Get("b971c6ef19b1d70ae8f0feb989b106c319b36230")
+				content, e := blobstore.Get(context.Background(), "b971c6ef19b1d70ae8f0feb989b106c319b36230")
 				Expect(e).NotTo(HaveOccurred())
 				Expect(ioutil.ReadAll(content)).To(MatchRegexp("test-content\n"))
-				content, e = blobstore.Get("e04c62ab0e87c29f862ee7c4e85c9fed51531dae")
+				content, e = blobstore.Get(context.Background(), "e04c62ab0e87c29f862ee7c4e85c9fed51531dae")
 				Expect(e).NotTo(HaveOccurred())
 				Expect(ioutil.ReadAll(content)).To(MatchRegexp("folder file content\n"))
 			})
@@ -0,0 +1,324 @@
+package bitsgo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+	"github.com/pkg/errors"
+)
+
+// AsyncUpload is a pending upload of a temp file to the blobstore, which has already been accepted.
+type AsyncUpload struct {
+	ID           string     `json:"id"`
+	ResourceType string     `json:"resource_type"`
+	Identifier   string     `json:"identifier"`
+	BlobKey      string     `json:"blob_key,omitempty"`
+	TempFilename string     `json:"temp_filename"`
+	Sha1         string     `json:"sha1"`
+	Sha256       string     `json:"sha256"`
+	AuditEvent   AuditEvent `json:"audit_event"`
+	EnqueuedAt   time.Time  `json:"enqueued_at"`
+
+	// Resumed is true for uploads which have been loaded from the queue directory after a restart.
+	Resumed bool `json:"-"`
+
+	ctx       context.Context
+	uploadJob *UploadJobTracker
+}
+
+// blobKey is where the upload is stored. It only differs from Identifier for droplets uploaded with a Digest header.
+func (upload *AsyncUpload) blobKey() string {
+	if upload.BlobKey == "" {
+		return upload.Identifier
+	}
+	return upload.BlobKey
+}
+
+// AsyncUploadQueue processes async uploads with a fixed number of workers. If it has a directory, uploads are
+// persisted there together with their temp files until they have been processed, so that they can be resumed
+// after a restart.
+type AsyncUploadQueue struct {
+	dir     string
+	workers int
+
+	mutex     sync.Mutex
+	cond      *sync.Cond
+	pending   []*AsyncUpload
+	active    []*AsyncUpload
+	stopped   bool
+	waitGroup sync.WaitGroup
+}
+
+// NewAsyncUploadQueue creates dir if it does not exist. An empty dir makes the queue non-durable.
+func NewAsyncUploadQueue(dir string, workers int) (*AsyncUploadQueue, error) {
+	if dir != "" {
+		e := os.MkdirAll(dir, 0700)
+		if e != nil {
+			return nil, errors.Wrapf(e, "Could not create async upload queue directory '%v'", dir)
+		}
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	queue := &AsyncUploadQueue{dir: dir, workers: workers}
+	queue.cond = sync.NewCond(&queue.mutex)
+	return queue, nil
+}
+
+// Enqueue persists upload before returning, if the queue is durable. In this case, the upload's temp file is
+// moved into the queue directory.
+func (queue *AsyncUploadQueue) Enqueue(upload *AsyncUpload) error {
+	if upload.ID == "" {
+		id, e := newAsyncUploadID()
+		if e != nil {
+			return e
+		}
+		upload.ID = id
+	}
+	if queue.dir != "" {
+		e := queue.persist(upload)
+		if e != nil {
+			return e
+		}
+	}
+
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	queue.pending = append(queue.pending, upload)
+	queue.cond.Signal()
+	return nil
+}
+
+// Start loads the uploads persisted before a restart and starts the workers, which call process for each upload.
+// process is responsible for reporting failures, e.g. to the Cloud Controller. Once it returns, the upload is
+// removed from the queue.
+func (queue *AsyncUploadQueue) Start(process func(upload *AsyncUpload)) error {
+	resumed, e := queue.loadPersisted()
+	if e != nil {
+		return e
+	}
+	if len(resumed) > 0 {
+		logger.Log.Infow("Resuming async uploads", "queue-dir", queue.dir, "count", len(resumed))
+	}
+
+	queue.mutex.Lock()
+	queue.pending = append(resumed, queue.pending...)
+	queue.mutex.Unlock()
+
+	for i := 0; i < queue.workers; i++ {
+		queue.waitGroup.Add(1)
+		go queue.work(process)
+	}
+	return nil
+}
+
+// Stop waits for the uploads currently being processed. Pending uploads are not processed anymore. Durable queues
+// resume them on the next Start.
+func (queue *AsyncUploadQueue) Stop() {
+	queue.mutex.Lock()
+	queue.stopped = true
+	queue.cond.Broadcast()
+	queue.mutex.Unlock()
+
+	queue.waitGroup.Wait()
+}
+
+// Drain processes the pending uploads until there are none left or ctx is done, and stops the workers.
+// It does not wait for uploads still in progress when ctx is done. A durable queue resumes its pending and
+// in-progress uploads on the next Start. A non-durable queue returns them instead, so that they can be failed.
+// The temp files of in-progress uploads are still being read.
+func (queue *AsyncUploadQueue) Drain(ctx context.Context) (abandoned []*AsyncUpload, inProgress []*AsyncUpload) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			queue.mutex.Lock()
+			queue.cond.Broadcast()
+			queue.mutex.Unlock()
+		case <-done:
+		}
+	}()
+
+	queue.mutex.Lock()
+	for (len(queue.pending) > 0 || len(queue.active) > 0) && ctx.Err() == nil {
+		queue.cond.Wait()
+	}
+	queue.stopped = true
+	queue.cond.Broadcast()
+	idle := len(queue.active) == 0
+	if queue.dir == "" {
+		abandoned = queue.pending
+		queue.pending = nil
+		inProgress = append(inProgress, queue.active...)
+	}
+	queue.mutex.Unlock()
+
+	if idle {
+		queue.waitGroup.Wait()
+	} else {
+		logger.Log.Errorw("Async uploads still in progress after drain timeout", "queue-dir", queue.dir)
+	}
+	return abandoned, inProgress
+}
+
+// Len returns the number of uploads which have not been picked up by a worker yet.
+func (queue *AsyncUploadQueue) Len() int {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	return len(queue.pending)
+}
+
+func (queue *AsyncUploadQueue) work(process func(upload *AsyncUpload)) {
+	defer queue.waitGroup.Done()
+	for {
+		upload, ok := queue.next()
+		if !ok {
+			return
+		}
+		process(upload)
+		queue.remove(upload)
+
+		queue.mutex.Lock()
+		for i := range queue.active {
+			if queue.active[i] == upload {
+				queue.active = append(queue.active[:i], queue.active[i+1:]...)
+				break
+			}
+		}
+		// Wakes up Drain
+		queue.cond.Broadcast()
+		queue.mutex.Unlock()
+	}
+}
+
+func (queue *AsyncUploadQueue) next() (*AsyncUpload, bool) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	for len(queue.pending) == 0 && !queue.stopped {
+		queue.cond.Wait()
+	}
+	if queue.stopped {
+		return nil, false
+	}
+	upload := queue.pending[0]
+	queue.pending = queue.pending[1:]
+	queue.active = append(queue.active, upload)
+	return upload, true
+}
+
+func (queue *AsyncUploadQueue) persist(upload *AsyncUpload) error {
+	queuedFilename := filepath.Join(queue.dir, upload.ID+".bits")
+	e := moveFile(upload.TempFilename, queuedFilename)
+	if e != nil {
+		return errors.Wrapf(e, "Could not move temp file '%v' into async upload queue", upload.TempFilename)
+	}
+	upload.TempFilename = queuedFilename
+
+	record, e := json.Marshal(upload)
+	if e != nil {
+		return errors.WithStack(e)
+	}
+	recordFilename := filepath.Join(queue.dir, upload.ID+".json")
+	e = util.WriteFileAtomically(recordFilename, record, 0600)
+	if e != nil {
+		return errors.Wrapf(e, "Could not write async upload record '%v'", recordFilename)
+	}
+	return nil
+}
+
+func (queue *AsyncUploadQueue) remove(upload *AsyncUpload) {
+	if queue.dir == "" {
+		return
+	}
+	e := os.Remove(filepath.Join(queue.dir, upload.ID+".json"))
+	if e != nil && !os.IsNotExist(e) {
+		logger.Log.Errorw("Could not remove async upload record", "id", upload.ID, "error", e)
+	}
+	// Usually removed when uploading. This only covers failures before the upload started.
+	os.Remove(upload.TempFilename)
+}
+
+func (queue *AsyncUploadQueue) loadPersisted() ([]*AsyncUpload, error) {
+	if queue.dir == "" {
+		return nil, nil
+	}
+	recordFilenames, e := filepath.Glob(filepath.Join(queue.dir, "*.json"))
+	if e != nil {
+		return nil, errors.WithStack(e)
+	}
+	var uploads []*AsyncUpload
+	for _, recordFilename := range recordFilenames {
+		record, e := ioutil.ReadFile(recordFilename)
+		if e != nil {
+			return nil, errors.Wrapf(e, "Could not read async upload record '%v'", recordFilename)
+		}
+		upload := &AsyncUpload{}
+		e = json.Unmarshal(record, upload)
+		if e != nil || upload.ID != strings.TrimSuffix(filepath.Base(recordFilename), ".json") {
+			logger.Log.Errorw("Discarding invalid async upload record", "record", recordFilename, "error", e)
+			os.Remove(recordFilename)
+			continue
+		}
+		upload.Resumed = true
+		uploads = append(uploads, upload)
+	}
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].EnqueuedAt.Before(uploads[j].EnqueuedAt) })
+	return uploads, nil
+}
+
+func newAsyncUploadID() (string, error) {
+	id := make([]byte, 16)
+	_, e := rand.Read(id)
+	if e != nil {
+		return "", errors.Wrap(e, "Could not generate async upload ID")
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// moveFile falls back to copying when source and target are on different file systems.
+func moveFile(source, target string) error {
+	if os.Rename(source, target) == nil {
+		return nil
+	}
+	sourceFile, e := os.Open(source)
+	if e != nil {
+		return e
+	}
+	defer sourceFile.Close()
+	targetFile, e := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if e != nil {
+		return e
+	}
+	_, e = io.Copy(targetFile, sourceFile)
+	if e != nil {
+		targetFile.Close()
+		os.Remove(target)
+		return e
+	}
+	e = targetFile.Sync()
+	if e != nil {
+		targetFile.Close()
+		return e
+	}
+	e = targetFile.Close()
+	if e != nil {
+		return e
+	}
+	return os.Remove(source)
+}
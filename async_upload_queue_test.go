@@ -0,0 +1,210 @@
+package bitsgo_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/cloudfoundry-incubator/bits-service"
+)
+
+var _ = Describe("AsyncUploadQueue", func() {
+	var (
+		queueDir     string
+		tempFilename string
+	)
+
+	BeforeEach(func() {
+		var e error
+		queueDir, e = ioutil.TempDir("", "async-upload-queue")
+		Expect(e).NotTo(HaveOccurred())
+		tempFile, e := ioutil.TempFile("", "bits")
+		Expect(e).NotTo(HaveOccurred())
+		_, e = tempFile.WriteString("some content")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(tempFile.Close()).To(Succeed())
+		tempFilename = tempFile.Name()
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(queueDir)
+		os.Remove(tempFilename)
+	})
+
+	It("processes uploads with at most the configured number of workers", func() {
+		queue, e := NewAsyncUploadQueue("", 2)
+		Expect(e).NotTo(HaveOccurred())
+
+		var (
+			mutex          sync.Mutex
+			running        int
+			maxRunning     int
+			processedCount int
+		)
+		Expect(queue.Start(func(upload *AsyncUpload) {
+			mutex.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mutex.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mutex.Lock()
+			running--
+			processedCount++
+			mutex.Unlock()
+		})).To(Succeed())
+		defer queue.Stop()
+
+		for i := 0; i < 6; i++ {
+			Expect(queue.Enqueue(&AsyncUpload{Identifier: "someguid"})).To(Succeed())
+		}
+
+		Eventually(func() int {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return processedCount
+		}).Should(Equal(6))
+		Expect(maxRunning).To(Equal(2))
+	})
+
+	Context("durable", func() {
+		It("moves the temp file into the queue directory and removes it with the record once processed", func() {
+			queue, e := NewAsyncUploadQueue(queueDir, 1)
+			Expect(e).NotTo(HaveOccurred())
+			upload := &AsyncUpload{ResourceType: "package", Identifier: "someguid", TempFilename: tempFilename}
+
+			Expect(queue.Enqueue(upload)).To(Succeed())
+
+			Expect(tempFilename).NotTo(BeAnExistingFile())
+			Expect(upload.TempFilename).To(Equal(filepath.Join(queueDir, upload.ID+".bits")))
+			Expect(ioutil.ReadFile(upload.TempFilename)).To(Equal([]byte("some content")))
+			Expect(filepath.Join(queueDir, upload.ID+".json")).To(BeAnExistingFile())
+
+			processed := make(chan *AsyncUpload, 1)
+			Expect(queue.Start(func(upload *AsyncUpload) { processed <- upload })).To(Succeed())
+			defer queue.Stop()
+
+			Eventually(processed).Should(Receive(Equal(upload)))
+			Eventually(filepath.Join(queueDir, upload.ID+".json")).ShouldNot(BeAnExistingFile())
+			Expect(upload.TempFilename).NotTo(BeAnExistingFile())
+		})
+
+		It("resumes pending uploads after a restart", func() {
+			queue, e := NewAsyncUploadQueue(queueDir, 1)
+			Expect(e).NotTo(HaveOccurred())
+			enqueuedAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			Expect(queue.Enqueue(&AsyncUpload{
+				ResourceType: "package",
+				Identifier:   "someguid",
+				TempFilename: tempFilename,
+				Sha1:         "some-sha1",
+				Sha256:       "some-sha256",
+				EnqueuedAt:   enqueuedAt,
+			})).To(Succeed())
+
+			restartedQueue, e := NewAsyncUploadQueue(queueDir, 1)
+			Expect(e).NotTo(HaveOccurred())
+			processed := make(chan *AsyncUpload, 1)
+			var content []byte
+			Expect(restartedQueue.Start(func(upload *AsyncUpload) {
+				// The temp file is removed once the upload has been processed
+				content, _ = ioutil.ReadFile(upload.TempFilename)
+				processed <- upload
+			})).To(Succeed())
+			defer restartedQueue.Stop()
+
+			var resumed *AsyncUpload
+			Eventually(processed).Should(Receive(&resumed))
+			Expect(resumed.Resumed).To(BeTrue())
+			Expect(resumed.Identifier).To(Equal("someguid"))
+			Expect(resumed.Sha256).To(Equal("some-sha256"))
+			Expect(resumed.EnqueuedAt).To(Equal(enqueuedAt))
+			Expect(content).To(Equal([]byte("some content")))
+		})
+
+		It("discards invalid records", func() {
+			Expect(ioutil.WriteFile(filepath.Join(queueDir, "invalid.json"), []byte("not json"), 0600)).To(Succeed())
+			queue, e := NewAsyncUploadQueue(queueDir, 1)
+			Expect(e).NotTo(HaveOccurred())
+
+			Expect(queue.Start(func(upload *AsyncUpload) { Fail("Must not process invalid records") })).To(Succeed())
+			defer queue.Stop()
+
+			Expect(filepath.Join(queueDir, "invalid.json")).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Context("Drain", func() {
+		It("processes pending uploads before stopping", func() {
+			queue, e := NewAsyncUploadQueue("", 1)
+			Expect(e).NotTo(HaveOccurred())
+			for i := 0; i < 3; i++ {
+				Expect(queue.Enqueue(&AsyncUpload{Identifier: "someguid"})).To(Succeed())
+			}
+			var processedCount int32
+			Expect(queue.Start(func(upload *AsyncUpload) {
+				time.Sleep(10 * time.Millisecond)
+				atomic.AddInt32(&processedCount, 1)
+			})).To(Succeed())
+
+			abandoned, inProgress := queue.Drain(context.Background())
+
+			Expect(abandoned).To(BeEmpty())
+			Expect(inProgress).To(BeEmpty())
+			Expect(atomic.LoadInt32(&processedCount)).To(BeEquivalentTo(3))
+		})
+
+		It("returns the uploads of a non-durable queue which could not be processed in time", func() {
+			queue, e := NewAsyncUploadQueue("", 1)
+			Expect(e).NotTo(HaveOccurred())
+			release := make(chan bool)
+			defer close(release)
+			Expect(queue.Start(func(upload *AsyncUpload) { <-release })).To(Succeed())
+			inProgress := &AsyncUpload{Identifier: "in-progress"}
+			pending := &AsyncUpload{Identifier: "pending"}
+			Expect(queue.Enqueue(inProgress)).To(Succeed())
+			Eventually(queue.Len).Should(Equal(0))
+			Expect(queue.Enqueue(pending)).To(Succeed())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			abandoned, stillInProgress := queue.Drain(ctx)
+
+			Expect(abandoned).To(ConsistOf(pending))
+			Expect(stillInProgress).To(ConsistOf(inProgress))
+		})
+
+		It("keeps the pending uploads of a durable queue", func() {
+			queue, e := NewAsyncUploadQueue(queueDir, 1)
+			Expect(e).NotTo(HaveOccurred())
+			upload := &AsyncUpload{Identifier: "someguid", TempFilename: tempFilename}
+			Expect(queue.Enqueue(upload)).To(Succeed())
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			abandoned, inProgress := queue.Drain(ctx)
+
+			Expect(abandoned).To(BeEmpty())
+			Expect(inProgress).To(BeEmpty())
+			Expect(filepath.Join(queueDir, upload.ID+".json")).To(BeAnExistingFile())
+		})
+	})
+
+	It("does not process pending uploads after Stop", func() {
+		queue, e := NewAsyncUploadQueue(queueDir, 1)
+		Expect(e).NotTo(HaveOccurred())
+		Expect(queue.Start(func(upload *AsyncUpload) { Fail("Must not process uploads after Stop") })).To(Succeed())
+
+		queue.Stop()
+		Expect(queue.Enqueue(&AsyncUpload{Identifier: "someguid", TempFilename: tempFilename})).To(Succeed())
+
+		Consistently(queue.Len).Should(Equal(1))
+	})
+})
@@ -0,0 +1,103 @@
+package bitsgo
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cloudfoundry-incubator/bits-service/util"
+)
+
+// AuditEvent records a mutating operation or a signing request.
+type AuditEvent struct {
+	Time               time.Time `json:"time"`
+	Operation          string    `json:"operation"`
+	ResourceType       string    `json:"resource_type"`
+	Identifier         string    `json:"identifier"`
+	SourceIdentifier   string    `json:"source_identifier,omitempty"`
+	SourceResourceType string    `json:"source_resource_type,omitempty"`
+	Verb               string    `json:"verb,omitempty"`
+	Principal          string    `json:"principal"`
+	SourceIP           string    `json:"source_ip"`
+	Sha256             string    `json:"sha256,omitempty"`
+	Outcome            string    `json:"outcome"`
+	StatusCode         int       `json:"status_code,omitempty"`
+	VcapRequestID      string    `json:"vcap_request_id,omitempty"`
+}
+
+const (
+	AuditOperationPut       = "put"
+	AuditOperationCopy      = "copy"
+	AuditOperationDelete    = "delete"
+	AuditOperationDeleteDir = "delete_dir"
+	AuditOperationSign      = "sign"
+
+	AuditOutcomeSuccess  = "success"
+	AuditOutcomeAccepted = "accepted"
+	AuditOutcomeFailure  = "failure"
+)
+
+type Auditor interface {
+	Audit(event AuditEvent)
+}
+
+type NullAuditor struct{}
+
+func (auditor *NullAuditor) Audit(event AuditEvent) {}
+
+func newAuditEvent(request *http.Request, operation, resourceType, identifier string) AuditEvent {
+	return AuditEvent{
+		Time:          time.Now().UTC(),
+		Operation:     operation,
+		ResourceType:  resourceType,
+		Identifier:    identifier,
+		Principal:     util.PrincipalFrom(request.Context()),
+		SourceIP:      util.RemoteIPFrom(request),
+		VcapRequestID: util.VcapRequestIDFrom(request.Context()),
+	}
+}
+
+// withOutcomeFrom sets the outcome based on the response status code. A status code of 0 means
+// that no response has been written, e.g. because of a panic.
+func (event AuditEvent) withOutcomeFrom(statusCode int) AuditEvent {
+	event.StatusCode = statusCode
+	switch {
+	case statusCode == http.StatusAccepted:
+		event.Outcome = AuditOutcomeAccepted
+	case statusCode > 0 && statusCode < 400:
+		event.Outcome = AuditOutcomeSuccess
+	default:
+		event.Outcome = AuditOutcomeFailure
+	}
+	return event
+}
+
+// auditedResponseWriter records the status code, so that the outcome of an operation can be audited
+// once its handler has written the response.
+type auditedResponseWriter struct {
+	http.ResponseWriter
+	auditor    Auditor
+	event      AuditEvent
+	statusCode int
+}
+
+func newAuditedResponseWriter(responseWriter http.ResponseWriter, auditor Auditor, event AuditEvent) *auditedResponseWriter {
+	return &auditedResponseWriter{ResponseWriter: responseWriter, auditor: auditor, event: event}
+}
+
+func (responseWriter *auditedResponseWriter) WriteHeader(statusCode int) {
+	if responseWriter.statusCode == 0 {
+		responseWriter.statusCode = statusCode
+	}
+	responseWriter.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (responseWriter *auditedResponseWriter) Write(p []byte) (int, error) {
+	if responseWriter.statusCode == 0 {
+		responseWriter.statusCode = http.StatusOK
+	}
+	return responseWriter.ResponseWriter.Write(p)
+}
+
+func (responseWriter *auditedResponseWriter) audit() {
+	responseWriter.auditor.Audit(responseWriter.event.withOutcomeFrom(responseWriter.statusCode))
+}
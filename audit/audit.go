@@ -0,0 +1,45 @@
+// Package audit writes bitsgo.AuditEvents to configurable sinks.
+package audit
+
+import (
+	"io"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+)
+
+// Sink persists or forwards audit events.
+type Sink interface {
+	Write(event bitsgo.AuditEvent) error
+	io.Closer
+}
+
+// Auditor writes every event to all of its sinks. Failing sinks do not affect other sinks or the audited operation.
+type Auditor struct {
+	sinks []Sink
+}
+
+func NewAuditor(sinks ...Sink) *Auditor {
+	return &Auditor{sinks: sinks}
+}
+
+func (auditor *Auditor) Audit(event bitsgo.AuditEvent) {
+	for _, sink := range auditor.sinks {
+		e := sink.Write(event)
+		if e != nil {
+			logger.Log.Errorw("Could not write audit event", "error", e, "operation", event.Operation,
+				"resource-type", event.ResourceType, "identifier", event.Identifier, "outcome", event.Outcome)
+		}
+	}
+}
+
+// Close flushes and closes all sinks.
+func (auditor *Auditor) Close() error {
+	var firstErr error
+	for _, sink := range auditor.sinks {
+		if e := sink.Close(); e != nil && firstErr == nil {
+			firstErr = e
+		}
+	}
+	return firstErr
+}
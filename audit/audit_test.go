@@ -0,0 +1,190 @@
+package audit_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	. "github.com/cloudfoundry-incubator/bits-service/audit"
+	"github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+func TestAudit(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Audit")
+}
+
+type recordingSink struct {
+	events   []bitsgo.AuditEvent
+	writeErr error
+	closed   bool
+}
+
+func (sink *recordingSink) Write(event bitsgo.AuditEvent) error {
+	sink.events = append(sink.events, event)
+	return sink.writeErr
+}
+
+func (sink *recordingSink) Close() error {
+	sink.closed = true
+	return nil
+}
+
+var _ = Describe("Audit", func() {
+	event := func(identifier string) bitsgo.AuditEvent {
+		return bitsgo.AuditEvent{
+			Operation:    bitsgo.AuditOperationPut,
+			ResourceType: "packages",
+			Identifier:   identifier,
+			Principal:    "basic_auth:cc",
+			Outcome:      bitsgo.AuditOutcomeSuccess,
+			StatusCode:   http.StatusCreated,
+		}
+	}
+
+	Describe("Auditor", func() {
+		It("writes events to all sinks, even if one of them fails", func() {
+			failingSink := &recordingSink{writeErr: errors.New("some error")}
+			sink := &recordingSink{}
+			auditor := NewAuditor(failingSink, sink)
+
+			auditor.Audit(event("guid"))
+
+			Expect(failingSink.events).To(HaveLen(1))
+			Expect(sink.events).To(ConsistOf(event("guid")))
+
+			Expect(auditor.Close()).To(Succeed())
+			Expect(failingSink.closed).To(BeTrue())
+			Expect(sink.closed).To(BeTrue())
+		})
+	})
+
+	Describe("JSONLinesSink", func() {
+		var (
+			tempDir string
+			path    string
+		)
+
+		BeforeEach(func() {
+			var e error
+			tempDir, e = ioutil.TempDir("", "audit")
+			Expect(e).NotTo(HaveOccurred())
+			path = filepath.Join(tempDir, "audit.log")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(tempDir)
+		})
+
+		readEvents := func(path string) []bitsgo.AuditEvent {
+			file, e := os.Open(path)
+			Expect(e).NotTo(HaveOccurred())
+			defer file.Close()
+			var events []bitsgo.AuditEvent
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				var event bitsgo.AuditEvent
+				Expect(json.Unmarshal(scanner.Bytes(), &event)).To(Succeed())
+				events = append(events, event)
+			}
+			return events
+		}
+
+		It("appends one JSON object per line", func() {
+			sink, e := NewJSONLinesSink(path, 0, 0)
+			Expect(e).NotTo(HaveOccurred())
+
+			Expect(sink.Write(event("guid1"))).To(Succeed())
+			Expect(sink.Write(event("guid2"))).To(Succeed())
+			Expect(sink.Close()).To(Succeed())
+
+			Expect(readEvents(path)).To(Equal([]bitsgo.AuditEvent{event("guid1"), event("guid2")}))
+			fileInfo, e := os.Stat(path)
+			Expect(e).NotTo(HaveOccurred())
+			Expect(fileInfo.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		})
+
+		It("rotates the file when it exceeds its max size and keeps at most max backups", func() {
+			line, e := json.Marshal(event("guid1"))
+			Expect(e).NotTo(HaveOccurred())
+			sink, e := NewJSONLinesSink(path, int64(len(line)+1), 2)
+			Expect(e).NotTo(HaveOccurred())
+
+			for _, identifier := range []string{"guid1", "guid2", "guid3", "guid4"} {
+				Expect(sink.Write(event(identifier))).To(Succeed())
+			}
+			Expect(sink.Close()).To(Succeed())
+
+			Expect(readEvents(path)).To(Equal([]bitsgo.AuditEvent{event("guid4")}))
+			Expect(readEvents(path + ".1")).To(Equal([]bitsgo.AuditEvent{event("guid3")}))
+			Expect(readEvents(path + ".2")).To(Equal([]bitsgo.AuditEvent{event("guid2")}))
+			Expect(path + ".3").NotTo(BeAnExistingFile())
+		})
+
+		It("fails to write once closed", func() {
+			sink, e := NewJSONLinesSink(path, 0, 0)
+			Expect(e).NotTo(HaveOccurred())
+			Expect(sink.Close()).To(Succeed())
+
+			Expect(sink.Write(event("guid"))).To(MatchError(ContainSubstring("closed")))
+		})
+	})
+
+	Describe("WebhookSink", func() {
+		var (
+			server   *httptest.Server
+			mutex    sync.Mutex
+			received []bitsgo.AuditEvent
+			headers  []http.Header
+		)
+
+		BeforeEach(func() {
+			received = nil
+			headers = nil
+			server = httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+				var event bitsgo.AuditEvent
+				Expect(json.NewDecoder(request.Body).Decode(&event)).To(Succeed())
+				mutex.Lock()
+				defer mutex.Unlock()
+				received = append(received, event)
+				headers = append(headers, request.Header)
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("POSTs all events before Close returns", func() {
+			sink := NewWebhookSink(server.URL, map[string]string{"Authorization": "Bearer some-token"}, http.DefaultClient, 10)
+
+			Expect(sink.Write(event("guid1"))).To(Succeed())
+			Expect(sink.Write(event("guid2"))).To(Succeed())
+			Expect(sink.Close()).To(Succeed())
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			Expect(received).To(Equal([]bitsgo.AuditEvent{event("guid1"), event("guid2")}))
+			Expect(headers[0].Get("Authorization")).To(Equal("Bearer some-token"))
+			Expect(headers[0].Get("Content-Type")).To(Equal("application/json"))
+		})
+
+		It("rejects events once closed", func() {
+			sink := NewWebhookSink(server.URL, nil, http.DefaultClient, 10)
+			Expect(sink.Close()).To(Succeed())
+
+			Expect(sink.Write(event("guid"))).To(MatchError(ContainSubstring("closed")))
+		})
+	})
+})
@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/pkg/errors"
+)
+
+// JSONLinesSink appends one JSON object per event to a file. When the file would exceed maxSizeBytes,
+// it is rotated to <path>.1, existing backups are shifted, and backups beyond maxBackups are removed.
+type JSONLinesSink struct {
+	path         string
+	maxSizeBytes int64
+	maxBackups   int
+
+	mutex sync.Mutex
+	file  *os.File
+	size  int64
+}
+
+func NewJSONLinesSink(path string, maxSizeBytes int64, maxBackups int) (*JSONLinesSink, error) {
+	sink := &JSONLinesSink{path: path, maxSizeBytes: maxSizeBytes, maxBackups: maxBackups}
+	e := sink.open()
+	if e != nil {
+		return nil, e
+	}
+	return sink, nil
+}
+
+func (sink *JSONLinesSink) Write(event bitsgo.AuditEvent) error {
+	line, e := json.Marshal(event)
+	if e != nil {
+		return errors.Wrap(e, "Could not marshal audit event")
+	}
+	line = append(line, '\n')
+
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	if sink.file == nil {
+		return errors.New("Audit log is closed")
+	}
+	if sink.maxSizeBytes > 0 && sink.size > 0 && sink.size+int64(len(line)) > sink.maxSizeBytes {
+		e = sink.rotate()
+		if e != nil {
+			return e
+		}
+	}
+	n, e := sink.file.Write(line)
+	sink.size += int64(n)
+	if e != nil {
+		return errors.Wrapf(e, "Could not write audit log '%v'", sink.path)
+	}
+	return nil
+}
+
+func (sink *JSONLinesSink) Close() error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	if sink.file == nil {
+		return nil
+	}
+	e := sink.file.Sync()
+	if closeErr := sink.file.Close(); e == nil {
+		e = closeErr
+	}
+	sink.file = nil
+	return e
+}
+
+func (sink *JSONLinesSink) open() error {
+	file, e := os.OpenFile(sink.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if e != nil {
+		return errors.Wrapf(e, "Could not open audit log '%v'", sink.path)
+	}
+	fileInfo, e := file.Stat()
+	if e != nil {
+		file.Close()
+		return errors.Wrapf(e, "Could not stat audit log '%v'", sink.path)
+	}
+	sink.file = file
+	sink.size = fileInfo.Size()
+	return nil
+}
+
+func (sink *JSONLinesSink) rotate() error {
+	e := sink.file.Close()
+	if e != nil {
+		return errors.Wrapf(e, "Could not close audit log '%v'", sink.path)
+	}
+	sink.file = nil
+
+	if sink.maxBackups > 0 {
+		os.Remove(backupPath(sink.path, sink.maxBackups))
+		for i := sink.maxBackups - 1; i >= 1; i-- {
+			os.Rename(backupPath(sink.path, i), backupPath(sink.path, i+1))
+		}
+		e = os.Rename(sink.path, backupPath(sink.path, 1))
+	} else {
+		e = os.Remove(sink.path)
+	}
+	if e != nil && !os.IsNotExist(e) {
+		return errors.Wrapf(e, "Could not rotate audit log '%v'", sink.path)
+	}
+	return sink.open()
+}
+
+func backupPath(path string, index int) string {
+	return fmt.Sprintf("%v.%v", path, index)
+}
@@ -0,0 +1,37 @@
+package audit
+
+import (
+	"encoding/json"
+	"log/syslog"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/pkg/errors"
+)
+
+// SyslogSink sends events as JSON messages with facility AUTHPRIV. An empty network and address use the local syslog daemon.
+type SyslogSink struct {
+	writer *syslog.Writer
+}
+
+func NewSyslogSink(network, address, tag string) (*SyslogSink, error) {
+	writer, e := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_AUTHPRIV, tag)
+	if e != nil {
+		return nil, errors.Wrapf(e, "Could not connect to syslog at '%v'", address)
+	}
+	return &SyslogSink{writer: writer}, nil
+}
+
+func (sink *SyslogSink) Write(event bitsgo.AuditEvent) error {
+	message, e := json.Marshal(event)
+	if e != nil {
+		return errors.Wrap(e, "Could not marshal audit event")
+	}
+	if event.Outcome == bitsgo.AuditOutcomeFailure {
+		return sink.writer.Warning(string(message))
+	}
+	return sink.writer.Info(string(message))
+}
+
+func (sink *SyslogSink) Close() error {
+	return sink.writer.Close()
+}
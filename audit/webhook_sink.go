@@ -0,0 +1,84 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/cenkalti/backoff"
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+	"github.com/pkg/errors"
+)
+
+// WebhookSink POSTs each event as JSON to a URL. Events are sent asynchronously, so that a slow receiver
+// does not slow down requests. If queueSize events are pending, new events are dropped.
+type WebhookSink struct {
+	url        string
+	headers    map[string]string
+	httpClient *http.Client
+	sender     *util.AsyncSender
+}
+
+func NewWebhookSink(url string, headers map[string]string, httpClient *http.Client, queueSize int) *WebhookSink {
+	sink := &WebhookSink{
+		url:        url,
+		headers:    headers,
+		httpClient: httpClient,
+	}
+	sink.sender = util.NewAsyncSender(queueSize,
+		func(event interface{}) error { return sink.send(event.(bitsgo.AuditEvent)) },
+		func() backoff.BackOff { return backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3) },
+		nil,
+		sink.sent)
+	return sink
+}
+
+func (sink *WebhookSink) Write(event bitsgo.AuditEvent) error {
+	switch sink.sender.Enqueue(event) {
+	case util.ErrAsyncSenderClosed:
+		return errors.New("Audit webhook is closed")
+	case util.ErrAsyncSenderQueueFull:
+		return errors.New("Audit webhook queue is full. Dropping event")
+	}
+	return nil
+}
+
+// Close sends all pending events before it returns.
+func (sink *WebhookSink) Close() error {
+	sink.sender.Close()
+	return nil
+}
+
+func (sink *WebhookSink) sent(item interface{}, e error) {
+	if e != nil {
+		event := item.(bitsgo.AuditEvent)
+		logger.Log.Errorw("Could not send audit event to webhook", "url", sink.url, "error", e,
+			"operation", event.Operation, "resource-type", event.ResourceType, "identifier", event.Identifier)
+	}
+}
+
+func (sink *WebhookSink) send(event bitsgo.AuditEvent) error {
+	body, e := json.Marshal(event)
+	if e != nil {
+		return backoff.Permanent(errors.Wrap(e, "Could not marshal audit event"))
+	}
+	request, e := http.NewRequest("POST", sink.url, bytes.NewReader(body))
+	if e != nil {
+		return backoff.Permanent(e)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range sink.headers {
+		request.Header.Set(name, value)
+	}
+	response, e := sink.httpClient.Do(request)
+	if e != nil {
+		return e
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return errors.Errorf("Unexpected status code %v", response.StatusCode)
+	}
+	return nil
+}
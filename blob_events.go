@@ -0,0 +1,62 @@
+package bitsgo
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudfoundry-incubator/bits-service/util"
+)
+
+// BlobEvent records a step in the lifecycle of a blob.
+type BlobEvent struct {
+	Time               time.Time `json:"time"`
+	Type               string    `json:"type"`
+	ResourceType       string    `json:"resource_type"`
+	Identifier         string    `json:"identifier"`
+	SourceIdentifier   string    `json:"source_identifier,omitempty"`
+	SourceResourceType string    `json:"source_resource_type,omitempty"`
+	Sha1               string    `json:"sha1,omitempty"`
+	Sha256             string    `json:"sha256,omitempty"`
+	Error              string    `json:"error,omitempty"`
+	VcapRequestID      string    `json:"vcap_request_id,omitempty"`
+}
+
+const (
+	// BlobEventCreated means that an upload has been received and accepted.
+	BlobEventCreated = "created"
+	// BlobEventProcessing means that the upload to the blobstore has started.
+	BlobEventProcessing = "processing"
+	BlobEventReady      = "ready"
+	BlobEventFailed     = "failed"
+	BlobEventCopied     = "copied"
+	BlobEventDeleted    = "deleted"
+)
+
+// BlobEventTypes lists all event types in lifecycle order.
+var BlobEventTypes = []string{BlobEventCreated, BlobEventProcessing, BlobEventReady, BlobEventFailed, BlobEventCopied, BlobEventDeleted}
+
+// EventPublisher delivers blob events. Publish must not block the publishing operation, and failures
+// must not affect it.
+type EventPublisher interface {
+	Publish(event BlobEvent)
+}
+
+type NullEventPublisher struct{}
+
+func (publisher *NullEventPublisher) Publish(event BlobEvent) {}
+
+func newBlobEvent(ctx context.Context, eventType, resourceType, identifier string) BlobEvent {
+	return BlobEvent{
+		Time:          time.Now().UTC(),
+		Type:          eventType,
+		ResourceType:  resourceType,
+		Identifier:    identifier,
+		VcapRequestID: util.VcapRequestIDFrom(ctx),
+	}
+}
+
+func (event BlobEvent) withChecksums(sha1, sha256 string) BlobEvent {
+	event.Sha1 = sha1
+	event.Sha256 = sha256
+	return event
+}
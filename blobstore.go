@@ -1,6 +1,7 @@
 package bitsgo
 
 import (
+	"context"
 	"fmt"
 	"io"
 )
@@ -32,28 +33,30 @@ func NewNoSpaceLeftError() *NoSpaceLeftError {
 	return &NoSpaceLeftError{fmt.Errorf("NoSpaceLeftError")}
 }
 
+// All methods take a context.Context. Implementers should stop any ongoing backend transfer when it is
+// cancelled, e.g. when the client disconnects or when an operation timeout expires.
 type Blobstore interface {
-	Exists(path string) (bool, error)
-	HeadOrRedirectAsGet(path string) (redirectLocation string, err error)
+	Exists(ctx context.Context, path string) (bool, error)
+	HeadOrRedirectAsGet(ctx context.Context, path string) (redirectLocation string, err error)
 
 	// Implementers must return *NotFoundError when the resource cannot be found
-	GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error)
+	GetOrRedirect(ctx context.Context, path string) (body io.ReadCloser, redirectLocation string, err error)
 
 	// Implementers must return *NoSpaceLeftError when there's no space left on device.
-	Put(path string, src io.ReadSeeker) error
-	Copy(src, dest string) error
-	Delete(path string) error
-	DeleteDir(prefix string) error
+	Put(ctx context.Context, path string, src io.ReadSeeker) error
+	Copy(ctx context.Context, src, dest string) error
+	Delete(ctx context.Context, path string) error
+	DeleteDir(ctx context.Context, prefix string) error
 }
 
 type NoRedirectBlobstore interface {
-	Exists(path string) (bool, error)
+	Exists(ctx context.Context, path string) (bool, error)
 
 	// Implementers must return *NotFoundError when the resource cannot be found
-	Get(path string) (body io.ReadCloser, err error)
+	Get(ctx context.Context, path string) (body io.ReadCloser, err error)
 
 	// Implementers must return *NoSpaceLeftError when there's no space left on device.
-	Put(path string, src io.ReadSeeker) error
-	Delete(path string) error
-	DeleteDir(prefix string) error
+	Put(ctx context.Context, path string, src io.ReadSeeker) error
+	Delete(ctx context.Context, path string) error
+	DeleteDir(ctx context.Context, prefix string) error
 }
@@ -1,6 +1,7 @@
 package alibaba
 
 import (
+	"context"
 	"io"
 	"strings"
 	"time"
@@ -12,6 +13,7 @@ import (
 	"github.com/cloudfoundry-incubator/bits-service/blobstores/validate"
 	"github.com/cloudfoundry-incubator/bits-service/config"
 	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
 )
 
 type Blobstore struct {
@@ -35,24 +37,24 @@ func NewBlobstore(config config.AlibabaBlobstoreConfig) *Blobstore {
 	}
 }
 
-func (blobstore *Blobstore) Copy(src string, dest string) error {
+func (blobstore *Blobstore) Copy(ctx context.Context, src string, dest string) error {
 	var copyErr error
 	logger.Log.Debugw("Copy in Alibaba", "bucket", blobstore.BucketName, "src", src, "dest", dest)
 	bucket := blobstore.getBucket()
-	_, copyErr = bucket.CopyObjectFrom(blobstore.BucketName, src, dest)
+	_, copyErr = bucket.CopyObjectFrom(blobstore.BucketName, src, dest, requestOptions(ctx)...)
 	if copyErr != nil {
 		return errors.Wrapf(copyErr, "Error while trying to copy src %v to dest %v in bucket %v", src, dest, blobstore.BucketName)
 	}
 	return copyErr
 }
 
-func (blobstore *Blobstore) Delete(resource string) error {
+func (blobstore *Blobstore) Delete(ctx context.Context, resource string) error {
 	bucket := blobstore.getBucket()
-	return bucket.DeleteObject(resource)
+	return bucket.DeleteObject(resource, requestOptions(ctx)...)
 
 }
 
-func (blobstore *Blobstore) DeleteDir(prefix string) error {
+func (blobstore *Blobstore) DeleteDir(ctx context.Context, prefix string) error {
 	var deletionError error
 	deletionErrs := []error{}
 	bucket := blobstore.getBucket()
@@ -61,11 +63,11 @@ func (blobstore *Blobstore) DeleteDir(prefix string) error {
 	portion := 20
 
 	for {
-		objList, err := bucket.ListObjects(oss.MaxKeys(portion), marker, prefixFilter)
+		objList, err := bucket.ListObjects(append(requestOptions(ctx), oss.MaxKeys(portion), marker, prefixFilter)...)
 		if err != nil {
 			return errors.Wrapf(err, "Prefix %v", prefix)
 		}
-		deletionErrs = blobstore.deleteObjects(objList)
+		deletionErrs = blobstore.deleteObjects(ctx, objList)
 		marker = oss.Marker(objList.NextMarker)
 		if !objList.IsTruncated {
 			break
@@ -78,11 +80,11 @@ func (blobstore *Blobstore) DeleteDir(prefix string) error {
 	return deletionError
 }
 
-func (blobstore *Blobstore) deleteObjects(objListResult oss.ListObjectsResult) []error {
+func (blobstore *Blobstore) deleteObjects(ctx context.Context, objListResult oss.ListObjectsResult) []error {
 	bucket := blobstore.getBucket()
 	deletionErrs := []error{}
 	for _, obj := range objListResult.Objects {
-		err := bucket.DeleteObject(obj.Key)
+		err := bucket.DeleteObject(obj.Key, requestOptions(ctx)...)
 		if err != nil {
 			deletionErrs = append(deletionErrs, err)
 		}
@@ -90,57 +92,72 @@ func (blobstore *Blobstore) deleteObjects(objListResult oss.ListObjectsResult) [
 	return deletionErrs
 }
 
-func (blobstore *Blobstore) Exists(resource string) (bool, error) {
+func (blobstore *Blobstore) Exists(ctx context.Context, resource string) (bool, error) {
 	bucket := blobstore.getBucket()
-	return bucket.IsObjectExist(resource)
+	return bucket.IsObjectExist(resource, requestOptions(ctx)...)
 }
 
-func (blobstore *Blobstore) Get(path string) (io.ReadCloser, error) {
+func (blobstore *Blobstore) Get(ctx context.Context, path string) (io.ReadCloser, error) {
 	logger.Log.Debugw("GET", "bucket", blobstore.BucketName, "path", path)
 	exists, _ := blobstore.Client.IsBucketExist(blobstore.BucketName)
 	if !exists {
 		return nil, errors.Errorf("Bucket not found: '%v'", blobstore.BucketName)
 	}
 	bucket := blobstore.getBucket()
-	obj, err := bucket.GetObject(path)
+	obj, err := bucket.GetObject(path, requestOptions(ctx)...)
 	if err != nil {
 		return nil, bitsgo.NewNotFoundErrorWithMessage("Could not find object: " + path)
 	}
 	return obj, nil
 }
 
-func (blobstore *Blobstore) GetOrRedirect(path string) (io.ReadCloser, string, error) {
-	signedURL, err := blobstore.HeadOrRedirectAsGet(path)
+func (blobstore *Blobstore) GetOrRedirect(ctx context.Context, path string) (io.ReadCloser, string, error) {
+	signedURL, err := blobstore.HeadOrRedirectAsGet(ctx, path)
 	return nil, signedURL, err
 }
 
-func (blobstore *Blobstore) HeadOrRedirectAsGet(resource string) (string, error) {
+func (blobstore *Blobstore) HeadOrRedirectAsGet(ctx context.Context, resource string) (string, error) {
 	bucket := blobstore.getBucket()
 	return bucket.SignURL(resource, oss.HTTPGet, getValidityPeriod(time.Now().Add(1*time.Hour)))
 }
 
-func (blobstore *Blobstore) Put(path string, rs io.ReadSeeker) error {
+func (blobstore *Blobstore) Put(ctx context.Context, path string, rs io.ReadSeeker) error {
 	logger.Log.Debugw("Put", "bucket", blobstore.BucketName, "path", path)
 	exists, _ := blobstore.Client.IsBucketExist(blobstore.BucketName)
 	if !exists {
 		return errors.Errorf("Bucket not found: '%v'", blobstore.BucketName)
 	}
 	bucket := blobstore.getBucket()
-	return bucket.PutObject(path, rs)
+	return bucket.PutObject(path, util.NewContextReader(ctx, rs), requestOptions(ctx)...)
 }
 
-func (blobstore *Blobstore) Sign(resource string, method string, timestamp time.Time) string {
+func (blobstore *Blobstore) Sign(resource string, method string, timestamp time.Time) (string, error) {
 	var signedURL string
+	var e error
 	bucket := blobstore.getBucket()
 	switch strings.ToLower(method) {
 	case "put":
-		signedURL, _ = bucket.SignURL(resource, oss.HTTPPut, getValidityPeriod(timestamp))
+		signedURL, e = bucket.SignURL(resource, oss.HTTPPut, getValidityPeriod(timestamp))
 	case "get":
-		signedURL, _ = bucket.SignURL(resource, oss.HTTPGet, getValidityPeriod(timestamp))
+		signedURL, e = bucket.SignURL(resource, oss.HTTPGet, getValidityPeriod(timestamp))
 	default:
-		panic("Supported methods are 'put' and 'get'.Got'" + method + "'")
+		return "", bitsgo.NewUnsupportedMethodError(method, "get", "put")
 	}
-	return signedURL
+	if e != nil {
+		return "", errors.Wrapf(e, "Bucket/Path %v/%v", blobstore.BucketName, resource)
+	}
+	return signedURL, nil
+}
+
+// requestOptions makes a request abort when ctx is done and passes on the request ID, so that OSS requests can be
+// correlated with bits-service requests. Client.IsBucketExist does not accept options, so the bucket checks in Get and
+// Put can neither be cancelled nor correlated.
+func requestOptions(ctx context.Context) []oss.Option {
+	options := []oss.Option{oss.WithContext(ctx)}
+	if vcapRequestID := util.VcapRequestIDFrom(ctx); vcapRequestID != "" {
+		options = append(options, oss.SetHeader("X-Vcap-Request-Id", vcapRequestID))
+	}
+	return options
 }
 
 func getValidityPeriod(timestamp time.Time) int64 {
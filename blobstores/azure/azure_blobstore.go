@@ -1,6 +1,7 @@
 package azure
 
 import (
+	"context"
 	"encoding/base64"
 	"io"
 	"strings"
@@ -17,9 +18,13 @@ import (
 	"github.com/cloudfoundry-incubator/bits-service/blobstores/validate"
 	"github.com/cloudfoundry-incubator/bits-service/config"
 	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
 	"github.com/pkg/errors"
 )
 
+// Blobstore passes the request ID of ctx as client request ID, which Azure Storage records in its logs. The storage
+// SDK does not support contexts, so ctx is only checked between blocks in Put and between deletions in DeleteDir.
+// Once sent, a request runs to completion.
 type Blobstore struct {
 	containerName  string
 	client         storage.BlobStorageClient
@@ -53,7 +58,7 @@ func NewBlobstoreWithDetails(config config.AzureBlobstoreConfig, putBlockSize in
 	}
 }
 
-func (blobstore *Blobstore) Exists(path string) (bool, error) {
+func (blobstore *Blobstore) Exists(ctx context.Context, path string) (bool, error) {
 	exists, e := blobstore.client.GetContainerReference(blobstore.containerName).GetBlobReference(path).Exists()
 	if e != nil {
 		return false, errors.Wrapf(e, "Failed to check for %v/%v", blobstore.containerName, path)
@@ -61,33 +66,33 @@ func (blobstore *Blobstore) Exists(path string) (bool, error) {
 	return exists, nil
 }
 
-func (blobstore *Blobstore) HeadOrRedirectAsGet(path string) (redirectLocation string, err error) {
+func (blobstore *Blobstore) HeadOrRedirectAsGet(ctx context.Context, path string) (redirectLocation string, err error) {
 	return blobstore.client.GetContainerReference(blobstore.containerName).GetBlobReference(path).GetSASURI(storage.BlobSASOptions{
 		BlobServiceSASPermissions: storage.BlobServiceSASPermissions{Read: true},
 		SASOptions:                storage.SASOptions{Expiry: time.Now().Add(time.Hour)},
 	})
 }
 
-func (blobstore *Blobstore) Get(path string) (body io.ReadCloser, err error) {
+func (blobstore *Blobstore) Get(ctx context.Context, path string) (body io.ReadCloser, err error) {
 	logger.Log.Debugw("Get", "bucket", blobstore.containerName, "path", path)
 
-	reader, e := blobstore.client.GetContainerReference(blobstore.containerName).GetBlobReference(path).Get(nil)
+	reader, e := blobstore.client.GetContainerReference(blobstore.containerName).GetBlobReference(path).Get(&storage.GetBlobOptions{RequestID: util.VcapRequestIDFrom(ctx)})
 	if e != nil {
 		return nil, blobstore.handleError(e, "Path %v", path)
 	}
 	return reader, nil
 }
 
-func (blobstore *Blobstore) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error) {
-	signedUrl, e := blobstore.HeadOrRedirectAsGet(path)
+func (blobstore *Blobstore) GetOrRedirect(ctx context.Context, path string) (body io.ReadCloser, redirectLocation string, err error) {
+	signedUrl, e := blobstore.HeadOrRedirectAsGet(ctx, path)
 	return nil, signedUrl, e
 }
 
-func (blobstore *Blobstore) Put(path string, src io.ReadSeeker) error {
+func (blobstore *Blobstore) Put(ctx context.Context, path string, src io.ReadSeeker) error {
 	logger.Log.Debugw("Put", "bucket", blobstore.containerName, "path", path)
 	blob := blobstore.client.GetContainerReference(blobstore.containerName).GetBlobReference(path)
 
-	e := blob.CreateBlockBlob(nil)
+	e := blob.CreateBlockBlob(&storage.PutBlobOptions{RequestID: util.VcapRequestIDFrom(ctx)})
 	if e != nil {
 		return errors.Wrapf(e, "create block blob failed. container: %v, path: %v", blobstore.containerName, path)
 	}
@@ -95,6 +100,9 @@ func (blobstore *Blobstore) Put(path string, src io.ReadSeeker) error {
 	uncommittedBlocksList := make([]storage.Block, 0)
 	eof := false
 	for i := 0; !eof; i++ {
+		if ctx.Err() != nil {
+			return errors.Wrapf(ctx.Err(), "put block aborted: %v", path)
+		}
 		// using information from https://docs.microsoft.com/en-us/rest/api/storageservices/understanding-block-blobs--append-blobs--and-page-blobs
 		block := storage.Block{
 			ID:     base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%05d", i))),
@@ -112,13 +120,13 @@ func (blobstore *Blobstore) Put(path string, src io.ReadSeeker) error {
 		if numBytesRead == 0 {
 			continue
 		}
-		e = blob.PutBlock(block.ID, data[:numBytesRead], nil)
+		e = blob.PutBlock(block.ID, data[:numBytesRead], &storage.PutBlockOptions{RequestID: util.VcapRequestIDFrom(ctx)})
 		if e != nil {
 			return errors.Wrapf(e, "put block failed: %v", path)
 		}
 		uncommittedBlocksList = append(uncommittedBlocksList, block)
 	}
-	e = blob.PutBlockList(uncommittedBlocksList, nil)
+	e = blob.PutBlockList(uncommittedBlocksList, &storage.PutBlockListOptions{RequestID: util.VcapRequestIDFrom(ctx)})
 	if e != nil {
 		return errors.Wrapf(e, "put block list failed: %v", path)
 	}
@@ -126,10 +134,10 @@ func (blobstore *Blobstore) Put(path string, src io.ReadSeeker) error {
 	return nil
 }
 
-func (blobstore *Blobstore) Copy(src, dest string) error {
+func (blobstore *Blobstore) Copy(ctx context.Context, src, dest string) error {
 	logger.Log.Debugw("Copy in Azure", "container", blobstore.containerName, "src", src, "dest", dest)
 	e := blobstore.client.GetContainerReference(blobstore.containerName).GetBlobReference(dest).Copy(
-		blobstore.client.GetContainerReference(blobstore.containerName).GetBlobReference(src).GetURL(), nil)
+		blobstore.client.GetContainerReference(blobstore.containerName).GetBlobReference(src).GetURL(), &storage.CopyOptions{RequestID: util.VcapRequestIDFrom(ctx)})
 
 	if e != nil {
 		blobstore.handleError(e, "Error while trying to copy src %v to dest %v in bucket %v", src, dest, blobstore.containerName)
@@ -137,8 +145,8 @@ func (blobstore *Blobstore) Copy(src, dest string) error {
 	return nil
 }
 
-func (blobstore *Blobstore) Delete(path string) error {
-	deleted, e := blobstore.client.GetContainerReference(blobstore.containerName).GetBlobReference(path).DeleteIfExists(nil)
+func (blobstore *Blobstore) Delete(ctx context.Context, path string) error {
+	deleted, e := blobstore.client.GetContainerReference(blobstore.containerName).GetBlobReference(path).DeleteIfExists(&storage.DeleteBlobOptions{RequestID: util.VcapRequestIDFrom(ctx)})
 	if e != nil {
 		return errors.Wrapf(e, "Path %v", path)
 	}
@@ -148,7 +156,7 @@ func (blobstore *Blobstore) Delete(path string) error {
 	return nil
 }
 
-func (blobstore *Blobstore) DeleteDir(prefix string) error {
+func (blobstore *Blobstore) DeleteDir(ctx context.Context, prefix string) error {
 	deletionErrs := []error{}
 	marker := ""
 	for {
@@ -156,12 +164,16 @@ func (blobstore *Blobstore) DeleteDir(prefix string) error {
 			Prefix:     prefix,
 			MaxResults: blobstore.maxListResults,
 			Marker:     marker,
+			RequestID:  util.VcapRequestIDFrom(ctx),
 		})
 		if e != nil {
 			return errors.Wrapf(e, "Prefix %v", prefix)
 		}
 		for _, blob := range response.Blobs {
-			e = blobstore.Delete(blob.Name)
+			if ctx.Err() != nil {
+				return errors.Wrapf(ctx.Err(), "Prefix %v, deletion aborted", prefix)
+			}
+			e = blobstore.Delete(ctx, blob.Name)
 			if e != nil {
 				if _, isNotFoundError := e.(*bitsgo.NotFoundError); !isNotFoundError {
 					deletionErrs = append(deletionErrs, e)
@@ -180,7 +192,7 @@ func (blobstore *Blobstore) DeleteDir(prefix string) error {
 	return nil
 }
 
-func (blobstore *Blobstore) Sign(resource string, method string, expirationTime time.Time) (signedURL string) {
+func (blobstore *Blobstore) Sign(resource string, method string, expirationTime time.Time) (signedURL string, err error) {
 	var e error
 	switch strings.ToLower(method) {
 	case "put":
@@ -194,10 +206,10 @@ func (blobstore *Blobstore) Sign(resource string, method string, expirationTime
 			SASOptions:                storage.SASOptions{Expiry: expirationTime},
 		})
 	default:
-		panic("The only supported methods are 'put' and 'get'")
+		return "", bitsgo.NewUnsupportedMethodError(method, "get", "put")
 	}
 	if e != nil {
-		panic(e)
+		return "", errors.Wrapf(e, "Container/Path %v/%v", blobstore.containerName, resource)
 	}
 	return
 }
@@ -1,9 +1,11 @@
 package blobstores_test
 
 import (
+	"context"
 	"io/ioutil"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/onsi/ginkgo"
 
@@ -13,6 +15,7 @@ import (
 
 	. "github.com/onsi/gomega"
 	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/blobstores/decorator"
 	inmemory "github.com/cloudfoundry-incubator/bits-service/blobstores/inmemory"
 	"github.com/cloudfoundry-incubator/bits-service/blobstores/local"
 	"github.com/cloudfoundry-incubator/bits-service/config"
@@ -29,48 +32,48 @@ var _ = Describe("Blobstore", func() {
 
 	itCanBeModifiedByItsMethods := func() {
 		It("can be modified by its methods", func() {
-			Expect(blobstore.Exists("/some/path")).To(BeFalse())
+			Expect(blobstore.Exists(context.Background(), "/some/path")).To(BeFalse())
 
-			redirectLocation, e := blobstore.HeadOrRedirectAsGet("/some/path")
+			redirectLocation, e := blobstore.HeadOrRedirectAsGet(context.Background(), "/some/path")
 			Expect(redirectLocation).To(BeEmpty())
 			Expect(e).To(BeAssignableToTypeOf(bitsgo.NewNotFoundError()))
 
-			Expect(blobstore.Put("/some/path", strings.NewReader("some string"))).To(Succeed())
+			Expect(blobstore.Put(context.Background(), "/some/path", strings.NewReader("some string"))).To(Succeed())
 
-			Expect(blobstore.Exists("/some/path")).To(BeTrue())
+			Expect(blobstore.Exists(context.Background(), "/some/path")).To(BeTrue())
 
-			Expect(blobstore.HeadOrRedirectAsGet("/some/path")).To(BeEmpty())
+			Expect(blobstore.HeadOrRedirectAsGet(context.Background(), "/some/path")).To(BeEmpty())
 
-			body, redirectLocation, e := blobstore.GetOrRedirect("/some/path")
+			body, redirectLocation, e := blobstore.GetOrRedirect(context.Background(), "/some/path")
 			Expect(redirectLocation, e).To(BeEmpty())
 			Expect(ioutil.ReadAll(body)).To(MatchRegexp("some string"))
 
-			Expect(blobstore.Copy("/some/path", "/some/other/path")).To(Succeed())
-			Expect(blobstore.Copy("/some/other/path", "/some/yet/other/path")).To(Succeed())
-			Expect(blobstore.Copy("/some/other/path", "/yet/some/other/path")).To(Succeed())
-			Expect(blobstore.Copy("/yet/some/other/path", "/yet/some/other/path")).To(Succeed())
+			Expect(blobstore.Copy(context.Background(), "/some/path", "/some/other/path")).To(Succeed())
+			Expect(blobstore.Copy(context.Background(), "/some/other/path", "/some/yet/other/path")).To(Succeed())
+			Expect(blobstore.Copy(context.Background(), "/some/other/path", "/yet/some/other/path")).To(Succeed())
+			Expect(blobstore.Copy(context.Background(), "/yet/some/other/path", "/yet/some/other/path")).To(Succeed())
 
-			body, redirectLocation, e = blobstore.GetOrRedirect("/some/other/path")
+			body, redirectLocation, e = blobstore.GetOrRedirect(context.Background(), "/some/other/path")
 			Expect(redirectLocation, e).To(BeEmpty())
 			Expect(ioutil.ReadAll(body)).To(MatchRegexp("some string"))
 
-			Expect(blobstore.Delete("/some/path")).To(Succeed())
+			Expect(blobstore.Delete(context.Background(), "/some/path")).To(Succeed())
 
-			Expect(blobstore.Exists("/some/path")).To(BeFalse())
+			Expect(blobstore.Exists(context.Background(), "/some/path")).To(BeFalse())
 
-			Expect(blobstore.Exists("/some/other/path")).To(BeTrue())
+			Expect(blobstore.Exists(context.Background(), "/some/other/path")).To(BeTrue())
 
-			redirectLocation, e = blobstore.HeadOrRedirectAsGet("/some/path")
+			redirectLocation, e = blobstore.HeadOrRedirectAsGet(context.Background(), "/some/path")
 			Expect(redirectLocation).To(BeEmpty())
 			Expect(e).To(BeAssignableToTypeOf(bitsgo.NewNotFoundError()))
 
-			Expect(blobstore.DeleteDir("/some")).To(Succeed())
-			Expect(blobstore.Exists("/some/other/path")).To(BeFalse())
-			Expect(blobstore.Exists("/some/yet/other/path")).To(BeFalse())
-			Expect(blobstore.Exists("/yet/some/other/path")).To(BeTrue())
+			Expect(blobstore.DeleteDir(context.Background(), "/some")).To(Succeed())
+			Expect(blobstore.Exists(context.Background(), "/some/other/path")).To(BeFalse())
+			Expect(blobstore.Exists(context.Background(), "/some/yet/other/path")).To(BeFalse())
+			Expect(blobstore.Exists(context.Background(), "/yet/some/other/path")).To(BeTrue())
 
-			Expect(blobstore.DeleteDir("")).To(Succeed())
-			Expect(blobstore.Exists("/yet/some/other/path")).To(BeFalse())
+			Expect(blobstore.DeleteDir(context.Background(), "")).To(Succeed())
+			Expect(blobstore.Exists(context.Background(), "/yet/some/other/path")).To(BeFalse())
 		})
 	}
 
@@ -87,6 +90,42 @@ var _ = Describe("Blobstore", func() {
 		AfterEach(func() { os.RemoveAll(tempDirname) })
 
 		itCanBeModifiedByItsMethods()
+
+		It("aborts Put and leaves no partial file behind when the context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			Expect(blobstore.Put(ctx, "/some/path", strings.NewReader("some string"))).NotTo(Succeed())
+			Expect(blobstore.Exists(context.Background(), "/some/path")).To(BeFalse())
+		})
+
+		Context("With timeouts", func() {
+			BeforeEach(func() {
+				blobstore = decorator.ForBlobstoreWithTimeouts(local.NewBlobstore(config.LocalBlobstoreConfig{PathPrefix: tempDirname}), config.TimeoutsConfig{
+					Exists: time.Minute,
+					Get:    time.Minute,
+					Put:    10 * time.Millisecond,
+				})
+			})
+
+			itCanBeModifiedByItsMethods()
+
+			It("aborts Put when it exceeds the put timeout", func() {
+				e := blobstore.Put(context.Background(), "/some/path", &slowReader{strings.NewReader("some string")})
+
+				Expect(e).To(MatchError(ContainSubstring("context deadline exceeded")))
+				Expect(blobstore.Exists(context.Background(), "/some/path")).To(BeFalse())
+			})
+
+			It("keeps the body readable after Get returns", func() {
+				Expect(blobstore.Put(context.Background(), "/some/path", strings.NewReader("some string"))).To(Succeed())
+
+				body, redirectLocation, e := blobstore.GetOrRedirect(context.Background(), "/some/path")
+				Expect(redirectLocation, e).To(BeEmpty())
+				Expect(ioutil.ReadAll(body)).To(MatchRegexp("some string"))
+				Expect(body.Close()).To(Succeed())
+			})
+		})
 	})
 
 	Describe("In-memory", func() {
@@ -95,3 +134,15 @@ var _ = Describe("Blobstore", func() {
 		itCanBeModifiedByItsMethods()
 	})
 })
+
+type slowReader struct {
+	*strings.Reader
+}
+
+func (reader *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(5 * time.Millisecond)
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	return reader.Reader.Read(p)
+}
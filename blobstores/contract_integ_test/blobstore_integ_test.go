@@ -1,6 +1,7 @@
 package main_test
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -35,47 +36,47 @@ var _ = Describe("Non-local blobstores", func() {
 	itCanPutAndGetAResourceThere := func() {
 
 		It("can put and get a resource there", func() {
-			redirectLocation, e := blobstore.HeadOrRedirectAsGet(filepath)
+			redirectLocation, e := blobstore.HeadOrRedirectAsGet(context.Background(), filepath)
 			Expect(redirectLocation, e).NotTo(BeEmpty())
 			Expect(http.Get(redirectLocation)).To(HaveStatusCode(http.StatusNotFound))
 
-			body, e := blobstore.Get(filepath)
+			body, e := blobstore.Get(context.Background(), filepath)
 			Expect(e).To(BeAssignableToTypeOf(&bitsgo.NotFoundError{}))
 			Expect(body).To(BeNil())
 
-			body, redirectLocation, e = blobstore.GetOrRedirect(filepath)
+			body, redirectLocation, e = blobstore.GetOrRedirect(context.Background(), filepath)
 			Expect(redirectLocation, e).NotTo(BeEmpty())
 			Expect(body).To(BeNil())
 			Expect(http.Get(redirectLocation)).To(HaveStatusCode(http.StatusNotFound))
 
-			e = blobstore.Put(filepath, strings.NewReader("the file content"))
+			e = blobstore.Put(context.Background(), filepath, strings.NewReader("the file content"))
 			Expect(e).NotTo(HaveOccurred())
 
-			redirectLocation, e = blobstore.HeadOrRedirectAsGet(filepath)
+			redirectLocation, e = blobstore.HeadOrRedirectAsGet(context.Background(), filepath)
 			Expect(redirectLocation, e).NotTo(BeEmpty())
 			Expect(http.Get(redirectLocation)).To(HaveStatusCode(http.StatusOK))
 
-			body, e = blobstore.Get(filepath)
+			body, e = blobstore.Get(context.Background(), filepath)
 			Expect(e).NotTo(HaveOccurred())
 			Expect(ioutil.ReadAll(body)).To(ContainSubstring("the file content"))
 
-			body, redirectLocation, e = blobstore.GetOrRedirect(filepath)
+			body, redirectLocation, e = blobstore.GetOrRedirect(context.Background(), filepath)
 			Expect(redirectLocation, e).NotTo(BeEmpty())
 			Expect(body).To(BeNil())
 			Expect(http.Get(redirectLocation)).To(HaveBodyWithSubstring("the file content"))
 
-			e = blobstore.Delete(filepath)
+			e = blobstore.Delete(context.Background(), filepath)
 			Expect(e).NotTo(HaveOccurred())
 
-			redirectLocation, e = blobstore.HeadOrRedirectAsGet(filepath)
+			redirectLocation, e = blobstore.HeadOrRedirectAsGet(context.Background(), filepath)
 			Expect(redirectLocation, e).NotTo(BeEmpty())
 			Expect(http.Get(redirectLocation)).To(HaveStatusCode(http.StatusNotFound))
 
-			body, e = blobstore.Get(filepath)
+			body, e = blobstore.Get(context.Background(), filepath)
 			Expect(e).To(BeAssignableToTypeOf(&bitsgo.NotFoundError{}))
 			Expect(body).To(BeNil())
 
-			body, redirectLocation, e = blobstore.GetOrRedirect(filepath)
+			body, redirectLocation, e = blobstore.GetOrRedirect(context.Background(), filepath)
 			Expect(redirectLocation, e).NotTo(BeEmpty())
 			Expect(body).To(BeNil())
 			Expect(http.Get(redirectLocation)).To(HaveStatusCode(http.StatusNotFound))
@@ -83,29 +84,29 @@ var _ = Describe("Non-local blobstores", func() {
 
 		Describe("DeleteDir", func() {
 			BeforeEach(func() {
-				e := blobstore.Put("one", strings.NewReader("the file content"))
+				e := blobstore.Put(context.Background(), "one", strings.NewReader("the file content"))
 				Expect(e).NotTo(HaveOccurred())
 
-				e = blobstore.Put("two", strings.NewReader("the file content"))
+				e = blobstore.Put(context.Background(), "two", strings.NewReader("the file content"))
 				Expect(e).NotTo(HaveOccurred())
 
-				Expect(blobstore.Exists("one")).To(BeTrue())
-				Expect(blobstore.Exists("two")).To(BeTrue())
+				Expect(blobstore.Exists(context.Background(), "one")).To(BeTrue())
+				Expect(blobstore.Exists(context.Background(), "two")).To(BeTrue())
 			})
 
 			AfterEach(func() {
-				blobstore.Delete("one")
-				blobstore.Delete("two")
-				Expect(blobstore.Exists("one")).To(BeFalse())
-				Expect(blobstore.Exists("two")).To(BeFalse())
+				blobstore.Delete(context.Background(), "one")
+				blobstore.Delete(context.Background(), "two")
+				Expect(blobstore.Exists(context.Background(), "one")).To(BeFalse())
+				Expect(blobstore.Exists(context.Background(), "two")).To(BeFalse())
 			})
 
 			It("Can delete a prefix", func() {
-				e := blobstore.DeleteDir("")
+				e := blobstore.DeleteDir(context.Background(), "")
 				Expect(e).NotTo(HaveOccurred())
 
-				Expect(blobstore.Exists("one")).To(BeFalse())
-				Expect(blobstore.Exists("two")).To(BeFalse())
+				Expect(blobstore.Exists(context.Background(), "one")).To(BeFalse())
+				Expect(blobstore.Exists(context.Background(), "two")).To(BeFalse())
 			})
 		})
 
@@ -113,51 +114,52 @@ var _ = Describe("Non-local blobstores", func() {
 			BeforeEach(func() {
 				srcFilepath = fmt.Sprintf("src-testfile")
 				destFilepath = fmt.Sprintf("dest-testfile")
-				body, e := blobstore.Get(srcFilepath)
+				body, e := blobstore.Get(context.Background(), srcFilepath)
 				Expect(e).To(BeAssignableToTypeOf(&bitsgo.NotFoundError{}))
 				Expect(body).To(BeNil())
-				e = blobstore.Put(srcFilepath, strings.NewReader("the file content"))
+				e = blobstore.Put(context.Background(), srcFilepath, strings.NewReader("the file content"))
 				Expect(e).NotTo(HaveOccurred())
 			})
 
 			AfterEach(func() {
-				e := blobstore.Delete(srcFilepath)
+				e := blobstore.Delete(context.Background(), srcFilepath)
 				Expect(e).NotTo(HaveOccurred())
-				e = blobstore.Delete(destFilepath)
+				e = blobstore.Delete(context.Background(), destFilepath)
 				Expect(e).NotTo(HaveOccurred())
 			})
 
 			It("copies a resource from src to dest", func() {
-				e := blobstore.Copy(srcFilepath, destFilepath)
+				e := blobstore.Copy(context.Background(), srcFilepath, destFilepath)
 				Expect(e).NotTo(HaveOccurred())
 
-				body, e := blobstore.Get(destFilepath)
+				body, e := blobstore.Get(context.Background(), destFilepath)
 				Expect(e).NotTo(HaveOccurred())
 				Expect(body).NotTo(BeNil())
 			})
 		})
 
 		It("Can delete a prefix like in a file tree", func() {
-			Expect(blobstore.Exists("dir/one")).To(BeFalse())
-			Expect(blobstore.Exists("dir/two")).To(BeFalse())
+			Expect(blobstore.Exists(context.Background(), "dir/one")).To(BeFalse())
+			Expect(blobstore.Exists(context.Background(), "dir/two")).To(BeFalse())
 
-			e := blobstore.Put("dir/one", strings.NewReader("the file content"))
+			e := blobstore.Put(context.Background(), "dir/one", strings.NewReader("the file content"))
 			Expect(e).NotTo(HaveOccurred())
-			e = blobstore.Put("dir/two", strings.NewReader("the file content"))
+			e = blobstore.Put(context.Background(), "dir/two", strings.NewReader("the file content"))
 			Expect(e).NotTo(HaveOccurred())
 
-			Expect(blobstore.Exists("dir/one")).To(BeTrue())
-			Expect(blobstore.Exists("dir/two")).To(BeTrue())
+			Expect(blobstore.Exists(context.Background(), "dir/one")).To(BeTrue())
+			Expect(blobstore.Exists(context.Background(), "dir/two")).To(BeTrue())
 
-			e = blobstore.DeleteDir("dir")
+			e = blobstore.DeleteDir(context.Background(), "dir")
 			Expect(e).NotTo(HaveOccurred())
 
-			Expect(blobstore.Exists("dir/one")).To(BeFalse())
-			Expect(blobstore.Exists("dir/two")).To(BeFalse())
+			Expect(blobstore.Exists(context.Background(), "dir/one")).To(BeFalse())
+			Expect(blobstore.Exists(context.Background(), "dir/two")).To(BeFalse())
 		})
 
 		It("can get a signed PUT URL and upload something to it", func() {
-			signedUrl := blobstore.Sign(filepath, "put", time.Now().Add(1*time.Hour))
+			signedUrl, e := blobstore.Sign(filepath, "put", time.Now().Add(1*time.Hour))
+			Expect(e).NotTo(HaveOccurred())
 
 			r := httputil.NewRequest("PUT", signedUrl, strings.NewReader("the file content"))
 
@@ -179,7 +181,7 @@ var _ = Describe("Non-local blobstores", func() {
 
 	ItDoesNotReturnNotFoundError := func() {
 		It("does not throw a NotFoundError", func() {
-			_, e := blobstore.Get("irrelevant-path")
+			_, e := blobstore.Get(context.Background(), "irrelevant-path")
 			Expect(e).NotTo(BeAssignableToTypeOf(&bitsgo.NotFoundError{}))
 		})
 	}
@@ -263,6 +265,12 @@ var _ = Describe("Non-local blobstores", func() {
 			ItDoesNotReturnNotFoundError()
 		})
 
+		Context("With objects larger than the segment size", func() {
+			BeforeEach(func() { openstackConfig.SegmentSize = "10B" })
+
+			itCanPutAndGetAResourceThere()
+		})
+
 	})
 	Context("alibaba", func() {
 		var alibabaConfig config.AlibabaBlobstoreConfig
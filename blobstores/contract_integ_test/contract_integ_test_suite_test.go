@@ -1,6 +1,7 @@
 package main_test
 
 import (
+	"context"
 	"io"
 
 	"github.com/onsi/ginkgo"
@@ -22,7 +23,7 @@ type blobstore interface {
 
 	// Instead doing:
 	bitsgo.Blobstore
-	Get(path string) (body io.ReadCloser, err error)
+	Get(ctx context.Context, path string) (body io.ReadCloser, err error)
 
 	bitsgo.ResourceSigner
 }
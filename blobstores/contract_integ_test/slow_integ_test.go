@@ -1,6 +1,7 @@
 package main_test
 
 import (
+	"context"
 	"crypto/md5"
 	"fmt"
 	"io"
@@ -44,11 +45,11 @@ var _ = XDescribe("Non-local blobstores SLOW TESTS", func() {
 			Expect(e).NotTo(HaveOccurred())
 			defer file.Close()
 
-			e = blobstore.Put(filepath, file)
+			e = blobstore.Put(context.Background(), filepath, file)
 			Expect(e).NotTo(HaveOccurred())
-			defer blobstore.Delete(filepath)
+			defer blobstore.Delete(context.Background(), filepath)
 
-			reader, e := blobstore.Get(filepath)
+			reader, e := blobstore.Get(context.Background(), filepath)
 			Expect(e).NotTo(HaveOccurred())
 			defer reader.Close()
 
@@ -65,7 +66,7 @@ var _ = XDescribe("Non-local blobstores SLOW TESTS", func() {
 			By("Files uploaded.")
 
 			By("Deleting dir...")
-			Expect(blobstore.DeleteDir(dirname)).To(Succeed())
+			Expect(blobstore.DeleteDir(context.Background(), dirname)).To(Succeed())
 			By("Dir deleted.")
 
 			By("Checking existence...")
@@ -161,9 +162,9 @@ func uploadFiles(blobstore blobstore, filenames []string) {
 	filenamesChannel := make(chan interface{}, 100)
 	setUpWorkers(numWorkers, assertionErrors, filenamesChannel, func(unit interface{}) {
 		filename := unit.(string)
-		Eventually(func() (bool, error) { return blobstore.Exists(filename) }, 1*time.Minute).Should(BeFalse())
-		Eventually(func() error { return blobstore.Put(filename, strings.NewReader("X")) }, 1*time.Minute).Should(Succeed())
-		Eventually(func() (bool, error) { return blobstore.Exists(filename) }, 1*time.Minute).Should(BeTrue())
+		Eventually(func() (bool, error) { return blobstore.Exists(context.Background(), filename) }, 1*time.Minute).Should(BeFalse())
+		Eventually(func() error { return blobstore.Put(context.Background(), filename, strings.NewReader("X")) }, 1*time.Minute).Should(Succeed())
+		Eventually(func() (bool, error) { return blobstore.Exists(context.Background(), filename) }, 1*time.Minute).Should(BeTrue())
 	})
 
 	go feedFilenamesInto(filenamesChannel, filenames)
@@ -176,7 +177,7 @@ func assertFilesDoNotExist(blobstore blobstore, filenames []string) {
 	filenamesChannel := make(chan interface{}, 100)
 	setUpWorkers(numWorkers, assertionErrors, filenamesChannel, func(unit interface{}) {
 		filename := unit.(string)
-		Eventually(func() (bool, error) { return blobstore.Exists(filename) }, 1*time.Minute).Should(BeFalse())
+		Eventually(func() (bool, error) { return blobstore.Exists(context.Background(), filename) }, 1*time.Minute).Should(BeFalse())
 	})
 
 	go feedFilenamesInto(filenamesChannel, filenames)
@@ -0,0 +1,78 @@
+package decorator
+
+import (
+	"context"
+	"io"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+)
+
+// IdentifierValidatingBlobstoreDecorator rejects invalid identifiers with *bitsgo.InvalidIdentifierError before they
+// reach the delegate. It must wrap decorators which derive paths from identifiers, e.g. for partitioning.
+type IdentifierValidatingBlobstoreDecorator struct {
+	delegate  Blobstore
+	validator *bitsgo.IdentifierValidator
+}
+
+func ForBlobstoreWithIdentifierValidation(delegate Blobstore, validator *bitsgo.IdentifierValidator) *IdentifierValidatingBlobstoreDecorator {
+	return &IdentifierValidatingBlobstoreDecorator{delegate, validator}
+}
+
+func (decorator *IdentifierValidatingBlobstoreDecorator) Exists(ctx context.Context, path string) (bool, error) {
+	if e := decorator.validator.Validate(path); e != nil {
+		return false, e
+	}
+	return decorator.delegate.Exists(ctx, path)
+}
+
+func (decorator *IdentifierValidatingBlobstoreDecorator) HeadOrRedirectAsGet(ctx context.Context, path string) (redirectLocation string, err error) {
+	if e := decorator.validator.Validate(path); e != nil {
+		return "", e
+	}
+	return decorator.delegate.HeadOrRedirectAsGet(ctx, path)
+}
+
+func (decorator *IdentifierValidatingBlobstoreDecorator) Get(ctx context.Context, path string) (body io.ReadCloser, err error) {
+	if e := decorator.validator.Validate(path); e != nil {
+		return nil, e
+	}
+	return decorator.delegate.Get(ctx, path)
+}
+
+func (decorator *IdentifierValidatingBlobstoreDecorator) GetOrRedirect(ctx context.Context, path string) (body io.ReadCloser, redirectLocation string, err error) {
+	if e := decorator.validator.Validate(path); e != nil {
+		return nil, "", e
+	}
+	return decorator.delegate.GetOrRedirect(ctx, path)
+}
+
+func (decorator *IdentifierValidatingBlobstoreDecorator) Put(ctx context.Context, path string, src io.ReadSeeker) error {
+	if e := decorator.validator.Validate(path); e != nil {
+		return e
+	}
+	return decorator.delegate.Put(ctx, path, src)
+}
+
+func (decorator *IdentifierValidatingBlobstoreDecorator) Copy(ctx context.Context, src, dest string) error {
+	if e := decorator.validator.Validate(src); e != nil {
+		return e
+	}
+	if e := decorator.validator.Validate(dest); e != nil {
+		return e
+	}
+	return decorator.delegate.Copy(ctx, src, dest)
+}
+
+func (decorator *IdentifierValidatingBlobstoreDecorator) Delete(ctx context.Context, path string) error {
+	if e := decorator.validator.Validate(path); e != nil {
+		return e
+	}
+	return decorator.delegate.Delete(ctx, path)
+}
+
+func (decorator *IdentifierValidatingBlobstoreDecorator) DeleteDir(ctx context.Context, prefix string) error {
+	if e := decorator.validator.ValidatePrefix(prefix); e != nil {
+		return e
+	}
+	return decorator.delegate.DeleteDir(ctx, prefix)
+}
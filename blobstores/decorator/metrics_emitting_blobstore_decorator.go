@@ -1,6 +1,7 @@
 package decorator
 
 import (
+	"context"
 	"io"
 	"time"
 
@@ -17,43 +18,43 @@ func ForBlobstoreWithMetricsEmitter(delegate Blobstore, metricsService bitsgo.Me
 	return &MetricsEmittingBlobstoreDecorator{delegate, metricsService, resourceType}
 }
 
-func (decorator *MetricsEmittingBlobstoreDecorator) Exists(path string) (bool, error) {
-	return decorator.delegate.Exists(path)
+func (decorator *MetricsEmittingBlobstoreDecorator) Exists(ctx context.Context, path string) (bool, error) {
+	return decorator.delegate.Exists(ctx, path)
 }
 
-func (decorator *MetricsEmittingBlobstoreDecorator) HeadOrRedirectAsGet(path string) (redirectLocation string, err error) {
-	return decorator.delegate.HeadOrRedirectAsGet(path)
+func (decorator *MetricsEmittingBlobstoreDecorator) HeadOrRedirectAsGet(ctx context.Context, path string) (redirectLocation string, err error) {
+	return decorator.delegate.HeadOrRedirectAsGet(ctx, path)
 }
 
-func (decorator *MetricsEmittingBlobstoreDecorator) Get(path string) (body io.ReadCloser, err error) {
-	return decorator.delegate.Get(path)
+func (decorator *MetricsEmittingBlobstoreDecorator) Get(ctx context.Context, path string) (body io.ReadCloser, err error) {
+	return decorator.delegate.Get(ctx, path)
 }
 
-func (decorator *MetricsEmittingBlobstoreDecorator) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error) {
-	return decorator.delegate.GetOrRedirect(path)
+func (decorator *MetricsEmittingBlobstoreDecorator) GetOrRedirect(ctx context.Context, path string) (body io.ReadCloser, redirectLocation string, err error) {
+	return decorator.delegate.GetOrRedirect(ctx, path)
 }
 
-func (decorator *MetricsEmittingBlobstoreDecorator) Put(path string, src io.ReadSeeker) error {
+func (decorator *MetricsEmittingBlobstoreDecorator) Put(ctx context.Context, path string, src io.ReadSeeker) error {
 	startTime := time.Now()
-	e := decorator.delegate.Put(path, src)
+	e := decorator.delegate.Put(ctx, path, src)
 	decorator.metricsService.SendTimingMetric(decorator.resourceType+"-cp_to_blobstore-time", time.Since(startTime))
 	return e
 }
 
-func (decorator *MetricsEmittingBlobstoreDecorator) Copy(src, dest string) error {
-	return decorator.delegate.Copy(src, dest)
+func (decorator *MetricsEmittingBlobstoreDecorator) Copy(ctx context.Context, src, dest string) error {
+	return decorator.delegate.Copy(ctx, src, dest)
 }
 
-func (decorator *MetricsEmittingBlobstoreDecorator) Delete(path string) error {
+func (decorator *MetricsEmittingBlobstoreDecorator) Delete(ctx context.Context, path string) error {
 	startTime := time.Now()
-	e := decorator.delegate.Delete(path)
+	e := decorator.delegate.Delete(ctx, path)
 	decorator.metricsService.SendTimingMetric(decorator.resourceType+"-delete_from_blobstore-time", time.Since(startTime))
 	return e
 }
 
-func (decorator *MetricsEmittingBlobstoreDecorator) DeleteDir(prefix string) error {
+func (decorator *MetricsEmittingBlobstoreDecorator) DeleteDir(ctx context.Context, prefix string) error {
 	startTime := time.Now()
-	e := decorator.delegate.DeleteDir(prefix)
+	e := decorator.delegate.DeleteDir(ctx, prefix)
 	decorator.metricsService.SendTimingMetric(decorator.resourceType+"-delete_dir_from_blobstore-time", time.Since(startTime))
 	return e
 }
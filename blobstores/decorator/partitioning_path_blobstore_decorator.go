@@ -1,6 +1,7 @@
 package decorator
 
 import (
+	"context"
 	"fmt"
 	"io"
 
@@ -16,7 +17,7 @@ type Blobstore interface {
 
 	// Instead doing:
 	bitsgo.Blobstore
-	Get(path string) (body io.ReadCloser, err error)
+	Get(ctx context.Context, path string) (body io.ReadCloser, err error)
 }
 
 func ForBlobstoreWithPathPartitioning(delegate Blobstore) *PartitioningPathBlobstoreDecorator {
@@ -27,39 +28,39 @@ type PartitioningPathBlobstoreDecorator struct {
 	delegate Blobstore
 }
 
-func (decorator *PartitioningPathBlobstoreDecorator) Exists(path string) (bool, error) {
-	return decorator.delegate.Exists(pathFor(path))
+func (decorator *PartitioningPathBlobstoreDecorator) Exists(ctx context.Context, path string) (bool, error) {
+	return decorator.delegate.Exists(ctx, pathFor(path))
 }
 
-func (decorator *PartitioningPathBlobstoreDecorator) HeadOrRedirectAsGet(path string) (redirectLocation string, err error) {
-	return decorator.delegate.HeadOrRedirectAsGet(pathFor(path))
+func (decorator *PartitioningPathBlobstoreDecorator) HeadOrRedirectAsGet(ctx context.Context, path string) (redirectLocation string, err error) {
+	return decorator.delegate.HeadOrRedirectAsGet(ctx, pathFor(path))
 }
 
-func (decorator *PartitioningPathBlobstoreDecorator) Get(path string) (body io.ReadCloser, err error) {
-	return decorator.delegate.Get(pathFor(path))
+func (decorator *PartitioningPathBlobstoreDecorator) Get(ctx context.Context, path string) (body io.ReadCloser, err error) {
+	return decorator.delegate.Get(ctx, pathFor(path))
 }
 
-func (decorator *PartitioningPathBlobstoreDecorator) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error) {
-	return decorator.delegate.GetOrRedirect(pathFor(path))
+func (decorator *PartitioningPathBlobstoreDecorator) GetOrRedirect(ctx context.Context, path string) (body io.ReadCloser, redirectLocation string, err error) {
+	return decorator.delegate.GetOrRedirect(ctx, pathFor(path))
 }
 
-func (decorator *PartitioningPathBlobstoreDecorator) Put(path string, src io.ReadSeeker) error {
-	return decorator.delegate.Put(pathFor(path), src)
+func (decorator *PartitioningPathBlobstoreDecorator) Put(ctx context.Context, path string, src io.ReadSeeker) error {
+	return decorator.delegate.Put(ctx, pathFor(path), src)
 }
 
-func (decorator *PartitioningPathBlobstoreDecorator) Copy(src, dest string) error {
-	return decorator.delegate.Copy(pathFor(src), pathFor(dest))
+func (decorator *PartitioningPathBlobstoreDecorator) Copy(ctx context.Context, src, dest string) error {
+	return decorator.delegate.Copy(ctx, pathFor(src), pathFor(dest))
 }
 
-func (decorator *PartitioningPathBlobstoreDecorator) Delete(path string) error {
-	return decorator.delegate.Delete(pathFor(path))
+func (decorator *PartitioningPathBlobstoreDecorator) Delete(ctx context.Context, path string) error {
+	return decorator.delegate.Delete(ctx, pathFor(path))
 }
 
-func (decorator *PartitioningPathBlobstoreDecorator) DeleteDir(prefix string) error {
+func (decorator *PartitioningPathBlobstoreDecorator) DeleteDir(ctx context.Context, prefix string) error {
 	if prefix == "" {
-		return decorator.delegate.DeleteDir(prefix)
+		return decorator.delegate.DeleteDir(ctx, prefix)
 	} else {
-		return decorator.delegate.DeleteDir(pathFor(prefix))
+		return decorator.delegate.DeleteDir(ctx, pathFor(prefix))
 	}
 }
 
@@ -84,6 +85,6 @@ type PartitioningPathResourceSigner struct {
 	delegate bitsgo.ResourceSigner
 }
 
-func (signer *PartitioningPathResourceSigner) Sign(resource string, method string, expirationTime time.Time) (signedURL string) {
+func (signer *PartitioningPathResourceSigner) Sign(resource string, method string, expirationTime time.Time) (signedURL string, err error) {
 	return signer.delegate.Sign(pathFor(resource), method, expirationTime)
 }
@@ -1,6 +1,7 @@
 package decorator
 
 import (
+	"context"
 	"io"
 	"time"
 
@@ -16,36 +17,36 @@ func ForBlobstoreWithPathPrefixing(delegate Blobstore, prefix string) *Prefixing
 	return &PrefixingPathBlobstoreDecorator{delegate, prefix}
 }
 
-func (decorator *PrefixingPathBlobstoreDecorator) Exists(path string) (bool, error) {
-	return decorator.delegate.Exists(decorator.prefix + path)
+func (decorator *PrefixingPathBlobstoreDecorator) Exists(ctx context.Context, path string) (bool, error) {
+	return decorator.delegate.Exists(ctx, decorator.prefix+path)
 }
 
-func (decorator *PrefixingPathBlobstoreDecorator) HeadOrRedirectAsGet(path string) (redirectLocation string, err error) {
-	return decorator.delegate.HeadOrRedirectAsGet(decorator.prefix + path)
+func (decorator *PrefixingPathBlobstoreDecorator) HeadOrRedirectAsGet(ctx context.Context, path string) (redirectLocation string, err error) {
+	return decorator.delegate.HeadOrRedirectAsGet(ctx, decorator.prefix+path)
 }
 
-func (decorator *PrefixingPathBlobstoreDecorator) Get(path string) (body io.ReadCloser, err error) {
-	return decorator.delegate.Get(decorator.prefix + path)
+func (decorator *PrefixingPathBlobstoreDecorator) Get(ctx context.Context, path string) (body io.ReadCloser, err error) {
+	return decorator.delegate.Get(ctx, decorator.prefix+path)
 }
 
-func (decorator *PrefixingPathBlobstoreDecorator) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error) {
-	return decorator.delegate.GetOrRedirect(decorator.prefix + path)
+func (decorator *PrefixingPathBlobstoreDecorator) GetOrRedirect(ctx context.Context, path string) (body io.ReadCloser, redirectLocation string, err error) {
+	return decorator.delegate.GetOrRedirect(ctx, decorator.prefix+path)
 }
 
-func (decorator *PrefixingPathBlobstoreDecorator) Put(path string, src io.ReadSeeker) error {
-	return decorator.delegate.Put(decorator.prefix+path, src)
+func (decorator *PrefixingPathBlobstoreDecorator) Put(ctx context.Context, path string, src io.ReadSeeker) error {
+	return decorator.delegate.Put(ctx, decorator.prefix+path, src)
 }
 
-func (decorator *PrefixingPathBlobstoreDecorator) Copy(src, dest string) error {
-	return decorator.delegate.Copy(decorator.prefix+src, decorator.prefix+dest)
+func (decorator *PrefixingPathBlobstoreDecorator) Copy(ctx context.Context, src, dest string) error {
+	return decorator.delegate.Copy(ctx, decorator.prefix+src, decorator.prefix+dest)
 }
 
-func (decorator *PrefixingPathBlobstoreDecorator) Delete(path string) error {
-	return decorator.delegate.Delete(decorator.prefix + path)
+func (decorator *PrefixingPathBlobstoreDecorator) Delete(ctx context.Context, path string) error {
+	return decorator.delegate.Delete(ctx, decorator.prefix+path)
 }
 
-func (decorator *PrefixingPathBlobstoreDecorator) DeleteDir(prefix string) error {
-	return decorator.delegate.DeleteDir(decorator.prefix + prefix)
+func (decorator *PrefixingPathBlobstoreDecorator) DeleteDir(ctx context.Context, prefix string) error {
+	return decorator.delegate.DeleteDir(ctx, decorator.prefix+prefix)
 }
 
 type PrefixingPathResourceSigner struct {
@@ -57,6 +58,6 @@ func ForResourceSignerWithPathPrefixing(delegate bitsgo.ResourceSigner, prefix s
 	return &PrefixingPathResourceSigner{delegate, prefix}
 }
 
-func (signer *PrefixingPathResourceSigner) Sign(resource string, method string, expirationTime time.Time) (signedURL string) {
+func (signer *PrefixingPathResourceSigner) Sign(resource string, method string, expirationTime time.Time) (signedURL string, err error) {
 	return signer.delegate.Sign(signer.prefix+resource, method, expirationTime)
 }
@@ -0,0 +1,93 @@
+package decorator
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/cloudfoundry-incubator/bits-service/config"
+)
+
+// TimeoutBlobstoreDecorator puts a deadline on every blobstore operation, so that a hanging backend
+// cannot block a request forever. Bodies returned by Get and GetOrRedirect can be read until they are closed.
+type TimeoutBlobstoreDecorator struct {
+	delegate Blobstore
+	timeouts config.TimeoutsConfig
+}
+
+func ForBlobstoreWithTimeouts(delegate Blobstore, timeouts config.TimeoutsConfig) *TimeoutBlobstoreDecorator {
+	return &TimeoutBlobstoreDecorator{delegate, timeouts}
+}
+
+func (decorator *TimeoutBlobstoreDecorator) Exists(ctx context.Context, path string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, decorator.timeouts.Exists)
+	defer cancel()
+	return decorator.delegate.Exists(ctx, path)
+}
+
+func (decorator *TimeoutBlobstoreDecorator) HeadOrRedirectAsGet(ctx context.Context, path string) (redirectLocation string, err error) {
+	ctx, cancel := withTimeout(ctx, decorator.timeouts.Exists)
+	defer cancel()
+	return decorator.delegate.HeadOrRedirectAsGet(ctx, path)
+}
+
+func (decorator *TimeoutBlobstoreDecorator) Get(ctx context.Context, path string) (body io.ReadCloser, err error) {
+	ctx, cancel := withTimeout(ctx, decorator.timeouts.Get)
+	body, e := decorator.delegate.Get(ctx, path)
+	return cancelOnClose(body, cancel), e
+}
+
+func (decorator *TimeoutBlobstoreDecorator) GetOrRedirect(ctx context.Context, path string) (body io.ReadCloser, redirectLocation string, err error) {
+	ctx, cancel := withTimeout(ctx, decorator.timeouts.Get)
+	body, redirectLocation, e := decorator.delegate.GetOrRedirect(ctx, path)
+	return cancelOnClose(body, cancel), redirectLocation, e
+}
+
+func (decorator *TimeoutBlobstoreDecorator) Put(ctx context.Context, path string, src io.ReadSeeker) error {
+	ctx, cancel := withTimeout(ctx, decorator.timeouts.Put)
+	defer cancel()
+	return decorator.delegate.Put(ctx, path, src)
+}
+
+func (decorator *TimeoutBlobstoreDecorator) Copy(ctx context.Context, src, dest string) error {
+	ctx, cancel := withTimeout(ctx, decorator.timeouts.Copy)
+	defer cancel()
+	return decorator.delegate.Copy(ctx, src, dest)
+}
+
+func (decorator *TimeoutBlobstoreDecorator) Delete(ctx context.Context, path string) error {
+	ctx, cancel := withTimeout(ctx, decorator.timeouts.Delete)
+	defer cancel()
+	return decorator.delegate.Delete(ctx, path)
+}
+
+func (decorator *TimeoutBlobstoreDecorator) DeleteDir(ctx context.Context, prefix string) error {
+	ctx, cancel := withTimeout(ctx, decorator.timeouts.DeleteDir)
+	defer cancel()
+	return decorator.delegate.DeleteDir(ctx, prefix)
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+type cancelOnCloseReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func cancelOnClose(body io.ReadCloser, cancel context.CancelFunc) io.ReadCloser {
+	if body == nil {
+		cancel()
+		return nil
+	}
+	return &cancelOnCloseReadCloser{body, cancel}
+}
+
+func (body *cancelOnCloseReadCloser) Close() error {
+	defer body.cancel()
+	return body.ReadCloser.Close()
+}
@@ -3,9 +3,11 @@ package gcp
 import (
 	"context"
 	"io"
+	"net/http"
 	"strings"
 	"time"
 
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/jwt"
 
 	"cloud.google.com/go/storage"
@@ -42,7 +44,12 @@ func NewBlobstore(config config.GCPBlobstoreConfig) *Blobstore {
 		Scopes:       []string{storage.ScopeFullControl},
 		TokenURL:     config.TokenURL,
 	}
-	client, err := storage.NewClient(ctx, option.WithTokenSource(jwtConfig.TokenSource(ctx)))
+	client, err := storage.NewClient(ctx, option.WithHTTPClient(&http.Client{
+		Transport: &oauth2.Transport{
+			Source: jwtConfig.TokenSource(ctx),
+			Base:   &vcapRequestIDTransport{http.DefaultTransport},
+		},
+	}))
 	if err != nil {
 		panic(err)
 	}
@@ -53,11 +60,37 @@ func NewBlobstore(config config.GCPBlobstoreConfig) *Blobstore {
 	}
 }
 
-func (blobstore *Blobstore) Exists(path string) (bool, error) {
-	_, e := blobstore.client.Bucket(blobstore.bucket).Object(path).NewReader(context.TODO())
+// vcapRequestIDTransport passes on the request ID, so that GCS requests can be correlated with bits-service requests.
+// The storage client sends all requests with the context of the blobstore operation, so all operations can be cancelled,
+// except for the signing of URLs, which does not send any requests.
+type vcapRequestIDTransport struct {
+	base http.RoundTripper
+}
+
+func (transport *vcapRequestIDTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if vcapRequestID := util.VcapRequestIDFrom(request.Context()); vcapRequestID != "" {
+		// A RoundTripper must not modify the request it is given.
+		clone := *request
+		clone.Header = cloneHeader(request.Header)
+		clone.Header.Set("X-Vcap-Request-Id", vcapRequestID)
+		request = &clone
+	}
+	return transport.base.RoundTrip(request)
+}
+
+func cloneHeader(header http.Header) http.Header {
+	clone := make(http.Header, len(header))
+	for key, values := range header {
+		clone[key] = append([]string(nil), values...)
+	}
+	return clone
+}
+
+func (blobstore *Blobstore) Exists(ctx context.Context, path string) (bool, error) {
+	_, e := blobstore.client.Bucket(blobstore.bucket).Object(path).NewReader(ctx)
 
 	if e != nil {
-		e = blobstore.handleError(e, "Failed to check for %v/%v", blobstore.bucket, path)
+		e = blobstore.handleError(ctx, e, "Failed to check for %v/%v", blobstore.bucket, path)
 		if _, ok := e.(*bitsgo.NotFoundError); ok {
 			return false, nil
 		}
@@ -66,7 +99,7 @@ func (blobstore *Blobstore) Exists(path string) (bool, error) {
 	return true, nil
 }
 
-func (blobstore *Blobstore) HeadOrRedirectAsGet(path string) (redirectLocation string, err error) {
+func (blobstore *Blobstore) HeadOrRedirectAsGet(ctx context.Context, path string) (redirectLocation string, err error) {
 	return storage.SignedURL(blobstore.bucket, path, &storage.SignedURLOptions{
 		GoogleAccessID: blobstore.jwtConfig.Email,
 		PrivateKey:     blobstore.jwtConfig.PrivateKey,
@@ -75,26 +108,26 @@ func (blobstore *Blobstore) HeadOrRedirectAsGet(path string) (redirectLocation s
 	})
 }
 
-func (blobstore *Blobstore) Get(path string) (body io.ReadCloser, err error) {
+func (blobstore *Blobstore) Get(ctx context.Context, path string) (body io.ReadCloser, err error) {
 	logger.Log.Debugw("Get from GCP", "bucket", blobstore.bucket, "path", path)
-	reader, e := blobstore.client.Bucket(blobstore.bucket).Object(path).NewReader(context.TODO())
+	reader, e := blobstore.client.Bucket(blobstore.bucket).Object(path).NewReader(ctx)
 	if e != nil {
-		return nil, blobstore.handleError(e, "Path %v", path)
+		return nil, blobstore.handleError(ctx, e, "Path %v", path)
 	}
 	return reader, nil
 }
 
-func (blobstore *Blobstore) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error) {
-	signedUrl, e := blobstore.HeadOrRedirectAsGet(path)
+func (blobstore *Blobstore) GetOrRedirect(ctx context.Context, path string) (body io.ReadCloser, redirectLocation string, err error) {
+	signedUrl, e := blobstore.HeadOrRedirectAsGet(ctx, path)
 	return nil, signedUrl, e
 }
 
-func (blobstore *Blobstore) Put(path string, src io.ReadSeeker) error {
+func (blobstore *Blobstore) Put(ctx context.Context, path string, src io.ReadSeeker) error {
 	logger.Log.Debugw("Put to GCP", "bucket", blobstore.bucket, "path", path)
-	if e := blobstore.bucketExists(); e != nil {
+	if e := blobstore.bucketExists(ctx); e != nil {
 		return e
 	}
-	writer := blobstore.client.Bucket(blobstore.bucket).Object(path).NewWriter(context.TODO())
+	writer := blobstore.client.Bucket(blobstore.bucket).Object(path).NewWriter(ctx)
 	var safeCloser util.SafeCloser
 	defer safeCloser.Close(writer)
 
@@ -110,26 +143,26 @@ func (blobstore *Blobstore) Put(path string, src io.ReadSeeker) error {
 	return nil
 }
 
-func (blobstore *Blobstore) Copy(src, dest string) error {
+func (blobstore *Blobstore) Copy(ctx context.Context, src, dest string) error {
 	logger.Log.Debugw("Copy in GCP", "bucket", blobstore.bucket, "src", src, "dest", dest)
-	_, e := blobstore.client.Bucket(blobstore.bucket).Object(dest).CopierFrom(blobstore.client.Bucket(blobstore.bucket).Object(src)).Run(context.TODO())
+	_, e := blobstore.client.Bucket(blobstore.bucket).Object(dest).CopierFrom(blobstore.client.Bucket(blobstore.bucket).Object(src)).Run(ctx)
 	if e != nil {
-		return blobstore.handleError(e, "Error while trying to copy src %v to dest %v in bucket %v", src, dest, blobstore.bucket)
+		return blobstore.handleError(ctx, e, "Error while trying to copy src %v to dest %v in bucket %v", src, dest, blobstore.bucket)
 	}
 	return nil
 }
 
-func (blobstore *Blobstore) Delete(path string) error {
-	e := blobstore.client.Bucket(blobstore.bucket).Object(path).Delete(context.TODO())
+func (blobstore *Blobstore) Delete(ctx context.Context, path string) error {
+	e := blobstore.client.Bucket(blobstore.bucket).Object(path).Delete(ctx)
 	if e != nil {
-		return blobstore.handleError(e, "Path %v", path)
+		return blobstore.handleError(ctx, e, "Path %v", path)
 	}
 	return nil
 }
 
-func (blobstore *Blobstore) DeleteDir(prefix string) error {
+func (blobstore *Blobstore) DeleteDir(ctx context.Context, prefix string) error {
 	deletionErrs := []error{}
-	it := blobstore.client.Bucket(blobstore.bucket).Objects(context.TODO(), &storage.Query{Prefix: prefix})
+	it := blobstore.client.Bucket(blobstore.bucket).Objects(ctx, &storage.Query{Prefix: prefix})
 	for {
 		attrs, e := it.Next()
 		if e == iterator.Done {
@@ -138,7 +171,7 @@ func (blobstore *Blobstore) DeleteDir(prefix string) error {
 		if e != nil {
 			return errors.Wrapf(e, "Prefix %v", prefix)
 		}
-		e = blobstore.Delete(attrs.Name)
+		e = blobstore.Delete(ctx, attrs.Name)
 		if e != nil {
 			if _, isNotFoundError := e.(*bitsgo.NotFoundError); !isNotFoundError {
 				deletionErrs = append(deletionErrs, e)
@@ -151,9 +184,9 @@ func (blobstore *Blobstore) DeleteDir(prefix string) error {
 	return nil
 }
 
-func (blobstore *Blobstore) Sign(resource string, method string, expirationTime time.Time) (signedURL string) {
-	if strings.ToLower(method) != "get" && method != "put" {
-		panic("The only supported methods are 'put' and 'get'")
+func (blobstore *Blobstore) Sign(resource string, method string, expirationTime time.Time) (signedURL string, err error) {
+	if strings.ToLower(method) != "get" && strings.ToLower(method) != "put" {
+		return "", bitsgo.NewUnsupportedMethodError(method, "get", "put")
 	}
 	signedURL, e := storage.SignedURL(blobstore.bucket, resource, &storage.SignedURLOptions{
 		GoogleAccessID: blobstore.jwtConfig.Email,
@@ -162,15 +195,15 @@ func (blobstore *Blobstore) Sign(resource string, method string, expirationTime
 		Expires:        expirationTime,
 	})
 	if e != nil {
-		panic(e)
+		return "", errors.Wrapf(e, "Bucket/Path %v/%v", blobstore.bucket, resource)
 	}
 	logger.Log.Debugw("Signed URL", "verb", method, "signed-url", signedURL)
 	return
 }
 
-func (blobstore *Blobstore) handleError(e error, context string, args ...interface{}) error {
+func (blobstore *Blobstore) handleError(ctx context.Context, e error, context string, args ...interface{}) error {
 	if e == storage.ErrObjectNotExist {
-		e := blobstore.bucketExists()
+		e := blobstore.bucketExists(ctx)
 		if e != nil {
 			return e
 		}
@@ -179,8 +212,8 @@ func (blobstore *Blobstore) handleError(e error, context string, args ...interfa
 	return errors.Wrapf(e, context, args...)
 }
 
-func (blobstore *Blobstore) bucketExists() error {
-	_, e := blobstore.client.Bucket(blobstore.bucket).Attrs(context.TODO())
+func (blobstore *Blobstore) bucketExists(ctx context.Context) error {
+	_, e := blobstore.client.Bucket(blobstore.bucket).Attrs(ctx)
 	if e != nil {
 		return errors.Wrapf(e, "Error while checking for bucket existence. Bucket '%v'", blobstore.bucket)
 	}
@@ -1,6 +1,7 @@
 package inmemory_blobstore
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"strings"
@@ -24,12 +25,12 @@ func NewBlobstoreWithEntries(entries map[string][]byte) *Blobstore {
 	return &Blobstore{Entries: entries}
 }
 
-func (blobstore *Blobstore) Exists(path string) (bool, error) {
+func (blobstore *Blobstore) Exists(ctx context.Context, path string) (bool, error) {
 	_, hasKey := blobstore.Entries[path]
 	return hasKey, nil
 }
 
-func (blobstore *Blobstore) HeadOrRedirectAsGet(path string) (redirectLocation string, err error) {
+func (blobstore *Blobstore) HeadOrRedirectAsGet(ctx context.Context, path string) (redirectLocation string, err error) {
 	_, hasKey := blobstore.Entries[path]
 	if !hasKey {
 		return "", bitsgo.NewNotFoundError()
@@ -37,7 +38,7 @@ func (blobstore *Blobstore) HeadOrRedirectAsGet(path string) (redirectLocation s
 	return "", nil
 }
 
-func (blobstore *Blobstore) Get(path string) (body io.ReadCloser, err error) {
+func (blobstore *Blobstore) Get(ctx context.Context, path string) (body io.ReadCloser, err error) {
 	entry, hasKey := blobstore.Entries[path]
 	if !hasKey {
 		return nil, bitsgo.NewNotFoundError()
@@ -45,12 +46,12 @@ func (blobstore *Blobstore) Get(path string) (body io.ReadCloser, err error) {
 	return ioutil.NopCloser(bytes.NewBuffer(entry)), nil
 }
 
-func (blobstore *Blobstore) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error) {
-	body, e := blobstore.Get(path)
+func (blobstore *Blobstore) GetOrRedirect(ctx context.Context, path string) (body io.ReadCloser, redirectLocation string, err error) {
+	body, e := blobstore.Get(ctx, path)
 	return body, "", e
 }
 
-func (blobstore *Blobstore) Put(path string, src io.ReadSeeker) error {
+func (blobstore *Blobstore) Put(ctx context.Context, path string, src io.ReadSeeker) error {
 	b, e := ioutil.ReadAll(src)
 	if e != nil {
 		return fmt.Errorf("Error while reading from src %v. Caused by: %v", path, e)
@@ -59,12 +60,12 @@ func (blobstore *Blobstore) Put(path string, src io.ReadSeeker) error {
 	return nil
 }
 
-func (blobstore *Blobstore) Copy(src, dest string) error {
+func (blobstore *Blobstore) Copy(ctx context.Context, src, dest string) error {
 	blobstore.Entries[dest] = blobstore.Entries[src]
 	return nil
 }
 
-func (blobstore *Blobstore) Delete(path string) error {
+func (blobstore *Blobstore) Delete(ctx context.Context, path string) error {
 	_, hasKey := blobstore.Entries[path]
 	if !hasKey {
 		return bitsgo.NewNotFoundError()
@@ -73,7 +74,7 @@ func (blobstore *Blobstore) Delete(path string) error {
 	return nil
 }
 
-func (blobstore *Blobstore) DeleteDir(prefix string) error {
+func (blobstore *Blobstore) DeleteDir(ctx context.Context, prefix string) error {
 	for key := range blobstore.Entries {
 		if strings.HasPrefix(key, prefix) {
 			delete(blobstore.Entries, key)
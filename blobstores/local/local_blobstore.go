@@ -1,6 +1,7 @@
 package local
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/cloudfoundry-incubator/bits-service"
 	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
 	"github.com/pkg/errors"
 )
 
@@ -23,7 +25,7 @@ func NewBlobstore(localConfig config.LocalBlobstoreConfig) *Blobstore {
 	return &Blobstore{pathPrefix: localConfig.PathPrefix}
 }
 
-func (blobstore *Blobstore) Exists(path string) (bool, error) {
+func (blobstore *Blobstore) Exists(ctx context.Context, path string) (bool, error) {
 	_, err := os.Stat(filepath.Join(blobstore.pathPrefix, path))
 	if os.IsNotExist(err) {
 		return false, nil
@@ -34,8 +36,8 @@ func (blobstore *Blobstore) Exists(path string) (bool, error) {
 	return true, nil
 }
 
-func (blobstore *Blobstore) HeadOrRedirectAsGet(path string) (redirectLocation string, err error) {
-	logger.Log.Debugw("Head", "local-path", filepath.Join(blobstore.pathPrefix, path))
+func (blobstore *Blobstore) HeadOrRedirectAsGet(ctx context.Context, path string) (redirectLocation string, err error) {
+	logger.FromContext(ctx).Debugw("Head", "local-path", filepath.Join(blobstore.pathPrefix, path))
 	_, e := os.Stat(filepath.Join(blobstore.pathPrefix, path))
 
 	if os.IsNotExist(e) {
@@ -47,8 +49,8 @@ func (blobstore *Blobstore) HeadOrRedirectAsGet(path string) (redirectLocation s
 	return "", nil
 }
 
-func (blobstore *Blobstore) Get(path string) (body io.ReadCloser, err error) {
-	logger.Log.Debugw("GetNoRedirect", "local-path", filepath.Join(blobstore.pathPrefix, path))
+func (blobstore *Blobstore) Get(ctx context.Context, path string) (body io.ReadCloser, err error) {
+	logger.FromContext(ctx).Debugw("GetNoRedirect", "local-path", filepath.Join(blobstore.pathPrefix, path))
 	file, e := os.Open(filepath.Join(blobstore.pathPrefix, path))
 
 	if os.IsNotExist(e) {
@@ -60,12 +62,12 @@ func (blobstore *Blobstore) Get(path string) (body io.ReadCloser, err error) {
 	return file, nil
 }
 
-func (blobstore *Blobstore) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error) {
-	body, e := blobstore.Get(path)
+func (blobstore *Blobstore) GetOrRedirect(ctx context.Context, path string) (body io.ReadCloser, redirectLocation string, err error) {
+	body, e := blobstore.Get(ctx, path)
 	return body, "", e
 }
 
-func (blobstore *Blobstore) Put(path string, src io.ReadSeeker) error {
+func (blobstore *Blobstore) Put(ctx context.Context, path string, src io.ReadSeeker) error {
 	e := os.MkdirAll(filepath.Dir(filepath.Join(blobstore.pathPrefix, path)), os.ModeDir|0755)
 	if e, isPathError := e.(*os.PathError); isPathError && e.Err == syscall.ENOSPC {
 		return bitsgo.NewNoSpaceLeftError()
@@ -81,17 +83,21 @@ func (blobstore *Blobstore) Put(path string, src io.ReadSeeker) error {
 		return fmt.Errorf("Error while creating file %v. Caused by: %v", path, e)
 	}
 	defer file.Close()
-	_, e = io.Copy(file, src)
+	_, e = io.Copy(file, util.NewContextReader(ctx, src))
 	if e, isPathError := e.(*os.PathError); isPathError && e.Err == syscall.ENOSPC {
 		return bitsgo.NewNoSpaceLeftError()
 	}
+	if e != nil && ctx.Err() != nil {
+		os.Remove(file.Name())
+		return errors.Wrapf(e, "Writing file %v aborted", path)
+	}
 	if e != nil {
 		return fmt.Errorf("Error while writing file %v. Caused by: %v", path, e)
 	}
 	return nil
 }
 
-func (blobstore *Blobstore) Copy(src, dest string) error {
+func (blobstore *Blobstore) Copy(ctx context.Context, src, dest string) error {
 	srcFull := filepath.Join(blobstore.pathPrefix, src)
 	destFull := filepath.Join(blobstore.pathPrefix, dest)
 
@@ -124,10 +130,14 @@ func (blobstore *Blobstore) Copy(src, dest string) error {
 	}
 	defer destFile.Close()
 
-	_, e = io.Copy(destFile, srcFile)
+	_, e = io.Copy(destFile, util.NewContextReader(ctx, srcFile))
 	if e, isPathError := e.(*os.PathError); isPathError && e.Err == syscall.ENOSPC {
 		return bitsgo.NewNoSpaceLeftError()
 	}
+	if e != nil && ctx.Err() != nil {
+		os.Remove(destFull)
+		return errors.Wrapf(e, "Copying aborted. (src=%v, dest=%v)", srcFull, destFull)
+	}
 	if e != nil {
 		return errors.Wrapf(e, "Copying failed. (src=%v, dest=%v)", srcFull, destFull)
 	}
@@ -135,7 +145,7 @@ func (blobstore *Blobstore) Copy(src, dest string) error {
 	return nil
 }
 
-func (blobstore *Blobstore) Delete(path string) error {
+func (blobstore *Blobstore) Delete(ctx context.Context, path string) error {
 	_, e := os.Stat(filepath.Join(blobstore.pathPrefix, path))
 	if e, isPathError := e.(*os.PathError); isPathError && e.Err == syscall.ENOSPC {
 		return bitsgo.NewNoSpaceLeftError()
@@ -153,7 +163,7 @@ func (blobstore *Blobstore) Delete(path string) error {
 	return nil
 }
 
-func (blobstore *Blobstore) DeleteDir(prefix string) error {
+func (blobstore *Blobstore) DeleteDir(ctx context.Context, prefix string) error {
 	e := os.RemoveAll(filepath.Join(blobstore.pathPrefix, prefix))
 	if e, isPathError := e.(*os.PathError); isPathError && e.Err == syscall.ENOSPC {
 		return bitsgo.NewNoSpaceLeftError()
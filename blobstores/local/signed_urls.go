@@ -1,28 +1,132 @@
 package local
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"os"
+	"strings"
 
 	"time"
 
+	"github.com/cloudfoundry-incubator/bits-service/logger"
 	"github.com/cloudfoundry-incubator/bits-service/pathsigner"
+	"github.com/cloudfoundry-incubator/bits-service/util"
 )
 
+// SignatureVerificationMiddleware rejects requests whose URL signature is invalid and enforces the
+// constraints embedded in the signature. The client IP is taken from the connection's remote address.
 type SignatureVerificationMiddleware struct {
 	SignatureValidator pathsigner.PathSignatureValidator
+	// MaxBodySizes maps the first path segment of a resource type, e.g. "packages", to the maximum body size
+	// of its handler. It bounds bodies spooled for content_digest verification without a max_content_length.
+	MaxBodySizes map[string]uint64
 }
 
 func (middleware *SignatureVerificationMiddleware) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request, next http.HandlerFunc) {
-	if request.URL.Query().Get("md5") == "" {
+	if !middleware.SignatureValidator.SignatureValid(request.Method, request.URL) {
 		responseWriter.WriteHeader(403)
 		return
 	}
-	if !middleware.SignatureValidator.SignatureValid(request.URL) {
+	constraints, e := pathsigner.ConstraintsFrom(request.URL)
+	if e != nil {
 		responseWriter.WriteHeader(403)
 		return
 	}
-	next(responseWriter, request)
+
+	if !constraints.AllowsClientIP(remoteIPFrom(request)) {
+		logger.From(request).Infow("Client IP not allowed by signed URL", "remote-addr", request.RemoteAddr, "client-ip", constraints.ClientIP)
+		responseWriter.WriteHeader(http.StatusForbidden)
+		util.FprintDescriptionAsJSON(responseWriter, "Client IP is not allowed to use this signed URL")
+		return
+	}
+
+	if constraints.MaxContentLength != 0 {
+		if request.ContentLength == -1 {
+			responseWriter.WriteHeader(http.StatusLengthRequired)
+			util.FprintDescriptionAsJSON(responseWriter, "Content-Length header is required for this signed URL")
+			return
+		}
+		if request.ContentLength > constraints.MaxContentLength {
+			responseWriter.WriteHeader(http.StatusRequestEntityTooLarge)
+			util.FprintDescriptionAsJSON(responseWriter, "Content length %v exceeds the maximum of %v bytes allowed by this signed URL", request.ContentLength, constraints.MaxContentLength)
+			return
+		}
+	}
+
+	if constraints.ContentDigest != "" {
+		if digest := request.Header.Get("Digest"); digest != "" && !strings.EqualFold(digest, "sha256="+constraints.ContentDigest) {
+			responseWriter.WriteHeader(http.StatusBadRequest)
+			util.FprintDescriptionAsJSON(responseWriter, "Digest header does not match the content digest of this signed URL")
+			return
+		}
+		maxBodySize := middleware.maxBodySizeFor(request, constraints)
+		if maxBodySize != 0 {
+			request.Body = http.MaxBytesReader(responseWriter, request.Body, maxBodySize)
+		}
+		body, digest, size, e := spoolToTempFile(request.Body)
+		if e != nil && maxBodySize != 0 && size >= maxBodySize {
+			responseWriter.WriteHeader(http.StatusRequestEntityTooLarge)
+			util.FprintDescriptionAsJSON(responseWriter, "Request body exceeds the maximum of %v bytes", maxBodySize)
+			return
+		}
+		util.PanicOnError(e)
+		defer os.Remove(body.Name())
+		defer body.Close()
+
+		if digest != constraints.ContentDigest {
+			responseWriter.WriteHeader(http.StatusBadRequest)
+			util.FprintDescriptionAsJSON(responseWriter, "Request body does not match the content digest of this signed URL")
+			return
+		}
+		request.Body = body
+	}
+	principal := "signed_url"
+	if keyID := request.URL.Query().Get("key_id"); keyID != "" {
+		principal += ":" + keyID
+	}
+	next(responseWriter, util.RequestWithPrincipal(request, principal))
+}
+
+func (middleware *SignatureVerificationMiddleware) maxBodySizeFor(request *http.Request, constraints pathsigner.Constraints) int64 {
+	if constraints.MaxContentLength != 0 {
+		return constraints.MaxContentLength
+	}
+	resourceType := strings.SplitN(strings.TrimPrefix(request.URL.Path, "/"), "/", 2)[0]
+	return int64(middleware.MaxBodySizes[resourceType])
+}
+
+func remoteIPFrom(request *http.Request) net.IP {
+	host, _, e := net.SplitHostPort(request.RemoteAddr)
+	if e != nil {
+		host = request.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// spoolToTempFile writes the body to a temporary file while computing its SHA256 digest, so that the body
+// can be verified before it reaches the handler. The returned file is positioned at its beginning. size is the
+// number of bytes read, also when reading fails.
+func spoolToTempFile(body io.Reader) (file *os.File, digest string, size int64, e error) {
+	file, e = ioutil.TempFile("", "bits-signed-upload")
+	if e != nil {
+		return nil, "", 0, e
+	}
+	sha := sha256.New()
+	size, e = io.Copy(io.MultiWriter(file, sha), body)
+	if e == nil {
+		_, e = file.Seek(0, io.SeekStart)
+	}
+	if e != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, "", size, e
+	}
+	return file, hex.EncodeToString(sha.Sum(nil)), size, nil
 }
 
 type LocalResourceSigner struct {
@@ -31,6 +135,10 @@ type LocalResourceSigner struct {
 	DelegateEndpoint   string
 }
 
-func (signer *LocalResourceSigner) Sign(resource string, method string, expirationTime time.Time) (signedURL string) {
-	return fmt.Sprintf("%s%s", signer.DelegateEndpoint, signer.Signer.Sign(signer.ResourcePathPrefix+resource, expirationTime))
+func (signer *LocalResourceSigner) Sign(resource string, method string, expirationTime time.Time) (signedURL string, err error) {
+	return fmt.Sprintf("%s%s", signer.DelegateEndpoint, signer.Signer.Sign(method, signer.ResourcePathPrefix+resource, expirationTime)), nil
+}
+
+func (signer *LocalResourceSigner) SignWithConstraints(resource string, method string, expirationTime time.Time, constraints pathsigner.Constraints) (signedURL string, err error) {
+	return fmt.Sprintf("%s%s", signer.DelegateEndpoint, signer.Signer.SignWithConstraints(method, signer.ResourcePathPrefix+resource, expirationTime, constraints)), nil
 }
@@ -1,7 +1,11 @@
 package local_test
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/benbjohnson/clock"
@@ -38,7 +42,7 @@ var _ = Describe("Signing URLs", func() {
 
 	BeforeEach(func() {
 		mockClock = clock.NewMock()
-		pathSignerValidator = &pathsigner.PathSignerValidator{"geheim", mockClock}
+		pathSignerValidator = &pathsigner.PathSignerValidator{Secrets: map[string]string{"key1": "geheim"}, ActiveKeyID: "key1", Clock: mockClock}
 		handler = &LocalResourceSigner{
 			Signer:             pathSignerValidator,
 			DelegateEndpoint:   "http://example.com",
@@ -48,9 +52,10 @@ var _ = Describe("Signing URLs", func() {
 
 	It("signs and verifies URLs", func() {
 		// signing
-		responseBody := handler.Sign("path", "get", mockClock.Now().Add(1*time.Hour))
+		responseBody, e := handler.Sign("path", "get", mockClock.Now().Add(1*time.Hour))
 
-		Expect(responseBody).To(ContainSubstring("http://example.com/my/path?md5="))
+		Expect(e).NotTo(HaveOccurred())
+		Expect(responseBody).To(ContainSubstring("http://example.com/my/path?signature="))
 		Expect(responseBody).To(ContainSubstring("expires"))
 
 		// verifying
@@ -59,7 +64,7 @@ var _ = Describe("Signing URLs", func() {
 
 		r := mux.NewRouter()
 		r.Path("/my/path").Methods("GET").Handler(negroni.New(
-			&SignatureVerificationMiddleware{pathSignerValidator},
+			&SignatureVerificationMiddleware{SignatureValidator: pathSignerValidator},
 			negroni.Wrap(delegateHandler),
 		))
 		r.ServeHTTP(responseWriter, httptest.NewRequest("GET", responseBody, nil))
@@ -69,9 +74,10 @@ var _ = Describe("Signing URLs", func() {
 
 	It("signs and returns an error when URL has expired", func() {
 		// signing
-		responseBody := handler.Sign("path", "get", mockClock.Now().Add(1*time.Hour))
+		responseBody, e := handler.Sign("path", "get", mockClock.Now().Add(1*time.Hour))
 
-		Expect(responseBody).To(ContainSubstring("http://example.com/my/path?md5="))
+		Expect(e).NotTo(HaveOccurred())
+		Expect(responseBody).To(ContainSubstring("http://example.com/my/path?signature="))
 		Expect(responseBody).To(ContainSubstring("expires"))
 
 		mockClock.Add(longerThanExpirationDuration)
@@ -82,7 +88,7 @@ var _ = Describe("Signing URLs", func() {
 
 		r := mux.NewRouter()
 		r.Path("/my/path").Methods("GET").Handler(negroni.New(
-			&SignatureVerificationMiddleware{pathSignerValidator},
+			&SignatureVerificationMiddleware{SignatureValidator: pathSignerValidator},
 			negroni.Wrap(delegateHandler),
 		))
 		r.ServeHTTP(responseWriter, httptest.NewRequest("GET", responseBody, nil))
@@ -90,4 +96,173 @@ var _ = Describe("Signing URLs", func() {
 		Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
 	})
 
+	It("rejects a URL signed for GET when it is replayed as PUT", func() {
+		signedURL, e := handler.Sign("path", "get", mockClock.Now().Add(1*time.Hour))
+		Expect(e).NotTo(HaveOccurred())
+
+		responseWriter := httptest.NewRecorder()
+		delegateHandler := NewMockHandler()
+
+		r := mux.NewRouter()
+		r.Path("/my/path").Methods("GET", "PUT").Handler(negroni.New(
+			&SignatureVerificationMiddleware{SignatureValidator: pathSignerValidator},
+			negroni.Wrap(delegateHandler),
+		))
+		r.ServeHTTP(responseWriter, httptest.NewRequest("PUT", signedURL, nil))
+
+		Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("accepts a URL signed for PUT only as PUT", func() {
+		signedURL, e := handler.Sign("path", "put", mockClock.Now().Add(1*time.Hour))
+		Expect(e).NotTo(HaveOccurred())
+
+		r := mux.NewRouter()
+		r.Path("/my/path").Methods("GET", "PUT").Handler(negroni.New(
+			&SignatureVerificationMiddleware{SignatureValidator: pathSignerValidator},
+			negroni.Wrap(NewMockHandler()),
+		))
+
+		responseWriter := httptest.NewRecorder()
+		r.ServeHTTP(responseWriter, httptest.NewRequest("PUT", signedURL, nil))
+		Expect(responseWriter.Code).To(Equal(http.StatusOK))
+
+		responseWriter = httptest.NewRecorder()
+		r.ServeHTTP(responseWriter, httptest.NewRequest("GET", signedURL, nil))
+		Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("accepts a URL signed for HEAD only as HEAD", func() {
+		signedURL, e := handler.Sign("path", "head", mockClock.Now().Add(1*time.Hour))
+		Expect(e).NotTo(HaveOccurred())
+
+		r := mux.NewRouter()
+		r.Path("/my/path").Methods("GET", "HEAD").Handler(negroni.New(
+			&SignatureVerificationMiddleware{SignatureValidator: pathSignerValidator},
+			negroni.Wrap(NewMockHandler()),
+		))
+
+		responseWriter := httptest.NewRecorder()
+		r.ServeHTTP(responseWriter, httptest.NewRequest("HEAD", signedURL, nil))
+		Expect(responseWriter.Code).To(Equal(http.StatusOK))
+
+		responseWriter = httptest.NewRecorder()
+		r.ServeHTTP(responseWriter, httptest.NewRequest("GET", signedURL, nil))
+		Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+	})
+
+	Context("constraints", func() {
+		var (
+			router       *mux.Router
+			receivedBody []byte
+		)
+
+		BeforeEach(func() {
+			receivedBody = nil
+			router = mux.NewRouter()
+			router.Path("/my/path").Methods("GET", "PUT").Handler(negroni.New(
+				&SignatureVerificationMiddleware{SignatureValidator: pathSignerValidator, MaxBodySizes: map[string]uint64{"my": 15}},
+				negroni.Wrap(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+					var e error
+					receivedBody, e = ioutil.ReadAll(request.Body)
+					Expect(e).NotTo(HaveOccurred())
+				})),
+			))
+		})
+
+		serve := func(request *http.Request) *httptest.ResponseRecorder {
+			responseWriter := httptest.NewRecorder()
+			router.ServeHTTP(responseWriter, request)
+			return responseWriter
+		}
+
+		It("rejects requests from a client IP outside the signed CIDR range", func() {
+			signedURL, e := handler.SignWithConstraints("path", "get", mockClock.Now().Add(time.Hour), pathsigner.Constraints{ClientIP: "10.0.0.0/8"})
+			Expect(e).NotTo(HaveOccurred())
+
+			request := httptest.NewRequest("GET", signedURL, nil)
+			request.RemoteAddr = "10.1.2.3:4567"
+			Expect(serve(request).Code).To(Equal(http.StatusOK))
+
+			request = httptest.NewRequest("GET", signedURL, nil)
+			request.RemoteAddr = "192.168.1.1:4567"
+			Expect(serve(request).Code).To(Equal(http.StatusForbidden))
+		})
+
+		It("rejects requests when a constraint has been removed from the URL", func() {
+			signedURL, e := handler.SignWithConstraints("path", "get", mockClock.Now().Add(time.Hour), pathsigner.Constraints{ClientIP: "10.1.2.3"})
+			Expect(e).NotTo(HaveOccurred())
+
+			request := httptest.NewRequest("GET", strings.Replace(signedURL, "&client_ip=10.1.2.3", "", 1), nil)
+			request.RemoteAddr = "192.168.1.1:4567"
+			Expect(serve(request).Code).To(Equal(http.StatusForbidden))
+		})
+
+		It("rejects bodies larger than the signed maximum content length", func() {
+			signedURL, e := handler.SignWithConstraints("path", "put", mockClock.Now().Add(time.Hour), pathsigner.Constraints{MaxContentLength: 5})
+			Expect(e).NotTo(HaveOccurred())
+
+			Expect(serve(httptest.NewRequest("PUT", signedURL, strings.NewReader("12345"))).Code).To(Equal(http.StatusOK))
+			Expect(serve(httptest.NewRequest("PUT", signedURL, strings.NewReader("123456"))).Code).To(Equal(http.StatusRequestEntityTooLarge))
+		})
+
+		It("requires a Content-Length when a maximum content length is signed", func() {
+			signedURL, e := handler.SignWithConstraints("path", "put", mockClock.Now().Add(time.Hour), pathsigner.Constraints{MaxContentLength: 5})
+			Expect(e).NotTo(HaveOccurred())
+
+			request := httptest.NewRequest("PUT", signedURL, strings.NewReader("12345"))
+			request.ContentLength = -1
+			Expect(serve(request).Code).To(Equal(http.StatusLengthRequired))
+		})
+
+		It("passes the body on when it matches the signed content digest", func() {
+			signedURL, e := handler.SignWithConstraints("path", "put", mockClock.Now().Add(time.Hour), pathsigner.Constraints{ContentDigest: sha256Hex("the content")})
+			Expect(e).NotTo(HaveOccurred())
+
+			Expect(serve(httptest.NewRequest("PUT", signedURL, strings.NewReader("the content"))).Code).To(Equal(http.StatusOK))
+			Expect(string(receivedBody)).To(Equal("the content"))
+		})
+
+		It("rejects bodies not matching the signed content digest", func() {
+			signedURL, e := handler.SignWithConstraints("path", "put", mockClock.Now().Add(time.Hour), pathsigner.Constraints{ContentDigest: sha256Hex("the content")})
+			Expect(e).NotTo(HaveOccurred())
+
+			Expect(serve(httptest.NewRequest("PUT", signedURL, strings.NewReader("other content"))).Code).To(Equal(http.StatusBadRequest))
+			Expect(receivedBody).To(BeNil())
+		})
+
+		It("rejects bodies to be verified against the content digest which exceed the handler's maximum body size", func() {
+			signedURL, e := handler.SignWithConstraints("path", "put", mockClock.Now().Add(time.Hour), pathsigner.Constraints{ContentDigest: sha256Hex("more than fifteen bytes")})
+			Expect(e).NotTo(HaveOccurred())
+
+			request := httptest.NewRequest("PUT", signedURL, strings.NewReader("more than fifteen bytes"))
+			request.ContentLength = -1
+			Expect(serve(request).Code).To(Equal(http.StatusRequestEntityTooLarge))
+			Expect(receivedBody).To(BeNil())
+		})
+
+		It("bounds bodies to be verified against the content digest by the signed maximum content length", func() {
+			signedURL, e := handler.SignWithConstraints("path", "put", mockClock.Now().Add(time.Hour), pathsigner.Constraints{MaxContentLength: 5, ContentDigest: sha256Hex("123456")})
+			Expect(e).NotTo(HaveOccurred())
+
+			request := httptest.NewRequest("PUT", signedURL, strings.NewReader("123456"))
+			request.ContentLength = 5
+			Expect(serve(request).Code).To(Equal(http.StatusRequestEntityTooLarge))
+			Expect(receivedBody).To(BeNil())
+		})
+
+		It("rejects a Digest header not matching the signed content digest", func() {
+			signedURL, e := handler.SignWithConstraints("path", "put", mockClock.Now().Add(time.Hour), pathsigner.Constraints{ContentDigest: sha256Hex("the content")})
+			Expect(e).NotTo(HaveOccurred())
+
+			request := httptest.NewRequest("PUT", signedURL, strings.NewReader("the content"))
+			request.Header.Set("Digest", "sha256="+sha256Hex("other content"))
+			Expect(serve(request).Code).To(Equal(http.StatusBadRequest))
+		})
+	})
 })
+
+func sha256Hex(content string) string {
+	digest := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(digest[:])
+}
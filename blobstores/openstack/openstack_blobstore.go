@@ -1,28 +1,32 @@
 package openstack
 
 import (
+	"context"
 	"io"
 	"time"
 
 	"github.com/ncw/swift"
 
-	"io/ioutil"
-
-	"bytes"
-
 	"strings"
 
 	"github.com/cloudfoundry-incubator/bits-service"
 	"github.com/cloudfoundry-incubator/bits-service/blobstores/validate"
 	"github.com/cloudfoundry-incubator/bits-service/config"
 	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
 	"github.com/pkg/errors"
 )
 
+// Blobstore passes the request ID of ctx as X-Trans-Id-Extra, which Swift appends to its transaction ID, on all
+// requests which accept headers, i.e. uploads, downloads, copies and large object manifests, but not segments.
+// The Swift client does not support contexts, so ctx is only checked while content is transferred and between
+// deletions in DeleteDir. Other requests, e.g. HEAD requests, deletions and listings, run to completion.
 type Blobstore struct {
 	containerName         string
 	swiftConn             *swift.Connection
 	accountMetaTempURLKey string
+	segmentContainerName  string
+	segmentSize           int64
 }
 
 func NewBlobstore(config config.OpenstackBlobstoreConfig) *Blobstore {
@@ -57,10 +61,12 @@ func NewBlobstore(config config.OpenstackBlobstoreConfig) *Blobstore {
 		swiftConn:             swiftConn,
 		containerName:         config.ContainerName,
 		accountMetaTempURLKey: config.AccountMetaTempURLKey,
+		segmentContainerName:  config.SegmentContainerName(),
+		segmentSize:           int64(config.SegmentSizeBytes()),
 	}
 }
 
-func (blobstore *Blobstore) Exists(path string) (bool, error) {
+func (blobstore *Blobstore) Exists(ctx context.Context, path string) (bool, error) {
 	if !blobstore.containerExists() {
 		return false, errors.Errorf("Container not found: '%v'", blobstore.containerName)
 	}
@@ -75,7 +81,7 @@ func (blobstore *Blobstore) Exists(path string) (bool, error) {
 	return true, nil
 }
 
-func (blobstore *Blobstore) HeadOrRedirectAsGet(path string) (redirectLocation string, err error) {
+func (blobstore *Blobstore) HeadOrRedirectAsGet(ctx context.Context, path string) (redirectLocation string, err error) {
 	return blobstore.swiftConn.ObjectTempUrl(blobstore.containerName, path, blobstore.accountMetaTempURLKey, "GET", time.Now().Add(time.Hour)), nil
 }
 
@@ -84,65 +90,211 @@ func (blobstore *Blobstore) containerExists() bool {
 	return e != swift.ContainerNotFound
 }
 
-func (blobstore *Blobstore) Get(path string) (body io.ReadCloser, err error) {
+func (blobstore *Blobstore) Get(ctx context.Context, path string) (body io.ReadCloser, err error) {
 	logger.Log.Debugw("Get", "bucket", blobstore.containerName, "path", path)
 
 	if !blobstore.containerExists() {
 		return nil, errors.Errorf("Container not found: '%v'", blobstore.containerName)
 	}
 
-	buf, e := blobstore.swiftConn.ObjectGetBytes(blobstore.containerName, path)
+	file, _, e := blobstore.swiftConn.ObjectOpen(blobstore.containerName, path, false, requestHeaders(ctx))
 	if e == swift.ObjectNotFound {
 		return nil, bitsgo.NewNotFoundError()
 	}
 	if e != nil {
 		return nil, errors.Wrapf(e, "Container: '%v', path: '%v'", blobstore.containerName, path)
 	}
-	return ioutil.NopCloser(bytes.NewBuffer(buf)), nil
+	return &contextReadCloser{util.NewContextReader(ctx, file), file}, nil
+}
+
+type contextReadCloser struct {
+	io.Reader
+	io.Closer
 }
 
-func (blobstore *Blobstore) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error) {
-	signedUrl, e := blobstore.HeadOrRedirectAsGet(path)
+// requestHeaders makes Swift append the request ID to its transaction ID, so that Swift requests can be correlated
+// with bits-service requests. Swift truncates it to 32 characters.
+func requestHeaders(ctx context.Context) swift.Headers {
+	if vcapRequestID := util.VcapRequestIDFrom(ctx); vcapRequestID != "" {
+		return swift.Headers{"X-Trans-Id-Extra": vcapRequestID}
+	}
+	return nil
+}
+
+func (blobstore *Blobstore) GetOrRedirect(ctx context.Context, path string) (body io.ReadCloser, redirectLocation string, err error) {
+	signedUrl, e := blobstore.HeadOrRedirectAsGet(ctx, path)
 	return nil, signedUrl, e
 }
 
-func (blobstore *Blobstore) Put(path string, src io.ReadSeeker) error {
+func (blobstore *Blobstore) Put(ctx context.Context, path string, src io.ReadSeeker) error {
 	logger.Log.Debugw("Put", "bucket", blobstore.containerName, "path", path)
 
-	if !blobstore.containerExists() {
-		return errors.Errorf("Container not found: '%v'", blobstore.containerName)
+	// Unlike the other operations, Put does not check for the container upfront, because deleteSegmentsOf already
+	// requires a HEAD request per object. A missing container makes ObjectPut fail with ObjectNotFound instead.
+	size, e := sizeOf(src)
+	if e != nil {
+		return errors.Wrapf(e, "Container: '%v', path: '%v'", blobstore.containerName, path)
+	}
+	if size > blobstore.segmentSize {
+		return blobstore.putLargeObject(ctx, path, src)
+	}
+
+	// Overwriting a large object with a regular one would otherwise leave its segments behind.
+	e = blobstore.deleteSegmentsOf(path)
+	if e != nil {
+		return errors.Wrapf(e, "Container: '%v', path: '%v'", blobstore.containerName, path)
 	}
 
-	_, e := blobstore.swiftConn.ObjectPut(blobstore.containerName, path, src, false, "", "", nil)
+	_, e = blobstore.swiftConn.ObjectPut(blobstore.containerName, path, util.NewContextReader(ctx, src), false, "", "", requestHeaders(ctx))
+	if e == swift.ObjectNotFound {
+		return errors.Errorf("Container not found: '%v'", blobstore.containerName)
+	}
 	if e != nil {
 		return errors.Wrapf(e, "Container: '%v', path: '%v'", blobstore.containerName, path)
 	}
 	return nil
 }
 
-func (blobstore *Blobstore) Copy(src, dest string) error {
+func sizeOf(src io.ReadSeeker) (int64, error) {
+	size, e := src.Seek(0, io.SeekEnd)
+	if e != nil {
+		return 0, e
+	}
+	_, e = src.Seek(0, io.SeekStart)
+	if e != nil {
+		return 0, e
+	}
+	return size, nil
+}
+
+// putLargeObject uploads src in segments of at most segmentSize into the segment container and
+// creates a manifest at path. It uses a Static Large Object (SLO) manifest when the cluster supports it
+// and falls back to a Dynamic Large Object (DLO) manifest otherwise.
+func (blobstore *Blobstore) putLargeObject(ctx context.Context, path string, src io.Reader) error {
+	logger.Log.Debugw("Put large object", "bucket", blobstore.containerName, "segment-container", blobstore.segmentContainerName, "path", path)
+
+	e := blobstore.swiftConn.ContainerCreate(blobstore.segmentContainerName, requestHeaders(ctx))
+	if e != nil {
+		return errors.Wrapf(e, "Could not create segment container '%v'", blobstore.segmentContainerName)
+	}
+
+	largeObjectOpts := &swift.LargeObjectOpts{
+		Container:        blobstore.containerName,
+		ObjectName:       path,
+		ChunkSize:        blobstore.segmentSize,
+		SegmentContainer: blobstore.segmentContainerName,
+		NoBuffer:         true,
+		Headers:          requestHeaders(ctx),
+	}
+	largeObject, e := blobstore.swiftConn.StaticLargeObjectCreate(largeObjectOpts)
+	if e == swift.SLONotSupported {
+		logger.Log.Infow("SLO not supported by Swift cluster. Falling back to DLO.", "container", blobstore.containerName)
+		largeObject, e = blobstore.swiftConn.DynamicLargeObjectCreate(largeObjectOpts)
+	}
+	if e != nil {
+		return errors.Wrapf(e, "Could not create large object. Container: '%v', path: '%v'", blobstore.containerName, path)
+	}
+
+	_, e = io.Copy(largeObject, util.NewContextReader(ctx, src))
+	if e != nil {
+		largeObject.Close()
+		return errors.Wrapf(e, "Could not upload segments. Container: '%v', path: '%v'", blobstore.containerName, path)
+	}
+	// Close writes the last segment and the manifest
+	e = largeObject.Close()
+	if e != nil {
+		return errors.Wrapf(e, "Could not write large object manifest. Container: '%v', path: '%v'", blobstore.containerName, path)
+	}
+	return nil
+}
+
+func (blobstore *Blobstore) isLargeObject(path string) (bool, error) {
+	_, headers, e := blobstore.swiftConn.Object(blobstore.containerName, path)
+	if e == swift.ObjectNotFound {
+		return false, nil
+	}
+	if e != nil {
+		return false, e
+	}
+	return headers.IsLargeObject(), nil
+}
+
+func (blobstore *Blobstore) deleteSegmentsOf(path string) error {
+	isLargeObject, e := blobstore.isLargeObject(path)
+	if e != nil {
+		return e
+	}
+	if !isLargeObject {
+		return nil
+	}
+	e = blobstore.swiftConn.LargeObjectDelete(blobstore.containerName, path)
+	if e == swift.ObjectNotFound {
+		return nil
+	}
+	return e
+}
+
+func (blobstore *Blobstore) Copy(ctx context.Context, src, dest string) error {
 	logger.Log.Debugw("Copy", "container", blobstore.containerName, "src", src, "dest", dest)
 
 	if !blobstore.containerExists() {
 		return errors.Errorf("Container not found: '%v'", blobstore.containerName)
 	}
 
-	_, e := blobstore.swiftConn.ObjectCopy(blobstore.containerName, src, blobstore.containerName, dest, nil)
+	isLargeObject, e := blobstore.isLargeObject(src)
+	if e != nil {
+		return errors.Wrapf(e, "Container: '%v', src: '%v', dst: '%v'", blobstore.containerName, src, dest)
+	}
+	if isLargeObject {
+		return blobstore.copyLargeObject(ctx, src, dest)
+	}
+
+	e = blobstore.deleteSegmentsOf(dest)
+	if e != nil {
+		return errors.Wrapf(e, "Container: '%v', src: '%v', dst: '%v'", blobstore.containerName, src, dest)
+	}
+
+	_, e = blobstore.swiftConn.ObjectCopy(blobstore.containerName, src, blobstore.containerName, dest, requestHeaders(ctx))
+	if e == swift.ObjectNotFound {
+		return bitsgo.NewNotFoundError()
+	}
+	if e != nil {
+		return errors.Wrapf(e, "Container: '%v', src: '%v', dst: '%v'", blobstore.containerName, src, dest)
+	}
+	return nil
+}
+
+// copyLargeObject streams the content of a large object into a new large object with its own segments.
+// A server-side COPY would either fail for objects above 5GB or, when copying only the manifest,
+// share segments between src and dest, so that deleting one of them would corrupt the other.
+func (blobstore *Blobstore) copyLargeObject(ctx context.Context, src, dest string) error {
+	if src == dest {
+		return nil
+	}
+
+	srcFile, _, e := blobstore.swiftConn.ObjectOpen(blobstore.containerName, src, false, requestHeaders(ctx))
 	if e == swift.ObjectNotFound {
 		return bitsgo.NewNotFoundError()
 	}
 	if e != nil {
 		return errors.Wrapf(e, "Container: '%v', src: '%v', dst: '%v'", blobstore.containerName, src, dest)
 	}
+	defer srcFile.Close()
+
+	e = blobstore.putLargeObject(ctx, dest, srcFile)
+	if e != nil {
+		return errors.Wrapf(e, "Container: '%v', src: '%v', dst: '%v'", blobstore.containerName, src, dest)
+	}
 	return nil
 }
 
-func (blobstore *Blobstore) Delete(path string) error {
+func (blobstore *Blobstore) Delete(ctx context.Context, path string) error {
 	if !blobstore.containerExists() {
 		return errors.Errorf("Container not found: '%v'", blobstore.containerName)
 	}
 
-	e := blobstore.swiftConn.ObjectDelete(blobstore.containerName, path)
+	// LargeObjectDelete also deletes the segments in case path is a large object manifest.
+	e := blobstore.swiftConn.LargeObjectDelete(blobstore.containerName, path)
 	if e == swift.ObjectNotFound {
 		return bitsgo.NewNotFoundError()
 	}
@@ -152,7 +304,7 @@ func (blobstore *Blobstore) Delete(path string) error {
 	return nil
 }
 
-func (blobstore *Blobstore) DeleteDir(prefix string) error {
+func (blobstore *Blobstore) DeleteDir(ctx context.Context, prefix string) error {
 	if !blobstore.containerExists() {
 		return errors.Errorf("Container not found: '%v'", blobstore.containerName)
 	}
@@ -163,7 +315,10 @@ func (blobstore *Blobstore) DeleteDir(prefix string) error {
 	}
 	deletionErrs := []error{}
 	for _, name := range names {
-		e = blobstore.Delete(name)
+		if ctx.Err() != nil {
+			return errors.Wrapf(ctx.Err(), "Prefix '%v', deletion aborted", prefix)
+		}
+		e = blobstore.Delete(ctx, name)
 		if e != nil {
 			if _, isNotFoundError := e.(*bitsgo.NotFoundError); !isNotFoundError {
 				deletionErrs = append(deletionErrs, e)
@@ -177,11 +332,16 @@ func (blobstore *Blobstore) DeleteDir(prefix string) error {
 	return nil
 }
 
-func (blobstore *Blobstore) Sign(resource string, method string, expirationTime time.Time) (signedURL string) {
-	if strings.ToLower(method) != "get" && method != "put" {
-		panic("The only supported methods are 'put' and 'get'")
+// Sign also works for large objects: Swift's tempurl middleware serves the concatenated segments
+// when the signed URL points to a manifest.
+func (blobstore *Blobstore) Sign(resource string, method string, expirationTime time.Time) (signedURL string, err error) {
+	method = strings.ToLower(method)
+	switch method {
+	case "get", "head", "put", "delete":
+	default:
+		return "", bitsgo.NewUnsupportedMethodError(method, "get", "head", "put", "delete")
 	}
-	signedURL = blobstore.swiftConn.ObjectTempUrl(blobstore.containerName, resource, blobstore.accountMetaTempURLKey, strings.ToUpper(method), time.Now().Add(time.Hour))
+	signedURL = blobstore.swiftConn.ObjectTempUrl(blobstore.containerName, resource, blobstore.accountMetaTempURLKey, strings.ToUpper(method), expirationTime)
 	logger.Log.Debugw("Signed URL", "verb", method, "signed-url", signedURL)
 	return
 }
@@ -0,0 +1,269 @@
+package openstack
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+	"github.com/ncw/swift"
+	"github.com/ncw/swift/swifttest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+// countingTransport records the method and transaction ID suffix of each request, so that tests can check
+// which requests an operation issues.
+type countingTransport struct {
+	mutex         sync.Mutex
+	methods       []string
+	transIDExtras []string
+}
+
+func (transport *countingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	transport.mutex.Lock()
+	transport.methods = append(transport.methods, request.Method)
+	transport.transIDExtras = append(transport.transIDExtras, request.Header.Get("X-Trans-Id-Extra"))
+	transport.mutex.Unlock()
+	return http.DefaultTransport.RoundTrip(request)
+}
+
+func (transport *countingTransport) count(method string) int {
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+	count := 0
+	for _, m := range transport.methods {
+		if m == method {
+			count++
+		}
+	}
+	return count
+}
+
+func (transport *countingTransport) reset() {
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+	transport.methods = nil
+	transport.transIDExtras = nil
+}
+
+func (transport *countingTransport) transIDExtrasOf(method string) []string {
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+	transIDExtras := []string{}
+	for i, m := range transport.methods {
+		if m == method {
+			transIDExtras = append(transIDExtras, transport.transIDExtras[i])
+		}
+	}
+	return transIDExtras
+}
+
+var _ = Describe("Blobstore", func() {
+	const segmentSize = 10
+
+	var (
+		swiftServer *swifttest.SwiftServer
+		transport   *countingTransport
+		swiftConn   *swift.Connection
+		blobstore   *Blobstore
+		ctx         context.Context
+	)
+
+	BeforeEach(func() {
+		var e error
+		swiftServer, e = swifttest.NewSwiftServer("localhost")
+		Expect(e).NotTo(HaveOccurred())
+		transport = &countingTransport{}
+		swiftConn = &swift.Connection{
+			UserName:  swifttest.TEST_ACCOUNT,
+			ApiKey:    swifttest.TEST_ACCOUNT,
+			AuthUrl:   swiftServer.AuthURL,
+			Transport: transport,
+		}
+		Expect(swiftConn.Authenticate()).To(Succeed())
+		Expect(swiftConn.ContainerCreate("container", nil)).To(Succeed())
+		blobstore = &Blobstore{
+			swiftConn:             swiftConn,
+			containerName:         "container",
+			accountMetaTempURLKey: "some-key",
+			segmentContainerName:  "container_segments",
+			segmentSize:           segmentSize,
+		}
+		ctx = context.Background()
+		transport.reset()
+	})
+
+	AfterEach(func() {
+		swiftServer.Close()
+	})
+
+	contentOf := func(path string) string {
+		body, e := blobstore.Get(ctx, path)
+		Expect(e).NotTo(HaveOccurred())
+		content, e := ioutil.ReadAll(body)
+		Expect(e).NotTo(HaveOccurred())
+		return string(content)
+	}
+
+	segments := func() []string {
+		names, e := swiftConn.ObjectNames("container_segments", nil)
+		if e == swift.ContainerNotFound {
+			return nil
+		}
+		Expect(e).NotTo(HaveOccurred())
+		return names
+	}
+
+	isLargeObject := func(path string) bool {
+		_, headers, e := swiftConn.Object("container", path)
+		Expect(e).NotTo(HaveOccurred())
+		return headers.IsLargeObject()
+	}
+
+	DescribeTable("segments objects which are larger than segment_size",
+		func(size int, expectedSegments int) {
+			content := strings.Repeat("x", size)
+
+			Expect(blobstore.Put(ctx, "some-path", strings.NewReader(content))).To(Succeed())
+
+			Expect(contentOf("some-path")).To(Equal(content))
+			Expect(isLargeObject("some-path")).To(Equal(expectedSegments > 0))
+			Expect(segments()).To(HaveLen(expectedSegments))
+		},
+		Entry("below segment_size", segmentSize-1, 0),
+		Entry("at segment_size", segmentSize, 0),
+		Entry("above segment_size", segmentSize+1, 2),
+		Entry("multiple of segment_size", 3*segmentSize, 3),
+	)
+
+	It("creates static large objects when the cluster supports them", func() {
+		Expect(blobstore.Put(ctx, "some-path", strings.NewReader(strings.Repeat("x", 2*segmentSize)))).To(Succeed())
+
+		_, headers, e := swiftConn.Object("container", "some-path")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(headers).To(HaveKeyWithValue("X-Static-Large-Object", "True"))
+	})
+
+	It("falls back to dynamic large objects when the cluster does not support SLOs", func() {
+		swiftServer.SetOverride("/info", func(w http.ResponseWriter, r *http.Request, recorder *httptest.ResponseRecorder) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+
+		Expect(blobstore.Put(ctx, "some-path", strings.NewReader(strings.Repeat("x", 2*segmentSize)))).To(Succeed())
+
+		_, headers, e := swiftConn.Object("container", "some-path")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(headers).NotTo(HaveKey("X-Static-Large-Object"))
+		Expect(headers).To(HaveKey("X-Object-Manifest"))
+		Expect(contentOf("some-path")).To(Equal(strings.Repeat("x", 2*segmentSize)))
+	})
+
+	DescribeTable("cleans up segments",
+		func(operation func()) {
+			Expect(blobstore.Put(ctx, "some-path", strings.NewReader(strings.Repeat("x", 2*segmentSize)))).To(Succeed())
+			Expect(segments()).To(HaveLen(2))
+
+			operation()
+
+			Expect(segments()).To(BeEmpty())
+		},
+		Entry("when a large object is overwritten with a regular one", func() {
+			Expect(blobstore.Put(ctx, "some-path", strings.NewReader("small"))).To(Succeed())
+			Expect(contentOf("some-path")).To(Equal("small"))
+		}),
+		Entry("when a regular object is copied over a large one", func() {
+			Expect(blobstore.Put(ctx, "other-path", strings.NewReader("small"))).To(Succeed())
+			Expect(blobstore.Copy(ctx, "other-path", "some-path")).To(Succeed())
+			Expect(contentOf("some-path")).To(Equal("small"))
+		}),
+		Entry("when a large object is deleted", func() {
+			Expect(blobstore.Delete(ctx, "some-path")).To(Succeed())
+		}),
+		Entry("when a directory containing a large object is deleted", func() {
+			Expect(blobstore.DeleteDir(ctx, "some-")).To(Succeed())
+		}),
+	)
+
+	It("replaces the segments when a large object is overwritten with a large one", func() {
+		Expect(blobstore.Put(ctx, "some-path", strings.NewReader(strings.Repeat("x", 3*segmentSize)))).To(Succeed())
+
+		Expect(blobstore.Put(ctx, "some-path", strings.NewReader(strings.Repeat("y", 2*segmentSize)))).To(Succeed())
+
+		Expect(contentOf("some-path")).To(Equal(strings.Repeat("y", 2*segmentSize)))
+		Expect(segments()).To(HaveLen(2))
+	})
+
+	It("gives copies of large objects their own segments", func() {
+		Expect(blobstore.Put(ctx, "some-path", strings.NewReader(strings.Repeat("x", 2*segmentSize)))).To(Succeed())
+
+		Expect(blobstore.Copy(ctx, "some-path", "other-path")).To(Succeed())
+		Expect(segments()).To(HaveLen(4))
+
+		Expect(blobstore.Delete(ctx, "some-path")).To(Succeed())
+		Expect(contentOf("other-path")).To(Equal(strings.Repeat("x", 2*segmentSize)))
+		Expect(segments()).To(HaveLen(2))
+	})
+
+	It("issues a single HEAD request when putting a regular object", func() {
+		Expect(blobstore.Put(ctx, "some-path", strings.NewReader("small"))).To(Succeed())
+
+		Expect(transport.count("HEAD")).To(Equal(1))
+		Expect(transport.count("PUT")).To(Equal(1))
+	})
+
+	It("passes on the request ID when transferring regular objects", func() {
+		ctx = util.WithVcapRequestID(ctx, "some-request-id")
+
+		Expect(blobstore.Put(ctx, "some-path", strings.NewReader("small"))).To(Succeed())
+		Expect(contentOf("some-path")).To(Equal("small"))
+
+		Expect(transport.transIDExtrasOf("PUT")).To(ConsistOf("some-request-id"))
+		Expect(transport.transIDExtrasOf("GET")).To(ConsistOf("some-request-id"))
+	})
+
+	Describe("Sign", func() {
+		It("signs URLs which expire at the expiration time", func() {
+			expirationTime := time.Now().Add(3 * time.Hour).Truncate(time.Second)
+
+			signedURL, e := blobstore.Sign("some-path", "PUT", expirationTime)
+
+			Expect(e).NotTo(HaveOccurred())
+			parsedURL, e := url.Parse(signedURL)
+			Expect(e).NotTo(HaveOccurred())
+			Expect(parsedURL.Path).To(HaveSuffix("/container/some-path"))
+			Expect(parsedURL.Query().Get("temp_url_expires")).To(Equal(strconv.FormatInt(expirationTime.Unix(), 10)))
+		})
+
+		It("signs the method in addition to the path", func() {
+			expirationTime := time.Now().Add(time.Hour)
+			urls := map[string]bool{}
+			for _, method := range []string{"get", "head", "put", "delete"} {
+				signedURL, e := blobstore.Sign("some-path", method, expirationTime)
+				Expect(e).NotTo(HaveOccurred())
+				urls[signedURL] = true
+			}
+			Expect(urls).To(HaveLen(4))
+		})
+
+		It("rejects unsupported methods with an UnsupportedMethodError", func() {
+			_, e := blobstore.Sign("some-path", "post", time.Now().Add(time.Hour))
+
+			Expect(e).To(BeAssignableToTypeOf(&bitsgo.UnsupportedMethodError{}))
+		})
+	})
+
+	It("fails to put into a missing container", func() {
+		blobstore.containerName = "missing"
+
+		Expect(blobstore.Put(ctx, "some-path", strings.NewReader("small"))).To(MatchError("Container not found: 'missing'"))
+	})
+})
@@ -0,0 +1,13 @@
+package openstack
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestOpenstackBlobstore(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "OpenstackBlobstore")
+}
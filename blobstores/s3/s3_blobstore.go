@@ -1,6 +1,7 @@
 package s3
 
 import (
+	"context"
 	"io"
 	"strings"
 	"time"
@@ -16,6 +17,7 @@ import (
 	"github.com/cloudfoundry-incubator/bits-service/config"
 	"github.com/cloudfoundry-incubator/bits-service/logger"
 	log "github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
 	"github.com/pkg/errors"
 )
 
@@ -60,11 +62,11 @@ func NewBlobstoreWithLogger(config config.S3BlobstoreConfig, logger *zap.Sugared
 	}
 }
 
-func (blobstore *Blobstore) Exists(path string) (bool, error) {
-	_, e := blobstore.s3Client.HeadObject(&s3.HeadObjectInput{
+func (blobstore *Blobstore) Exists(ctx context.Context, path string) (bool, error) {
+	_, e := blobstore.s3Client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
 		Bucket: &blobstore.bucket,
 		Key:    &path,
-	})
+	}, withVcapRequestID(ctx))
 	if e != nil {
 		if isS3NotFoundError(e) {
 			return false, nil
@@ -74,7 +76,7 @@ func (blobstore *Blobstore) Exists(path string) (bool, error) {
 	return true, nil
 }
 
-func (blobstore *Blobstore) HeadOrRedirectAsGet(path string) (redirectLocation string, err error) {
+func (blobstore *Blobstore) HeadOrRedirectAsGet(ctx context.Context, path string) (redirectLocation string, err error) {
 	request, _ := blobstore.s3Client.GetObjectRequest(&s3.GetObjectInput{
 		Bucket: &blobstore.bucket,
 		Key:    &path,
@@ -82,12 +84,12 @@ func (blobstore *Blobstore) HeadOrRedirectAsGet(path string) (redirectLocation s
 	return blobstore.signer.Sign(request, blobstore.bucket, path, time.Now().Add(time.Hour))
 }
 
-func (blobstore *Blobstore) Get(path string) (body io.ReadCloser, err error) {
+func (blobstore *Blobstore) Get(ctx context.Context, path string) (body io.ReadCloser, err error) {
 	logger.Log.Debugw("Get from S3", "bucket", blobstore.bucket, "path", path)
-	output, e := blobstore.s3Client.GetObject(&s3.GetObjectInput{
+	output, e := blobstore.s3Client.GetObjectWithContext(ctx, &s3.GetObjectInput{
 		Bucket: &blobstore.bucket,
 		Key:    &path,
-	})
+	}, withVcapRequestID(ctx))
 	if e != nil {
 		if isS3NotFoundError(e) {
 			return nil, bitsgo.NewNotFoundError()
@@ -97,7 +99,7 @@ func (blobstore *Blobstore) Get(path string) (body io.ReadCloser, err error) {
 	return output.Body, nil
 }
 
-func (blobstore *Blobstore) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error) {
+func (blobstore *Blobstore) GetOrRedirect(ctx context.Context, path string) (body io.ReadCloser, redirectLocation string, err error) {
 	request, _ := blobstore.s3Client.GetObjectRequest(&s3.GetObjectInput{
 		Bucket: &blobstore.bucket,
 		Key:    &path,
@@ -106,26 +108,26 @@ func (blobstore *Blobstore) GetOrRedirect(path string) (body io.ReadCloser, redi
 	return nil, signedUrl, e
 }
 
-func (blobstore *Blobstore) Put(path string, src io.ReadSeeker) error {
+func (blobstore *Blobstore) Put(ctx context.Context, path string, src io.ReadSeeker) error {
 	logger.Log.Debugw("Put to S3", "bucket", blobstore.bucket, "path", path)
-	_, e := blobstore.s3Client.PutObject(&s3.PutObjectInput{
+	_, e := blobstore.s3Client.PutObjectWithContext(ctx, &s3.PutObjectInput{
 		Bucket: &blobstore.bucket,
 		Key:    &path,
 		Body:   src,
-	})
+	}, withVcapRequestID(ctx))
 	if e != nil {
 		return errors.Wrapf(e, "Path %v", path)
 	}
 	return nil
 }
 
-func (blobstore *Blobstore) Copy(src, dest string) error {
+func (blobstore *Blobstore) Copy(ctx context.Context, src, dest string) error {
 	logger.Log.Debugw("Copy in S3", "bucket", blobstore.bucket, "src", src, "dest", dest)
-	_, e := blobstore.s3Client.CopyObject(&s3.CopyObjectInput{
+	_, e := blobstore.s3Client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
 		Key:        &dest,
 		CopySource: aws.String(blobstore.bucket + "/" + src),
 		Bucket:     &blobstore.bucket,
-	})
+	}, withVcapRequestID(ctx))
 	if e != nil {
 		if isS3NotFoundError(e) {
 			return bitsgo.NewNotFoundError()
@@ -135,11 +137,11 @@ func (blobstore *Blobstore) Copy(src, dest string) error {
 	return nil
 }
 
-func (blobstore *Blobstore) Delete(path string) error {
-	_, e := blobstore.s3Client.DeleteObject(&s3.DeleteObjectInput{
+func (blobstore *Blobstore) Delete(ctx context.Context, path string) error {
+	_, e := blobstore.s3Client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
 		Bucket: &blobstore.bucket,
 		Key:    &path,
-	})
+	}, withVcapRequestID(ctx))
 	if e != nil {
 		if isS3NotFoundError(e) {
 			return bitsgo.NewNotFoundError()
@@ -149,16 +151,16 @@ func (blobstore *Blobstore) Delete(path string) error {
 	return nil
 }
 
-func (blobstore *Blobstore) DeleteDir(prefix string) error {
+func (blobstore *Blobstore) DeleteDir(ctx context.Context, prefix string) error {
 	deletionErrs := []error{}
-	e := blobstore.s3Client.ListObjectsPages(
+	e := blobstore.s3Client.ListObjectsPagesWithContext(ctx,
 		&s3.ListObjectsInput{
 			Bucket: &blobstore.bucket,
 			Prefix: &prefix,
 		},
 		func(p *s3.ListObjectsOutput, lastPage bool) (shouldContinue bool) {
 			for _, object := range p.Contents {
-				e := blobstore.Delete(*object.Key)
+				e := blobstore.Delete(ctx, *object.Key)
 				if e != nil {
 					if _, isNotFoundError := e.(*bitsgo.NotFoundError); !isNotFoundError {
 						deletionErrs = append(deletionErrs, e)
@@ -166,7 +168,7 @@ func (blobstore *Blobstore) DeleteDir(prefix string) error {
 				}
 			}
 			return true
-		})
+		}, withVcapRequestID(ctx))
 	if e != nil {
 		return errors.Wrapf(e, "Prefix %v, errors from deleting: %v", prefix, deletionErrs)
 	}
@@ -176,7 +178,16 @@ func (blobstore *Blobstore) DeleteDir(prefix string) error {
 	return nil
 }
 
-func (signer *Blobstore) Sign(resource string, method string, expirationTime time.Time) (signedURL string) {
+// withVcapRequestID passes on the request ID, so that backend requests can be correlated with bits-service requests.
+func withVcapRequestID(ctx context.Context) request.Option {
+	return func(r *request.Request) {
+		if vcapRequestID := util.VcapRequestIDFrom(ctx); vcapRequestID != "" {
+			r.HTTPRequest.Header.Set("X-Vcap-Request-Id", vcapRequestID)
+		}
+	}
+}
+
+func (signer *Blobstore) Sign(resource string, method string, expirationTime time.Time) (signedURL string, err error) {
 	var request *request.Request
 	switch strings.ToLower(method) {
 	case "put":
@@ -190,12 +201,12 @@ func (signer *Blobstore) Sign(resource string, method string, expirationTime tim
 			Key:    aws.String(resource),
 		})
 	default:
-		panic("The only supported methods are 'put' and 'get'. But got '" + method + "'")
+		return "", bitsgo.NewUnsupportedMethodError(method, "get", "put")
 	}
 	// TODO use clock
 	signedURL, e := signer.signer.Sign(request, signer.bucket, resource, expirationTime)
 	if e != nil {
-		panic(e)
+		return "", errors.Wrapf(e, "Bucket/Path %v/%v", signer.bucket, resource)
 	}
 	logger.Log.Debugw("Signed URL", "verb", method, "signed-url", signedURL)
 	return
@@ -1,10 +1,13 @@
 package webdav
 
 import (
+	"context"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	neturl "net/url"
 	"strings"
 
 	"bytes"
@@ -15,15 +18,20 @@ import (
 	"github.com/cloudfoundry-incubator/bits-service/config"
 	"github.com/cloudfoundry-incubator/bits-service/httputil"
 	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
 	"github.com/pkg/errors"
 )
 
+// Blobstore talks to the CF blobstore (nginx) by default, which expects writes under /admin/ and provides
+// /sign and /sign_for_put endpoints. In generic mode it only uses standard WebDAV methods (RFC 4918),
+// does not redirect to the WebDAV server and expects resources to be signed and proxied by bits-service.
 type Blobstore struct {
 	httpClient            *http.Client
 	webdavPrivateEndpoint string
 	webdavPublicEndpoint  string
 	webdavUsername        string
 	webdavPassword        string
+	generic               bool
 }
 
 func NewBlobstore(c config.WebdavBlobstoreConfig) *Blobstore {
@@ -33,31 +41,70 @@ func NewBlobstore(c config.WebdavBlobstoreConfig) *Blobstore {
 		httpClient:            NewHttpClient(c.CACert(), c.SkipCertVerify),
 		webdavUsername:        c.Username,
 		webdavPassword:        c.Password,
+		generic:               c.Generic,
 	}
 }
 
-func (blobstore *Blobstore) Exists(path string) (bool, error) {
+func (blobstore *Blobstore) Exists(ctx context.Context, path string) (bool, error) {
+	if blobstore.generic {
+		return blobstore.existsWithPropfind(ctx, path)
+	}
 	url := blobstore.webdavPrivateEndpoint + "/" + path
-	logger.Log.Debugw("Exists", "path", path, "url", url)
-	response, e := blobstore.httpClient.Do(blobstore.newRequestWithBasicAuth("HEAD", url, nil))
+	logger.FromContext(ctx).Debugw("Exists", "path", path, "url", url)
+	response, e := blobstore.do(ctx, blobstore.newRequestWithBasicAuth("HEAD", url, nil))
 	if e != nil {
 		return false, errors.Wrapf(e, "Error in Exists, path=%v", path)
 	}
 	if response.StatusCode == http.StatusOK {
-		logger.Log.Debugw("Exists", "result", true)
+		logger.FromContext(ctx).Debugw("Exists", "result", true)
 		return true, nil
 	}
-	logger.Log.Debugw("Exists", "result", false)
+	logger.FromContext(ctx).Debugw("Exists", "result", false)
 	return false, nil
 }
 
-func (blobstore *Blobstore) HeadOrRedirectAsGet(path string) (redirectLocation string, err error) {
-	_, redirectLocation, e := blobstore.GetOrRedirect(path)
+func (blobstore *Blobstore) existsWithPropfind(ctx context.Context, path string) (bool, error) {
+	url := blobstore.webdavPrivateEndpoint + "/" + path
+	logger.FromContext(ctx).Debugw("Exists", "path", path, "url", url)
+	response, e := blobstore.do(ctx,
+		httputil.NewRequest("PROPFIND", url, strings.NewReader(propfindResourceTypeBody)).
+			WithHeader("Depth", "0").
+			WithHeader("Content-Type", "application/xml").
+			WithBasicAuth(blobstore.webdavUsername, blobstore.webdavPassword).
+			Build())
+	if e != nil {
+		return false, errors.Wrapf(e, "Error in Exists, path=%v", path)
+	}
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusMultiStatus, http.StatusOK:
+		logger.FromContext(ctx).Debugw("Exists", "result", true)
+		return true, nil
+	case http.StatusNotFound:
+		logger.FromContext(ctx).Debugw("Exists", "result", false)
+		return false, nil
+	default:
+		return false, errors.Errorf("Unexpected status code %v in Exists, path=%v", response.Status, path)
+	}
+}
+
+func (blobstore *Blobstore) HeadOrRedirectAsGet(ctx context.Context, path string) (redirectLocation string, err error) {
+	if blobstore.generic {
+		exists, e := blobstore.Exists(ctx, path)
+		if e != nil {
+			return "", e
+		}
+		if !exists {
+			return "", bitsgo.NewNotFoundError()
+		}
+		return "", nil
+	}
+	_, redirectLocation, e := blobstore.GetOrRedirect(ctx, path)
 	return redirectLocation, e
 }
 
-func (blobstore *Blobstore) Get(path string) (body io.ReadCloser, err error) {
-	exists, e := blobstore.Exists(path)
+func (blobstore *Blobstore) Get(ctx context.Context, path string) (body io.ReadCloser, err error) {
+	exists, e := blobstore.Exists(ctx, path)
 	if e != nil {
 		return nil, e
 	}
@@ -65,10 +112,11 @@ func (blobstore *Blobstore) Get(path string) (body io.ReadCloser, err error) {
 		return nil, bitsgo.NewNotFoundError()
 	}
 
-	response, e := blobstore.httpClient.Get(blobstore.webdavPrivateEndpoint + "/" + path)
+	response, e := blobstore.do(ctx,
+		blobstore.newRequestWithBasicAuth("GET", blobstore.webdavPrivateEndpoint+"/"+path, nil))
 
 	if e != nil {
-		return nil, errors.Wrapf(e, "path=%v")
+		return nil, errors.Wrapf(e, "path=%v", path)
 	}
 	if response.StatusCode != http.StatusOK {
 		return nil, errors.Errorf("Unexpected status code %v. Expected status OK", response.Status)
@@ -77,8 +125,12 @@ func (blobstore *Blobstore) Get(path string) (body io.ReadCloser, err error) {
 	return response.Body, nil
 }
 
-func (blobstore *Blobstore) GetOrRedirect(path string) (body io.ReadCloser, redirectLocation string, err error) {
-	exists, e := blobstore.Exists(path)
+func (blobstore *Blobstore) GetOrRedirect(ctx context.Context, path string) (body io.ReadCloser, redirectLocation string, err error) {
+	if blobstore.generic {
+		body, e := blobstore.Get(ctx, path)
+		return body, "", e
+	}
+	exists, e := blobstore.Exists(ctx, path)
 	if e != nil {
 		return nil, "", e
 	}
@@ -86,13 +138,22 @@ func (blobstore *Blobstore) GetOrRedirect(path string) (body io.ReadCloser, redi
 		return nil, "", bitsgo.NewNotFoundError()
 	}
 	// TODO use clock instead
-	signedUrl := blobstore.Sign(path, "get", time.Now().Add(1*time.Hour))
+	signedUrl, e := blobstore.Sign(path, "get", time.Now().Add(1*time.Hour))
+	if e != nil {
+		return nil, "", e
+	}
 	return nil, signedUrl, nil
 }
 
-func (blobstore *Blobstore) Put(path string, src io.ReadSeeker) error {
-	response, e := blobstore.httpClient.Do(
-		blobstore.newRequestWithBasicAuth("PUT", blobstore.webdavPrivateEndpoint+"/admin/"+path, src))
+func (blobstore *Blobstore) Put(ctx context.Context, path string, src io.ReadSeeker) error {
+	if blobstore.generic {
+		e := blobstore.createParentCollectionsOf(ctx, path)
+		if e != nil {
+			return e
+		}
+	}
+	response, e := blobstore.do(ctx,
+		blobstore.newRequestWithBasicAuth("PUT", blobstore.writeURLFor(path), src))
 	if e != nil {
 		return errors.Wrapf(e, "Request failed. path=%v", path)
 	}
@@ -102,18 +163,24 @@ func (blobstore *Blobstore) Put(path string, src io.ReadSeeker) error {
 	return nil
 }
 
-func (blobstore *Blobstore) PutOrRedirect(path string, src io.ReadSeeker) (redirectLocation string, err error) {
-	return "", blobstore.Put(path, src)
+func (blobstore *Blobstore) PutOrRedirect(ctx context.Context, path string, src io.ReadSeeker) (redirectLocation string, err error) {
+	return "", blobstore.Put(ctx, path, src)
 }
 
-func (blobstore *Blobstore) Copy(src, dest string) error {
-	_, e := blobstore.PutOrRedirect(dest, bytes.NewReader(nil))
+func (blobstore *Blobstore) Copy(ctx context.Context, src, dest string) error {
+	var e error
+	if blobstore.generic {
+		e = blobstore.createParentCollectionsOf(ctx, dest)
+	} else {
+		_, e = blobstore.PutOrRedirect(ctx, dest, bytes.NewReader(nil))
+	}
 	if e != nil {
 		return e
 	}
-	response, e := blobstore.httpClient.Do(
-		httputil.NewRequest("COPY", blobstore.webdavPrivateEndpoint+"/admin/"+src, nil).
-			WithHeader("Destination", blobstore.webdavPrivateEndpoint+"/admin/"+dest).
+	response, e := blobstore.do(ctx,
+		httputil.NewRequest("COPY", blobstore.writeURLFor(src), nil).
+			WithHeader("Destination", blobstore.writeURLFor(dest)).
+			WithHeader("Overwrite", "T").
 			WithBasicAuth(blobstore.webdavUsername, blobstore.webdavPassword).
 			Build())
 	if e != nil {
@@ -128,23 +195,29 @@ func (blobstore *Blobstore) Copy(src, dest string) error {
 	return nil
 }
 
-func (blobstore *Blobstore) Delete(path string) error {
-	response, e := blobstore.httpClient.Do(
-		blobstore.newRequestWithBasicAuth("DELETE", blobstore.webdavPrivateEndpoint+"/admin/"+path, nil))
+func (blobstore *Blobstore) Delete(ctx context.Context, path string) error {
+	response, e := blobstore.do(ctx,
+		blobstore.newRequestWithBasicAuth("DELETE", blobstore.writeURLFor(path), nil))
 	if e != nil {
 		return errors.Wrapf(e, "Request failed. path=%v", path)
 	}
+	if blobstore.generic && response.StatusCode == http.StatusNotFound {
+		return bitsgo.NewNotFoundError()
+	}
 	if response.StatusCode < 200 || response.StatusCode > 204 {
 		return errors.Errorf("Expected HTTP status code 200-204, but got status code: " + response.Status)
 	}
 	return nil
 }
 
-func (blobstore *Blobstore) DeleteDir(prefix string) error {
+func (blobstore *Blobstore) DeleteDir(ctx context.Context, prefix string) error {
+	if blobstore.generic {
+		return blobstore.deleteMembersOf(ctx, strings.TrimSuffix(prefix, "/"))
+	}
 	if prefix != "" {
 		prefix += "/"
 	}
-	response, e := blobstore.httpClient.Do(
+	response, e := blobstore.do(ctx,
 		blobstore.newRequestWithBasicAuth("DELETE", blobstore.webdavPrivateEndpoint+"/admin/"+prefix, nil))
 	if e != nil {
 		return errors.Wrapf(e, "Request failed. prefix=%v", prefix)
@@ -160,7 +233,11 @@ func (blobstore *Blobstore) DeleteDir(prefix string) error {
 	return nil
 }
 
-func (signer *Blobstore) Sign(resource string, method string, expirationTime time.Time) string {
+func (signer *Blobstore) Sign(resource string, method string, expirationTime time.Time) (string, error) {
+	if signer.generic {
+		// In generic mode, bits-service signs URLs itself and proxies requests to the WebDAV server.
+		return "", errors.New("WebDAV server in generic mode has no signing endpoint")
+	}
 	var url string
 	switch strings.ToLower(method) {
 	case "put":
@@ -168,24 +245,29 @@ func (signer *Blobstore) Sign(resource string, method string, expirationTime tim
 		url = fmt.Sprintf(signer.webdavPrivateEndpoint+"/sign_for_put?path=/%v&expires=%v", resource, expirationTime.Unix())
 	case "get":
 		url = fmt.Sprintf(signer.webdavPrivateEndpoint+"/sign?path=/%v&expires=%v", resource, expirationTime.Unix())
+	default:
+		return "", bitsgo.NewUnsupportedMethodError(method, "get", "put")
 	}
 	response, e := signer.httpClient.Do(
 		httputil.NewRequest("GET", url, nil).
 			WithBasicAuth(signer.webdavUsername, signer.webdavPassword).
 			Build())
 	if e != nil {
-		return "Error during signing. Error: " + e.Error()
+		return "", errors.Wrapf(e, "Error during signing. path=%v", resource)
 	}
+	defer response.Body.Close()
 	if response.StatusCode != http.StatusOK {
-		return "Error during signing. Error code: " + response.Status
+		return "", errors.Errorf("Error during signing. Expected status OK, but got status code: %v", response.Status)
 	}
-	defer response.Body.Close()
 	content, e := ioutil.ReadAll(response.Body)
 	if e != nil {
-		return "Error reading response body. Error: " + e.Error()
+		return "", errors.Wrapf(e, "Error reading response body. path=%v", resource)
 	}
 
-	signedUrl := httputil.MustParse(string(content))
+	signedUrl, e := neturl.ParseRequestURI(string(content))
+	if e != nil {
+		return "", errors.Wrapf(e, "Signing endpoint returned an invalid URL. path=%v", resource)
+	}
 
 	// TODO Is this really what we want to do?
 	signedUrl.Host = httputil.MustParse(signer.webdavPublicEndpoint).Host
@@ -197,7 +279,15 @@ func (signer *Blobstore) Sign(resource string, method string, expirationTime tim
 	//       for now to be functinally equivalent.
 	signedUrl.Scheme = "http"
 
-	return signedUrl.String()
+	return signedUrl.String(), nil
+}
+
+// do sends request bound to ctx, so that it is aborted when ctx is done, and passes on the request ID for correlation.
+func (blobstore *Blobstore) do(ctx context.Context, request *http.Request) (*http.Response, error) {
+	if vcapRequestID := util.VcapRequestIDFrom(ctx); vcapRequestID != "" {
+		request.Header.Set("X-Vcap-Request-Id", vcapRequestID)
+	}
+	return blobstore.httpClient.Do(request.WithContext(ctx))
 }
 
 func (blobstore *Blobstore) newRequestWithBasicAuth(method string, urlStr string, body io.Reader) *http.Request {
@@ -206,3 +296,109 @@ func (blobstore *Blobstore) newRequestWithBasicAuth(method string, urlStr string
 		WithBasicAuth(blobstore.webdavUsername, blobstore.webdavPassword).
 		Build()
 }
+
+func (blobstore *Blobstore) writeURLFor(path string) string {
+	if blobstore.generic {
+		return blobstore.webdavPrivateEndpoint + "/" + path
+	}
+	return blobstore.webdavPrivateEndpoint + "/admin/" + path
+}
+
+// createParentCollectionsOf creates all missing collections along path, because
+// standard WebDAV servers respond with 409 Conflict when PUTting into a non-existing collection.
+func (blobstore *Blobstore) createParentCollectionsOf(ctx context.Context, path string) error {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	collection := ""
+	for _, segment := range segments[:len(segments)-1] {
+		collection += segment + "/"
+		response, e := blobstore.do(ctx,
+			blobstore.newRequestWithBasicAuth("MKCOL", blobstore.webdavPrivateEndpoint+"/"+collection, nil))
+		if e != nil {
+			return errors.Wrapf(e, "Request failed. collection=%v", collection)
+		}
+		response.Body.Close()
+		// 405 Method Not Allowed means the collection exists already
+		if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusMethodNotAllowed {
+			return errors.Errorf("Could not create collection %v. Expected StatusCreated or StatusMethodNotAllowed, but got status code: %v", collection, response.Status)
+		}
+	}
+	return nil
+}
+
+func (blobstore *Blobstore) deleteMembersOf(ctx context.Context, collection string) error {
+	collectionURL := blobstore.webdavPrivateEndpoint + "/"
+	if collection != "" {
+		collectionURL += collection + "/"
+	}
+	memberURLs, e := blobstore.listMembersOf(ctx, collectionURL)
+	if e != nil {
+		return e
+	}
+	deletionErrs := []error{}
+	for _, memberURL := range memberURLs {
+		// DELETE on a collection deletes it including all its members
+		response, e := blobstore.do(ctx, blobstore.newRequestWithBasicAuth("DELETE", memberURL, nil))
+		if e != nil {
+			deletionErrs = append(deletionErrs, errors.Wrapf(e, "Request failed. url=%v", memberURL))
+			continue
+		}
+		response.Body.Close()
+		if (response.StatusCode < 200 || response.StatusCode > 204) && response.StatusCode != http.StatusNotFound {
+			deletionErrs = append(deletionErrs, errors.Errorf("Could not delete %v. Status code: %v", memberURL, response.Status))
+		}
+	}
+	if len(deletionErrs) != 0 {
+		return errors.Errorf("Prefix '%v', errors from deleting: %v", collection, deletionErrs)
+	}
+	return nil
+}
+
+const propfindResourceTypeBody = `<?xml version="1.0" encoding="utf-8"?><D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/></D:prop></D:propfind>`
+
+type multistatus struct {
+	Responses []struct {
+		Href string `xml:"DAV: href"`
+	} `xml:"DAV: response"`
+}
+
+// listMembersOf returns the absolute URLs of the direct members of the collection at collectionURL.
+func (blobstore *Blobstore) listMembersOf(ctx context.Context, collectionURL string) ([]string, error) {
+	response, e := blobstore.do(ctx,
+		httputil.NewRequest("PROPFIND", collectionURL, strings.NewReader(propfindResourceTypeBody)).
+			WithHeader("Depth", "1").
+			WithHeader("Content-Type", "application/xml").
+			WithBasicAuth(blobstore.webdavUsername, blobstore.webdavPassword).
+			Build())
+	if e != nil {
+		return nil, errors.Wrapf(e, "Request failed. url=%v", collectionURL)
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, bitsgo.NewNotFoundError()
+	}
+	if response.StatusCode != http.StatusMultiStatus {
+		return nil, errors.Errorf("Expected StatusMultiStatus, but got status code: %v", response.Status)
+	}
+
+	var result multistatus
+	e = xml.NewDecoder(response.Body).Decode(&result)
+	if e != nil {
+		return nil, errors.Wrapf(e, "Could not parse PROPFIND response. url=%v", collectionURL)
+	}
+
+	baseURL := httputil.MustParse(collectionURL)
+	memberURLs := []string{}
+	for _, r := range result.Responses {
+		href, e := neturl.Parse(r.Href)
+		if e != nil {
+			return nil, errors.Wrapf(e, "Invalid href in PROPFIND response: %v", r.Href)
+		}
+		memberURL := baseURL.ResolveReference(href)
+		// The collection itself is part of the response, too
+		if strings.TrimSuffix(memberURL.Path, "/") == strings.TrimSuffix(baseURL.Path, "/") {
+			continue
+		}
+		memberURLs = append(memberURLs, memberURL.String())
+	}
+	return memberURLs, nil
+}
@@ -0,0 +1,136 @@
+package webdav_test
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/blobstores/webdav"
+	"github.com/cloudfoundry-incubator/bits-service/config"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	xwebdav "golang.org/x/net/webdav"
+)
+
+var _ = Describe("Blobstore in generic mode", func() {
+	var (
+		webdavServer *httptest.Server
+		caCertFile   *os.File
+		blobstore    *webdav.Blobstore
+	)
+
+	BeforeEach(func() {
+		webdavServer = httptest.NewTLSServer(&xwebdav.Handler{
+			FileSystem: xwebdav.NewMemFS(),
+			LockSystem: xwebdav.NewMemLS(),
+		})
+
+		var e error
+		caCertFile, e = ioutil.TempFile("", "webdav_ca_cert.pem")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(pem.Encode(caCertFile, &pem.Block{Type: "CERTIFICATE", Bytes: webdavServer.Certificate().Raw})).To(Succeed())
+		Expect(caCertFile.Close()).To(Succeed())
+
+		blobstore = webdav.NewBlobstore(config.WebdavBlobstoreConfig{
+			PrivateEndpoint: webdavServer.URL,
+			PublicEndpoint:  webdavServer.URL,
+			CACertPath:      caCertFile.Name(),
+			Generic:         true,
+		})
+	})
+
+	AfterEach(func() {
+		webdavServer.Close()
+		os.Remove(caCertFile.Name())
+	})
+
+	It("can put, get and delete a resource in nested collections", func() {
+		Expect(blobstore.Exists(context.Background(), "ab/cd/some-guid")).To(BeFalse())
+
+		Expect(blobstore.Put(context.Background(), "ab/cd/some-guid", strings.NewReader("the file content"))).To(Succeed())
+
+		Expect(blobstore.Exists(context.Background(), "ab/cd/some-guid")).To(BeTrue())
+
+		body, e := blobstore.Get(context.Background(), "ab/cd/some-guid")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(ioutil.ReadAll(body)).To(MatchRegexp("the file content"))
+
+		Expect(blobstore.Put(context.Background(), "ab/cd/some-guid", strings.NewReader("the new file content"))).To(Succeed())
+
+		body, e = blobstore.Get(context.Background(), "ab/cd/some-guid")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(ioutil.ReadAll(body)).To(MatchRegexp("the new file content"))
+
+		Expect(blobstore.Delete(context.Background(), "ab/cd/some-guid")).To(Succeed())
+
+		Expect(blobstore.Exists(context.Background(), "ab/cd/some-guid")).To(BeFalse())
+	})
+
+	It("returns a NotFoundError for non-existing resources", func() {
+		_, e := blobstore.Get(context.Background(), "ab/cd/non-existing")
+		Expect(e).To(BeAssignableToTypeOf(&bitsgo.NotFoundError{}))
+
+		_, _, e = blobstore.GetOrRedirect(context.Background(), "ab/cd/non-existing")
+		Expect(e).To(BeAssignableToTypeOf(&bitsgo.NotFoundError{}))
+
+		_, e = blobstore.HeadOrRedirectAsGet(context.Background(), "ab/cd/non-existing")
+		Expect(e).To(BeAssignableToTypeOf(&bitsgo.NotFoundError{}))
+
+		Expect(blobstore.Delete(context.Background(), "ab/cd/non-existing")).To(BeAssignableToTypeOf(&bitsgo.NotFoundError{}))
+		Expect(blobstore.Copy(context.Background(), "ab/cd/non-existing", "ef/gh/other-guid")).To(BeAssignableToTypeOf(&bitsgo.NotFoundError{}))
+	})
+
+	It("serves content instead of redirecting to the WebDAV server", func() {
+		Expect(blobstore.Put(context.Background(), "ab/cd/some-guid", strings.NewReader("the file content"))).To(Succeed())
+
+		redirectLocation, e := blobstore.HeadOrRedirectAsGet(context.Background(), "ab/cd/some-guid")
+		Expect(redirectLocation, e).To(BeEmpty())
+
+		body, redirectLocation, e := blobstore.GetOrRedirect(context.Background(), "ab/cd/some-guid")
+		Expect(redirectLocation, e).To(BeEmpty())
+		Expect(ioutil.ReadAll(body)).To(MatchRegexp("the file content"))
+	})
+
+	It("can copy a resource into a non-existing collection", func() {
+		Expect(blobstore.Put(context.Background(), "ab/cd/some-guid", strings.NewReader("the file content"))).To(Succeed())
+
+		Expect(blobstore.Copy(context.Background(), "ab/cd/some-guid", "ef/gh/other-guid")).To(Succeed())
+		Expect(blobstore.Copy(context.Background(), "ab/cd/some-guid", "ef/gh/other-guid")).To(Succeed())
+
+		body, e := blobstore.Get(context.Background(), "ef/gh/other-guid")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(ioutil.ReadAll(body)).To(MatchRegexp("the file content"))
+	})
+
+	Describe("DeleteDir", func() {
+		BeforeEach(func() {
+			Expect(blobstore.Put(context.Background(), "buildpack_cache/ab/cd/app-guid/stack1", strings.NewReader("content"))).To(Succeed())
+			Expect(blobstore.Put(context.Background(), "buildpack_cache/ab/cd/app-guid/stack2", strings.NewReader("content"))).To(Succeed())
+			Expect(blobstore.Put(context.Background(), "buildpack_cache/ef/gh/other-app-guid/stack1", strings.NewReader("content"))).To(Succeed())
+		})
+
+		It("deletes all resources in the collection", func() {
+			Expect(blobstore.DeleteDir(context.Background(), "buildpack_cache/ab/cd/app-guid")).To(Succeed())
+
+			Expect(blobstore.Exists(context.Background(), "buildpack_cache/ab/cd/app-guid/stack1")).To(BeFalse())
+			Expect(blobstore.Exists(context.Background(), "buildpack_cache/ab/cd/app-guid/stack2")).To(BeFalse())
+			Expect(blobstore.Exists(context.Background(), "buildpack_cache/ef/gh/other-app-guid/stack1")).To(BeTrue())
+		})
+
+		It("deletes nested collections", func() {
+			Expect(blobstore.DeleteDir(context.Background(), "buildpack_cache/")).To(Succeed())
+
+			Expect(blobstore.Exists(context.Background(), "buildpack_cache/ab/cd/app-guid/stack1")).To(BeFalse())
+			Expect(blobstore.Exists(context.Background(), "buildpack_cache/ef/gh/other-app-guid/stack1")).To(BeFalse())
+			Expect(blobstore.Exists(context.Background(), "buildpack_cache")).To(BeTrue())
+		})
+
+		It("returns a NotFoundError when the collection does not exist", func() {
+			Expect(blobstore.DeleteDir(context.Background(), "non-existing")).To(BeAssignableToTypeOf(&bitsgo.NotFoundError{}))
+		})
+	})
+})
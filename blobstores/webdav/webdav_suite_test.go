@@ -0,0 +1,13 @@
+package webdav_test
+
+import (
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestWebdavBlobstore(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "WebdavBlobstore")
+}
@@ -2,25 +2,58 @@ package ccupdater
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/cenkalti/backoff"
 
 	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
 
 	"github.com/cloudfoundry-incubator/bits-service"
 
 	"github.com/pkg/errors"
 )
 
+// States of uploads as reported to the Cloud Controller. Payload templates are configured per state.
+const (
+	StateProcessingUpload = "PROCESSING_UPLOAD"
+	StateReady            = "READY"
+	StateFailed           = "FAILED"
+)
+
+const (
+	// PayloadFormatChecksums sends checksums as a list: {"state": "READY", "checksums": [{"type": "sha1", "value": "..."}, ...]}
+	PayloadFormatChecksums = "checksums"
+	// PayloadFormatFlat sends checksums as properties: {"state": "READY", "sha1": "...", "sha256": "..."}
+	PayloadFormatFlat = "flat"
+)
+
 type CCUpdater struct {
-	httpClient HttpClient
-	endpoint   string
-	method     string
+	httpClient     HttpClient
+	endpoint       string
+	method         string
+	payloadFormat  string
+	newBackOff     func() backoff.BackOff
+	metricsService bitsgo.MetricsService
+
+	tokenSource        TokenSource
+	payloadTemplates   map[string]*template.Template
+	successStatusCodes []int
+
+	// deadLetterMutex makes sure that a redelivery does not overtake a newer notification for the same guid.
+	deadLetterMutex sync.Mutex
+	deadLetters     *DeadLetterQueue
 }
 
 type processingUploadPayload struct {
@@ -37,6 +70,12 @@ type successPayload struct {
 	Checksums []checksum `json:"checksums"`
 }
 
+type flatSuccessPayload struct {
+	State  string `json:"state"`
+	Sha1   string `json:"sha1"`
+	Sha256 string `json:"sha256"`
+}
+
 type failurePayload struct {
 	State string `json:"state"`
 	Error string `json:"error"`
@@ -46,7 +85,7 @@ type HttpClient interface {
 	Do(*http.Request) (*http.Response, error)
 }
 
-func NewCCUpdater(endpoint string, method string, clientCertFile string, clientKeyFile string, caCertFile string) *CCUpdater {
+func NewCCUpdater(endpoint string, method string, timeout time.Duration, clientCertFile string, clientKeyFile string, caCertFile string) *CCUpdater {
 	u, e := url.Parse(endpoint)
 	if e != nil {
 		logger.Log.Fatalw("Could not parse endpoint", "endpoint", endpoint, "error", e)
@@ -58,77 +97,355 @@ func NewCCUpdater(endpoint string, method string, clientCertFile string, clientK
 	}
 	return NewCCUpdaterWithHttpClient(endpoint, method, &http.Client{
 		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		Timeout:   timeout,
 	})
 }
 
+// NewCCUpdaterWithHttpClient creates an updater which tries each notification only once. See WithRetries.
 func NewCCUpdaterWithHttpClient(endpoint string, method string, httpClient HttpClient) *CCUpdater {
 	return &CCUpdater{
-		httpClient: httpClient,
-		endpoint:   endpoint,
-		method:     method,
+		httpClient:       httpClient,
+		endpoint:         endpoint,
+		method:           method,
+		payloadFormat:    PayloadFormatChecksums,
+		newBackOff:       func() backoff.BackOff { return &backoff.StopBackOff{} },
+		metricsService:   nullMetricsService{},
+		payloadTemplates: make(map[string]*template.Template),
 	}
 }
 
-func loadTLSConfig(clientCertFile string, clientKeyFile string, caCertFile string) *tls.Config {
-	cert, e := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
-	if e != nil {
-		logger.Log.Fatalw("Could not load X509 key pair", "error", e, "client-cert-file", clientCertFile, "client-key-file", clientKeyFile)
+// WithRetries retries notifications which fail because of connection errors or 5xx responses up to maxRetries
+// times, with exponentially growing intervals between initialInterval and maxInterval.
+func (updater *CCUpdater) WithRetries(maxRetries uint64, initialInterval time.Duration, maxInterval time.Duration) *CCUpdater {
+	updater.newBackOff = func() backoff.BackOff {
+		exponentialBackOff := backoff.NewExponentialBackOff()
+		exponentialBackOff.InitialInterval = initialInterval
+		exponentialBackOff.MaxInterval = maxInterval
+		exponentialBackOff.MaxElapsedTime = 0
+		return backoff.WithMaxRetries(exponentialBackOff, maxRetries)
 	}
+	return updater
+}
 
-	caCert, e := ioutil.ReadFile(caCertFile)
-	if e != nil {
-		logger.Log.Fatalw("Could not read CA Cert file", "error", e, "ca-cert-file", caCertFile)
+// WithDeadLetterQueue keeps notifications about completed uploads which could not be delivered even after
+// retrying, so that Redeliver can send them once the Cloud Controller is reachable again.
+func (updater *CCUpdater) WithDeadLetterQueue(deadLetters *DeadLetterQueue) *CCUpdater {
+	updater.deadLetters = deadLetters
+	return updater
+}
+
+// WithPayloadFormat selects how checksums are sent. Either PayloadFormatChecksums, the default, or PayloadFormatFlat.
+func (updater *CCUpdater) WithPayloadFormat(payloadFormat string) *CCUpdater {
+	updater.payloadFormat = payloadFormat
+	return updater
+}
+
+// WithTokenSource authenticates requests with a bearer token, e.g. from UAA, in addition to any client certificate.
+func (updater *CCUpdater) WithTokenSource(tokenSource TokenSource) *CCUpdater {
+	updater.tokenSource = tokenSource
+	return updater
+}
+
+// WithPayloadTemplate replaces the payload for state, which is one of StateProcessingUpload, StateReady and
+// StateFailed. See ParsePayloadTemplate.
+func (updater *CCUpdater) WithPayloadTemplate(state string, payloadTemplate *template.Template) *CCUpdater {
+	updater.payloadTemplates[state] = payloadTemplate
+	return updater
+}
+
+// WithSuccessStatusCodes only accepts responses with one of successStatusCodes. By default, any response with a
+// status code below 400 is a success.
+func (updater *CCUpdater) WithSuccessStatusCodes(successStatusCodes []int) *CCUpdater {
+	updater.successStatusCodes = successStatusCodes
+	return updater
+}
+
+func (updater *CCUpdater) WithMetricsService(metricsService bitsgo.MetricsService) *CCUpdater {
+	updater.metricsService = metricsService
+	return updater
+}
+
+// loadTLSConfig only presents a client certificate if clientCertFile is set, e.g. not when using a TokenSource
+// instead. Without caCertFile, the system's root CAs are used.
+func loadTLSConfig(clientCertFile string, clientKeyFile string, caCertFile string) *tls.Config {
+	tlsConfig := &tls.Config{}
+	if clientCertFile != "" {
+		cert, e := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+		if e != nil {
+			logger.Log.Fatalw("Could not load X509 key pair", "error", e, "client-cert-file", clientCertFile, "client-key-file", clientKeyFile)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(caCert)
 
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		RootCAs:      caCertPool,
+	if caCertFile != "" {
+		caCert, e := ioutil.ReadFile(caCertFile)
+		if e != nil {
+			logger.Log.Fatalw("Could not read CA Cert file", "error", e, "ca-cert-file", caCertFile)
+		}
+		caCertPool := x509.NewCertPool()
+		caCertPool.AppendCertsFromPEM(caCert)
+		tlsConfig.RootCAs = caCertPool
 	}
 	tlsConfig.BuildNameToCertificate()
 	return tlsConfig
 }
 
-func (updater *CCUpdater) NotifyProcessingUpload(guid string) error {
-	return updater.update(guid, processingUploadPayload{"PROCESSING_UPLOAD"})
+// NotifyProcessingUpload is not dead-lettered: the upload request fails instead, so that the client can retry it.
+func (updater *CCUpdater) NotifyProcessingUpload(ctx context.Context, guid string) error {
+	return updater.update(ctx, PayloadData{Guid: guid, State: StateProcessingUpload}, false)
 }
 
-func (updater *CCUpdater) NotifyUploadSucceeded(guid string, sha1 string, sha256 string) error {
-	return updater.update(guid, successPayload{
-		"READY",
-		[]checksum{
-			checksum{Type: "sha1", Value: sha1},
-			checksum{Type: "sha256", Value: sha256},
-		},
-	})
+func (updater *CCUpdater) NotifyUploadSucceeded(ctx context.Context, guid string, sha1 string, sha256 string) error {
+	return updater.update(ctx, PayloadData{Guid: guid, State: StateReady, Sha1: sha1, Sha256: sha256}, true)
 }
 
-func (updater *CCUpdater) NotifyUploadFailed(guid string, e error) error {
-	return updater.update(guid, failurePayload{"FAILED", e.Error()})
+func (updater *CCUpdater) NotifyUploadFailed(ctx context.Context, guid string, e error) error {
+	return updater.update(ctx, PayloadData{Guid: guid, State: StateFailed, Error: e.Error()}, true)
 }
 
-func (updater *CCUpdater) update(guid string, p interface{}) error {
+func (updater *CCUpdater) payload(data PayloadData) ([]byte, error) {
+	if payloadTemplate, exists := updater.payloadTemplates[data.State]; exists {
+		return renderPayload(payloadTemplate, data)
+	}
+	var p interface{}
+	switch {
+	case data.State == StateProcessingUpload:
+		p = processingUploadPayload{data.State}
+	case data.State == StateReady && updater.payloadFormat == PayloadFormatFlat:
+		p = flatSuccessPayload{data.State, data.Sha1, data.Sha256}
+	case data.State == StateReady:
+		p = successPayload{
+			data.State,
+			[]checksum{
+				checksum{Type: "sha1", Value: data.Sha1},
+				checksum{Type: "sha256", Value: data.Sha256},
+			},
+		}
+	default:
+		p = failurePayload{data.State, data.Error}
+	}
 	payload, e := json.Marshal(p)
 	if e != nil {
 		logger.Log.Fatalw("Unexpected error in CC Updater update when marshalling payload",
-			"error", e, "guid", guid, "payload", p)
+			"error", e, "guid", data.Guid, "payload", p)
+	}
+	return payload, nil
+}
+
+// requestHeaders passes on the request ID and trace headers of the upload request, so that the Cloud Controller
+// can correlate the notification with it.
+func requestHeaders(ctx context.Context) http.Header {
+	headers := make(http.Header)
+	for name, values := range util.TraceHeadersFromContext(ctx) {
+		headers[name] = values
+	}
+	if vcapRequestID := util.VcapRequestIDFrom(ctx); vcapRequestID != "" {
+		headers.Set("X-Vcap-Request-Id", vcapRequestID)
+	}
+	return headers
+}
+
+func (updater *CCUpdater) update(ctx context.Context, data PayloadData, deadLetterOnFailure bool) error {
+	guid := data.Guid
+	payload, e := updater.payload(data)
+	if e != nil {
+		return e
+	}
+	headers := requestHeaders(ctx)
+
+	if updater.deadLetters != nil {
+		// This notification supersedes any dead-lettered one for the same guid.
+		updater.deadLetterMutex.Lock()
+		e = updater.deadLetters.Remove(guid)
+		updater.deadLetterMutex.Unlock()
+		if e != nil {
+			logger.Log.Errorw("Could not remove superseded dead letter", "guid", guid, "error", e)
+		}
+	}
+
+	attempts := 0
+	e = backoff.RetryNotify(func() error {
+		attempts++
+		e := updater.send(ctx, guid, payload, headers)
+		if e != nil && !isRetryable(e) {
+			return backoff.Permanent(e)
+		}
+		return e
+	}, backoff.WithContext(updater.newBackOff(), ctx), func(e error, backOffDelay time.Duration) {
+		logger.Log.Infow("Retrying CC notification", "guid", guid, "error", e, "back-off-delay", backOffDelay)
+		updater.metricsService.SendCounterMetric("ccUpdater.retries", 1)
+	})
+	if e == nil {
+		return nil
 	}
+	updater.metricsService.SendCounterMetric("ccUpdater.failures", 1)
+	if !isRetryable(e) || !deadLetterOnFailure || updater.deadLetters == nil {
+		return e
+	}
+
+	updater.deadLetterMutex.Lock()
+	putError := updater.deadLetters.Put(DeadLetter{
+		Guid:           guid,
+		Payload:        payload,
+		Headers:        headers,
+		Attempts:       attempts,
+		LastError:      e.Error(),
+		DeadLetteredAt: time.Now().UTC(),
+	})
+	updater.deadLetterMutex.Unlock()
+	if putError != nil {
+		logger.Log.Errorw("Could not dead-letter CC notification", "guid", guid, "error", putError)
+		return e
+	}
+	logger.Log.Errorw("Dead-lettered CC notification. It will be redelivered.", "guid", guid, "error", e)
+	updater.metricsService.SendCounterMetric("ccUpdater.deadLettered", 1)
+	return e
+}
 
+// send makes a single request. Connection errors, 5xx responses and 401 responses, after which a new token is
+// requested, are retryable. Other 4xx responses are not.
+func (updater *CCUpdater) send(ctx context.Context, guid string, payload []byte, headers http.Header) error {
 	r, e := http.NewRequest(updater.method, strings.TrimRight(updater.endpoint, "/")+"/"+guid, bytes.NewReader(payload))
 	if e != nil {
 		logger.Log.Fatalw("Unexpected error in CC Updater update when creating new request",
-			"error", e, "guid", guid, "payload", p)
+			"error", e, "guid", guid, "payload", string(payload))
+	}
+	r = r.WithContext(ctx)
+	for name, values := range headers {
+		r.Header[name] = values
 	}
+	r.Header.Set("Content-Type", "application/json")
+	if updater.tokenSource != nil {
+		token, e := updater.tokenSource.Token()
+		if e != nil {
+			return e
+		}
+		r.Header.Set("Authorization", "bearer "+token)
+	}
+	updater.metricsService.SendCounterMetric("ccUpdater.attempts", 1)
 	resp, e := updater.httpClient.Do(r)
 	if e != nil {
-		return errors.Wrapf(e, "Could not make request against CC (GUID: \"%v\")", guid)
+		return &retryableError{errors.Wrapf(e, "Could not make request against CC (GUID: \"%v\")", guid)}
 	}
-	if resp.StatusCode == http.StatusNotFound {
-		return bitsgo.NewNotFoundError()
+	if resp.Body != nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
 	}
-	if resp.StatusCode == http.StatusUnprocessableEntity {
+	switch {
+	case updater.isSuccess(resp.StatusCode):
+		return nil
+	case resp.StatusCode == http.StatusUnauthorized && updater.tokenSource != nil:
+		updater.tokenSource.Invalidate()
+		return &retryableError{errors.Errorf("CC rejected token with status code %v (GUID: \"%v\")", resp.StatusCode, guid)}
+	case resp.StatusCode == http.StatusNotFound:
+		return bitsgo.NewNotFoundError()
+	case resp.StatusCode == http.StatusUnprocessableEntity:
 		return bitsgo.NewStateForbiddenError()
+	case resp.StatusCode >= 500:
+		return &retryableError{errors.Errorf("CC responded with status code %v (GUID: \"%v\")", resp.StatusCode, guid)}
+	case resp.StatusCode >= 400:
+		return errors.Errorf("CC rejected notification with status code %v (GUID: \"%v\")", resp.StatusCode, guid)
+	}
+	return errors.Errorf("CC responded with unexpected status code %v (GUID: \"%v\")", resp.StatusCode, guid)
+}
+
+func (updater *CCUpdater) isSuccess(statusCode int) bool {
+	if len(updater.successStatusCodes) == 0 {
+		return statusCode < 400
+	}
+	for _, successStatusCode := range updater.successStatusCodes {
+		if statusCode == successStatusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// Redeliver sends each dead-lettered notification once. Delivered notifications and the ones which the Cloud
+// Controller rejects are removed from the dead letter queue. The others are kept for the next redelivery.
+func (updater *CCUpdater) Redeliver() {
+	if updater.deadLetters == nil {
+		return
+	}
+	deadLetters, e := updater.deadLetters.List()
+	if e != nil {
+		logger.Log.Errorw("Could not list dead-lettered CC notifications", "error", e)
+		return
+	}
+	for _, deadLetter := range deadLetters {
+		updater.redeliver(deadLetter.Guid)
+	}
+	remaining, e := updater.deadLetters.List()
+	if e == nil {
+		updater.metricsService.SendGaugeMetric("ccUpdater.deadLetters", int64(len(remaining)))
+	}
+}
+
+func (updater *CCUpdater) redeliver(guid string) {
+	updater.deadLetterMutex.Lock()
+	defer updater.deadLetterMutex.Unlock()
+
+	// Reloading makes sure that a newer notification has not superseded the dead letter in the meantime.
+	deadLetter, exists, e := updater.deadLetters.Get(guid)
+	if e != nil {
+		logger.Log.Errorw("Could not load dead-lettered CC notification", "guid", guid, "error", e)
+		return
+	}
+	if !exists {
+		return
 	}
-	return nil
+
+	e = updater.send(context.Background(), guid, deadLetter.Payload, deadLetter.Headers)
+	if e != nil && isRetryable(e) {
+		deadLetter.Attempts++
+		deadLetter.LastError = e.Error()
+		putError := updater.deadLetters.Put(deadLetter)
+		if putError != nil {
+			logger.Log.Errorw("Could not update dead-lettered CC notification", "guid", guid, "error", putError)
+		}
+		logger.Log.Infow("Could not redeliver CC notification", "guid", guid, "attempts", deadLetter.Attempts, "error", e)
+		updater.metricsService.SendCounterMetric("ccUpdater.redeliveryFailures", 1)
+		return
+	}
+
+	if e != nil {
+		logger.Log.Errorw("CC rejected redelivered notification. Discarding it.", "guid", guid, "error", e)
+		updater.metricsService.SendCounterMetric("ccUpdater.discarded", 1)
+	} else {
+		logger.Log.Infow("Redelivered CC notification", "guid", guid, "attempts", deadLetter.Attempts+1)
+		updater.metricsService.SendCounterMetric("ccUpdater.redelivered", 1)
+	}
+	e = updater.deadLetters.Remove(guid)
+	if e != nil {
+		logger.Log.Errorw("Could not remove redelivered CC notification", "guid", guid, "error", e)
+	}
+}
+
+// RedeliverRegularly calls Redeliver every interval until stop is closed.
+func (updater *CCUpdater) RedeliverRegularly(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			updater.Redeliver()
+		case <-stop:
+			return
+		}
+	}
+}
+
+type retryableError struct {
+	error
+}
+
+func isRetryable(e error) bool {
+	_, retryable := e.(*retryableError)
+	return retryable
 }
+
+type nullMetricsService struct{}
+
+func (nullMetricsService) SendTimingMetric(name string, duration time.Duration) {}
+func (nullMetricsService) SendGaugeMetric(name string, value int64)             {}
+func (nullMetricsService) SendCounterMetric(name string, value int64)           {}
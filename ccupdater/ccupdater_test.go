@@ -1,11 +1,19 @@
 package ccupdater_test
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/benbjohnson/clock"
 	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/util"
 
 	. "github.com/cloudfoundry-incubator/bits-service/ccupdater"
 	. "github.com/cloudfoundry-incubator/bits-service/ccupdater/matchers"
@@ -27,7 +35,7 @@ var _ = Describe("CCUpdater", func() {
 		It("works", func() {
 			When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(&http.Response{}, nil)
 
-			e := updater.NotifyProcessingUpload("abc")
+			e := updater.NotifyProcessingUpload(context.Background(), "abc")
 
 			Expect(e).NotTo(HaveOccurred())
 
@@ -41,7 +49,7 @@ var _ = Describe("CCUpdater", func() {
 			It("fails with a generic error", func() {
 				When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(nil, fmt.Errorf("Some network error"))
 
-				e := updater.NotifyProcessingUpload("abc")
+				e := updater.NotifyProcessingUpload(context.Background(), "abc")
 
 				Expect(e).To(MatchError(SatisfyAll(
 					ContainSubstring("Could not make request against CC"),
@@ -55,7 +63,7 @@ var _ = Describe("CCUpdater", func() {
 			It("fails with a generic error", func() {
 				When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(&http.Response{StatusCode: http.StatusNotFound}, nil)
 
-				e := updater.NotifyProcessingUpload("abc")
+				e := updater.NotifyProcessingUpload(context.Background(), "abc")
 
 				Expect(e).To(Equal(bitsgo.NewNotFoundError()))
 			})
@@ -66,7 +74,7 @@ var _ = Describe("CCUpdater", func() {
 		It("works", func() {
 			When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(&http.Response{}, nil)
 
-			e := updater.NotifyUploadSucceeded("abc", "sha1", "sha256")
+			e := updater.NotifyUploadSucceeded(context.Background(), "abc", "sha1", "sha256")
 
 			Expect(e).NotTo(HaveOccurred())
 
@@ -87,13 +95,24 @@ var _ = Describe("CCUpdater", func() {
 				]
 			  }`))
 		})
+		Context("flat payload format", func() {
+			It("sends the checksums as top-level fields", func() {
+				When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(&http.Response{}, nil)
+
+				e := updater.WithPayloadFormat(PayloadFormatFlat).NotifyUploadSucceeded(context.Background(), "abc", "sha1", "sha256")
+
+				Expect(e).NotTo(HaveOccurred())
+				request := httpClient.VerifyWasCalledOnce().Do(AnyPtrToHttpRequest()).GetCapturedArguments()
+				Expect(ioutil.ReadAll(request.Body)).To(MatchJSON(`{"state": "READY", "sha1": "sha1", "sha256": "sha256"}`))
+			})
+		})
 	})
 
 	Describe("NotifyUploadFailed", func() {
 		It("works", func() {
 			When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(&http.Response{}, nil)
 
-			e := updater.NotifyUploadFailed("abc", fmt.Errorf("some error"))
+			e := updater.NotifyUploadFailed(context.Background(), "abc", fmt.Errorf("some error"))
 
 			Expect(e).NotTo(HaveOccurred())
 
@@ -106,4 +125,337 @@ var _ = Describe("CCUpdater", func() {
 			  }`))
 		})
 	})
+	Describe("retries", func() {
+		var metricsService *recordingMetricsService
+
+		BeforeEach(func() {
+			metricsService = &recordingMetricsService{counters: make(map[string]int64)}
+			updater.WithRetries(2, time.Millisecond, time.Millisecond).WithMetricsService(metricsService)
+		})
+
+		It("retries 5xx responses until it succeeds", func() {
+			When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(&http.Response{StatusCode: http.StatusBadGateway}, nil).
+				ThenReturn(&http.Response{StatusCode: http.StatusOK}, nil)
+
+			e := updater.NotifyUploadSucceeded(context.Background(), "abc", "sha1", "sha256")
+
+			Expect(e).NotTo(HaveOccurred())
+			requests := httpClient.VerifyWasCalled(Times(2)).Do(AnyPtrToHttpRequest()).GetAllCapturedArguments()
+			By("sending the complete payload with each attempt")
+			Expect(ioutil.ReadAll(requests[1].Body)).To(MatchJSON(`{
+				"state": "READY",
+				"checksums": [{"type": "sha1", "value": "sha1"}, {"type": "sha256", "value": "sha256"}]
+			}`))
+			Expect(metricsService.counters).To(HaveKeyWithValue("ccUpdater.attempts", int64(2)))
+			Expect(metricsService.counters).To(HaveKeyWithValue("ccUpdater.retries", int64(1)))
+		})
+
+		It("retries connection errors and fails once the retries are exhausted", func() {
+			When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(nil, fmt.Errorf("Some network error"))
+
+			e := updater.NotifyProcessingUpload(context.Background(), "abc")
+
+			Expect(e).To(MatchError(ContainSubstring("Some network error")))
+			httpClient.VerifyWasCalled(Times(3)).Do(AnyPtrToHttpRequest())
+			Expect(metricsService.counters).To(HaveKeyWithValue("ccUpdater.failures", int64(1)))
+		})
+
+		It("does not retry 4xx responses", func() {
+			When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(&http.Response{StatusCode: http.StatusBadRequest}, nil)
+
+			e := updater.NotifyProcessingUpload(context.Background(), "abc")
+
+			Expect(e).To(MatchError(ContainSubstring("CC rejected notification with status code 400")))
+			httpClient.VerifyWasCalledOnce().Do(AnyPtrToHttpRequest())
+		})
+
+		It("does not retry NotFound", func() {
+			When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(&http.Response{StatusCode: http.StatusNotFound}, nil)
+
+			e := updater.NotifyProcessingUpload(context.Background(), "abc")
+
+			Expect(e).To(Equal(bitsgo.NewNotFoundError()))
+			httpClient.VerifyWasCalledOnce().Do(AnyPtrToHttpRequest())
+		})
+
+		It("stops retrying once the context is done and sends the requests with it", func() {
+			updater.WithRetries(2, time.Hour, time.Hour)
+			When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(nil, fmt.Errorf("Some network error"))
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			e := updater.NotifyProcessingUpload(ctx, "abc")
+
+			Expect(e).To(MatchError(ContainSubstring("Some network error")))
+			request := httpClient.VerifyWasCalledOnce().Do(AnyPtrToHttpRequest()).GetCapturedArguments()
+			Expect(request.Context()).To(Equal(ctx))
+		})
+	})
+
+	Describe("dead letter queue", func() {
+		var (
+			metricsService *recordingMetricsService
+			deadLetterDir  string
+			deadLetters    *DeadLetterQueue
+		)
+
+		BeforeEach(func() {
+			var e error
+			deadLetterDir, e = ioutil.TempDir("", "cc-dead-letters")
+			Expect(e).NotTo(HaveOccurred())
+			deadLetters, e = NewDeadLetterQueue(deadLetterDir)
+			Expect(e).NotTo(HaveOccurred())
+			metricsService = &recordingMetricsService{counters: make(map[string]int64)}
+			updater.WithRetries(1, time.Millisecond, time.Millisecond).
+				WithDeadLetterQueue(deadLetters).
+				WithMetricsService(metricsService)
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(deadLetterDir)
+		})
+
+		It("dead-letters completed uploads which cannot be notified and redelivers them", func() {
+			When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(&http.Response{StatusCode: http.StatusServiceUnavailable}, nil)
+
+			e := updater.NotifyUploadFailed(context.Background(), "abc", fmt.Errorf("some error"))
+
+			Expect(e).To(MatchError(ContainSubstring("CC responded with status code 503")))
+			Expect(deadLetters.List()).To(HaveLen(1))
+			deadLetter, exists, e := deadLetters.Get("abc")
+			Expect(e).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue())
+			Expect(deadLetter.Attempts).To(Equal(2))
+			Expect([]byte(deadLetter.Payload)).To(MatchJSON(`{"state": "FAILED", "error": "some error"}`))
+			Expect(metricsService.counters).To(HaveKeyWithValue("ccUpdater.deadLettered", int64(1)))
+
+			By("keeping it while the CC is still unavailable")
+			updater.Redeliver()
+
+			deadLetter, exists, e = deadLetters.Get("abc")
+			Expect(e).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue())
+			Expect(deadLetter.Attempts).To(Equal(3))
+			Expect(metricsService.counters).To(HaveKeyWithValue("ccUpdater.redeliveryFailures", int64(1)))
+
+			By("removing it once it has been redelivered")
+			When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(&http.Response{StatusCode: http.StatusOK}, nil)
+
+			updater.Redeliver()
+
+			Expect(deadLetters.List()).To(BeEmpty())
+			Expect(metricsService.counters).To(HaveKeyWithValue("ccUpdater.redelivered", int64(1)))
+			Expect(metricsService.gauges).To(HaveKeyWithValue("ccUpdater.deadLetters", int64(0)))
+			requests := httpClient.VerifyWasCalled(Times(4)).Do(AnyPtrToHttpRequest()).GetAllCapturedArguments()
+			Expect(ioutil.ReadAll(requests[3].Body)).To(MatchJSON(`{"state": "FAILED", "error": "some error"}`))
+		})
+
+		It("discards dead letters which the CC rejects", func() {
+			Expect(deadLetters.Put(DeadLetter{Guid: "abc", Payload: []byte(`{"state":"READY"}`)})).To(Succeed())
+			When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(&http.Response{StatusCode: http.StatusNotFound}, nil)
+
+			updater.Redeliver()
+
+			Expect(deadLetters.List()).To(BeEmpty())
+			Expect(metricsService.counters).To(HaveKeyWithValue("ccUpdater.discarded", int64(1)))
+		})
+
+		It("does not dead-letter processing notifications", func() {
+			When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(nil, fmt.Errorf("Some network error"))
+
+			Expect(updater.NotifyProcessingUpload(context.Background(), "abc")).NotTo(Succeed())
+
+			Expect(deadLetters.List()).To(BeEmpty())
+		})
+
+		It("does not dead-letter rejected notifications", func() {
+			When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(&http.Response{StatusCode: http.StatusUnprocessableEntity}, nil)
+
+			Expect(updater.NotifyUploadSucceeded(context.Background(), "abc", "sha1", "sha256")).NotTo(Succeed())
+
+			Expect(deadLetters.List()).To(BeEmpty())
+		})
+
+		It("drops a dead letter once a newer notification for the same guid is sent", func() {
+			Expect(deadLetters.Put(DeadLetter{Guid: "abc", Payload: []byte(`{"state":"FAILED"}`)})).To(Succeed())
+			When(httpClient.Do(AnyPtrToHttpRequest())).ThenReturn(&http.Response{StatusCode: http.StatusOK}, nil)
+
+			Expect(updater.NotifyUploadSucceeded(context.Background(), "abc", "sha1", "sha256")).To(Succeed())
+			updater.Redeliver()
+
+			Expect(deadLetters.List()).To(BeEmpty())
+			httpClient.VerifyWasCalledOnce().Do(AnyPtrToHttpRequest())
+		})
+
+		It("keeps dead letters across restarts and discards invalid ones", func() {
+			Expect(deadLetters.Put(DeadLetter{Guid: "abc", Payload: []byte(`{"state":"READY"}`)})).To(Succeed())
+			Expect(ioutil.WriteFile(deadLetterDir+"/invalid.json", []byte("not json"), 0600)).To(Succeed())
+
+			restarted, e := NewDeadLetterQueue(deadLetterDir)
+			Expect(e).NotTo(HaveOccurred())
+
+			Expect(restarted.List()).To(ConsistOf(DeadLetter{Guid: "abc", Payload: []byte(`{"state":"READY"}`)}))
+			Expect(deadLetterDir + "/invalid.json").NotTo(BeAnExistingFile())
+		})
+	})
+})
+
+var _ = Describe("CCUpdater against a fake Cloud Controller", func() {
+	var (
+		server        *httptest.Server
+		mutex         sync.Mutex
+		tokenRequests int
+		ccRequests    []*http.Request
+		ccBodies      []string
+		ccStatusCodes []int
+		updater       *CCUpdater
+	)
+
+	BeforeEach(func() {
+		tokenRequests = 0
+		ccRequests = nil
+		ccBodies = nil
+		ccStatusCodes = nil
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/oauth/token", func(responseWriter http.ResponseWriter, request *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			clientID, clientSecret, _ := request.BasicAuth()
+			if clientID != "bits-service" || clientSecret != "some-secret" || request.FormValue("grant_type") != "client_credentials" {
+				responseWriter.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			tokenRequests++
+			fmt.Fprintf(responseWriter, `{"access_token": "token-%v", "token_type": "bearer", "expires_in": 3600}`, tokenRequests)
+		})
+		mux.HandleFunc("/internal/v4/packages/", func(responseWriter http.ResponseWriter, request *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			body, e := ioutil.ReadAll(request.Body)
+			Expect(e).NotTo(HaveOccurred())
+			ccRequests = append(ccRequests, request)
+			ccBodies = append(ccBodies, string(body))
+			if len(ccStatusCodes) > 0 {
+				responseWriter.WriteHeader(ccStatusCodes[0])
+				ccStatusCodes = ccStatusCodes[1:]
+			}
+		})
+		server = httptest.NewServer(mux)
+
+		updater = NewCCUpdater(server.URL+"/internal/v4/packages", "PUT", time.Second, "", "", "").
+			WithTokenSource(NewUAATokenSource(server.URL+"/oauth/token", "bits-service", "some-secret", time.Second, ""))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("authenticates with a cached UAA token and passes on the request ID and trace headers", func() {
+		ctx := util.WithVcapRequestID(context.Background(), "some-request-id")
+		ctx = util.WithTraceHeaders(ctx, http.Header{"Traceparent": {"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}})
+
+		Expect(updater.NotifyProcessingUpload(ctx, "abc")).To(Succeed())
+		Expect(updater.NotifyUploadSucceeded(ctx, "abc", "sha1", "sha256")).To(Succeed())
+
+		Expect(tokenRequests).To(Equal(1))
+		Expect(ccRequests).To(HaveLen(2))
+		for _, request := range ccRequests {
+			Expect(request.Method).To(Equal("PUT"))
+			Expect(request.URL.Path).To(Equal("/internal/v4/packages/abc"))
+			Expect(request.Header.Get("Authorization")).To(Equal("bearer token-1"))
+			Expect(request.Header.Get("Content-Type")).To(Equal("application/json"))
+			Expect(request.Header.Get("X-Vcap-Request-Id")).To(Equal("some-request-id"))
+			Expect(request.Header.Get("Traceparent")).To(Equal("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"))
+		}
+	})
+
+	It("requests a new token when the Cloud Controller rejects the cached one", func() {
+		updater.WithRetries(1, time.Millisecond, time.Millisecond)
+		ccStatusCodes = []int{http.StatusUnauthorized, http.StatusOK}
+
+		Expect(updater.NotifyProcessingUpload(context.Background(), "abc")).To(Succeed())
+
+		Expect(tokenRequests).To(Equal(2))
+		Expect(ccRequests[1].Header.Get("Authorization")).To(Equal("bearer token-2"))
+	})
+
+	It("fails when UAA rejects the client credentials", func() {
+		updater.WithTokenSource(NewUAATokenSource(server.URL+"/oauth/token", "bits-service", "wrong-secret", time.Second, ""))
+
+		Expect(updater.NotifyProcessingUpload(context.Background(), "abc")).To(MatchError(ContainSubstring("UAA rejected token request with status code 401")))
+		Expect(ccRequests).To(BeEmpty())
+	})
+
+	It("renders payload templates", func() {
+		readyTemplate, e := ParsePayloadTemplate(StateReady, `{"state": "READY", "checksums": {"sha256": {{json .Sha256}}}, "guid": {{json .Guid}}}`)
+		Expect(e).NotTo(HaveOccurred())
+		updater.WithPayloadTemplate(StateReady, readyTemplate)
+
+		Expect(updater.NotifyUploadSucceeded(context.Background(), "abc", "sha1", "sha256")).To(Succeed())
+		Expect(updater.NotifyUploadFailed(context.Background(), "abc", fmt.Errorf("some error"))).To(Succeed())
+
+		Expect(ccBodies[0]).To(MatchJSON(`{"state": "READY", "checksums": {"sha256": "sha256"}, "guid": "abc"}`))
+		Expect(ccBodies[1]).To(MatchJSON(`{"state": "FAILED", "error": "some error"}`))
+	})
+
+	It("does not send payload templates which do not render valid JSON", func() {
+		failedTemplate, e := ParsePayloadTemplate(StateFailed, `{"state": "FAILED", "error": "{{.Error}}"}`)
+		Expect(e).NotTo(HaveOccurred())
+		updater.WithPayloadTemplate(StateFailed, failedTemplate)
+
+		e = updater.NotifyUploadFailed(context.Background(), "abc", fmt.Errorf(`some "quoted" error`))
+
+		Expect(e).To(MatchError(ContainSubstring("did not render valid JSON")))
+		Expect(ccRequests).To(BeEmpty())
+	})
+
+	It("only accepts the configured success status codes", func() {
+		updater.WithSuccessStatusCodes([]int{http.StatusNoContent})
+		ccStatusCodes = []int{http.StatusOK, http.StatusNoContent}
+
+		Expect(updater.NotifyProcessingUpload(context.Background(), "abc")).To(MatchError(ContainSubstring("unexpected status code 200")))
+		Expect(updater.NotifyProcessingUpload(context.Background(), "abc")).To(Succeed())
+	})
+})
+
+var _ = Describe("UAATokenSource", func() {
+	It("requests a new token once 90% of its lifetime has passed", func() {
+		httpClient := NewMockHttpClient()
+		When(httpClient.Do(AnyPtrToHttpRequest())).Then(func([]Param) ReturnValues {
+			return []ReturnValue{&http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"access_token": "some-token", "expires_in": 100}`)),
+			}, nil}
+		})
+		mockClock := clock.NewMock()
+		tokenSource := NewUAATokenSourceWithHttpClient("http://uaa.example.com/oauth/token", "bits-service", "some-secret", httpClient).WithClock(mockClock)
+
+		Expect(tokenSource.Token()).To(Equal("some-token"))
+		mockClock.Add(89 * time.Second)
+		Expect(tokenSource.Token()).To(Equal("some-token"))
+		httpClient.VerifyWasCalledOnce().Do(AnyPtrToHttpRequest())
+
+		mockClock.Add(1 * time.Second)
+		Expect(tokenSource.Token()).To(Equal("some-token"))
+		httpClient.VerifyWasCalled(Times(2)).Do(AnyPtrToHttpRequest())
+	})
 })
+
+type recordingMetricsService struct {
+	counters map[string]int64
+	gauges   map[string]int64
+}
+
+func (service *recordingMetricsService) SendTimingMetric(name string, duration time.Duration) {}
+
+func (service *recordingMetricsService) SendGaugeMetric(name string, value int64) {
+	if service.gauges == nil {
+		service.gauges = make(map[string]int64)
+	}
+	service.gauges[name] = value
+}
+
+func (service *recordingMetricsService) SendCounterMetric(name string, value int64) {
+	service.counters[name] += value
+}
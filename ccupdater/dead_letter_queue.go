@@ -0,0 +1,114 @@
+package ccupdater
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+	"github.com/pkg/errors"
+)
+
+// DeadLetter is a notification which could not be delivered to the Cloud Controller.
+type DeadLetter struct {
+	Guid           string          `json:"guid"`
+	Payload        json.RawMessage `json:"payload"`
+	Headers        http.Header     `json:"headers,omitempty"`
+	Attempts       int             `json:"attempts"`
+	LastError      string          `json:"last_error"`
+	DeadLetteredAt time.Time       `json:"dead_lettered_at"`
+}
+
+// DeadLetterQueue persists dead letters as files in a directory, so that they survive restarts.
+// It keeps at most one dead letter per guid.
+type DeadLetterQueue struct {
+	dir string
+}
+
+// NewDeadLetterQueue creates dir if it does not exist.
+func NewDeadLetterQueue(dir string) (*DeadLetterQueue, error) {
+	e := os.MkdirAll(dir, 0700)
+	if e != nil {
+		return nil, errors.Wrapf(e, "Could not create dead letter directory '%v'", dir)
+	}
+	return &DeadLetterQueue{dir: dir}, nil
+}
+
+// Put replaces any dead letter with the same guid.
+func (queue *DeadLetterQueue) Put(deadLetter DeadLetter) error {
+	record, e := json.Marshal(deadLetter)
+	if e != nil {
+		return errors.WithStack(e)
+	}
+	filename := queue.filename(deadLetter.Guid)
+	e = util.WriteFileAtomically(filename, record, 0600)
+	if e != nil {
+		return errors.Wrapf(e, "Could not write dead letter '%v'", filename)
+	}
+	return nil
+}
+
+func (queue *DeadLetterQueue) Get(guid string) (deadLetter DeadLetter, exists bool, e error) {
+	record, e := ioutil.ReadFile(queue.filename(guid))
+	if os.IsNotExist(e) {
+		return DeadLetter{}, false, nil
+	}
+	if e != nil {
+		return DeadLetter{}, false, errors.WithStack(e)
+	}
+	e = json.Unmarshal(record, &deadLetter)
+	if e != nil {
+		return DeadLetter{}, false, errors.Wrapf(e, "Could not parse dead letter for guid '%v'", guid)
+	}
+	return deadLetter, true, nil
+}
+
+// Remove does nothing if there is no dead letter for guid.
+func (queue *DeadLetterQueue) Remove(guid string) error {
+	e := os.Remove(queue.filename(guid))
+	if e != nil && !os.IsNotExist(e) {
+		return errors.WithStack(e)
+	}
+	return nil
+}
+
+// List returns the dead letters, oldest first. Invalid records are discarded.
+func (queue *DeadLetterQueue) List() ([]DeadLetter, error) {
+	filenames, e := filepath.Glob(filepath.Join(queue.dir, "*.json"))
+	if e != nil {
+		return nil, errors.WithStack(e)
+	}
+	deadLetters := []DeadLetter{}
+	for _, filename := range filenames {
+		record, e := ioutil.ReadFile(filename)
+		if os.IsNotExist(e) {
+			continue
+		}
+		if e != nil {
+			return nil, errors.Wrapf(e, "Could not read dead letter '%v'", filename)
+		}
+		var deadLetter DeadLetter
+		e = json.Unmarshal(record, &deadLetter)
+		if e != nil || queue.filename(deadLetter.Guid) != filename {
+			logger.Log.Errorw("Discarding invalid dead letter", "filename", filename, "error", e)
+			os.Remove(filename)
+			continue
+		}
+		deadLetters = append(deadLetters, deadLetter)
+	}
+	sort.Slice(deadLetters, func(i, j int) bool { return deadLetters[i].DeadLetteredAt.Before(deadLetters[j].DeadLetteredAt) })
+	return deadLetters, nil
+}
+
+// filename hashes guid, so that it can be used as a file name regardless of its characters.
+func (queue *DeadLetterQueue) filename(guid string) string {
+	hash := sha256.Sum256([]byte(guid))
+	return filepath.Join(queue.dir, hex.EncodeToString(hash[:])+".json")
+}
@@ -0,0 +1,41 @@
+package ccupdater
+
+import (
+	"bytes"
+	"encoding/json"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// PayloadData is available in payload templates, e.g. {"state": {{json .State}}, "sha256": {{json .Sha256}}}.
+type PayloadData struct {
+	Guid   string
+	State  string
+	Sha1   string
+	Sha256 string
+	Error  string
+}
+
+// ParsePayloadTemplate parses a payload template. Its "json" function encodes a value as JSON, which should be used
+// for all values to keep the payload valid JSON.
+func ParsePayloadTemplate(name string, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Funcs(template.FuncMap{
+		"json": func(value interface{}) (string, error) {
+			encoded, e := json.Marshal(value)
+			return string(encoded), e
+		},
+	}).Parse(text)
+}
+
+func renderPayload(payloadTemplate *template.Template, data PayloadData) ([]byte, error) {
+	var payload bytes.Buffer
+	e := payloadTemplate.Execute(&payload, data)
+	if e != nil {
+		return nil, errors.Wrapf(e, "Could not render payload template for state %v (GUID: \"%v\")", data.State, data.Guid)
+	}
+	if !json.Valid(payload.Bytes()) {
+		return nil, errors.Errorf("Payload template for state %v did not render valid JSON (GUID: \"%v\")", data.State, data.Guid)
+	}
+	return payload.Bytes(), nil
+}
@@ -0,0 +1,127 @@
+package ccupdater
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/pkg/errors"
+)
+
+// TokenSource provides bearer tokens for requests against the Cloud Controller.
+type TokenSource interface {
+	Token() (string, error)
+	// Invalidate makes the next call to Token request a new token, e.g. after the Cloud Controller rejected it.
+	Invalidate()
+}
+
+// UAATokenSource requests tokens with the client credentials grant and caches them until 90% of their lifetime
+// has passed.
+type UAATokenSource struct {
+	tokenEndpoint string
+	clientID      string
+	clientSecret  string
+	httpClient    HttpClient
+	clock         clock.Clock
+
+	mutex     sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func NewUAATokenSource(tokenEndpoint string, clientID string, clientSecret string, timeout time.Duration, caCertFile string) *UAATokenSource {
+	return NewUAATokenSourceWithHttpClient(tokenEndpoint, clientID, clientSecret, &http.Client{
+		Transport: &http.Transport{TLSClientConfig: loadTLSConfig("", "", caCertFile)},
+		Timeout:   timeout,
+	})
+}
+
+func NewUAATokenSourceWithHttpClient(tokenEndpoint string, clientID string, clientSecret string, httpClient HttpClient) *UAATokenSource {
+	return &UAATokenSource{
+		tokenEndpoint: tokenEndpoint,
+		clientID:      clientID,
+		clientSecret:  clientSecret,
+		httpClient:    httpClient,
+		clock:         clock.New(),
+	}
+}
+
+func (tokenSource *UAATokenSource) WithClock(clock clock.Clock) *UAATokenSource {
+	tokenSource.clock = clock
+	return tokenSource
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func (tokenSource *UAATokenSource) Token() (string, error) {
+	tokenSource.mutex.Lock()
+	defer tokenSource.mutex.Unlock()
+
+	if tokenSource.token != "" && tokenSource.clock.Now().Before(tokenSource.expiresAt) {
+		return tokenSource.token, nil
+	}
+
+	now := tokenSource.clock.Now()
+	token, e := tokenSource.requestToken()
+	if e != nil {
+		return "", e
+	}
+	tokenSource.token = token.AccessToken
+	tokenSource.expiresAt = now.Add(time.Duration(token.ExpiresIn) * time.Second * 9 / 10)
+	return tokenSource.token, nil
+}
+
+func (tokenSource *UAATokenSource) Invalidate() {
+	tokenSource.mutex.Lock()
+	defer tokenSource.mutex.Unlock()
+
+	tokenSource.token = ""
+}
+
+// requestToken fails with a retryable error if UAA is unreachable or responds with a 5xx status code.
+func (tokenSource *UAATokenSource) requestToken() (*tokenResponse, error) {
+	r, e := http.NewRequest("POST", tokenSource.tokenEndpoint, strings.NewReader(url.Values{
+		"grant_type":    {"client_credentials"},
+		"response_type": {"token"},
+	}.Encode()))
+	if e != nil {
+		logger.Log.Fatalw("Unexpected error when creating token request", "error", e, "token-endpoint", tokenSource.tokenEndpoint)
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Accept", "application/json")
+	r.SetBasicAuth(url.QueryEscape(tokenSource.clientID), url.QueryEscape(tokenSource.clientSecret))
+
+	resp, e := tokenSource.httpClient.Do(r)
+	if e != nil {
+		return nil, &retryableError{errors.Wrapf(e, "Could not request token from UAA")}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil, &retryableError{errors.Errorf("UAA responded with status code %v", resp.StatusCode)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil, errors.Errorf("UAA rejected token request with status code %v", resp.StatusCode)
+	}
+
+	var token tokenResponse
+	e = json.NewDecoder(resp.Body).Decode(&token)
+	if e != nil {
+		return nil, errors.Wrapf(e, "Could not decode token response from UAA")
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("UAA responded without access_token")
+	}
+	return &token, nil
+}
@@ -0,0 +1,152 @@
+// Package certreloader serves TLS certificates which are reloaded from disk when they change.
+package certreloader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/pkg/errors"
+)
+
+// CertReloader holds the certificate loaded from certFile and keyFile. Use GetCertificate as tls.Config.GetCertificate,
+// so that new handshakes use the reloaded certificate, while established connections are not affected.
+type CertReloader struct {
+	name           string
+	certFile       string
+	keyFile        string
+	metricsService bitsgo.MetricsService
+	clock          clock.Clock
+
+	mutex       sync.RWMutex
+	certificate *tls.Certificate
+	notAfter    time.Time
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+// NewCertReloader loads the certificate initially and fails if it cannot. name identifies the certificate
+// in logs and metrics.
+func NewCertReloader(name, certFile, keyFile string, metricsService bitsgo.MetricsService, clock clock.Clock) (*CertReloader, error) {
+	reloader := &CertReloader{
+		name:           name,
+		certFile:       certFile,
+		keyFile:        keyFile,
+		metricsService: metricsService,
+		clock:          clock,
+	}
+	certModTime, keyModTime, e := reloader.modTimes()
+	if e != nil {
+		return nil, e
+	}
+	e = reloader.load(certModTime, keyModTime)
+	if e != nil {
+		return nil, e
+	}
+	reloader.sendExpiryMetric()
+	return reloader, nil
+}
+
+func (reloader *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.mutex.RLock()
+	defer reloader.mutex.RUnlock()
+
+	return reloader.certificate, nil
+}
+
+// NotAfter returns the expiry of the current certificate.
+func (reloader *CertReloader) NotAfter() time.Time {
+	reloader.mutex.RLock()
+	defer reloader.mutex.RUnlock()
+
+	return reloader.notAfter
+}
+
+// Watch checks the files for changes every interval until stop is closed. If loading a changed certificate fails,
+// e.g. because only one of the files has been replaced so far, the current certificate is kept.
+func (reloader *CertReloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := reloader.clock.Ticker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			reloader.ReloadIfChanged()
+			reloader.sendExpiryMetric()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// ReloadIfChanged reloads the certificate if the modification time of either file has changed since the last attempt.
+func (reloader *CertReloader) ReloadIfChanged() {
+	certModTime, keyModTime, e := reloader.modTimes()
+	if e != nil {
+		logger.Log.Errorw("Could not check TLS certificate for changes", "name", reloader.name, "error", e)
+		reloader.metricsService.SendCounterMetric("tls."+reloader.name+".certificateReloadFailures", 1)
+		return
+	}
+
+	reloader.mutex.RLock()
+	unchanged := certModTime.Equal(reloader.certModTime) && keyModTime.Equal(reloader.keyModTime)
+	reloader.mutex.RUnlock()
+	if unchanged {
+		return
+	}
+
+	e = reloader.load(certModTime, keyModTime)
+	if e != nil {
+		logger.Log.Errorw("Could not reload TLS certificate. Keeping the current one.", "name", reloader.name,
+			"cert-file", reloader.certFile, "key-file", reloader.keyFile, "error", e)
+		reloader.metricsService.SendCounterMetric("tls."+reloader.name+".certificateReloadFailures", 1)
+		return
+	}
+	logger.Log.Infow("Reloaded TLS certificate", "name", reloader.name,
+		"cert-file", reloader.certFile, "key-file", reloader.keyFile, "not-after", reloader.NotAfter())
+	reloader.metricsService.SendCounterMetric("tls."+reloader.name+".certificateReloads", 1)
+}
+
+// load remembers the modification times even if loading fails, so that a broken pair is only retried once it changes again.
+func (reloader *CertReloader) load(certModTime, keyModTime time.Time) error {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+
+	reloader.certModTime = certModTime
+	reloader.keyModTime = keyModTime
+
+	certificate, e := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if e != nil {
+		return errors.Wrapf(e, "Could not load key pair from '%v' and '%v'", reloader.certFile, reloader.keyFile)
+	}
+	leaf, e := x509.ParseCertificate(certificate.Certificate[0])
+	if e != nil {
+		return errors.Wrapf(e, "Could not parse certificate '%v'", reloader.certFile)
+	}
+	certificate.Leaf = leaf
+
+	reloader.certificate = &certificate
+	reloader.notAfter = leaf.NotAfter
+	return nil
+}
+
+func (reloader *CertReloader) modTimes() (certModTime time.Time, keyModTime time.Time, e error) {
+	certFileInfo, e := os.Stat(reloader.certFile)
+	if e != nil {
+		return time.Time{}, time.Time{}, errors.Wrapf(e, "Could not stat '%v'", reloader.certFile)
+	}
+	keyFileInfo, e := os.Stat(reloader.keyFile)
+	if e != nil {
+		return time.Time{}, time.Time{}, errors.Wrapf(e, "Could not stat '%v'", reloader.keyFile)
+	}
+	return certFileInfo.ModTime(), keyFileInfo.ModTime(), nil
+}
+
+func (reloader *CertReloader) sendExpiryMetric() {
+	reloader.metricsService.SendGaugeMetric("tls."+reloader.name+".certificateSecondsUntilExpiry",
+		int64(reloader.NotAfter().Sub(reloader.clock.Now()).Seconds()))
+}
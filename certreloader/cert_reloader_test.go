@@ -0,0 +1,165 @@
+package certreloader_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	. "github.com/cloudfoundry-incubator/bits-service/certreloader"
+	"github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+)
+
+func TestCertReloader(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "CertReloader")
+}
+
+type recordingMetricsService struct {
+	gauges   map[string]int64
+	counters map[string]int64
+}
+
+func (service *recordingMetricsService) SendTimingMetric(name string, duration time.Duration) {}
+
+func (service *recordingMetricsService) SendGaugeMetric(name string, value int64) {
+	service.gauges[name] = value
+}
+
+func (service *recordingMetricsService) SendCounterMetric(name string, value int64) {
+	service.counters[name] += value
+}
+
+var _ = Describe("CertReloader", func() {
+	var (
+		tempDir          string
+		certFile         string
+		keyFile          string
+		mockClock        *clock.Mock
+		metricsService   *recordingMetricsService
+		reloader         *CertReloader
+		initialNotAfter  time.Time
+		modTimeIncrement int
+	)
+
+	writeKeyPair := func(commonName string, notAfter time.Time) {
+		privateKey, e := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(e).NotTo(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: commonName},
+			NotBefore:    notAfter.Add(-30 * 24 * time.Hour),
+			NotAfter:     notAfter,
+		}
+		der, e := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+		Expect(e).NotTo(HaveOccurred())
+		keyDer, e := x509.MarshalECPrivateKey(privateKey)
+		Expect(e).NotTo(HaveOccurred())
+
+		Expect(ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)).To(Succeed())
+		// Make sure modification times change even on file systems with a coarse resolution
+		modTimeIncrement++
+		modTime := time.Now().Add(time.Duration(modTimeIncrement) * time.Second)
+		Expect(os.Chtimes(certFile, modTime, modTime)).To(Succeed())
+		Expect(os.Chtimes(keyFile, modTime, modTime)).To(Succeed())
+	}
+
+	commonNameOfCurrentCertificate := func() string {
+		certificate, e := reloader.GetCertificate(nil)
+		Expect(e).NotTo(HaveOccurred())
+		return certificate.Leaf.Subject.CommonName
+	}
+
+	BeforeEach(func() {
+		var e error
+		tempDir, e = ioutil.TempDir("", "certreloader")
+		Expect(e).NotTo(HaveOccurred())
+		certFile = filepath.Join(tempDir, "cert.pem")
+		keyFile = filepath.Join(tempDir, "key.pem")
+
+		mockClock = clock.NewMock()
+		mockClock.Set(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		metricsService = &recordingMetricsService{gauges: make(map[string]int64), counters: make(map[string]int64)}
+		initialNotAfter = mockClock.Now().Add(10 * 24 * time.Hour).Truncate(time.Second)
+
+		writeKeyPair("initial", initialNotAfter)
+		reloader, e = NewCertReloader("public", certFile, keyFile, metricsService, mockClock)
+		Expect(e).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tempDir)
+	})
+
+	It("serves the initial certificate and reports its expiry", func() {
+		Expect(commonNameOfCurrentCertificate()).To(Equal("initial"))
+		Expect(reloader.NotAfter()).To(BeTemporally("==", initialNotAfter))
+		Expect(metricsService.gauges).To(HaveKeyWithValue("tls.public.certificateSecondsUntilExpiry", int64(10*24*60*60)))
+	})
+
+	It("fails when the key pair cannot be loaded", func() {
+		Expect(ioutil.WriteFile(keyFile, []byte("not a key"), 0600)).To(Succeed())
+
+		_, e := NewCertReloader("public", certFile, keyFile, metricsService, mockClock)
+		Expect(e).To(MatchError(ContainSubstring("Could not load key pair")))
+	})
+
+	It("reloads the certificate when the files change", func() {
+		writeKeyPair("rotated", initialNotAfter.Add(30*24*time.Hour))
+
+		reloader.ReloadIfChanged()
+
+		Expect(commonNameOfCurrentCertificate()).To(Equal("rotated"))
+		Expect(reloader.NotAfter()).To(BeTemporally("==", initialNotAfter.Add(30*24*time.Hour)))
+		Expect(metricsService.counters).To(HaveKeyWithValue("tls.public.certificateReloads", int64(1)))
+	})
+
+	It("does not reload unchanged files", func() {
+		reloader.ReloadIfChanged()
+
+		Expect(metricsService.counters).NotTo(HaveKey("tls.public.certificateReloads"))
+	})
+
+	It("keeps the current certificate when the changed files cannot be loaded", func() {
+		Expect(ioutil.WriteFile(keyFile, []byte("not a key"), 0600)).To(Succeed())
+		modTime := time.Now().Add(time.Hour)
+		Expect(os.Chtimes(keyFile, modTime, modTime)).To(Succeed())
+
+		reloader.ReloadIfChanged()
+
+		Expect(commonNameOfCurrentCertificate()).To(Equal("initial"))
+		Expect(metricsService.counters).To(HaveKeyWithValue("tls.public.certificateReloadFailures", int64(1)))
+	})
+
+	It("watches the files and updates the expiry metric until stopped", func() {
+		stop := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			reloader.Watch(time.Minute, stop)
+			close(stopped)
+		}()
+		writeKeyPair("rotated", initialNotAfter.Add(30*24*time.Hour))
+
+		Eventually(func() string {
+			mockClock.Add(time.Minute)
+			return commonNameOfCurrentCertificate()
+		}).Should(Equal("rotated"))
+
+		close(stop)
+		Eventually(stopped).Should(BeClosed())
+		Expect(metricsService.gauges["tls.public.certificateSecondsUntilExpiry"]).To(BeNumerically(">", int64(39*24*60*60)))
+	})
+})
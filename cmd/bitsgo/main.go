@@ -1,18 +1,28 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/cloudfoundry-incubator/bits-service/ccupdater"
 
 	"github.com/benbjohnson/clock"
 	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/audit"
 	"github.com/cloudfoundry-incubator/bits-service/blobstores/alibaba"
 	"github.com/cloudfoundry-incubator/bits-service/blobstores/azure"
 	"github.com/cloudfoundry-incubator/bits-service/blobstores/decorator"
@@ -21,7 +31,9 @@ import (
 	"github.com/cloudfoundry-incubator/bits-service/blobstores/openstack"
 	"github.com/cloudfoundry-incubator/bits-service/blobstores/s3"
 	"github.com/cloudfoundry-incubator/bits-service/blobstores/webdav"
+	"github.com/cloudfoundry-incubator/bits-service/certreloader"
 	"github.com/cloudfoundry-incubator/bits-service/config"
+	"github.com/cloudfoundry-incubator/bits-service/events"
 	log "github.com/cloudfoundry-incubator/bits-service/logger"
 	"github.com/cloudfoundry-incubator/bits-service/middlewares"
 	"github.com/cloudfoundry-incubator/bits-service/pathsigner"
@@ -32,6 +44,13 @@ import (
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
+const (
+	// certificateReloadInterval is how often cert_file and key_file are checked for changes.
+	certificateReloadInterval = 1 * time.Minute
+	// uploadJobCleanupInterval is how often expired upload jobs are removed.
+	uploadJobCleanupInterval = 1 * time.Minute
+)
+
 var (
 	configPath = kingpin.Flag("config", "specify config to use").Required().Short('c').String()
 )
@@ -48,65 +67,442 @@ func main() {
 	logger := createLoggerWith(config.Logging.Level)
 	log.SetLogger(logger)
 
+	tempDir := setUpTempDir(config.TempDirOrDefault())
+
 	metricsService := statsd.NewMetricsService()
+	pathSignerValidator := createPathSignerValidator(config.SigningSecrets(), config.Secret, config.SignedURLs)
+
+	appStashBlobstore, signAppStashURLHandler := createAppStashBlobstore(config.AppStash, config.PublicEndpointUrl(), config.PublicPort(), pathSignerValidator, config.SignedURLs.MaxExpirationOrDefault(), log.Log, metricsService)
+	packageBlobstore, signPackageURLHandler := createBlobstoreAndSignURLHandler(config.Packages, config.PublicEndpointUrl(), config.PublicPort(), pathSignerValidator, config.SignedURLs.MaxExpirationOrDefault(), "packages", log.Log, metricsService)
+	dropletBlobstore, signDropletURLHandler := createBlobstoreAndSignURLHandler(config.Droplets, config.PublicEndpointUrl(), config.PublicPort(), pathSignerValidator, config.SignedURLs.MaxExpirationOrDefault(), "droplets", log.Log, metricsService)
+	buildpackBlobstore, signBuildpackURLHandler := createBlobstoreAndSignURLHandler(config.Buildpacks, config.PublicEndpointUrl(), config.PublicPort(), pathSignerValidator, config.SignedURLs.MaxExpirationOrDefault(), "buildpacks", log.Log, metricsService)
+	buildpackCacheBlobstore, signBuildpackCacheURLHandler := createBuildpackCacheSignURLHandler(config.Droplets, config.PublicEndpointUrl(), config.PublicPort(), pathSignerValidator, config.SignedURLs.MaxExpirationOrDefault(), log.Log, metricsService)
 
-	appStashBlobstore, signAppStashURLHandler := createAppStashBlobstore(config.AppStash, config.PublicEndpointUrl(), config.Port, config.Secret, log.Log, metricsService)
-	packageBlobstore, signPackageURLHandler := createBlobstoreAndSignURLHandler(config.Packages, config.PublicEndpointUrl(), config.Port, config.Secret, "packages", log.Log, metricsService)
-	dropletBlobstore, signDropletURLHandler := createBlobstoreAndSignURLHandler(config.Droplets, config.PublicEndpointUrl(), config.Port, config.Secret, "droplets", log.Log, metricsService)
-	buildpackBlobstore, signBuildpackURLHandler := createBlobstoreAndSignURLHandler(config.Buildpacks, config.PublicEndpointUrl(), config.Port, config.Secret, "buildpacks", log.Log, metricsService)
-	buildpackCacheBlobstore, signBuildpackCacheURLHandler := createBuildpackCacheSignURLHandler(config.Droplets, config.PublicEndpointUrl(), config.Port, config.Secret, log.Log, metricsService)
+	appStashBlobstore = decorator.ForBlobstoreWithTimeouts(appStashBlobstore, config.AppStash.Timeouts)
+	packageBlobstore = decorator.ForBlobstoreWithTimeouts(packageBlobstore, config.Packages.Timeouts)
+	dropletBlobstore = decorator.ForBlobstoreWithTimeouts(dropletBlobstore, config.Droplets.Timeouts)
+	buildpackBlobstore = decorator.ForBlobstoreWithTimeouts(buildpackBlobstore, config.Buildpacks.Timeouts)
+	buildpackCacheBlobstore = decorator.ForBlobstoreWithTimeouts(buildpackCacheBlobstore, config.Droplets.Timeouts)
+
+	appStashBlobstore = decorator.ForBlobstoreWithIdentifierValidation(appStashBlobstore, bitsgo.IdentifierValidatorFor("app_stash"))
+	packageBlobstore = decorator.ForBlobstoreWithIdentifierValidation(packageBlobstore, bitsgo.IdentifierValidatorFor("packages"))
+	dropletBlobstore = decorator.ForBlobstoreWithIdentifierValidation(dropletBlobstore, bitsgo.IdentifierValidatorFor("droplets"))
+	buildpackBlobstore = decorator.ForBlobstoreWithIdentifierValidation(buildpackBlobstore, bitsgo.IdentifierValidatorFor("buildpacks"))
+	buildpackCacheBlobstore = decorator.ForBlobstoreWithIdentifierValidation(buildpackCacheBlobstore, bitsgo.IdentifierValidatorFor("buildpack_cache"))
 
 	go regularlyEmitGoRoutines(metricsService)
 
-	handler := routes.SetUpAllRoutes(
-		config.PrivateEndpointUrl().Host,
-		config.PublicEndpointUrl().Host,
-		middlewares.NewBasicAuthMiddleWare(basicAuthCredentialsFrom(config.SigningUsers)...),
-		&local.SignatureVerificationMiddleware{&pathsigner.PathSignerValidator{config.Secret, clock.New()}},
-		signPackageURLHandler,
-		signDropletURLHandler,
-		signBuildpackURLHandler,
-		signBuildpackCacheURLHandler,
-		signAppStashURLHandler,
-		bitsgo.NewAppStashHandlerWithSizeThresholds(appStashBlobstore, config.AppStash.MaxBodySizeBytes(), config.AppStashConfig.MinimumSizeBytes(), config.AppStashConfig.MaximumSizeBytes(), metricsService),
-		bitsgo.NewResourceHandlerWithUpdaterAndSizeThresholds(
-			packageBlobstore,
-			appStashBlobstore,
-			createUpdater(config.CCUpdater),
-			"package",
-			metricsService,
-			config.Packages.MaxBodySizeBytes(),
-			config.AppStashConfig.MinimumSizeBytes(),
-			config.AppStashConfig.MaximumSizeBytes(),
-		),
-		bitsgo.NewResourceHandler(buildpackBlobstore, appStashBlobstore, "buildpack", metricsService, config.Buildpacks.MaxBodySizeBytes()),
-		bitsgo.NewResourceHandler(dropletBlobstore, appStashBlobstore, "droplet", metricsService, config.Droplets.MaxBodySizeBytes()),
-		bitsgo.NewResourceHandler(buildpackCacheBlobstore, appStashBlobstore, "buildpack_cache", metricsService, config.BuildpackCache.MaxBodySizeBytes()))
+	auditor := createAuditor(config.Audit)
+	eventBus := createEventBus(config.Events, metricsService)
+	signPackageURLHandler.WithAuditor(auditor, "packages")
+	signDropletURLHandler.WithAuditor(auditor, "droplets")
+	signBuildpackURLHandler.WithAuditor(auditor, "buildpacks")
+	signBuildpackCacheURLHandler.WithAuditor(auditor, "buildpack_cache")
+	signAppStashURLHandler.WithAuditor(auditor, "app_stash_matches")
+
+	basicAuthMiddleware := middlewares.NewBasicAuthMiddleWare(basicAuthCredentialsFrom(config.SigningUsers)...).
+		WithLoginThrottle(middlewares.NewLoginThrottle(
+			config.SigningLockout.MaxFailedAttemptsOrDefault(),
+			config.SigningLockout.WindowOrDefault(),
+			config.SigningLockout.LockoutDurationOrDefault(),
+			clock.New()))
+	signatureVerificationMiddleware := &local.SignatureVerificationMiddleware{
+		SignatureValidator: pathSignerValidator,
+		MaxBodySizes: map[string]uint64{
+			"packages":        config.Packages.MaxBodySizeBytes(),
+			"droplets":        config.Droplets.MaxBodySizeBytes(),
+			"buildpacks":      config.Buildpacks.MaxBodySizeBytes(),
+			"buildpack_cache": config.BuildpackCache.MaxBodySizeBytes(),
+			"app_stash":       config.AppStash.MaxBodySizeBytes(),
+		},
+	}
+	tokenAuth := createTokenAuth(config.TokenAuth)
+	clientCertAuth := createClientCertAuth(config.ClientAuth)
+	signAppStashEntriesURLHandler := createAppStashSignURLHandler(config.PublicEndpointUrl(), config.PublicPort(), pathSignerValidator, config.SignedURLs.MaxExpirationOrDefault(), "entries").
+		WithAuditor(auditor, "app_stash_entries")
+	signAppStashBundlesURLHandler := createAppStashSignURLHandler(config.PublicEndpointUrl(), config.PublicPort(), pathSignerValidator, config.SignedURLs.MaxExpirationOrDefault(), "bundles").
+		WithAuditor(auditor, "app_stash_bundles")
+	zipLimits := bitsgo.ZipLimits{
+		MaxUncompressedSize: config.ZipLimits.MaxUncompressedSizeBytes(),
+		MaxEntries:          config.ZipLimits.MaxEntriesOrDefault(),
+		MaxCompressionRatio: uint64(config.ZipLimits.MaxCompressionRatioOrDefault()),
+		MaxPathDepth:        config.ZipLimits.MaxPathDepthOrDefault(),
+	}
+	stopRedeliveringNotifications := make(chan struct{})
+	uploadJobs := bitsgo.NewUploadJobRegistry(bitsgo.NewInMemoryUploadJobStore(), config.UploadJobs.RetentionOrDefault(), clock.New())
+	appStashHandler := bitsgo.NewAppStashHandlerWithSizeThresholds(appStashBlobstore, config.AppStash.MaxBodySizeBytes(), config.AppStashConfig.MinimumSizeBytes(), config.AppStashConfig.MaximumSizeBytes(), metricsService).
+		WithZipLimits(zipLimits)
+	packageHandler := bitsgo.NewResourceHandlerWithUpdaterAndSizeThresholds(
+		packageBlobstore,
+		appStashBlobstore,
+		createUpdater(config.PackagesCCUpdater(), metricsService, stopRedeliveringNotifications),
+		"package",
+		metricsService,
+		config.Packages.MaxBodySizeBytes(),
+		config.AppStashConfig.MinimumSizeBytes(),
+		config.AppStashConfig.MaximumSizeBytes(),
+	).WithAuditor(auditor).WithEventPublisher(eventBus).WithZipLimits(zipLimits).WithUploadJobs(uploadJobs).
+		WithAsyncUploadQueue(createAsyncUploadQueue(config.AsyncUploads, "packages"))
+	buildpackHandler := bitsgo.NewResourceHandlerWithUpdater(buildpackBlobstore, appStashBlobstore,
+		createUpdater(config.Buildpacks.CCUpdater, metricsService, stopRedeliveringNotifications),
+		"buildpack", metricsService, config.Buildpacks.MaxBodySizeBytes()).
+		WithAuditor(auditor).WithEventPublisher(eventBus).WithUploadJobs(uploadJobs).
+		WithAsyncUploadQueue(createAsyncUploadQueue(config.AsyncUploads, "buildpacks"))
+	dropletHandler := bitsgo.NewResourceHandlerWithUpdater(dropletBlobstore, appStashBlobstore,
+		createUpdater(config.Droplets.CCUpdater, metricsService, stopRedeliveringNotifications),
+		"droplet", metricsService, config.Droplets.MaxBodySizeBytes()).
+		WithAuditor(auditor).WithEventPublisher(eventBus).WithUploadJobs(uploadJobs).
+		WithAsyncUploadQueue(createAsyncUploadQueue(config.AsyncUploads, "droplets"))
+	buildpackCacheHandler := bitsgo.NewResourceHandlerWithUpdater(buildpackCacheBlobstore, appStashBlobstore,
+		createUpdater(config.BuildpackCache.CCUpdater, metricsService, stopRedeliveringNotifications),
+		"buildpack_cache", metricsService, config.BuildpackCache.MaxBodySizeBytes()).
+		WithAuditor(auditor).WithEventPublisher(eventBus).WithUploadJobs(uploadJobs).
+		WithAsyncUploadQueue(createAsyncUploadQueue(config.AsyncUploads, "buildpack_cache"))
+	copySources := map[string]bitsgo.CopySource{
+		"package":         packageBlobstore,
+		"droplet":         dropletBlobstore,
+		"buildpack":       buildpackBlobstore,
+		"buildpack_cache": buildpackCacheBlobstore,
+	}
+	packageHandler.WithCopySources(copySources)
+	buildpackHandler.WithCopySources(copySources)
+	dropletHandler.WithCopySources(copySources)
+	buildpackCacheHandler.WithCopySources(copySources)
+	if config.RemoteFetch != nil {
+		sourceURLFetcher := bitsgo.NewSourceURLFetcher(config.RemoteFetch.AllowedHosts, config.RemoteFetch.MaxSizeBytes(),
+			config.RemoteFetch.TimeoutOrDefault(), config.RemoteFetch.AllowPrivateNetworks)
+		packageHandler.WithSourceURLFetcher(sourceURLFetcher)
+		buildpackHandler.WithSourceURLFetcher(sourceURLFetcher)
+		dropletHandler.WithSourceURLFetcher(sourceURLFetcher)
+	}
+	resourceHandlers := []*bitsgo.ResourceHandler{packageHandler, buildpackHandler, dropletHandler, buildpackCacheHandler}
+	for _, resourceHandler := range resourceHandlers {
+		e = resourceHandler.StartAsyncUploadQueue()
+		if e != nil {
+			log.Log.Fatalw("Could not start async upload queue", "error", e)
+		}
+	}
+
+	readiness := &bitsgo.Readiness{}
 
 	address := os.Getenv("BITS_LISTEN_ADDR")
 	if address == "" {
 		address = "0.0.0.0"
 	}
 
-	log.Log.Infow("Starting server",
-		"ip-address", address,
-		"port", config.Port,
-		"public-endpoint", config.PublicEndpointUrl().Host,
-		"private-endpoint", config.PrivateEndpointUrl().Host)
-	httpServer := &http.Server{
-		Handler: negroni.New(
-			middlewares.NewMetricsMiddleware(metricsService),
-			middlewares.NewZapLoggerMiddleware(log.Log),
-			&middlewares.MultipartMiddleware{},
-			&middlewares.PanicMiddleware{},
-			negroni.Wrap(handler)),
-		Addr:         fmt.Sprintf("%v:%v", address, config.Port),
-		WriteTimeout: 60 * time.Minute,
-		ReadTimeout:  60 * time.Minute,
-		ErrorLog:     log.NewStdLog(logger),
+	var servers []*tlsServer
+	if config.Listeners == nil {
+		handler := routes.SetUpAllRoutes(
+			config.PrivateEndpointUrl().Host,
+			config.PublicEndpointUrl().Host,
+			basicAuthMiddleware,
+			signatureVerificationMiddleware,
+			tokenAuth,
+			clientCertAuth,
+			signPackageURLHandler,
+			signDropletURLHandler,
+			signBuildpackURLHandler,
+			signBuildpackCacheURLHandler,
+			signAppStashURLHandler,
+			signAppStashEntriesURLHandler,
+			signAppStashBundlesURLHandler,
+			appStashHandler,
+			packageHandler,
+			buildpackHandler,
+			dropletHandler,
+			buildpackCacheHandler)
+
+		log.Log.Infow("Starting server",
+			"ip-address", address,
+			"port", config.Port,
+			"public-endpoint", config.PublicEndpointUrl().Host,
+			"private-endpoint", config.PrivateEndpointUrl().Host)
+		servers = append(servers,
+			// The public host is used by clients without certificates. Hence, certificates are only verified
+			// if given, and the private host's routes require them.
+			createTLSServer("server", routes.WithReadinessRoute(handler, readiness), listenerWithDefaultAddress(config.SinglePortListener(), address), createTLSConfig(config.ClientAuth, tls.VerifyClientCertIfGiven), metricsService, logger))
+	} else {
+		privateHandler := routes.SetUpPrivateRoutes(
+			basicAuthMiddleware,
+			tokenAuth,
+			clientCertAuth,
+			signPackageURLHandler,
+			signDropletURLHandler,
+			signBuildpackURLHandler,
+			signBuildpackCacheURLHandler,
+			signAppStashURLHandler,
+			signAppStashEntriesURLHandler,
+			signAppStashBundlesURLHandler,
+			appStashHandler,
+			packageHandler,
+			buildpackHandler,
+			dropletHandler,
+			buildpackCacheHandler)
+		publicHandler := routes.SetUpPublicRoutes(
+			signatureVerificationMiddleware,
+			appStashHandler,
+			packageHandler,
+			buildpackHandler,
+			dropletHandler,
+			buildpackCacheHandler)
+
+		privateListener := listenerWithDefaultAddress(config.PrivateListener(), address)
+		publicListener := listenerWithDefaultAddress(config.PublicListener(), address)
+		log.Log.Infow("Starting servers",
+			"private-ip-address", privateListener.Address,
+			"private-port", privateListener.Port,
+			"public-ip-address", publicListener.Address,
+			"public-port", publicListener.Port,
+			"public-endpoint", config.PublicEndpointUrl().Host,
+			"private-endpoint", config.PrivateEndpointUrl().Host)
+		servers = append(servers,
+			// Only the private endpoint is used with client certificates. Hence, it can require them during the handshake.
+			createTLSServer("private", routes.WithReadinessRoute(privateHandler, readiness), privateListener, createTLSConfig(config.ClientAuth, tls.RequireAndVerifyClientCert), metricsService, logger),
+			createTLSServer("public", routes.WithReadinessRoute(publicHandler, readiness), publicListener, nil, metricsService, logger))
+	}
+	stopWatchingCertificates := make(chan struct{})
+	for _, server := range servers {
+		go server.certReloader.Watch(certificateReloadInterval, stopWatchingCertificates)
+	}
+	stopRemovingUploadJobs := make(chan struct{})
+	go uploadJobs.RemoveExpiredRegularly(uploadJobCleanupInterval, stopRemovingUploadJobs)
+	serveUntilSignaled(servers)
+
+	readiness.StartDraining()
+	if config.Shutdown.ReadinessGracePeriod > 0 {
+		log.Log.Infow("Failing readiness check before shutting down servers", "readiness-grace-period", config.Shutdown.ReadinessGracePeriod)
+		time.Sleep(config.Shutdown.ReadinessGracePeriod)
+	}
+	drainContext, cancelDrain := context.WithTimeout(context.Background(), config.Shutdown.DrainTimeoutOrDefault())
+	shutDownServers(drainContext, servers)
+	tempFilesInUse := drainAsyncUploadQueues(drainContext, resourceHandlers)
+	cancelDrain()
+	close(stopWatchingCertificates)
+	close(stopRemovingUploadJobs)
+	close(stopRedeliveringNotifications)
+
+	e = eventBus.Close()
+	if e != nil {
+		log.Log.Errorw("Could not close event sinks", "error", e)
+	}
+	e = auditor.Close()
+	if e != nil {
+		log.Log.Errorw("Could not close audit sinks", "error", e)
+	}
+	metricsService.Close()
+	removeTempFiles(tempDir, tempFilesInUse...)
+	if len(tempFilesInUse) == 0 {
+		e = os.Remove(tempDir)
+		if e != nil {
+			log.Log.Errorw("Could not remove temp dir", "temp-dir", tempDir, "error", e)
+		}
+	}
+	log.Log.Infow("Shut down")
+	logger.Sync()
+}
+
+const processTempDirPrefix = "bits-process-"
+
+// bitsTempFilePrefixes are the prefixes of all temp files created by the service, including the ones created by the
+// standard library for multipart uploads. Other files are never removed.
+var bitsTempFilePrefixes = []string{"bits", "multipart-"}
+
+// setUpTempDir makes all temp files, including the ones created by the standard library, e.g. for multipart
+// uploads, end up in a subdirectory of tempDir which belongs to this process. Subdirectories of processes which
+// are no longer running, e.g. after a crash, are orphaned, hence their temp files are removed.
+func setUpTempDir(tempDir string) (processTempDir string) {
+	e := os.MkdirAll(tempDir, 0700)
+	if e != nil {
+		log.Log.Fatalw("Could not create temp dir", "temp-dir", tempDir, "error", e)
+	}
+	removeOrphanedProcessTempDirs(tempDir)
+	processTempDir = filepath.Join(tempDir, fmt.Sprintf("%v%v", processTempDirPrefix, os.Getpid()))
+	e = os.MkdirAll(processTempDir, 0700)
+	if e != nil {
+		log.Log.Fatalw("Could not create temp dir", "temp-dir", processTempDir, "error", e)
+	}
+	e = os.Setenv("TMPDIR", processTempDir)
+	if e != nil {
+		log.Log.Fatalw("Could not set TMPDIR", "temp-dir", processTempDir, "error", e)
+	}
+	return processTempDir
+}
+
+// removeOrphanedProcessTempDirs also cleans up a subdirectory with the pid of this process, since it can only be
+// left behind by an earlier process, e.g. in a container where the service always runs with the same pid.
+func removeOrphanedProcessTempDirs(tempDir string) {
+	entries, e := ioutil.ReadDir(tempDir)
+	if e != nil {
+		log.Log.Errorw("Could not list temp dir", "temp-dir", tempDir, "error", e)
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), processTempDirPrefix) {
+			continue
+		}
+		pid, e := strconv.Atoi(strings.TrimPrefix(entry.Name(), processTempDirPrefix))
+		if e != nil || (pid != os.Getpid() && processIsRunning(pid)) {
+			continue
+		}
+		processTempDir := filepath.Join(tempDir, entry.Name())
+		removeTempFiles(processTempDir)
+		e = os.Remove(processTempDir)
+		if e != nil {
+			log.Log.Errorw("Could not remove orphaned temp dir", "temp-dir", processTempDir, "error", e)
+		}
+	}
+}
+
+func processIsRunning(pid int) bool {
+	process, e := os.FindProcess(pid)
+	if e != nil {
+		return false
+	}
+	e = process.Signal(syscall.Signal(0))
+	return e == nil || e == syscall.EPERM
+}
+
+// removeTempFiles only removes files created by the service and skips the files in keep, e.g. because async
+// uploads are still reading them.
+func removeTempFiles(tempDir string, keep ...string) {
+	tempFiles, e := ioutil.ReadDir(tempDir)
+	if e != nil {
+		log.Log.Errorw("Could not list temp files", "temp-dir", tempDir, "error", e)
+		return
+	}
+	removed := 0
+	for _, tempFile := range tempFiles {
+		if tempFile.IsDir() || !hasAnyPrefix(tempFile.Name(), bitsTempFilePrefixes) ||
+			contains(keep, filepath.Join(tempDir, tempFile.Name())) {
+			continue
+		}
+		e = os.Remove(filepath.Join(tempDir, tempFile.Name()))
+		if e != nil {
+			log.Log.Errorw("Could not remove temp file", "temp-file", tempFile.Name(), "error", e)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		log.Log.Infow("Removed orphaned temp files", "temp-dir", tempDir, "count", removed)
+	}
+}
+
+func hasAnyPrefix(value string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// tlsServer is an http.Server which serves the certificate reloaded by certReloader.
+type tlsServer struct {
+	*http.Server
+	certReloader *certreloader.CertReloader
+}
+
+func createTLSServer(name string, handler http.Handler, listener config.ListenerConfig, tlsConfig *tls.Config, metricsService bitsgo.MetricsService, logger *zap.Logger) *tlsServer {
+	certReloader, e := certreloader.NewCertReloader(name, listener.CertFile, listener.KeyFile, metricsService, clock.New())
+	if e != nil {
+		log.Log.Fatalw("Could not load TLS certificate", "name", name, "error", e)
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	tlsConfig.GetCertificate = certReloader.GetCertificate
+	return &tlsServer{
+		Server: &http.Server{
+			Handler: negroni.New(
+				middlewares.NewMetricsMiddleware(metricsService),
+				middlewares.NewZapLoggerMiddleware(log.Log),
+				&middlewares.MultipartMiddleware{},
+				&middlewares.PanicMiddleware{},
+				negroni.Wrap(handler)),
+			Addr:         fmt.Sprintf("%v:%v", listener.Address, listener.Port),
+			WriteTimeout: listener.WriteTimeout,
+			ReadTimeout:  listener.ReadTimeout,
+			ErrorLog:     log.NewStdLog(logger),
+			TLSConfig:    tlsConfig,
+		},
+		certReloader: certReloader,
+	}
+}
+
+func listenerWithDefaultAddress(listener config.ListenerConfig, defaultAddress string) config.ListenerConfig {
+	if listener.Address == "" {
+		listener.Address = defaultAddress
+	}
+	return listener
+}
+
+// serveUntilSignaled runs all servers until one of them fails or the process receives SIGTERM or SIGINT.
+// In the latter case, it returns while the servers are still accepting connections.
+func serveUntilSignaled(servers []*tlsServer) {
+	serverErrors := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *tlsServer) {
+			// The certificate is served by TLSConfig.GetCertificate
+			serverErrors <- server.ListenAndServeTLS("", "")
+		}(server)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+
+	select {
+	case e := <-serverErrors:
+		log.Log.Fatalw("http server crashed", "error", e)
+	case s := <-signals:
+		log.Log.Infow("Received signal. Draining.", "signal", s.String())
 	}
-	e = httpServer.ListenAndServeTLS(config.CertFile, config.KeyFile)
-	log.Log.Fatalw("http server crashed", "error", e)
+}
+
+// shutDownServers stops accepting connections and waits for in-flight requests until ctx is done.
+func shutDownServers(ctx context.Context, servers []*tlsServer) {
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *tlsServer) {
+			defer wg.Done()
+			if e := server.Shutdown(ctx); e != nil {
+				log.Log.Errorw("Could not shut down server gracefully", "address", server.Addr, "error", e)
+			}
+		}(server)
+	}
+	wg.Wait()
+	log.Log.Infow("Servers shut down")
+}
+
+// drainAsyncUploadQueues waits for accepted async uploads until ctx is done.
+func drainAsyncUploadQueues(ctx context.Context, resourceHandlers []*bitsgo.ResourceHandler) (tempFilesInUse []string) {
+	var (
+		wg    sync.WaitGroup
+		mutex sync.Mutex
+	)
+	for _, resourceHandler := range resourceHandlers {
+		wg.Add(1)
+		go func(resourceHandler *bitsgo.ResourceHandler) {
+			defer wg.Done()
+			inUse := resourceHandler.DrainAsyncUploadQueue(ctx)
+			mutex.Lock()
+			tempFilesInUse = append(tempFilesInUse, inUse...)
+			mutex.Unlock()
+		}(resourceHandler)
+	}
+	wg.Wait()
+	log.Log.Infow("Async upload queues drained", "temp-files-in-use", len(tempFilesInUse))
+	return tempFilesInUse
 }
 
 func createLoggerWith(logLevel string) *zap.Logger {
@@ -147,8 +543,8 @@ func basicAuthCredentialsFrom(configCredententials []config.Credential) (basicAu
 	return
 }
 
-func createBlobstoreAndSignURLHandler(blobstoreConfig config.BlobstoreConfig, publicEndpoint *url.URL, port int, secret string, resourceType string, logger *zap.SugaredLogger, metricsService bitsgo.MetricsService) (bitsgo.Blobstore, *bitsgo.SignResourceHandler) {
-	localResourceSigner := createLocalResourceSigner(publicEndpoint, port, secret, resourceType)
+func createBlobstoreAndSignURLHandler(blobstoreConfig config.BlobstoreConfig, publicEndpoint *url.URL, port int, pathSigner pathsigner.PathSigner, maxExpiration time.Duration, resourceType string, logger *zap.SugaredLogger, metricsService bitsgo.MetricsService) (decorator.Blobstore, *bitsgo.SignResourceHandler) {
+	localResourceSigner := createLocalResourceSigner(publicEndpoint, port, pathSigner, resourceType)
 	switch blobstoreConfig.BlobstoreType {
 	case config.Local:
 		log.Log.Infow("Creating local blobstore", "path-prefix", blobstoreConfig.LocalConfig.PathPrefix)
@@ -157,7 +553,7 @@ func createBlobstoreAndSignURLHandler(blobstoreConfig config.BlobstoreConfig, pu
 					local.NewBlobstore(*blobstoreConfig.LocalConfig),
 					metricsService,
 					resourceType)),
-			bitsgo.NewSignResourceHandler(localResourceSigner, localResourceSigner)
+			bitsgo.NewSignResourceHandlerWithMaxExpiration(localResourceSigner, localResourceSigner, maxExpiration)
 	case config.AWS:
 		log.Log.Infow("Creating S3 blobstore", "bucket", blobstoreConfig.S3Config.Bucket)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -165,10 +561,11 @@ func createBlobstoreAndSignURLHandler(blobstoreConfig config.BlobstoreConfig, pu
 					s3.NewBlobstoreWithLogger(*blobstoreConfig.S3Config, logger),
 					metricsService,
 					resourceType)),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithMaxExpiration(
 				decorator.ForResourceSignerWithPathPartitioning(
 					s3.NewBlobstoreWithLogger(*blobstoreConfig.S3Config, logger)),
-				localResourceSigner)
+				localResourceSigner,
+				maxExpiration)
 	case config.Google:
 		log.Log.Infow("Creating GCP blobstore", "bucket", blobstoreConfig.GCPConfig.Bucket)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -176,10 +573,11 @@ func createBlobstoreAndSignURLHandler(blobstoreConfig config.BlobstoreConfig, pu
 					gcp.NewBlobstore(*blobstoreConfig.GCPConfig),
 					metricsService,
 					resourceType)),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithMaxExpiration(
 				decorator.ForResourceSignerWithPathPartitioning(
 					gcp.NewBlobstore(*blobstoreConfig.GCPConfig)),
-				localResourceSigner)
+				localResourceSigner,
+				maxExpiration)
 	case config.Azure:
 		log.Log.Infow("Creating Azure blobstore", "container", blobstoreConfig.AzureConfig.ContainerName)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -187,10 +585,11 @@ func createBlobstoreAndSignURLHandler(blobstoreConfig config.BlobstoreConfig, pu
 					azure.NewBlobstore(*blobstoreConfig.AzureConfig),
 					metricsService,
 					resourceType)),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithMaxExpiration(
 				decorator.ForResourceSignerWithPathPartitioning(
 					azure.NewBlobstore(*blobstoreConfig.AzureConfig)),
-				localResourceSigner)
+				localResourceSigner,
+				maxExpiration)
 	case config.OpenStack:
 		log.Log.Infow("Creating Openstack blobstore", "container", blobstoreConfig.OpenstackConfig.ContainerName)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -198,10 +597,11 @@ func createBlobstoreAndSignURLHandler(blobstoreConfig config.BlobstoreConfig, pu
 					openstack.NewBlobstore(*blobstoreConfig.OpenstackConfig),
 					metricsService,
 					resourceType)),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithMaxExpiration(
 				decorator.ForResourceSignerWithPathPartitioning(
 					openstack.NewBlobstore(*blobstoreConfig.OpenstackConfig)),
-				localResourceSigner)
+				localResourceSigner,
+				maxExpiration)
 	case config.WebDAV:
 		log.Log.Infow("Creating Webdav blobstore",
 			"public-endpoint", blobstoreConfig.WebdavConfig.PublicEndpoint,
@@ -213,12 +613,10 @@ func createBlobstoreAndSignURLHandler(blobstoreConfig config.BlobstoreConfig, pu
 						metricsService,
 						resourceType),
 					blobstoreConfig.WebdavConfig.DirectoryKey+"/")),
-			bitsgo.NewSignResourceHandler(
-				decorator.ForResourceSignerWithPathPartitioning(
-					decorator.ForResourceSignerWithPathPrefixing(
-						webdav.NewBlobstore(*blobstoreConfig.WebdavConfig),
-						blobstoreConfig.WebdavConfig.DirectoryKey+"/")),
-				localResourceSigner)
+			bitsgo.NewSignResourceHandlerWithMaxExpiration(
+				createWebdavResourceSigner(*blobstoreConfig.WebdavConfig, blobstoreConfig.WebdavConfig.DirectoryKey+"/", localResourceSigner),
+				localResourceSigner,
+				maxExpiration)
 	case config.Alibaba:
 		log.Log.Infow("Creating Alibaba blobstore", "bucket", blobstoreConfig.AlibabaConfig.BucketName)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -226,18 +624,19 @@ func createBlobstoreAndSignURLHandler(blobstoreConfig config.BlobstoreConfig, pu
 					alibaba.NewBlobstore(*blobstoreConfig.AlibabaConfig),
 					metricsService,
 					resourceType)),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithMaxExpiration(
 				decorator.ForResourceSignerWithPathPartitioning(
 					alibaba.NewBlobstore(*blobstoreConfig.AlibabaConfig)),
-				localResourceSigner)
+				localResourceSigner,
+				maxExpiration)
 	default:
 		log.Log.Fatalw("blobstoreConfig is invalid.", "blobstore-type", blobstoreConfig.BlobstoreType)
 		return nil, nil // satisfy compiler
 	}
 }
 
-func createBuildpackCacheSignURLHandler(blobstoreConfig config.BlobstoreConfig, publicEndpoint *url.URL, port int, secret string, logger *zap.SugaredLogger, metricsService bitsgo.MetricsService) (bitsgo.Blobstore, *bitsgo.SignResourceHandler) {
-	localResourceSigner := createLocalResourceSigner(publicEndpoint, port, secret, "buildpack_cache/entries")
+func createBuildpackCacheSignURLHandler(blobstoreConfig config.BlobstoreConfig, publicEndpoint *url.URL, port int, pathSigner pathsigner.PathSigner, maxExpiration time.Duration, logger *zap.SugaredLogger, metricsService bitsgo.MetricsService) (decorator.Blobstore, *bitsgo.SignResourceHandler) {
+	localResourceSigner := createLocalResourceSigner(publicEndpoint, port, pathSigner, "buildpack_cache/entries")
 	switch blobstoreConfig.BlobstoreType {
 	case config.Local:
 		log.Log.Infow("Creating local blobstore", "path-prefix", blobstoreConfig.LocalConfig.PathPrefix)
@@ -248,7 +647,7 @@ func createBuildpackCacheSignURLHandler(blobstoreConfig config.BlobstoreConfig,
 						metricsService,
 						"buildpack_cache"),
 					"buildpack_cache/")),
-			bitsgo.NewSignResourceHandler(localResourceSigner, localResourceSigner)
+			bitsgo.NewSignResourceHandlerWithMaxExpiration(localResourceSigner, localResourceSigner, maxExpiration)
 	case config.AWS:
 		log.Log.Infow("Creating S3 blobstore", "bucket", blobstoreConfig.S3Config.Bucket)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -258,12 +657,13 @@ func createBuildpackCacheSignURLHandler(blobstoreConfig config.BlobstoreConfig,
 						metricsService,
 						"buildpack_cache"),
 					"buildpack_cache/")),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithMaxExpiration(
 				decorator.ForResourceSignerWithPathPartitioning(
 					decorator.ForResourceSignerWithPathPrefixing(
 						s3.NewBlobstoreWithLogger(*blobstoreConfig.S3Config, logger),
 						"buildpack_cache")),
-				localResourceSigner)
+				localResourceSigner,
+				maxExpiration)
 	case config.Google:
 		log.Log.Infow("Creating GCP blobstore", "bucket", blobstoreConfig.GCPConfig.Bucket)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -273,12 +673,13 @@ func createBuildpackCacheSignURLHandler(blobstoreConfig config.BlobstoreConfig,
 						metricsService,
 						"buildpack_cache"),
 					"buildpack_cache/")),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithMaxExpiration(
 				decorator.ForResourceSignerWithPathPartitioning(
 					decorator.ForResourceSignerWithPathPrefixing(
 						gcp.NewBlobstore(*blobstoreConfig.GCPConfig),
 						"buildpack_cache")),
-				localResourceSigner)
+				localResourceSigner,
+				maxExpiration)
 	case config.Azure:
 		log.Log.Infow("Creating Azure blobstore", "container", blobstoreConfig.AzureConfig.ContainerName)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -288,12 +689,13 @@ func createBuildpackCacheSignURLHandler(blobstoreConfig config.BlobstoreConfig,
 						metricsService,
 						"buildpack_cache"),
 					"buildpack_cache/")),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithMaxExpiration(
 				decorator.ForResourceSignerWithPathPartitioning(
 					decorator.ForResourceSignerWithPathPrefixing(
 						azure.NewBlobstore(*blobstoreConfig.AzureConfig),
 						"buildpack_cache")),
-				localResourceSigner)
+				localResourceSigner,
+				maxExpiration)
 	case config.OpenStack:
 		log.Log.Infow("Creating Openstack blobstore", "container", blobstoreConfig.OpenstackConfig.ContainerName)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -303,12 +705,13 @@ func createBuildpackCacheSignURLHandler(blobstoreConfig config.BlobstoreConfig,
 						metricsService,
 						"buildpack_cache"),
 					"buildpack_cache/")),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithMaxExpiration(
 				decorator.ForResourceSignerWithPathPartitioning(
 					decorator.ForResourceSignerWithPathPrefixing(
 						openstack.NewBlobstore(*blobstoreConfig.OpenstackConfig),
 						"buildpack_cache")),
-				localResourceSigner)
+				localResourceSigner,
+				maxExpiration)
 	case config.WebDAV:
 		log.Log.Infow("Creating Webdav blobstore",
 			"public-endpoint", blobstoreConfig.WebdavConfig.PublicEndpoint,
@@ -320,12 +723,10 @@ func createBuildpackCacheSignURLHandler(blobstoreConfig config.BlobstoreConfig,
 						metricsService,
 						"buildpack_cache"),
 					blobstoreConfig.WebdavConfig.DirectoryKey+"/buildpack_cache/")),
-			bitsgo.NewSignResourceHandler(
-				decorator.ForResourceSignerWithPathPartitioning(
-					decorator.ForResourceSignerWithPathPrefixing(
-						webdav.NewBlobstore(*blobstoreConfig.WebdavConfig),
-						blobstoreConfig.WebdavConfig.DirectoryKey+"/buildpack_cache/")),
-				localResourceSigner)
+			bitsgo.NewSignResourceHandlerWithMaxExpiration(
+				createWebdavResourceSigner(*blobstoreConfig.WebdavConfig, blobstoreConfig.WebdavConfig.DirectoryKey+"/buildpack_cache/", localResourceSigner),
+				localResourceSigner,
+				maxExpiration)
 	case config.Alibaba:
 		log.Log.Infow("Creating Alibaba blobstore", "bucket", blobstoreConfig.AlibabaConfig.BucketName)
 		return decorator.ForBlobstoreWithPathPartitioning(
@@ -335,34 +736,68 @@ func createBuildpackCacheSignURLHandler(blobstoreConfig config.BlobstoreConfig,
 						metricsService,
 						"buildpack_cache"),
 					"buildpack_cache/")),
-			bitsgo.NewSignResourceHandler(
+			bitsgo.NewSignResourceHandlerWithMaxExpiration(
 				decorator.ForResourceSignerWithPathPartitioning(
 					decorator.ForResourceSignerWithPathPrefixing(
 						alibaba.NewBlobstore(*blobstoreConfig.AlibabaConfig),
 						"buildpack_cache")),
-				localResourceSigner)
+				localResourceSigner,
+				maxExpiration)
 	default:
 		log.Log.Fatalw("blobstoreConfig is invalid.", "blobstore-type", blobstoreConfig.BlobstoreType)
 		return nil, nil // satisfy compiler
 	}
 }
 
-func createLocalResourceSigner(publicEndpoint *url.URL, port int, secret string, resourceType string) bitsgo.ResourceSigner {
+func createPathSignerValidator(secrets []config.SigningSecret, md5Secret string, signedURLsConfig config.SignedURLsConfig) *pathsigner.PathSignerValidator {
+	pathSignerValidator := &pathsigner.PathSignerValidator{
+		Secrets:                     make(map[string]string),
+		Clock:                       clock.New(),
+		AcceptMD5Signatures:         signedURLsConfig.AcceptMD5Signatures,
+		MD5Secret:                   md5Secret,
+		AcceptLegacySignaturesUntil: time.Now().Add(signedURLsConfig.LegacySignatureGracePeriod),
+	}
+	for _, secret := range secrets {
+		pathSignerValidator.Secrets[secret.KeyID] = secret.Secret
+		if secret.Active {
+			pathSignerValidator.ActiveKeyID = secret.KeyID
+		}
+	}
+	return pathSignerValidator
+}
+
+func createLocalResourceSigner(publicEndpoint *url.URL, port int, pathSigner pathsigner.PathSigner, resourceType string) bitsgo.ResourceSigner {
 	return &local.LocalResourceSigner{
 		DelegateEndpoint:   fmt.Sprintf("%v://%v:%v", publicEndpoint.Scheme, publicEndpoint.Host, port),
-		Signer:             &pathsigner.PathSignerValidator{secret, clock.New()},
+		Signer:             pathSigner,
 		ResourcePathPrefix: "/" + resourceType + "/",
 	}
 }
 
-func createAppStashBlobstore(blobstoreConfig config.BlobstoreConfig, publicEndpoint *url.URL, port int, secret string, logger *zap.SugaredLogger, metricsService bitsgo.MetricsService) (bitsgo.NoRedirectBlobstore, *bitsgo.SignResourceHandler) {
-	signAppStashMatchesHandler := bitsgo.NewSignResourceHandler(
+func createWebdavResourceSigner(webdavConfig config.WebdavBlobstoreConfig, pathPrefix string, localResourceSigner bitsgo.ResourceSigner) bitsgo.ResourceSigner {
+	if webdavConfig.Generic {
+		// Generic WebDAV servers have no signing endpoint. Hence, bits-service signs the URLs itself and proxies the requests.
+		return localResourceSigner
+	}
+	return decorator.ForResourceSignerWithPathPartitioning(
+		decorator.ForResourceSignerWithPathPrefixing(
+			webdav.NewBlobstore(webdavConfig),
+			pathPrefix))
+}
+
+func createAppStashSignURLHandler(publicEndpoint *url.URL, port int, pathSigner pathsigner.PathSigner, maxExpiration time.Duration, endpoint string) *bitsgo.SignResourceHandler {
+	return bitsgo.NewSignResourceHandlerWithMaxExpiration(
 		nil, // signing for get is not necessary for app_stash
 		&local.LocalResourceSigner{
 			DelegateEndpoint:   fmt.Sprintf("%v://%v:%v", publicEndpoint.Scheme, publicEndpoint.Host, port),
-			Signer:             &pathsigner.PathSignerValidator{secret, clock.New()},
-			ResourcePathPrefix: "/app_stash/matches",
-		})
+			Signer:             pathSigner,
+			ResourcePathPrefix: "/app_stash/" + endpoint,
+		},
+		maxExpiration)
+}
+
+func createAppStashBlobstore(blobstoreConfig config.BlobstoreConfig, publicEndpoint *url.URL, port int, pathSigner pathsigner.PathSigner, maxExpiration time.Duration, logger *zap.SugaredLogger, metricsService bitsgo.MetricsService) (decorator.Blobstore, *bitsgo.SignResourceHandler) {
+	signAppStashMatchesHandler := createAppStashSignURLHandler(publicEndpoint, port, pathSigner, maxExpiration, "matches")
 
 	switch blobstoreConfig.BlobstoreType {
 	case config.Local:
@@ -443,16 +878,180 @@ func createAppStashBlobstore(blobstoreConfig config.BlobstoreConfig, publicEndpo
 	}
 }
 
-func createUpdater(ccUpdaterConfig *config.CCUpdaterConfig) bitsgo.Updater {
+func createTokenAuth(tokenAuthConfig *config.TokenAuthConfig) routes.TokenAuth {
+	if tokenAuthConfig == nil {
+		return routes.TokenAuth{}
+	}
+	var keyProviders middlewares.CombinedKeyProvider
+	if len(tokenAuthConfig.VerificationKeys) != 0 {
+		staticKeyProvider, e := middlewares.NewStaticKeyProvider(tokenAuthConfig.VerificationKeys)
+		if e != nil {
+			log.Log.Fatalw("Could not parse token_auth.verification_keys", "error", e)
+		}
+		keyProviders = append(keyProviders, staticKeyProvider)
+	}
+	if tokenAuthConfig.JWKSURL != "" {
+		keyProviders = append(keyProviders, middlewares.NewJWKSKeyProvider(tokenAuthConfig.JWKSURL, &http.Client{Timeout: 10 * time.Second}, time.Minute))
+	}
+	return routes.TokenAuth{
+		Middleware:     middlewares.NewBearerTokenAuthMiddleware(keyProviders, tokenAuthConfig.Issuer, tokenAuthConfig.Audience),
+		InternalRouter: tokenAuthConfig.InternalRouter,
+		SignRoutes:     tokenAuthConfig.SignRoutes,
+	}
+}
+
+func createAsyncUploadQueue(asyncUploadsConfig config.AsyncUploadsConfig, resourceType string) *bitsgo.AsyncUploadQueue {
+	queueDir := ""
+	if asyncUploadsConfig.QueueDir != "" {
+		queueDir = filepath.Join(asyncUploadsConfig.QueueDir, resourceType)
+	}
+	queue, e := bitsgo.NewAsyncUploadQueue(queueDir, asyncUploadsConfig.WorkersOrDefault())
+	if e != nil {
+		log.Log.Fatalw("Could not create async upload queue", "resource-type", resourceType, "error", e)
+	}
+	return queue
+}
+
+func createEventBus(eventsConfig config.EventsConfig, metricsService bitsgo.MetricsService) *events.Bus {
+	var subscriptions []*events.Subscription
+	for _, sinkConfig := range eventsConfig.Sinks {
+		var sink events.Sink
+		switch sinkConfig.Type {
+		case "webhook":
+			sink = events.NewWebhookSink(
+				sinkConfig.Webhook.URL,
+				sinkConfig.Webhook.Secret,
+				sinkConfig.Webhook.Headers,
+				&http.Client{Timeout: sinkConfig.Webhook.TimeoutOrDefault()})
+		case "json_lines":
+			jsonLinesSink, e := events.NewJSONLinesSink(sinkConfig.JSONLines.Path)
+			if e != nil {
+				log.Log.Fatalw("Could not create events sink", "name", sinkConfig.Name, "error", e)
+			}
+			sink = jsonLinesSink
+		case "cc_updater":
+			// The subscription retries failed notifications
+			sink = events.NewUpdaterSink(newCCUpdater(sinkConfig.CCUpdater, metricsService))
+		}
+		subscriptions = append(subscriptions, events.NewSubscription(
+			sinkConfig.Name,
+			sink,
+			events.Filter{EventTypes: sinkConfig.EventTypes, ResourceTypes: sinkConfig.ResourceTypes},
+			events.RetryPolicy{
+				MaxRetries:      sinkConfig.Retries.MaxRetriesOrDefault(),
+				InitialInterval: sinkConfig.Retries.InitialIntervalOrDefault(),
+				MaxInterval:     sinkConfig.Retries.MaxIntervalOrDefault(),
+			},
+			sinkConfig.QueueSizeOrDefault(),
+			metricsService))
+	}
+	return events.NewBus(subscriptions...)
+}
+
+func createAuditor(auditConfig config.AuditConfig) *audit.Auditor {
+	var sinks []audit.Sink
+	if auditConfig.JSONLines != nil {
+		sink, e := audit.NewJSONLinesSink(auditConfig.JSONLines.Path, int64(auditConfig.JSONLines.MaxSizeBytes()), auditConfig.JSONLines.MaxBackups)
+		if e != nil {
+			log.Log.Fatalw("Could not create audit.json_lines sink", "error", e)
+		}
+		sinks = append(sinks, sink)
+	}
+	if auditConfig.Syslog != nil {
+		tag := auditConfig.Syslog.Tag
+		if tag == "" {
+			tag = "bits-service-audit"
+		}
+		sink, e := audit.NewSyslogSink(auditConfig.Syslog.Network, auditConfig.Syslog.Address, tag)
+		if e != nil {
+			log.Log.Fatalw("Could not create audit.syslog sink", "error", e)
+		}
+		sinks = append(sinks, sink)
+	}
+	if auditConfig.Webhook != nil {
+		sinks = append(sinks, audit.NewWebhookSink(
+			auditConfig.Webhook.URL,
+			auditConfig.Webhook.Headers,
+			&http.Client{Timeout: auditConfig.Webhook.TimeoutOrDefault()},
+			auditConfig.Webhook.QueueSizeOrDefault()))
+	}
+	return audit.NewAuditor(sinks...)
+}
+
+func createClientCertAuth(clientAuthConfig *config.ClientAuthConfig) routes.ClientCertAuth {
+	if clientAuthConfig == nil {
+		return routes.ClientCertAuth{}
+	}
+	return routes.ClientCertAuth{Enabled: true, AllowedIdentities: clientAuthConfig.AllowedIdentities}
+}
+
+func createTLSConfig(clientAuthConfig *config.ClientAuthConfig, clientAuthType tls.ClientAuthType) *tls.Config {
+	if clientAuthConfig == nil {
+		return nil
+	}
+	caCert, e := ioutil.ReadFile(clientAuthConfig.CACertFile)
+	if e != nil {
+		log.Log.Fatalw("Could not read client_auth.ca_cert_file", "error", e)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caCert) {
+		log.Log.Fatalw("client_auth.ca_cert_file does not contain any PEM-encoded certificates", "ca-cert-file", clientAuthConfig.CACertFile)
+	}
+	return &tls.Config{
+		ClientCAs:  clientCAs,
+		ClientAuth: clientAuthType,
+	}
+}
+
+// createUpdater redelivers dead-lettered notifications until stopRedelivering is closed.
+func createUpdater(ccUpdaterConfig *config.CCUpdaterConfig, metricsService bitsgo.MetricsService, stopRedelivering <-chan struct{}) bitsgo.Updater {
 	if ccUpdaterConfig == nil {
 		return &bitsgo.NullUpdater{}
 	}
-	return ccupdater.NewCCUpdater(
+	updater := newCCUpdater(ccUpdaterConfig, metricsService).
+		WithRetries(
+			ccUpdaterConfig.Retries.MaxRetriesOrDefault(),
+			ccUpdaterConfig.Retries.InitialIntervalOrDefault(),
+			ccUpdaterConfig.Retries.MaxIntervalOrDefault())
+	if ccUpdaterConfig.DeadLetterDir != "" {
+		deadLetters, e := ccupdater.NewDeadLetterQueue(ccUpdaterConfig.DeadLetterDir)
+		if e != nil {
+			log.Log.Fatalw("Could not create CC updater dead letter queue", "error", e)
+		}
+		updater.WithDeadLetterQueue(deadLetters)
+		go updater.RedeliverRegularly(ccUpdaterConfig.RedeliveryIntervalOrDefault(), stopRedelivering)
+	}
+	return updater
+}
+
+// newCCUpdater creates an updater which tries each notification only once.
+func newCCUpdater(ccUpdaterConfig *config.CCUpdaterConfig, metricsService bitsgo.MetricsService) *ccupdater.CCUpdater {
+	updater := ccupdater.NewCCUpdater(
 		ccUpdaterConfig.Endpoint,
 		ccUpdaterConfig.Method,
+		ccUpdaterConfig.TimeoutOrDefault(),
 		ccUpdaterConfig.ClientCertFile,
 		ccUpdaterConfig.ClientKeyFile,
-		ccUpdaterConfig.CACertFile)
+		ccUpdaterConfig.CACertFile).
+		WithPayloadFormat(ccUpdaterConfig.PayloadFormatOrDefault()).
+		WithSuccessStatusCodes(ccUpdaterConfig.SuccessStatusCodes).
+		WithMetricsService(metricsService)
+	for state, text := range ccUpdaterConfig.PayloadTemplates.ByState() {
+		payloadTemplate, e := ccupdater.ParsePayloadTemplate(state, text)
+		if e != nil {
+			log.Log.Fatalw("Could not parse CC updater payload template", "state", state, "error", e)
+		}
+		updater.WithPayloadTemplate(state, payloadTemplate)
+	}
+	if ccUpdaterConfig.UAA != nil {
+		updater.WithTokenSource(ccupdater.NewUAATokenSource(
+			ccUpdaterConfig.UAA.TokenEndpoint,
+			ccUpdaterConfig.UAA.ClientID,
+			ccUpdaterConfig.UAA.ClientSecret,
+			ccUpdaterConfig.TimeoutOrDefault(),
+			ccUpdaterConfig.UAA.CACertFile))
+	}
+	return updater
 }
 
 func regularlyEmitGoRoutines(metricsService bitsgo.MetricsService) {
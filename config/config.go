@@ -1,12 +1,17 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
 	"math"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/cloudfoundry-incubator/bits-service/ccupdater"
+	"github.com/cloudfoundry-incubator/bits-service/passwordhash"
 	"github.com/pkg/errors"
 
 	"code.cloudfoundry.org/bytefmt"
@@ -21,7 +26,7 @@ type Config struct {
 	AppStash   BlobstoreConfig `yaml:"app_stash"`
 
 	// BuildpackCache is a Pseudo blobstore, because in reality it is using the Droplets blobstore.
-	// However, we want to be able to control its max_body_size.
+	// However, we want to be able to control its max_body_size and cc_updater.
 	BuildpackCache BlobstoreConfig `yaml:"buildpack_cache"`
 
 	Logging         LoggingConfig
@@ -29,14 +34,50 @@ type Config struct {
 	PrivateEndpoint string `yaml:"private_endpoint"`
 	Secret          string
 	Port            int
-	SigningUsers    []Credential `yaml:"signing_users"`
-	MaxBodySize     string       `yaml:"max_body_size"`
-	CertFile        string       `yaml:"cert_file"`
-	KeyFile         string       `yaml:"key_file"`
+	SigningUsers    []Credential     `yaml:"signing_users"`
+	SigningLockout  LockoutConfig    `yaml:"signing_users_lockout"`
+	SignedURLs      SignedURLsConfig `yaml:"signed_urls"`
+	MaxBodySize     string           `yaml:"max_body_size"`
+	CertFile        string           `yaml:"cert_file"`
+	KeyFile         string           `yaml:"key_file"`
 
 	CCUpdater *CCUpdaterConfig `yaml:"cc_updater"`
 
+	TokenAuth *TokenAuthConfig `yaml:"token_auth"`
+
+	ClientAuth *ClientAuthConfig `yaml:"client_auth"`
+
+	Audit AuditConfig
+
+	// Listeners separates the public and the private endpoint into two servers. Without it, both endpoints
+	// are served on Port and distinguished by their host names.
+	Listeners *ListenersConfig `yaml:"listeners"`
+
 	AppStashConfig AppStashConfig `yaml:"app_stash_config"`
+
+	ZipLimits ZipLimitsConfig `yaml:"zip_limits"`
+
+	UploadJobs UploadJobsConfig `yaml:"upload_jobs"`
+
+	AsyncUploads AsyncUploadsConfig `yaml:"async_uploads"`
+
+	Shutdown ShutdownConfig `yaml:"shutdown"`
+
+	Events EventsConfig `yaml:"events"`
+
+	// RemoteFetch enables uploads from a source_url. Without it, such uploads are rejected.
+	RemoteFetch *RemoteFetchConfig `yaml:"remote_fetch"`
+
+	// TempDir holds temp files, e.g. of uploads being processed, in a subdirectory per process. Only temp files
+	// created by the service are removed on startup and shutdown. Defaults to bits-service in the system's temp dir.
+	TempDir string `yaml:"temp_dir"`
+}
+
+func (config *Config) TempDirOrDefault() string {
+	if config.TempDir == "" {
+		return filepath.Join(os.TempDir(), "bits-service")
+	}
+	return config.TempDir
 }
 
 func (config *Config) PublicEndpointUrl() *url.URL {
@@ -56,16 +97,30 @@ func (config *Config) PrivateEndpointUrl() *url.URL {
 }
 
 type BlobstoreConfig struct {
-	BlobstoreType     BlobstoreType             `yaml:"blobstore_type"`
-	LocalConfig       *LocalBlobstoreConfig     `yaml:"local_config"`
-	S3Config          *S3BlobstoreConfig        `yaml:"s3_config"`
-	GCPConfig         *GCPBlobstoreConfig       `yaml:"gcp_config"`
-	AzureConfig       *AzureBlobstoreConfig     `yaml:"azure_config"`
-	OpenstackConfig   *OpenstackBlobstoreConfig `yaml:"openstack_config"`
-	WebdavConfig      *WebdavBlobstoreConfig    `yaml:"webdav_config"`
-	AlibabaConfig     *AlibabaBlobstoreConfig   `yaml:"alibaba_config"`
-	MaxBodySize       string                    `yaml:"max_body_size"`
-	GlobalMaxBodySize string                    // Not to be set by yaml
+	BlobstoreType   BlobstoreType             `yaml:"blobstore_type"`
+	LocalConfig     *LocalBlobstoreConfig     `yaml:"local_config"`
+	S3Config        *S3BlobstoreConfig        `yaml:"s3_config"`
+	GCPConfig       *GCPBlobstoreConfig       `yaml:"gcp_config"`
+	AzureConfig     *AzureBlobstoreConfig     `yaml:"azure_config"`
+	OpenstackConfig *OpenstackBlobstoreConfig `yaml:"openstack_config"`
+	WebdavConfig    *WebdavBlobstoreConfig    `yaml:"webdav_config"`
+	AlibabaConfig   *AlibabaBlobstoreConfig   `yaml:"alibaba_config"`
+	MaxBodySize     string                    `yaml:"max_body_size"`
+	Timeouts        TimeoutsConfig            `yaml:"timeouts"`
+	// CCUpdater notifies the Cloud Controller about uploads of this resource type. For packages,
+	// the top-level cc_updater can be used instead.
+	CCUpdater         *CCUpdaterConfig `yaml:"cc_updater"`
+	GlobalMaxBodySize string           // Not to be set by yaml
+}
+
+// TimeoutsConfig limits how long a single blobstore operation may take. A zero value means no timeout.
+type TimeoutsConfig struct {
+	Exists    time.Duration `yaml:"exists"`
+	Get       time.Duration `yaml:"get"`
+	Put       time.Duration `yaml:"put"`
+	Copy      time.Duration `yaml:"copy"`
+	Delete    time.Duration `yaml:"delete"`
+	DeleteDir time.Duration `yaml:"delete_dir"`
 }
 
 type BlobstoreType string
@@ -161,6 +216,23 @@ type OpenstackBlobstoreConfig struct {
 	TrustId        string `yaml:"trust_id"`         // Id of the trust (v3 auth only)
 
 	AccountMetaTempURLKey string `yaml:"account_meta_temp_url_key"` // used as secret for signed URLs
+
+	SegmentSize      string `yaml:"segment_size"`      // Objects larger than this are uploaded as segmented large objects (default: 1G, max: 5G)
+	SegmentContainer string `yaml:"segment_container"` // Container for large object segments (default: <container_name>_segments)
+}
+
+// Swift rejects single-request uploads larger than 5GB.
+const MaxOpenstackSegmentSize = 5 << 30
+
+func (c *OpenstackBlobstoreConfig) SegmentSizeBytes() uint64 {
+	return parseSizeProperty(c.SegmentSize, 1<<30)
+}
+
+func (c *OpenstackBlobstoreConfig) SegmentContainerName() string {
+	if c.SegmentContainer != "" {
+		return c.SegmentContainer
+	}
+	return c.ContainerName + "_segments"
 }
 
 type WebdavBlobstoreConfig struct {
@@ -171,6 +243,7 @@ type WebdavBlobstoreConfig struct {
 	SkipCertVerify  bool   `yaml:"skip_cert_verify"`
 	Username        string
 	Password        string
+	Generic         bool // Set this to true for standard WebDAV servers (e.g. Apache mod_dav), which do not follow the CF blobstore conventions
 }
 
 type AlibabaBlobstoreConfig struct {
@@ -191,8 +264,216 @@ func (config WebdavBlobstoreConfig) CACert() string {
 type Credential struct {
 	Username string
 	Password string
+	// PasswordHash is a bcrypt or argon2id hash of the password. It should be used instead of Password.
+	PasswordHash string `yaml:"password_hash"`
+	// Scopes restrict the URLs the user may sign to "<resource type>:<verb>" pairs, e.g. "packages:put".
+	// "*" matches any resource type or verb. A user without scopes may sign any URL.
+	Scopes []string
+}
+
+// SigningResourceTypes are the resource types of signing user scopes.
+var SigningResourceTypes = []string{"packages", "droplets", "buildpacks", "buildpack_cache", "app_stash_matches", "app_stash_entries", "app_stash_bundles"}
+
+// SigningVerbs are the verbs of signing user scopes.
+var SigningVerbs = []string{"get", "head", "put", "post", "delete"}
+
+// LockoutConfig configures how client IPs are locked out after failed basic auth attempts.
+type LockoutConfig struct {
+	MaxFailedAttempts int `yaml:"max_failed_attempts"`
+	Window            time.Duration
+	LockoutDuration   time.Duration `yaml:"lockout_duration"`
+}
+
+func (config *LockoutConfig) MaxFailedAttemptsOrDefault() int {
+	if config.MaxFailedAttempts == 0 {
+		return 5
+	}
+	return config.MaxFailedAttempts
+}
+
+func (config *LockoutConfig) WindowOrDefault() time.Duration {
+	if config.Window == 0 {
+		return time.Minute
+	}
+	return config.Window
+}
+
+func (config *LockoutConfig) LockoutDurationOrDefault() time.Duration {
+	if config.LockoutDuration == 0 {
+		return 5 * time.Minute
+	}
+	return config.LockoutDuration
+}
+
+type SignedURLsConfig struct {
+	// Secrets used to sign URLs with HMAC-SHA256. The active one signs new URLs, all of them are accepted when
+	// validating. When empty, the top-level secret is used.
+	Secrets []SigningSecret `yaml:"secrets"`
+
+	// AcceptMD5Signatures allows URLs signed with md5 and the top-level secret by earlier versions.
+	AcceptMD5Signatures bool `yaml:"accept_md5_signatures"`
+
+	// URLs signed by earlier versions are not bound to an HTTP method. They are accepted for this long after startup.
+	// Requires accept_md5_signatures.
+	LegacySignatureGracePeriod time.Duration `yaml:"legacy_signature_grace_period"`
+
+	// MaxExpiration bounds the expires_in a client may request when signing a URL. Defaults to 1 hour.
+	MaxExpiration time.Duration `yaml:"max_expiration"`
+}
+
+func (config *SignedURLsConfig) MaxExpirationOrDefault() time.Duration {
+	if config.MaxExpiration == 0 {
+		return 1 * time.Hour
+	}
+	return config.MaxExpiration
+}
+
+type SigningSecret struct {
+	KeyID  string `yaml:"key_id"`
+	Secret string
+	Active bool
+}
+
+const DefaultSigningKeyID = "default"
+
+func (config *Config) SigningSecrets() []SigningSecret {
+	if len(config.SignedURLs.Secrets) == 0 {
+		return []SigningSecret{{KeyID: DefaultSigningKeyID, Secret: config.Secret, Active: true}}
+	}
+	return config.SignedURLs.Secrets
+}
+
+// TokenAuthConfig configures JWT bearer token authentication, e.g. with tokens issued by UAA.
+type TokenAuthConfig struct {
+	// JWKSURL points to a JSON Web Key Set, e.g. UAA's /token_keys endpoint.
+	JWKSURL string `yaml:"jwks_url"`
+	// VerificationKeys are PEM-encoded public keys by key ID. They can be used instead of or in addition to a JWKS.
+	VerificationKeys map[string]string `yaml:"verification_keys"`
+	Issuer           string
+	Audience         string
+
+	// InternalRouter requires tokens for the resource routes on the private host.
+	InternalRouter bool `yaml:"internal_router"`
+	// SignRoutes requires tokens instead of basic auth for the /sign routes.
+	SignRoutes bool `yaml:"sign_routes"`
+}
+
+// AuditConfig configures the sinks audit events are written to. Without sinks, auditing is disabled.
+type AuditConfig struct {
+	JSONLines *JSONLinesAuditConfig `yaml:"json_lines"`
+	Syslog    *SyslogAuditConfig
+	Webhook   *WebhookAuditConfig
+}
+
+type JSONLinesAuditConfig struct {
+	Path string
+	// MaxSize is the size at which the file is rotated, e.g. "100M". Defaults to 100M.
+	MaxSize    string `yaml:"max_size"`
+	MaxBackups int    `yaml:"max_backups"`
+}
+
+func (config *JSONLinesAuditConfig) MaxSizeBytes() uint64 {
+	return parseSizeProperty(config.MaxSize, 100*bytefmt.MEGABYTE)
+}
+
+type SyslogAuditConfig struct {
+	// Network and Address of the syslog daemon, e.g. "udp" and "localhost:514". If empty, the local daemon is used.
+	Network string
+	Address string
+	Tag     string
+}
+
+type WebhookAuditConfig struct {
+	URL       string
+	Headers   map[string]string
+	Timeout   time.Duration
+	QueueSize int `yaml:"queue_size"`
 }
 
+func (config *WebhookAuditConfig) TimeoutOrDefault() time.Duration {
+	if config.Timeout == 0 {
+		return 10 * time.Second
+	}
+	return config.Timeout
+}
+
+func (config *WebhookAuditConfig) QueueSizeOrDefault() int {
+	if config.QueueSize == 0 {
+		return 1000
+	}
+	return config.QueueSize
+}
+
+// DefaultServerTimeout is used for listeners without read_timeout or write_timeout.
+const DefaultServerTimeout = 60 * time.Minute
+
+type ListenersConfig struct {
+	Public  ListenerConfig
+	Private ListenerConfig
+}
+
+type ListenerConfig struct {
+	// Address defaults to the BITS_LISTEN_ADDR environment variable or 0.0.0.0.
+	Address string
+	Port    int
+	// CertFile and KeyFile default to the top-level cert_file and key_file.
+	CertFile     string        `yaml:"cert_file"`
+	KeyFile      string        `yaml:"key_file"`
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+}
+
+// PublicPort is the port signed URLs for the local blobstore point to.
+func (config *Config) PublicPort() int {
+	if config.Listeners != nil {
+		return config.Listeners.Public.Port
+	}
+	return config.Port
+}
+
+// SinglePortListener returns the listener for serving both endpoints on Port.
+func (config *Config) SinglePortListener() ListenerConfig {
+	return config.withListenerDefaults(ListenerConfig{Port: config.Port})
+}
+
+// PublicListener returns the public listener with defaults applied. It must only be used if Listeners is configured.
+func (config *Config) PublicListener() ListenerConfig {
+	return config.withListenerDefaults(config.Listeners.Public)
+}
+
+// PrivateListener returns the private listener with defaults applied. It must only be used if Listeners is configured.
+func (config *Config) PrivateListener() ListenerConfig {
+	return config.withListenerDefaults(config.Listeners.Private)
+}
+
+func (config *Config) withListenerDefaults(listener ListenerConfig) ListenerConfig {
+	if listener.CertFile == "" {
+		listener.CertFile = config.CertFile
+	}
+	if listener.KeyFile == "" {
+		listener.KeyFile = config.KeyFile
+	}
+	if listener.ReadTimeout == 0 {
+		listener.ReadTimeout = DefaultServerTimeout
+	}
+	if listener.WriteTimeout == 0 {
+		listener.WriteTimeout = DefaultServerTimeout
+	}
+	return listener
+}
+
+// ClientAuthConfig configures mutual TLS for the private host.
+type ClientAuthConfig struct {
+	// CACertFile contains the PEM-encoded CA certificates client certificates are verified against.
+	CACertFile string `yaml:"ca_cert_file"`
+	// AllowedIdentities restricts the subject CNs and SANs allowed per route group. A route group without entries
+	// accepts any verified client certificate.
+	AllowedIdentities map[string][]string `yaml:"allowed_identities"`
+}
+
+// ClientAuthRouteGroups are the valid keys of ClientAuthConfig.AllowedIdentities.
+var ClientAuthRouteGroups = []string{"sign", "app_stash", "packages", "buildpacks", "droplets", "buildpack_cache"}
+
 type LoggingConfig struct {
 	Level string
 }
@@ -203,6 +484,112 @@ type CCUpdaterConfig struct {
 	ClientCertFile string `yaml:"client_cert_file"`
 	ClientKeyFile  string `yaml:"client_key_file"`
 	CACertFile     string `yaml:"ca_cert_file"`
+	// Timeout limits each request to the Cloud Controller. Defaults to 10s.
+	Timeout time.Duration `yaml:"timeout"`
+	Retries RetriesConfig `yaml:"retries"`
+	// PayloadFormat is one of CCUpdaterPayloadFormats. Defaults to checksums.
+	PayloadFormat string `yaml:"payload_format"`
+	// DeadLetterDir keeps notifications about completed uploads which could not be delivered even after retrying.
+	// They are redelivered every RedeliveryInterval. When empty, such notifications are lost.
+	DeadLetterDir      string        `yaml:"dead_letter_dir"`
+	RedeliveryInterval time.Duration `yaml:"redelivery_interval"`
+	// UAA authenticates requests with a client credentials token, in addition to any client certificate.
+	UAA              *UAAConfig             `yaml:"uaa"`
+	PayloadTemplates PayloadTemplatesConfig `yaml:"payload_templates"`
+	// SuccessStatusCodes are the only status codes accepted as success. When empty, any status code below 400 is.
+	SuccessStatusCodes []int `yaml:"success_status_codes"`
+}
+
+type UAAConfig struct {
+	TokenEndpoint string `yaml:"token_endpoint"`
+	ClientID      string `yaml:"client_id"`
+	ClientSecret  string `yaml:"client_secret"`
+	CACertFile    string `yaml:"ca_cert_file"`
+}
+
+// PayloadTemplatesConfig replaces the payloads sent for the respective states. Templates use Go's text/template
+// syntax with the fields Guid, State, Sha1, Sha256 and Error. Values should be encoded with the json function,
+// e.g. {"state": {{json .State}}}.
+type PayloadTemplatesConfig struct {
+	ProcessingUpload string `yaml:"processing_upload"`
+	Ready            string `yaml:"ready"`
+	Failed           string `yaml:"failed"`
+}
+
+// ByState maps the Cloud Controller states to the configured templates. States without template are omitted.
+func (config PayloadTemplatesConfig) ByState() map[string]string {
+	templates := make(map[string]string)
+	for state, payloadTemplate := range map[string]string{
+		ccupdater.StateProcessingUpload: config.ProcessingUpload,
+		ccupdater.StateReady:            config.Ready,
+		ccupdater.StateFailed:           config.Failed,
+	} {
+		if payloadTemplate != "" {
+			templates[state] = payloadTemplate
+		}
+	}
+	return templates
+}
+
+// PackagesCCUpdater returns packages.cc_updater, falling back to the top-level cc_updater. It may be nil.
+func (config *Config) PackagesCCUpdater() *CCUpdaterConfig {
+	if config.Packages.CCUpdater != nil {
+		return config.Packages.CCUpdater
+	}
+	return config.CCUpdater
+}
+
+func (config *CCUpdaterConfig) PayloadFormatOrDefault() string {
+	if config.PayloadFormat == "" {
+		return "checksums"
+	}
+	return config.PayloadFormat
+}
+
+func (config *CCUpdaterConfig) TimeoutOrDefault() time.Duration {
+	if config.Timeout == 0 {
+		return 10 * time.Second
+	}
+	return config.Timeout
+}
+
+func (config *CCUpdaterConfig) RedeliveryIntervalOrDefault() time.Duration {
+	if config.RedeliveryInterval == 0 {
+		return time.Minute
+	}
+	return config.RedeliveryInterval
+}
+
+// RetriesConfig configures the exponential backoff of failed notifications.
+type RetriesConfig struct {
+	// MaxRetries defaults to 5. Use -1 to disable retries.
+	MaxRetries      int           `yaml:"max_retries"`
+	InitialInterval time.Duration `yaml:"initial_interval"`
+	MaxInterval     time.Duration `yaml:"max_interval"`
+}
+
+func (config *RetriesConfig) MaxRetriesOrDefault() uint64 {
+	switch {
+	case config.MaxRetries == 0:
+		return 5
+	case config.MaxRetries < 0:
+		return 0
+	}
+	return uint64(config.MaxRetries)
+}
+
+func (config *RetriesConfig) InitialIntervalOrDefault() time.Duration {
+	if config.InitialInterval == 0 {
+		return 500 * time.Millisecond
+	}
+	return config.InitialInterval
+}
+
+func (config *RetriesConfig) MaxIntervalOrDefault() time.Duration {
+	if config.MaxInterval == 0 {
+		return 10 * time.Second
+	}
+	return config.MaxInterval
 }
 
 type AppStashConfig struct {
@@ -217,6 +604,168 @@ func (config *AppStashConfig) MaximumSizeBytes() uint64 {
 	return parseSizeProperty(config.MaximumSize, math.MaxUint64)
 }
 
+// ZipLimitsConfig restricts uploaded packages and app stash entries, so that small zip files cannot expand
+// to huge temp files.
+type ZipLimitsConfig struct {
+	// MaxUncompressedSize is the maximum total size of all entries, e.g. "4G". Defaults to 4G.
+	MaxUncompressedSize string `yaml:"max_uncompressed_size"`
+	MaxEntries          int    `yaml:"max_entries"`
+	MaxCompressionRatio int    `yaml:"max_compression_ratio"`
+	MaxPathDepth        int    `yaml:"max_path_depth"`
+}
+
+func (config *ZipLimitsConfig) MaxUncompressedSizeBytes() uint64 {
+	return parseSizeProperty(config.MaxUncompressedSize, 4*bytefmt.GIGABYTE)
+}
+
+func (config *ZipLimitsConfig) MaxEntriesOrDefault() int {
+	if config.MaxEntries == 0 {
+		return 100000
+	}
+	return config.MaxEntries
+}
+
+func (config *ZipLimitsConfig) MaxCompressionRatioOrDefault() int {
+	if config.MaxCompressionRatio == 0 {
+		return 200
+	}
+	return config.MaxCompressionRatio
+}
+
+func (config *ZipLimitsConfig) MaxPathDepthOrDefault() int {
+	if config.MaxPathDepth == 0 {
+		return 64
+	}
+	return config.MaxPathDepth
+}
+
+// UploadJobsConfig configures how the status of async uploads is kept.
+type UploadJobsConfig struct {
+	// Retention is how long completed uploads can be queried. Defaults to 1h.
+	Retention time.Duration `yaml:"retention"`
+}
+
+func (config *UploadJobsConfig) RetentionOrDefault() time.Duration {
+	if config.Retention == 0 {
+		return time.Hour
+	}
+	return config.Retention
+}
+
+// AsyncUploadsConfig configures how uploads with async=true are processed.
+type AsyncUploadsConfig struct {
+	// QueueDir persists accepted uploads and their temp files, so that they are resumed after a restart.
+	// Each resource type uses a subdirectory. When empty, pending uploads are lost on restart.
+	QueueDir string `yaml:"queue_dir"`
+	// Workers is the number of concurrent uploads per resource type. Defaults to 4.
+	Workers int `yaml:"workers"`
+}
+
+func (config *AsyncUploadsConfig) WorkersOrDefault() int {
+	if config.Workers == 0 {
+		return 4
+	}
+	return config.Workers
+}
+
+// EventsConfig configures the sinks blob lifecycle events are sent to. Without sinks, no events are sent.
+type EventsConfig struct {
+	Sinks []EventSinkConfig `yaml:"sinks"`
+}
+
+// EventTypes are the types of blob lifecycle events.
+var EventTypes = []string{"created", "processing", "ready", "failed", "copied", "deleted"}
+
+// EventResourceTypes are the resource types blob lifecycle events are published for.
+var EventResourceTypes = []string{"package", "droplet", "buildpack", "buildpack_cache"}
+
+// EventSinkTypes are the supported values of EventSinkConfig.Type.
+var EventSinkTypes = []string{"webhook", "json_lines", "cc_updater"}
+
+type EventSinkConfig struct {
+	// Name identifies the sink in logs and metrics.
+	Name string
+	// Type is one of EventSinkTypes. The sink is configured by the property of the same name.
+	Type string
+	// EventTypes and ResourceTypes filter the events sent to the sink. Empty lists match all events.
+	EventTypes    []string      `yaml:"event_types"`
+	ResourceTypes []string      `yaml:"resource_types"`
+	Retries       RetriesConfig `yaml:"retries"`
+	// QueueSize is the number of events which can be pending before new ones are dropped. Defaults to 1000.
+	QueueSize int `yaml:"queue_size"`
+
+	Webhook   *WebhookEventSinkConfig   `yaml:"webhook"`
+	JSONLines *JSONLinesEventSinkConfig `yaml:"json_lines"`
+	CCUpdater *CCUpdaterConfig          `yaml:"cc_updater"`
+}
+
+func (config *EventSinkConfig) QueueSizeOrDefault() int {
+	if config.QueueSize == 0 {
+		return 1000
+	}
+	return config.QueueSize
+}
+
+type WebhookEventSinkConfig struct {
+	URL string
+	// Secret is the key of the HMAC-SHA256 signature of each request.
+	Secret  string
+	Headers map[string]string
+	// Timeout limits each request. Defaults to 10s.
+	Timeout time.Duration
+}
+
+func (config *WebhookEventSinkConfig) TimeoutOrDefault() time.Duration {
+	if config.Timeout == 0 {
+		return 10 * time.Second
+	}
+	return config.Timeout
+}
+
+type JSONLinesEventSinkConfig struct {
+	Path string
+}
+
+// RemoteFetchConfig restricts from where the service fetches uploads with a source_url.
+type RemoteFetchConfig struct {
+	// AllowedHosts are the host names content may be fetched from. A leading "*." matches all subdomains.
+	AllowedHosts []string `yaml:"allowed_hosts"`
+	// MaxSize limits the size of fetched content in addition to the resource's max_body_size. Defaults to 1G.
+	MaxSize string `yaml:"max_size"`
+	// Timeout limits each fetch, including reading the content. Defaults to 10m.
+	Timeout time.Duration `yaml:"timeout"`
+	// AllowPrivateNetworks allows fetching from hosts which resolve to loopback, link-local or private
+	// addresses. Only enable it if allowed_hosts are internal hosts.
+	AllowPrivateNetworks bool `yaml:"allow_private_networks"`
+}
+
+func (config *RemoteFetchConfig) MaxSizeBytes() uint64 {
+	return parseSizeProperty(config.MaxSize, bytefmt.GIGABYTE)
+}
+
+func (config *RemoteFetchConfig) TimeoutOrDefault() time.Duration {
+	if config.Timeout == 0 {
+		return 10 * time.Minute
+	}
+	return config.Timeout
+}
+
+// ShutdownConfig configures how the service drains when it receives SIGTERM or SIGINT.
+type ShutdownConfig struct {
+	// ReadinessGracePeriod is how long the readiness check fails before the servers stop accepting connections,
+	// so that load balancers can take the instance out of rotation. Defaults to 0.
+	ReadinessGracePeriod time.Duration `yaml:"readiness_grace_period"`
+	// DrainTimeout limits how long in-flight requests and async uploads can take. Defaults to 30s.
+	DrainTimeout time.Duration `yaml:"drain_timeout"`
+}
+
+func (config *ShutdownConfig) DrainTimeoutOrDefault() time.Duration {
+	if config.DrainTimeout == 0 {
+		return 30 * time.Second
+	}
+	return config.DrainTimeout
+}
+
 func parseSizeProperty(size string, defaultValue uint64) uint64 {
 	if size == "" {
 		return defaultValue
@@ -255,8 +804,22 @@ func LoadConfig(filename string) (config Config, err error) {
 
 	var errs []string
 
-	if config.Port == 0 {
-		errs = append(errs, "port must be an integer > 0")
+	if config.Listeners == nil {
+		if config.Port == 0 {
+			errs = append(errs, "port must be an integer > 0")
+		}
+		if config.CertFile == "" {
+			errs = append(errs, "cert_file must not be empty")
+		}
+		if config.KeyFile == "" {
+			errs = append(errs, "key_file must not be empty")
+		}
+	} else {
+		verifyListener(config.PublicListener(), "listeners.public", &errs)
+		verifyListener(config.PrivateListener(), "listeners.private", &errs)
+		if config.Listeners.Public.Address == config.Listeners.Private.Address && config.Listeners.Public.Port == config.Listeners.Private.Port {
+			errs = append(errs, "listeners.public and listeners.private must not use the same address and port")
+		}
 	}
 	if config.PublicEndpoint == "" {
 		errs = append(errs, "public_endpoint must not be empty")
@@ -288,12 +851,6 @@ func LoadConfig(filename string) (config Config, err error) {
 			}
 		}
 	}
-	if config.CertFile == "" {
-		errs = append(errs, "cert_file must not be empty")
-	}
-	if config.KeyFile == "" {
-		errs = append(errs, "key_file must not be empty")
-	}
 	if config.MaxBodySize != "" {
 		_, e = bytefmt.ToBytes(config.MaxBodySize)
 		if e != nil {
@@ -302,15 +859,53 @@ func LoadConfig(filename string) (config Config, err error) {
 	}
 
 	if config.CCUpdater != nil {
-		config.CCUpdater.Method = "PATCH"
-		u, e := url.Parse(config.CCUpdater.Endpoint)
-		if e != nil {
-			errs = append(errs, "cc_updater.endpoint is invalid. Caused by:"+e.Error())
-		} else if u.Host == "" {
-			errs = append(errs, "cc_updater.endpoint host must not be empty")
+		verifyCCUpdater(config.CCUpdater, "cc_updater", &errs)
+		if config.Packages.CCUpdater != nil {
+			errs = append(errs, "cc_updater and packages.cc_updater must not both be configured")
+		}
+	}
+	deadLetterDirs := make(map[string]bool)
+	for _, resource := range []struct {
+		name      string
+		ccUpdater *CCUpdaterConfig
+	}{
+		{"packages", config.PackagesCCUpdater()},
+		{"droplets", config.Droplets.CCUpdater},
+		{"buildpacks", config.Buildpacks.CCUpdater},
+		{"buildpack_cache", config.BuildpackCache.CCUpdater},
+	} {
+		if resource.ccUpdater == nil {
+			continue
+		}
+		if resource.ccUpdater != config.CCUpdater {
+			verifyCCUpdater(resource.ccUpdater, resource.name+".cc_updater", &errs)
+		}
+		if resource.ccUpdater.DeadLetterDir != "" {
+			if deadLetterDirs[resource.ccUpdater.DeadLetterDir] {
+				errs = append(errs, "cc_updater dead_letter_dir '"+resource.ccUpdater.DeadLetterDir+"' must not be shared by resource types")
+			}
+			deadLetterDirs[resource.ccUpdater.DeadLetterDir] = true
 		}
 	}
 
+	if config.TokenAuth != nil {
+		if config.TokenAuth.JWKSURL == "" && len(config.TokenAuth.VerificationKeys) == 0 {
+			errs = append(errs, "token_auth must have a jwks_url or verification_keys configured")
+		}
+		if config.TokenAuth.JWKSURL != "" {
+			u, e := url.Parse(config.TokenAuth.JWKSURL)
+			if e != nil {
+				errs = append(errs, "token_auth.jwks_url is invalid. Caused by:"+e.Error())
+			} else if u.Host == "" {
+				errs = append(errs, "token_auth.jwks_url host must not be empty")
+			}
+		}
+	}
+
+	if config.ClientAuth != nil {
+		verifyClientAuth(*config.ClientAuth, &errs)
+	}
+
 	verifyBlobstoreType(config.Droplets.BlobstoreType, "droplets", &errs)
 	verifyBlobstoreType(config.Packages.BlobstoreType, "packages", &errs)
 	verifyBlobstoreType(config.AppStash.BlobstoreType, "app_stash", &errs)
@@ -321,6 +916,52 @@ func LoadConfig(filename string) (config Config, err error) {
 	verifyBlobstoreConfig(config.Buildpacks, "buildpacks", &errs)
 	verifyBlobstoreConfig(config.AppStash, "app_stash", &errs)
 
+	verifyOpenstackSegmentSize(config.Droplets, "droplets", &errs)
+	verifyOpenstackSegmentSize(config.Packages, "packages", &errs)
+	verifyOpenstackSegmentSize(config.Buildpacks, "buildpacks", &errs)
+	verifyOpenstackSegmentSize(config.AppStash, "app_stash", &errs)
+
+	if config.SignedURLs.LegacySignatureGracePeriod < 0 {
+		errs = append(errs, "signed_urls.legacy_signature_grace_period must not be negative")
+	}
+	if config.SignedURLs.MaxExpiration < 0 {
+		errs = append(errs, "signed_urls.max_expiration must not be negative")
+	}
+	verifySigningSecrets(config.SignedURLs.Secrets, &errs)
+	verifySigningUsers(config.SigningUsers, &errs)
+	verifyAudit(config.Audit, &errs)
+	verifyZipLimits(config.ZipLimits, &errs)
+	verifyEvents(config.Events, &errs)
+	verifyRemoteFetch(config.RemoteFetch, &errs)
+	if config.UploadJobs.Retention < 0 {
+		errs = append(errs, "upload_jobs.retention must not be negative")
+	}
+	if config.AsyncUploads.Workers < 0 {
+		errs = append(errs, "async_uploads.workers must not be negative")
+	}
+	if config.Shutdown.ReadinessGracePeriod < 0 || config.Shutdown.DrainTimeout < 0 {
+		errs = append(errs, "shutdown.readiness_grace_period and shutdown.drain_timeout must not be negative")
+	}
+	if config.TempDir != "" && filepath.Clean(config.TempDir) == filepath.Clean(os.TempDir()) {
+		errs = append(errs, "temp_dir must be dedicated to the service and must not be the system's temp dir")
+	}
+	if config.AsyncUploads.QueueDir != "" && isInside(config.AsyncUploads.QueueDir, config.TempDirOrDefault()) {
+		errs = append(errs, "async_uploads.queue_dir must not be inside temp_dir")
+	}
+	for _, path := range config.pathsOutsideTempDir() {
+		if isInside(path.path, config.TempDirOrDefault()) || isInside(config.TempDirOrDefault(), path.path) {
+			errs = append(errs, "temp_dir must neither contain nor be inside "+path.name+" '"+path.path+"'")
+		}
+	}
+	if config.SigningLockout.MaxFailedAttempts < 0 || config.SigningLockout.Window < 0 || config.SigningLockout.LockoutDuration < 0 {
+		errs = append(errs, "signing_users_lockout values must not be negative")
+	}
+
+	verifyTimeouts(config.Droplets.Timeouts, "droplets", &errs)
+	verifyTimeouts(config.Packages.Timeouts, "packages", &errs)
+	verifyTimeouts(config.Buildpacks.Timeouts, "buildpacks", &errs)
+	verifyTimeouts(config.AppStash.Timeouts, "app_stash", &errs)
+
 	if len(errs) > 0 {
 		// returning here already, because follow-up checks are difficult if not even basic checks succeed
 		return Config{}, errors.New("error in config values: " + strings.Join(errs, "; "))
@@ -333,7 +974,7 @@ func LoadConfig(filename string) (config Config, err error) {
 		config.BuildpackCache.S3Config != nil ||
 		config.BuildpackCache.AlibabaConfig != nil ||
 		config.BuildpackCache.WebdavConfig != nil {
-		errs = append(errs, "buildpack_cache must not have a blobstore configured, as it only exists to allow to configure max_body_size. "+
+		errs = append(errs, "buildpack_cache must not have a blobstore configured, as it only exists to allow to configure max_body_size and cc_updater. "+
 			"As blobstore, the droplet blobstore is used.")
 	}
 
@@ -380,6 +1021,332 @@ func verifyBlobstoreConfig(blobstoreConfig BlobstoreConfig, resourceType string,
 	}
 }
 
+func verifyOpenstackSegmentSize(blobstoreConfig BlobstoreConfig, resourceType string, errs *[]string) {
+	if blobstoreConfig.BlobstoreType != OpenStack || blobstoreConfig.OpenstackConfig == nil || blobstoreConfig.OpenstackConfig.SegmentSize == "" {
+		return
+	}
+	segmentSize, e := bytefmt.ToBytes(blobstoreConfig.OpenstackConfig.SegmentSize)
+	if e != nil {
+		*errs = append(*errs, resourceType+".openstack_config.segment_size is invalid. Caused by: "+e.Error())
+		return
+	}
+	if segmentSize == 0 || segmentSize > MaxOpenstackSegmentSize {
+		*errs = append(*errs, resourceType+".openstack_config.segment_size must be greater than 0 and not greater than 5G")
+	}
+}
+
+func verifySigningSecrets(secrets []SigningSecret, errs *[]string) {
+	if len(secrets) == 0 {
+		return
+	}
+	numActive := 0
+	keyIDs := make(map[string]bool)
+	for _, secret := range secrets {
+		if secret.KeyID == "" {
+			*errs = append(*errs, "signed_urls.secrets key_id must not be empty")
+		} else if keyIDs[secret.KeyID] {
+			*errs = append(*errs, "signed_urls.secrets key_id '"+secret.KeyID+"' is not unique")
+		}
+		keyIDs[secret.KeyID] = true
+		if secret.Secret == "" {
+			*errs = append(*errs, "signed_urls.secrets secret for key_id '"+secret.KeyID+"' must not be empty")
+		}
+		if secret.Active {
+			numActive++
+		}
+	}
+	if numActive != 1 {
+		*errs = append(*errs, "signed_urls.secrets must have exactly one active secret")
+	}
+}
+
+func verifySigningUsers(signingUsers []Credential, errs *[]string) {
+	for _, user := range signingUsers {
+		if user.PasswordHash != "" {
+			if user.Password != "" {
+				*errs = append(*errs, "signing_users '"+user.Username+"' must not have both password and password_hash")
+			}
+			if e := passwordhash.Validate(user.PasswordHash); e != nil {
+				*errs = append(*errs, "signing_users '"+user.Username+"' password_hash is invalid. Caused by: "+e.Error())
+			}
+		}
+		for _, scope := range user.Scopes {
+			parts := strings.SplitN(scope, ":", 2)
+			if len(parts) != 2 ||
+				(parts[0] != "*" && !contains(SigningResourceTypes, parts[0])) ||
+				(parts[1] != "*" && !contains(SigningVerbs, strings.ToLower(parts[1]))) {
+				*errs = append(*errs, "signing_users '"+user.Username+"' scope '"+scope+"' is invalid. Must be <resource type>:<verb> with resource type one of "+
+					strings.Join(SigningResourceTypes, ", ")+" and verb one of "+strings.Join(SigningVerbs, ", ")+", or *")
+			}
+		}
+	}
+}
+
+type namedPath struct {
+	name string
+	path string
+}
+
+// pathsOutsideTempDir returns the configured paths which hold data that must survive a restart.
+func (config *Config) pathsOutsideTempDir() []namedPath {
+	var paths []namedPath
+	for _, blobstore := range []struct {
+		name   string
+		config BlobstoreConfig
+	}{
+		{"buildpacks", config.Buildpacks},
+		{"droplets", config.Droplets},
+		{"packages", config.Packages},
+		{"app_stash", config.AppStash},
+		{"buildpack_cache", config.BuildpackCache},
+	} {
+		if blobstore.config.LocalConfig != nil && blobstore.config.LocalConfig.PathPrefix != "" {
+			paths = append(paths, namedPath{blobstore.name + ".local_config.path_prefix", blobstore.config.LocalConfig.PathPrefix})
+		}
+		if blobstore.config.CCUpdater != nil && blobstore.config.CCUpdater.DeadLetterDir != "" {
+			paths = append(paths, namedPath{blobstore.name + ".cc_updater.dead_letter_dir", blobstore.config.CCUpdater.DeadLetterDir})
+		}
+	}
+	if config.CCUpdater != nil && config.CCUpdater.DeadLetterDir != "" {
+		paths = append(paths, namedPath{"cc_updater.dead_letter_dir", config.CCUpdater.DeadLetterDir})
+	}
+	if config.Audit.JSONLines != nil && config.Audit.JSONLines.Path != "" {
+		paths = append(paths, namedPath{"audit.json_lines.path", config.Audit.JSONLines.Path})
+	}
+	for i, sink := range config.Events.Sinks {
+		if sink.JSONLines != nil && sink.JSONLines.Path != "" {
+			paths = append(paths, namedPath{fmt.Sprintf("events.sinks[%v].json_lines.path", i), sink.JSONLines.Path})
+		}
+	}
+	return paths
+}
+
+func isInside(path string, dir string) bool {
+	return strings.HasPrefix(filepath.Clean(path)+"/", filepath.Clean(dir)+"/")
+}
+
+func verifyAudit(audit AuditConfig, errs *[]string) {
+	if audit.JSONLines != nil {
+		if audit.JSONLines.Path == "" {
+			*errs = append(*errs, "audit.json_lines.path must not be empty")
+		}
+		if audit.JSONLines.MaxSize != "" {
+			if _, e := bytefmt.ToBytes(audit.JSONLines.MaxSize); e != nil {
+				*errs = append(*errs, "audit.json_lines.max_size is invalid. Caused by: "+e.Error())
+			}
+		}
+		if audit.JSONLines.MaxBackups < 0 {
+			*errs = append(*errs, "audit.json_lines.max_backups must not be negative")
+		}
+	}
+	if audit.Webhook != nil {
+		u, e := url.Parse(audit.Webhook.URL)
+		if e != nil {
+			*errs = append(*errs, "audit.webhook.url is invalid. Caused by:"+e.Error())
+		} else if u.Host == "" {
+			*errs = append(*errs, "audit.webhook.url host must not be empty")
+		}
+		if audit.Webhook.Timeout < 0 || audit.Webhook.QueueSize < 0 {
+			*errs = append(*errs, "audit.webhook timeout and queue_size must not be negative")
+		}
+	}
+}
+
+// CCUpdaterMethods are the HTTP methods the Cloud Controller can be notified with.
+var CCUpdaterMethods = []string{"PATCH", "PUT", "POST"}
+
+// CCUpdaterPayloadFormats are the supported values of CCUpdaterConfig.PayloadFormat.
+var CCUpdaterPayloadFormats = []string{"checksums", "flat"}
+
+// verifyCCUpdater defaults the method to PATCH.
+func verifyCCUpdater(ccUpdater *CCUpdaterConfig, name string, errs *[]string) {
+	if ccUpdater.Method == "" {
+		ccUpdater.Method = "PATCH"
+	}
+	u, e := url.Parse(ccUpdater.Endpoint)
+	if e != nil {
+		*errs = append(*errs, name+".endpoint is invalid. Caused by:"+e.Error())
+	} else if u.Host == "" {
+		*errs = append(*errs, name+".endpoint host must not be empty")
+	}
+	if !contains(CCUpdaterMethods, ccUpdater.Method) {
+		*errs = append(*errs, name+".method '"+ccUpdater.Method+"' is invalid. Must be one of "+strings.Join(CCUpdaterMethods, ", "))
+	}
+	if ccUpdater.PayloadFormat != "" && !contains(CCUpdaterPayloadFormats, ccUpdater.PayloadFormat) {
+		*errs = append(*errs, name+".payload_format '"+ccUpdater.PayloadFormat+"' is invalid. Must be one of "+strings.Join(CCUpdaterPayloadFormats, ", "))
+	}
+	if ccUpdater.Timeout < 0 || ccUpdater.RedeliveryInterval < 0 ||
+		ccUpdater.Retries.InitialInterval < 0 || ccUpdater.Retries.MaxInterval < 0 {
+		*errs = append(*errs, name+" timeout, redelivery_interval and retries intervals must not be negative")
+	}
+	if ccUpdater.Retries.MaxRetries < -1 {
+		*errs = append(*errs, name+".retries.max_retries must not be less than -1")
+	}
+	if ccUpdater.UAA != nil {
+		u, e := url.Parse(ccUpdater.UAA.TokenEndpoint)
+		if e != nil || u.Host == "" {
+			*errs = append(*errs, name+".uaa.token_endpoint must be a valid URL")
+		}
+		if ccUpdater.UAA.ClientID == "" {
+			*errs = append(*errs, name+".uaa.client_id must not be empty")
+		}
+	}
+	for state, payloadTemplate := range ccUpdater.PayloadTemplates.ByState() {
+		_, e := ccupdater.ParsePayloadTemplate(state, payloadTemplate)
+		if e != nil {
+			*errs = append(*errs, name+".payload_templates for state "+state+" is invalid. Caused by: "+e.Error())
+		}
+	}
+	for _, statusCode := range ccUpdater.SuccessStatusCodes {
+		if statusCode < 100 || statusCode >= 400 {
+			*errs = append(*errs, fmt.Sprintf("%v.success_status_codes %v is invalid. Must be between 100 and 399", name, statusCode))
+		}
+	}
+}
+
+func verifyEvents(events EventsConfig, errs *[]string) {
+	names := make(map[string]bool)
+	for i, sink := range events.Sinks {
+		if sink.Name == "" {
+			*errs = append(*errs, fmt.Sprintf("events.sinks[%v].name must not be empty", i))
+		} else if names[sink.Name] {
+			*errs = append(*errs, "events.sinks name '"+sink.Name+"' is not unique")
+		}
+		names[sink.Name] = true
+		prefix := "events.sinks '" + sink.Name + "'"
+
+		for _, eventType := range sink.EventTypes {
+			if !contains(EventTypes, eventType) {
+				*errs = append(*errs, prefix+" event_types '"+eventType+"' is invalid. Must be one of "+strings.Join(EventTypes, ", "))
+			}
+		}
+		for _, resourceType := range sink.ResourceTypes {
+			if !contains(EventResourceTypes, resourceType) {
+				*errs = append(*errs, prefix+" resource_types '"+resourceType+"' is invalid. Must be one of "+strings.Join(EventResourceTypes, ", "))
+			}
+		}
+		if sink.QueueSize < 0 || sink.Retries.InitialInterval < 0 || sink.Retries.MaxInterval < 0 {
+			*errs = append(*errs, prefix+" queue_size and retries intervals must not be negative")
+		}
+		if sink.Retries.MaxRetries < -1 {
+			*errs = append(*errs, prefix+" retries.max_retries must not be less than -1")
+		}
+
+		switch sink.Type {
+		case "webhook":
+			if sink.Webhook == nil {
+				*errs = append(*errs, prefix+" is missing webhook config")
+				continue
+			}
+			u, e := url.Parse(sink.Webhook.URL)
+			if e != nil {
+				*errs = append(*errs, prefix+" webhook.url is invalid. Caused by:"+e.Error())
+			} else if u.Host == "" {
+				*errs = append(*errs, prefix+" webhook.url host must not be empty")
+			}
+			if sink.Webhook.Secret == "" {
+				*errs = append(*errs, prefix+" webhook.secret must not be empty")
+			}
+			if sink.Webhook.Timeout < 0 {
+				*errs = append(*errs, prefix+" webhook.timeout must not be negative")
+			}
+		case "json_lines":
+			if sink.JSONLines == nil || sink.JSONLines.Path == "" {
+				*errs = append(*errs, prefix+" json_lines.path must not be empty")
+			}
+		case "cc_updater":
+			if sink.CCUpdater == nil {
+				*errs = append(*errs, prefix+" is missing cc_updater config")
+				continue
+			}
+			verifyCCUpdater(sink.CCUpdater, prefix+" cc_updater", errs)
+		default:
+			*errs = append(*errs, prefix+" type '"+sink.Type+"' is invalid. Must be one of "+strings.Join(EventSinkTypes, ", "))
+		}
+	}
+}
+
+func verifyZipLimits(zipLimits ZipLimitsConfig, errs *[]string) {
+	if zipLimits.MaxUncompressedSize != "" {
+		if _, e := bytefmt.ToBytes(zipLimits.MaxUncompressedSize); e != nil {
+			*errs = append(*errs, "zip_limits.max_uncompressed_size is invalid. Caused by: "+e.Error())
+		}
+	}
+	if zipLimits.MaxEntries < 0 || zipLimits.MaxCompressionRatio < 0 || zipLimits.MaxPathDepth < 0 {
+		*errs = append(*errs, "zip_limits max_entries, max_compression_ratio and max_path_depth must not be negative")
+	}
+}
+
+func verifyListener(listener ListenerConfig, name string, errs *[]string) {
+	if listener.Port <= 0 {
+		*errs = append(*errs, name+".port must be an integer > 0")
+	}
+	if listener.CertFile == "" {
+		*errs = append(*errs, name+".cert_file must not be empty")
+	}
+	if listener.KeyFile == "" {
+		*errs = append(*errs, name+".key_file must not be empty")
+	}
+	if listener.ReadTimeout < 0 {
+		*errs = append(*errs, name+".read_timeout must not be negative")
+	}
+	if listener.WriteTimeout < 0 {
+		*errs = append(*errs, name+".write_timeout must not be negative")
+	}
+}
+
+func verifyClientAuth(clientAuth ClientAuthConfig, errs *[]string) {
+	if clientAuth.CACertFile == "" {
+		*errs = append(*errs, "client_auth.ca_cert_file must not be empty")
+	}
+	for routeGroup := range clientAuth.AllowedIdentities {
+		if !contains(ClientAuthRouteGroups, routeGroup) {
+			*errs = append(*errs, "client_auth.allowed_identities route group '"+routeGroup+"' is invalid. Valid route groups are: "+strings.Join(ClientAuthRouteGroups, ", "))
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func verifyRemoteFetch(remoteFetch *RemoteFetchConfig, errs *[]string) {
+	if remoteFetch == nil {
+		return
+	}
+	if len(remoteFetch.AllowedHosts) == 0 {
+		*errs = append(*errs, "remote_fetch.allowed_hosts must not be empty")
+	}
+	for _, host := range remoteFetch.AllowedHosts {
+		if host == "" || strings.ContainsAny(host, ":/?#@ ") || strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+			*errs = append(*errs, fmt.Sprintf("remote_fetch.allowed_hosts contains invalid host '%v'. "+
+				"Hosts must not have a scheme, port or path and may only use a leading \"*.\" as wildcard", host))
+		}
+	}
+	if remoteFetch.MaxSize != "" {
+		if _, e := bytefmt.ToBytes(remoteFetch.MaxSize); e != nil {
+			*errs = append(*errs, "remote_fetch.max_size is invalid. Caused by: "+e.Error())
+		}
+	}
+	if remoteFetch.Timeout < 0 {
+		*errs = append(*errs, "remote_fetch.timeout must not be negative")
+	}
+}
+
+func verifyTimeouts(timeouts TimeoutsConfig, resourceType string, errs *[]string) {
+	names := []string{"exists", "get", "put", "copy", "delete", "delete_dir"}
+	for i, timeout := range []time.Duration{timeouts.Exists, timeouts.Get, timeouts.Put, timeouts.Copy, timeouts.Delete, timeouts.DeleteDir} {
+		if timeout < 0 {
+			*errs = append(*errs, resourceType+".timeouts."+names[i]+" must not be negative")
+		}
+	}
+}
+
 func blobstoreConfigIsNil(blobstoreConfig BlobstoreConfig) bool {
 	switch blobstoreConfig.BlobstoreType {
 	case AWS:
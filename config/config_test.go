@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo"
@@ -228,4 +230,1629 @@ cert_file: /some/path
 
 	})
 
+	Context("openstack segment size", func() {
+		It("defaults to 1G", func() {
+			Expect((&OpenstackBlobstoreConfig{}).SegmentSizeBytes()).To(Equal(uint64(1073741824)))
+		})
+
+		It("uses <container_name>_segments as default segment container", func() {
+			Expect((&OpenstackBlobstoreConfig{ContainerName: "droplets"}).SegmentContainerName()).To(Equal("droplets_segments"))
+			Expect((&OpenstackBlobstoreConfig{ContainerName: "droplets", SegmentContainer: "segments"}).SegmentContainerName()).To(Equal("segments"))
+		})
+
+		It("returns an error when segment_size is larger than 5G", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: openstack
+  openstack_config:
+    container_name: dummy
+    segment_size: 6G
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(ContainSubstring("droplets.openstack_config.segment_size must be greater than 0 and not greater than 5G")))
+		})
+	})
+
+	Context("timeouts", func() {
+		It("parses durations per operation", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+  timeouts:
+    exists: 5s
+    put: 30m
+    delete_dir: 1h
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.Packages.Timeouts).To(Equal(TimeoutsConfig{
+				Exists:    5 * time.Second,
+				Put:       30 * time.Minute,
+				DeleteDir: time.Hour,
+			}))
+			Expect(config.Droplets.Timeouts).To(Equal(TimeoutsConfig{}))
+		})
+
+		It("returns an error when a timeout is negative", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+  timeouts:
+    get: -1s
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(ContainSubstring("droplets.timeouts.get must not be negative")))
+		})
+	})
+
+	Context("signed_urls", func() {
+		It("parses secrets", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+signed_urls:
+  accept_md5_signatures: true
+  max_expiration: 24h
+  secrets:
+  - key_id: key1
+    secret: old
+  - key_id: key2
+    secret: new
+    active: true
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.SigningSecrets()).To(Equal([]SigningSecret{
+				{KeyID: "key1", Secret: "old"},
+				{KeyID: "key2", Secret: "new", Active: true},
+			}))
+			Expect(config.SignedURLs.AcceptMD5Signatures).To(BeTrue())
+			Expect(config.SignedURLs.MaxExpirationOrDefault()).To(Equal(24 * time.Hour))
+		})
+
+		It("uses the top-level secret when no secrets are configured", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.SigningSecrets()).To(Equal([]SigningSecret{{KeyID: DefaultSigningKeyID, Secret: "geheim", Active: true}}))
+			Expect(config.SignedURLs.AcceptMD5Signatures).To(BeFalse())
+			Expect(config.SignedURLs.MaxExpirationOrDefault()).To(Equal(time.Hour))
+		})
+
+		It("returns an error when not exactly one secret is active", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+signed_urls:
+  secrets:
+  - key_id: key1
+    secret: old
+    active: true
+  - key_id: key2
+    secret: new
+    active: true
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(ContainSubstring("signed_urls.secrets must have exactly one active secret")))
+		})
+
+		It("returns an error when key IDs are not unique", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+secret: geheim
+signed_urls:
+  secrets:
+  - key_id: key1
+    secret: old
+    active: true
+  - key_id: key1
+    secret: new
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(ContainSubstring("signed_urls.secrets key_id 'key1' is not unique")))
+		})
+	})
+
+	Context("token_auth", func() {
+		It("parses it", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+token_auth:
+  jwks_url: https://uaa.example.com/token_keys
+  issuer: https://uaa.example.com/oauth/token
+  audience: bits_service
+  internal_router: true
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(*config.TokenAuth).To(Equal(TokenAuthConfig{
+				JWKSURL:        "https://uaa.example.com/token_keys",
+				Issuer:         "https://uaa.example.com/oauth/token",
+				Audience:       "bits_service",
+				InternalRouter: true,
+			}))
+		})
+
+		It("returns an error when no keys are configured", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+token_auth:
+  internal_router: true
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(ContainSubstring("token_auth must have a jwks_url or verification_keys configured")))
+		})
+	})
+
+	Context("client_auth", func() {
+		It("parses it", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+client_auth:
+  ca_cert_file: /some/ca.crt
+  allowed_identities:
+    sign: [cloud-controller]
+    packages: [cloud-controller, cc.service.cf.internal]
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(*config.ClientAuth).To(Equal(ClientAuthConfig{
+				CACertFile: "/some/ca.crt",
+				AllowedIdentities: map[string][]string{
+					"sign":     []string{"cloud-controller"},
+					"packages": []string{"cloud-controller", "cc.service.cf.internal"},
+				},
+			}))
+		})
+
+		It("requires a ca_cert_file", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+client_auth:
+  allowed_identities:
+    sign: [cloud-controller]
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(ContainSubstring("client_auth.ca_cert_file must not be empty")))
+		})
+
+		It("rejects unknown route groups", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+client_auth:
+  ca_cert_file: /some/ca.crt
+  allowed_identities:
+    signed: [cloud-controller]
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(ContainSubstring("client_auth.allowed_identities route group 'signed' is invalid")))
+		})
+	})
+
+	Context("listeners", func() {
+		It("parses them and applies defaults", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+key_file: /some/key
+cert_file: /some/cert
+listeners:
+  public:
+    port: 443
+    read_timeout: 5m
+  private:
+    address: 10.0.0.1
+    port: 8443
+    cert_file: /some/private/cert
+    key_file: /some/private/key
+    write_timeout: 30s
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.PublicPort()).To(Equal(443))
+			Expect(config.PublicListener()).To(Equal(ListenerConfig{
+				Port:         443,
+				CertFile:     "/some/cert",
+				KeyFile:      "/some/key",
+				ReadTimeout:  5 * time.Minute,
+				WriteTimeout: DefaultServerTimeout,
+			}))
+			Expect(config.PrivateListener()).To(Equal(ListenerConfig{
+				Address:      "10.0.0.1",
+				Port:         8443,
+				CertFile:     "/some/private/cert",
+				KeyFile:      "/some/private/key",
+				ReadTimeout:  DefaultServerTimeout,
+				WriteTimeout: 30 * time.Second,
+			}))
+		})
+
+		It("does not require a top-level port", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+key_file: /some/key
+listeners:
+  public:
+    port: 443
+  private:
+    cert_file: /some/private/cert
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(SatisfyAll(
+				Not(ContainSubstring("values: port must be an integer > 0")),
+				ContainSubstring("listeners.private.port must be an integer > 0"),
+				ContainSubstring("listeners.public.cert_file must not be empty"),
+			)))
+		})
+
+		It("rejects listeners using the same address and port", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+key_file: /some/key
+cert_file: /some/cert
+listeners:
+  public:
+    port: 443
+  private:
+    port: 443
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(ContainSubstring("listeners.public and listeners.private must not use the same address and port")))
+		})
+	})
+
+	Context("signing_users", func() {
+		It("parses password hashes, scopes and lockout settings", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+signing_users:
+- username: cc
+  password_hash: $2a$04$askb/DcexSVRR4imKS0N5eI6ZAXAyJZKLq/JmSsqLROyeY7Cm1B9a
+  scopes: ["packages:put", "droplets:*"]
+signing_users_lockout:
+  max_failed_attempts: 10
+  lockout_duration: 15m
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.SigningUsers).To(Equal([]Credential{{
+				Username:     "cc",
+				PasswordHash: "$2a$04$askb/DcexSVRR4imKS0N5eI6ZAXAyJZKLq/JmSsqLROyeY7Cm1B9a",
+				Scopes:       []string{"packages:put", "droplets:*"},
+			}}))
+			Expect(config.SigningLockout.MaxFailedAttemptsOrDefault()).To(Equal(10))
+			Expect(config.SigningLockout.WindowOrDefault()).To(Equal(time.Minute))
+			Expect(config.SigningLockout.LockoutDurationOrDefault()).To(Equal(15 * time.Minute))
+		})
+
+		It("rejects invalid password hashes and scopes", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+signing_users:
+- username: cc
+  password: secret
+  password_hash: 5f4dcc3b5aa765d61d8327deb882cf99
+  scopes: ["packages", "app_stash:post", "droplets:patch"]
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(SatisfyAll(
+				ContainSubstring("signing_users 'cc' must not have both password and password_hash"),
+				ContainSubstring("signing_users 'cc' password_hash is invalid"),
+				ContainSubstring("signing_users 'cc' scope 'packages' is invalid"),
+				ContainSubstring("signing_users 'cc' scope 'app_stash:post' is invalid"),
+				ContainSubstring("signing_users 'cc' scope 'droplets:patch' is invalid"),
+			)))
+		})
+	})
+
+	Context("audit", func() {
+		It("parses sinks and applies defaults", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+audit:
+  json_lines:
+    path: /var/vcap/sys/log/bits-service/audit.log
+    max_backups: 3
+  syslog:
+    network: udp
+    address: localhost:514
+  webhook:
+    url: https://audit.example.com/events
+    headers:
+      Authorization: Bearer some-token
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.Audit.JSONLines.Path).To(Equal("/var/vcap/sys/log/bits-service/audit.log"))
+			Expect(config.Audit.JSONLines.MaxSizeBytes()).To(BeEquivalentTo(100 * 1024 * 1024))
+			Expect(config.Audit.JSONLines.MaxBackups).To(Equal(3))
+			Expect(*config.Audit.Syslog).To(Equal(SyslogAuditConfig{Network: "udp", Address: "localhost:514"}))
+			Expect(config.Audit.Webhook.URL).To(Equal("https://audit.example.com/events"))
+			Expect(config.Audit.Webhook.Headers).To(Equal(map[string]string{"Authorization": "Bearer some-token"}))
+			Expect(config.Audit.Webhook.TimeoutOrDefault()).To(Equal(10 * time.Second))
+			Expect(config.Audit.Webhook.QueueSizeOrDefault()).To(Equal(1000))
+		})
+
+		It("rejects invalid sinks", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+audit:
+  json_lines:
+    max_size: lots
+  webhook:
+    url: /events
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(SatisfyAll(
+				ContainSubstring("audit.json_lines.path must not be empty"),
+				ContainSubstring("audit.json_lines.max_size is invalid"),
+				ContainSubstring("audit.webhook.url host must not be empty"),
+			)))
+		})
+	})
+	Context("zip_limits", func() {
+		It("applies defaults", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.ZipLimits.MaxUncompressedSizeBytes()).To(BeEquivalentTo(4 * 1024 * 1024 * 1024))
+			Expect(config.ZipLimits.MaxEntriesOrDefault()).To(Equal(100000))
+			Expect(config.ZipLimits.MaxCompressionRatioOrDefault()).To(Equal(200))
+			Expect(config.ZipLimits.MaxPathDepthOrDefault()).To(Equal(64))
+		})
+
+		It("parses configured limits", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+zip_limits:
+  max_uncompressed_size: 1G
+  max_entries: 500
+  max_compression_ratio: 50
+  max_path_depth: 10
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.ZipLimits.MaxUncompressedSizeBytes()).To(BeEquivalentTo(1024 * 1024 * 1024))
+			Expect(config.ZipLimits.MaxEntriesOrDefault()).To(Equal(500))
+			Expect(config.ZipLimits.MaxCompressionRatioOrDefault()).To(Equal(50))
+			Expect(config.ZipLimits.MaxPathDepthOrDefault()).To(Equal(10))
+		})
+
+		It("rejects invalid limits", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+zip_limits:
+  max_uncompressed_size: lots
+  max_entries: -1
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(SatisfyAll(
+				ContainSubstring("zip_limits.max_uncompressed_size is invalid"),
+				ContainSubstring("must not be negative"),
+			)))
+		})
+	})
+	Context("upload_jobs", func() {
+		It("defaults the retention to 1h", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.UploadJobs.RetentionOrDefault()).To(Equal(time.Hour))
+		})
+
+		It("rejects a negative retention", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+upload_jobs:
+  retention: -5m
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(ContainSubstring("upload_jobs.retention must not be negative")))
+		})
+	})
+	Context("async_uploads", func() {
+		It("parses the queue directory and defaults the number of workers", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+async_uploads:
+  queue_dir: /var/vcap/data/bits-service/async-uploads
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.AsyncUploads.QueueDir).To(Equal("/var/vcap/data/bits-service/async-uploads"))
+			Expect(config.AsyncUploads.WorkersOrDefault()).To(Equal(4))
+		})
+
+		It("rejects a negative number of workers", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+async_uploads:
+  workers: -1
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(ContainSubstring("async_uploads.workers must not be negative")))
+		})
+	})
+	Context("shutdown", func() {
+		It("applies defaults", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.Shutdown.DrainTimeoutOrDefault()).To(Equal(30 * time.Second))
+			Expect(config.Shutdown.ReadinessGracePeriod).To(BeZero())
+			Expect(config.TempDirOrDefault()).To(Equal(filepath.Join(os.TempDir(), "bits-service")))
+		})
+
+		It("parses the drain settings", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+shutdown:
+  readiness_grace_period: 10s
+  drain_timeout: 2m
+temp_dir: /var/vcap/data/bits-service/tmp
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.Shutdown.ReadinessGracePeriod).To(Equal(10 * time.Second))
+			Expect(config.Shutdown.DrainTimeoutOrDefault()).To(Equal(2 * time.Minute))
+			Expect(config.TempDirOrDefault()).To(Equal("/var/vcap/data/bits-service/tmp"))
+		})
+
+		It("rejects a temp_dir whose contents must not be removed", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+temp_dir: /var/vcap/data/bits-service
+async_uploads:
+  queue_dir: /var/vcap/data/bits-service/async-uploads
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(ContainSubstring("async_uploads.queue_dir must not be inside temp_dir")))
+		})
+
+		It("rejects a temp_dir which overlaps with other data", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+temp_dir: /var/vcap/data/bits-service/tmp
+audit:
+  json_lines:
+    path: /var/vcap/data/bits-service/tmp/audit.log
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: /var/vcap/data/bits-service
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(ContainSubstring("temp_dir must neither contain nor be inside packages.local_config.path_prefix '/var/vcap/data/bits-service'")))
+			Expect(e).To(MatchError(ContainSubstring("temp_dir must neither contain nor be inside audit.json_lines.path '/var/vcap/data/bits-service/tmp/audit.log'")))
+		})
+	})
+
+	Context("cc_updater", func() {
+		It("has defaults for timeout, retries and redelivery", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+cc_updater:
+  endpoint: https://cc.example.com/internal/v4/packages
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.CCUpdater.TimeoutOrDefault()).To(Equal(10 * time.Second))
+			Expect(config.CCUpdater.Retries.MaxRetriesOrDefault()).To(BeEquivalentTo(5))
+			Expect(config.CCUpdater.Retries.InitialIntervalOrDefault()).To(Equal(500 * time.Millisecond))
+			Expect(config.CCUpdater.Retries.MaxIntervalOrDefault()).To(Equal(10 * time.Second))
+			Expect(config.CCUpdater.DeadLetterDir).To(BeEmpty())
+			Expect(config.CCUpdater.RedeliveryIntervalOrDefault()).To(Equal(time.Minute))
+		})
+
+		It("parses timeout, retries and dead letter settings", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+cc_updater:
+  endpoint: https://cc.example.com/internal/v4/packages
+  timeout: 5s
+  retries:
+    max_retries: -1
+    initial_interval: 1s
+    max_interval: 1m
+  dead_letter_dir: /var/vcap/store/bits-service/cc-dead-letters
+  redelivery_interval: 30s
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.CCUpdater.TimeoutOrDefault()).To(Equal(5 * time.Second))
+			Expect(config.CCUpdater.Retries.MaxRetriesOrDefault()).To(BeEquivalentTo(0))
+			Expect(config.CCUpdater.Retries.InitialIntervalOrDefault()).To(Equal(time.Second))
+			Expect(config.CCUpdater.Retries.MaxIntervalOrDefault()).To(Equal(time.Minute))
+			Expect(config.CCUpdater.DeadLetterDir).To(Equal("/var/vcap/store/bits-service/cc-dead-letters"))
+			Expect(config.CCUpdater.RedeliveryIntervalOrDefault()).To(Equal(30 * time.Second))
+		})
+
+		It("rejects negative values", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+cc_updater:
+  endpoint: https://cc.example.com/internal/v4/packages
+  timeout: -5s
+  retries:
+    max_retries: -2
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(SatisfyAll(
+				ContainSubstring("cc_updater timeout, redelivery_interval and retries intervals must not be negative"),
+				ContainSubstring("cc_updater.retries.max_retries must not be less than -1"),
+			)))
+		})
+	})
+
+	Context("events", func() {
+		It("parses sinks with their filters and retries", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+events:
+  sinks:
+  - name: notifier
+    type: webhook
+    event_types: [ready, failed]
+    resource_types: [droplet]
+    retries:
+      max_retries: 3
+    queue_size: 50
+    webhook:
+      url: https://notifier.example.com/events
+      secret: some-secret
+  - name: log
+    type: json_lines
+    json_lines:
+      path: /var/vcap/sys/log/bits-service/events.log
+  - name: cc-droplets
+    type: cc_updater
+    resource_types: [droplet]
+    cc_updater:
+      endpoint: https://cc.example.com/internal/v4/droplets
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.Events.Sinks).To(HaveLen(3))
+			webhook := config.Events.Sinks[0]
+			Expect(webhook.EventTypes).To(Equal([]string{"ready", "failed"}))
+			Expect(webhook.ResourceTypes).To(Equal([]string{"droplet"}))
+			Expect(webhook.Retries.MaxRetriesOrDefault()).To(BeEquivalentTo(3))
+			Expect(webhook.QueueSizeOrDefault()).To(Equal(50))
+			Expect(webhook.Webhook.Secret).To(Equal("some-secret"))
+			Expect(webhook.Webhook.TimeoutOrDefault()).To(Equal(10 * time.Second))
+			Expect(config.Events.Sinks[1].QueueSizeOrDefault()).To(Equal(1000))
+			Expect(config.Events.Sinks[1].JSONLines.Path).To(Equal("/var/vcap/sys/log/bits-service/events.log"))
+			Expect(config.Events.Sinks[2].CCUpdater.Method).To(Equal("PATCH"))
+		})
+
+		It("rejects invalid sinks", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+events:
+  sinks:
+  - name: notifier
+    type: webhook
+    event_types: [uploaded]
+    resource_types: [app_stash]
+    webhook:
+      url: https://notifier.example.com/events
+  - name: notifier
+    type: kafka
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(SatisfyAll(
+				ContainSubstring("events.sinks 'notifier' event_types 'uploaded' is invalid"),
+				ContainSubstring("events.sinks 'notifier' resource_types 'app_stash' is invalid"),
+				ContainSubstring("events.sinks 'notifier' webhook.secret must not be empty"),
+				ContainSubstring("events.sinks name 'notifier' is not unique"),
+				ContainSubstring("events.sinks 'notifier' type 'kafka' is invalid"),
+			)))
+		})
+	})
+
+	Context("resource cc_updaters", func() {
+		It("loads an updater per resource type", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+cc_updater:
+  endpoint: https://api.example.com/internal/v4/packages
+  dead_letter_dir: /var/vcap/data/bits-service/dead-letters/packages
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+  cc_updater:
+    endpoint: https://api.example.com/internal/v4/droplets
+    payload_format: flat
+    dead_letter_dir: /var/vcap/data/bits-service/dead-letters/droplets
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+  cc_updater:
+    endpoint: https://api.example.com/internal/v4/buildpacks
+    method: PUT
+buildpack_cache:
+  cc_updater:
+    endpoint: https://api.example.com/internal/v4/buildpack_cache
+    method: POST
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.PackagesCCUpdater()).To(BeIdenticalTo(config.CCUpdater))
+			Expect(config.Droplets.CCUpdater.Method).To(Equal("PATCH"))
+			Expect(config.Droplets.CCUpdater.PayloadFormatOrDefault()).To(Equal("flat"))
+			Expect(config.Buildpacks.CCUpdater.Method).To(Equal("PUT"))
+			Expect(config.Buildpacks.CCUpdater.PayloadFormatOrDefault()).To(Equal("checksums"))
+			Expect(config.BuildpackCache.CCUpdater.Method).To(Equal("POST"))
+		})
+
+		It("rejects invalid updaters", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+cc_updater:
+  endpoint: https://api.example.com/internal/v4/packages
+packages:
+  blobstore_type: local
+  cc_updater:
+    endpoint: https://api.example.com/internal/v4/packages
+    dead_letter_dir: /var/vcap/data/bits-service/dead-letters
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+  cc_updater:
+    endpoint: https://api.example.com/internal/v4/droplets
+    method: DELETE
+    payload_format: xml
+    dead_letter_dir: /var/vcap/data/bits-service/dead-letters
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(SatisfyAll(
+				ContainSubstring("cc_updater and packages.cc_updater must not both be configured"),
+				ContainSubstring("droplets.cc_updater.method 'DELETE' is invalid"),
+				ContainSubstring("droplets.cc_updater.payload_format 'xml' is invalid"),
+				ContainSubstring("cc_updater dead_letter_dir '/var/vcap/data/bits-service/dead-letters' must not be shared by resource types"),
+			)))
+		})
+	})
+
+	Context("cc_updater authentication and payloads", func() {
+		It("loads UAA credentials, payload templates and success status codes", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+cc_updater:
+  endpoint: https://api.example.com/v3/internal/packages
+  method: POST
+  uaa:
+    token_endpoint: https://uaa.example.com/oauth/token
+    client_id: bits-service
+    client_secret: some-secret
+  payload_templates:
+    ready: '{"state": "READY", "checksums": {"sha256": {{json .Sha256}}}}'
+  success_status_codes: [200, 204]
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.CCUpdater.Method).To(Equal("POST"))
+			Expect(*config.CCUpdater.UAA).To(Equal(UAAConfig{
+				TokenEndpoint: "https://uaa.example.com/oauth/token",
+				ClientID:      "bits-service",
+				ClientSecret:  "some-secret",
+			}))
+			Expect(config.CCUpdater.PayloadTemplates.ByState()).To(Equal(map[string]string{
+				"READY": `{"state": "READY", "checksums": {"sha256": {{json .Sha256}}}}`,
+			}))
+			Expect(config.CCUpdater.SuccessStatusCodes).To(Equal([]int{200, 204}))
+		})
+
+		It("rejects invalid values", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+cc_updater:
+  endpoint: https://api.example.com/v3/internal/packages
+  uaa:
+    token_endpoint: not a url
+  payload_templates:
+    failed: '{"error": {{json .Error}'
+  success_status_codes: [404]
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(SatisfyAll(
+				ContainSubstring("cc_updater.uaa.token_endpoint must be a valid URL"),
+				ContainSubstring("cc_updater.uaa.client_id must not be empty"),
+				ContainSubstring("cc_updater.payload_templates for state FAILED is invalid"),
+				ContainSubstring("cc_updater.success_status_codes 404 is invalid"),
+			)))
+		})
+	})
+
+	Context("remote_fetch", func() {
+		It("is disabled by default", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.RemoteFetch).To(BeNil())
+		})
+
+		It("loads allowed hosts and defaults", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+remote_fetch:
+  allowed_hosts: [github.com, "*.githubusercontent.com"]
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			config, e := LoadConfig(configFile.Name())
+			Expect(e).NotTo(HaveOccurred())
+			Expect(config.RemoteFetch.AllowedHosts).To(Equal([]string{"github.com", "*.githubusercontent.com"}))
+			Expect(config.RemoteFetch.MaxSizeBytes()).To(Equal(uint64(1024 * 1024 * 1024)))
+			Expect(config.RemoteFetch.TimeoutOrDefault()).To(Equal(10 * time.Minute))
+			Expect(config.RemoteFetch.AllowPrivateNetworks).To(BeFalse())
+		})
+
+		It("rejects invalid values", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+remote_fetch:
+  allowed_hosts: ["https://github.com", "github.*"]
+  max_size: lots
+  timeout: -1s
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(SatisfyAll(
+				ContainSubstring("remote_fetch.allowed_hosts contains invalid host 'https://github.com'"),
+				ContainSubstring("remote_fetch.allowed_hosts contains invalid host 'github.*'"),
+				ContainSubstring("remote_fetch.max_size is invalid"),
+				ContainSubstring("remote_fetch.timeout must not be negative"),
+			)))
+		})
+
+		It("requires allowed hosts", func() {
+			fmt.Fprintf(configFile, "%s", `
+public_endpoint: https://public.127.0.0.1.nip.io
+private_endpoint: https://internal.127.0.0.1.nip.io
+port: 8000
+key_file: /some/path
+cert_file: /some/path
+remote_fetch:
+  max_size: 100M
+packages:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+droplets:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+buildpacks:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+app_stash:
+  blobstore_type: local
+  local_config:
+    path_prefix: dummy
+`)
+			_, e := LoadConfig(configFile.Name())
+			Expect(e).To(MatchError(ContainSubstring("remote_fetch.allowed_hosts must not be empty")))
+		})
+	})
 })
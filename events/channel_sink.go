@@ -0,0 +1,19 @@
+package events
+
+import "github.com/cloudfoundry-incubator/bits-service"
+
+// ChannelSink sends events to an in-process channel, e.g. for tests. Send blocks while the channel is full.
+type ChannelSink struct {
+	Events chan bitsgo.BlobEvent
+}
+
+func NewChannelSink(size int) *ChannelSink {
+	return &ChannelSink{Events: make(chan bitsgo.BlobEvent, size)}
+}
+
+func (sink *ChannelSink) Send(event bitsgo.BlobEvent) error {
+	sink.Events <- event
+	return nil
+}
+
+func (sink *ChannelSink) Close() error { return nil }
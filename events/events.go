@@ -0,0 +1,143 @@
+// Package events delivers bitsgo.BlobEvents to configurable sinks.
+package events
+
+import (
+	"io"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+)
+
+// Sink forwards or persists blob events. Send may return a *backoff.PermanentError to prevent retries.
+type Sink interface {
+	Send(event bitsgo.BlobEvent) error
+	io.Closer
+}
+
+// Filter selects events by type and resource type. An empty list matches everything.
+type Filter struct {
+	EventTypes    []string
+	ResourceTypes []string
+}
+
+func (filter Filter) Matches(event bitsgo.BlobEvent) bool {
+	return matches(filter.EventTypes, event.Type) && matches(filter.ResourceTypes, event.ResourceType)
+}
+
+func matches(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryPolicy retries failed sends up to MaxRetries times with exponentially growing intervals.
+type RetryPolicy struct {
+	MaxRetries      uint64
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+}
+
+func (policy RetryPolicy) backOff() backoff.BackOff {
+	exponentialBackOff := backoff.NewExponentialBackOff()
+	exponentialBackOff.InitialInterval = policy.InitialInterval
+	exponentialBackOff.MaxInterval = policy.MaxInterval
+	exponentialBackOff.MaxElapsedTime = 0
+	return backoff.WithMaxRetries(exponentialBackOff, policy.MaxRetries)
+}
+
+// Subscription sends the events matching its filter to its sink. Events are sent asynchronously and in order,
+// so that a slow sink does not slow down requests or other sinks. If queueSize events are pending, new events
+// are dropped.
+type Subscription struct {
+	name           string
+	sink           Sink
+	filter         Filter
+	metricsService bitsgo.MetricsService
+	sender         *util.AsyncSender
+}
+
+func NewSubscription(name string, sink Sink, filter Filter, retryPolicy RetryPolicy, queueSize int, metricsService bitsgo.MetricsService) *Subscription {
+	subscription := &Subscription{
+		name:           name,
+		sink:           sink,
+		filter:         filter,
+		metricsService: metricsService,
+	}
+	subscription.sender = util.NewAsyncSender(queueSize,
+		func(event interface{}) error { return sink.Send(event.(bitsgo.BlobEvent)) },
+		retryPolicy.backOff,
+		func(e error, backOffDelay time.Duration) {
+			metricsService.SendCounterMetric("events."+name+".retries", 1)
+		},
+		subscription.sent)
+	return subscription
+}
+
+func (subscription *Subscription) publish(event bitsgo.BlobEvent) {
+	if !subscription.filter.Matches(event) {
+		return
+	}
+
+	switch subscription.sender.Enqueue(event) {
+	case util.ErrAsyncSenderClosed:
+		logger.Log.Errorw("Event sink is closed. Dropping event", "sink", subscription.name, "type", event.Type,
+			"resource-type", event.ResourceType, "identifier", event.Identifier)
+	case util.ErrAsyncSenderQueueFull:
+		logger.Log.Errorw("Event sink queue is full. Dropping event", "sink", subscription.name, "type", event.Type,
+			"resource-type", event.ResourceType, "identifier", event.Identifier)
+		subscription.metricsService.SendCounterMetric("events."+subscription.name+".dropped", 1)
+	}
+}
+
+// close sends all pending events and closes the sink.
+func (subscription *Subscription) close() error {
+	subscription.sender.Close()
+	return subscription.sink.Close()
+}
+
+func (subscription *Subscription) sent(item interface{}, e error) {
+	event := item.(bitsgo.BlobEvent)
+	if e != nil {
+		logger.Log.Errorw("Could not send event", "sink", subscription.name, "error", e, "type", event.Type,
+			"resource-type", event.ResourceType, "identifier", event.Identifier)
+		subscription.metricsService.SendCounterMetric("events."+subscription.name+".failures", 1)
+		return
+	}
+	subscription.metricsService.SendCounterMetric("events."+subscription.name+".sent", 1)
+}
+
+// Bus publishes every event to all of its subscriptions. Failing sinks do not affect other sinks or the
+// publishing operation.
+type Bus struct {
+	subscriptions []*Subscription
+}
+
+func NewBus(subscriptions ...*Subscription) *Bus {
+	return &Bus{subscriptions: subscriptions}
+}
+
+func (bus *Bus) Publish(event bitsgo.BlobEvent) {
+	for _, subscription := range bus.subscriptions {
+		subscription.publish(event)
+	}
+}
+
+// Close sends all pending events and closes all sinks.
+func (bus *Bus) Close() error {
+	var firstErr error
+	for _, subscription := range bus.subscriptions {
+		if e := subscription.close(); e != nil && firstErr == nil {
+			firstErr = e
+		}
+	}
+	return firstErr
+}
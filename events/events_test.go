@@ -0,0 +1,271 @@
+package events_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/cloudfoundry-incubator/bits-service"
+	. "github.com/cloudfoundry-incubator/bits-service/events"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+	"github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+func TestEvents(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Events")
+}
+
+type flakySink struct {
+	mutex    sync.Mutex
+	failures int
+	sendErr  error
+	attempts int
+	sent     []bitsgo.BlobEvent
+}
+
+func (sink *flakySink) Send(event bitsgo.BlobEvent) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	sink.attempts++
+	if sink.sendErr != nil {
+		return sink.sendErr
+	}
+	if sink.attempts <= sink.failures {
+		return errors.New("some transient error")
+	}
+	sink.sent = append(sink.sent, event)
+	return nil
+}
+
+func (sink *flakySink) Close() error { return nil }
+
+type recordingMetricsService struct {
+	mutex    sync.Mutex
+	counters map[string]int64
+}
+
+func (service *recordingMetricsService) SendTimingMetric(name string, duration time.Duration) {}
+func (service *recordingMetricsService) SendGaugeMetric(name string, value int64)             {}
+
+func (service *recordingMetricsService) SendCounterMetric(name string, value int64) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	service.counters[name] += value
+}
+
+type recordingUpdater struct {
+	calls          []string
+	vcapRequestIDs []string
+	err            error
+}
+
+func (updater *recordingUpdater) NotifyProcessingUpload(ctx context.Context, guid string) error {
+	updater.record(ctx, "processing "+guid)
+	return updater.err
+}
+
+func (updater *recordingUpdater) NotifyUploadSucceeded(ctx context.Context, guid string, sha1 string, sha2 string) error {
+	updater.record(ctx, "succeeded "+guid+" "+sha1+" "+sha2)
+	return updater.err
+}
+
+func (updater *recordingUpdater) NotifyUploadFailed(ctx context.Context, guid string, e error) error {
+	updater.record(ctx, "failed "+guid+" "+e.Error())
+	return updater.err
+}
+
+func (updater *recordingUpdater) record(ctx context.Context, call string) {
+	updater.calls = append(updater.calls, call)
+	updater.vcapRequestIDs = append(updater.vcapRequestIDs, util.VcapRequestIDFrom(ctx))
+}
+
+var _ = Describe("Events", func() {
+	event := func(eventType, resourceType, identifier string) bitsgo.BlobEvent {
+		return bitsgo.BlobEvent{Type: eventType, ResourceType: resourceType, Identifier: identifier}
+	}
+	noRetries := RetryPolicy{}
+
+	var metricsService *recordingMetricsService
+
+	BeforeEach(func() {
+		metricsService = &recordingMetricsService{counters: make(map[string]int64)}
+	})
+
+	Describe("Bus", func() {
+		It("sends each event to the sinks whose filters match", func() {
+			allEvents := NewChannelSink(10)
+			readyDroplets := NewChannelSink(10)
+			bus := NewBus(
+				NewSubscription("all", allEvents, Filter{}, noRetries, 10, metricsService),
+				NewSubscription("ready-droplets", readyDroplets,
+					Filter{EventTypes: []string{bitsgo.BlobEventReady}, ResourceTypes: []string{"droplet"}}, noRetries, 10, metricsService))
+
+			bus.Publish(event(bitsgo.BlobEventReady, "droplet", "droplet-guid"))
+			bus.Publish(event(bitsgo.BlobEventReady, "package", "package-guid"))
+			bus.Publish(event(bitsgo.BlobEventDeleted, "droplet", "droplet-guid"))
+			Expect(bus.Close()).To(Succeed())
+
+			Expect(allEvents.Events).To(HaveLen(3))
+			Expect(readyDroplets.Events).To(HaveLen(1))
+			Expect(<-readyDroplets.Events).To(Equal(event(bitsgo.BlobEventReady, "droplet", "droplet-guid")))
+			Expect(metricsService.counters).To(HaveKeyWithValue("events.all.sent", int64(3)))
+		})
+
+		It("retries failed sends according to the sink's retry policy", func() {
+			sink := &flakySink{failures: 2}
+			bus := NewBus(NewSubscription("flaky", sink, Filter{}, RetryPolicy{MaxRetries: 2, InitialInterval: time.Millisecond, MaxInterval: time.Millisecond}, 10, metricsService))
+
+			bus.Publish(event(bitsgo.BlobEventReady, "droplet", "droplet-guid"))
+			Expect(bus.Close()).To(Succeed())
+
+			Expect(sink.sent).To(HaveLen(1))
+			Expect(sink.attempts).To(Equal(3))
+			Expect(metricsService.counters).To(HaveKeyWithValue("events.flaky.retries", int64(2)))
+		})
+
+		It("gives up once the retries are exhausted and does not retry permanent errors", func() {
+			flaky := &flakySink{failures: 10}
+			rejecting := &flakySink{sendErr: backoff.Permanent(errors.New("some permanent error"))}
+			retryPolicy := RetryPolicy{MaxRetries: 1, InitialInterval: time.Millisecond, MaxInterval: time.Millisecond}
+			bus := NewBus(
+				NewSubscription("flaky", flaky, Filter{}, retryPolicy, 10, metricsService),
+				NewSubscription("rejecting", rejecting, Filter{}, retryPolicy, 10, metricsService))
+
+			bus.Publish(event(bitsgo.BlobEventReady, "droplet", "droplet-guid"))
+			Expect(bus.Close()).To(Succeed())
+
+			Expect(flaky.attempts).To(Equal(2))
+			Expect(rejecting.attempts).To(Equal(1))
+			Expect(metricsService.counters).To(HaveKeyWithValue("events.flaky.failures", int64(1)))
+			Expect(metricsService.counters).To(HaveKeyWithValue("events.rejecting.failures", int64(1)))
+		})
+
+		It("drops events when a sink's queue is full", func() {
+			blocked := NewChannelSink(0)
+			bus := NewBus(NewSubscription("blocked", blocked, Filter{}, noRetries, 1, metricsService))
+
+			for i := 0; i < 3; i++ {
+				bus.Publish(event(bitsgo.BlobEventReady, "droplet", "droplet-guid"))
+			}
+
+			Eventually(func() int64 {
+				metricsService.mutex.Lock()
+				defer metricsService.mutex.Unlock()
+				return metricsService.counters["events.blocked.dropped"]
+			}).Should(BeNumerically(">=", 1))
+			go func() {
+				for range blocked.Events {
+				}
+			}()
+			Expect(bus.Close()).To(Succeed())
+		})
+	})
+
+	Describe("WebhookSink", func() {
+		It("POSTs the event signed with HMAC-SHA256", func() {
+			var (
+				body    []byte
+				headers http.Header
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ = ioutil.ReadAll(r.Body)
+				headers = r.Header
+			}))
+			defer server.Close()
+			sink := NewWebhookSink(server.URL, "some-secret", map[string]string{"X-Custom": "value"}, http.DefaultClient)
+
+			Expect(sink.Send(event(bitsgo.BlobEventReady, "droplet", "droplet-guid"))).To(Succeed())
+
+			var received bitsgo.BlobEvent
+			Expect(json.Unmarshal(body, &received)).To(Succeed())
+			Expect(received.Identifier).To(Equal("droplet-guid"))
+			Expect(headers.Get("X-Custom")).To(Equal("value"))
+			Expect(headers.Get(TimestampHeader)).NotTo(BeEmpty())
+			Expect(headers.Get(SignatureHeader)).To(Equal("sha256=" + Signature("some-secret", headers.Get(TimestampHeader), body)))
+			Expect(Signature("other-secret", headers.Get(TimestampHeader), body)).NotTo(Equal(Signature("some-secret", headers.Get(TimestampHeader), body)))
+		})
+
+		It("fails permanently on 4xx and transiently on 5xx", func() {
+			statusCode := http.StatusBadRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(statusCode)
+			}))
+			defer server.Close()
+			sink := NewWebhookSink(server.URL, "some-secret", nil, http.DefaultClient)
+
+			Expect(sink.Send(event(bitsgo.BlobEventReady, "droplet", "droplet-guid"))).To(BeAssignableToTypeOf(&backoff.PermanentError{}))
+
+			statusCode = http.StatusServiceUnavailable
+			e := sink.Send(event(bitsgo.BlobEventReady, "droplet", "droplet-guid"))
+			Expect(e).To(MatchError(ContainSubstring("503")))
+			Expect(e).NotTo(BeAssignableToTypeOf(&backoff.PermanentError{}))
+		})
+	})
+
+	Describe("JSONLinesSink", func() {
+		It("appends one JSON object per line", func() {
+			dir, e := ioutil.TempDir("", "events")
+			Expect(e).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+			sink, e := NewJSONLinesSink(filepath.Join(dir, "events.log"))
+			Expect(e).NotTo(HaveOccurred())
+
+			Expect(sink.Send(event(bitsgo.BlobEventCreated, "package", "first"))).To(Succeed())
+			Expect(sink.Send(event(bitsgo.BlobEventReady, "package", "first"))).To(Succeed())
+			Expect(sink.Close()).To(Succeed())
+
+			file, e := os.Open(filepath.Join(dir, "events.log"))
+			Expect(e).NotTo(HaveOccurred())
+			defer file.Close()
+			var types []string
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				var logged bitsgo.BlobEvent
+				Expect(json.Unmarshal(scanner.Bytes(), &logged)).To(Succeed())
+				types = append(types, logged.Type)
+			}
+			Expect(types).To(Equal([]string{bitsgo.BlobEventCreated, bitsgo.BlobEventReady}))
+			Expect(sink.Send(event(bitsgo.BlobEventDeleted, "package", "first"))).NotTo(Succeed())
+		})
+	})
+
+	Describe("UpdaterSink", func() {
+		It("translates upload events into updater notifications", func() {
+			updater := &recordingUpdater{}
+			sink := NewUpdaterSink(updater)
+
+			Expect(sink.Send(event(bitsgo.BlobEventCreated, "droplet", "guid"))).To(Succeed())
+			Expect(sink.Send(event(bitsgo.BlobEventProcessing, "droplet", "guid"))).To(Succeed())
+			Expect(sink.Send(bitsgo.BlobEvent{Type: bitsgo.BlobEventReady, Identifier: "guid", Sha1: "sha1", Sha256: "sha256", VcapRequestID: "some-request-id"})).To(Succeed())
+			Expect(sink.Send(bitsgo.BlobEvent{Type: bitsgo.BlobEventFailed, Identifier: "guid", Error: "some error"})).To(Succeed())
+			Expect(sink.Send(event(bitsgo.BlobEventDeleted, "droplet", "guid"))).To(Succeed())
+
+			Expect(updater.calls).To(Equal([]string{
+				"processing guid",
+				"succeeded guid sha1 sha256",
+				"failed guid some error",
+			}))
+			Expect(updater.vcapRequestIDs).To(Equal([]string{"", "some-request-id", ""}))
+		})
+
+		It("does not retry notifications the updater rejects", func() {
+			sink := NewUpdaterSink(&recordingUpdater{err: bitsgo.NewNotFoundError()})
+
+			Expect(sink.Send(event(bitsgo.BlobEventProcessing, "droplet", "guid"))).To(BeAssignableToTypeOf(&backoff.PermanentError{}))
+		})
+	})
+})
@@ -0,0 +1,61 @@
+package events
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/pkg/errors"
+)
+
+// JSONLinesSink appends one JSON object per event to a file.
+type JSONLinesSink struct {
+	path string
+
+	mutex sync.Mutex
+	file  *os.File
+}
+
+func NewJSONLinesSink(path string) (*JSONLinesSink, error) {
+	file, e := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if e != nil {
+		return nil, errors.Wrapf(e, "Could not open event log '%v'", path)
+	}
+	return &JSONLinesSink{path: path, file: file}, nil
+}
+
+func (sink *JSONLinesSink) Send(event bitsgo.BlobEvent) error {
+	line, e := json.Marshal(event)
+	if e != nil {
+		return errors.Wrap(e, "Could not marshal event")
+	}
+	line = append(line, '\n')
+
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	if sink.file == nil {
+		return errors.New("Event log is closed")
+	}
+	_, e = sink.file.Write(line)
+	if e != nil {
+		return errors.Wrapf(e, "Could not write event log '%v'", sink.path)
+	}
+	return nil
+}
+
+func (sink *JSONLinesSink) Close() error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	if sink.file == nil {
+		return nil
+	}
+	e := sink.file.Sync()
+	if closeErr := sink.file.Close(); e == nil {
+		e = closeErr
+	}
+	sink.file = nil
+	return e
+}
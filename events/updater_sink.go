@@ -0,0 +1,41 @@
+package events
+
+import (
+	"context"
+
+	"github.com/cenkalti/backoff"
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+	"github.com/pkg/errors"
+)
+
+// UpdaterSink translates processing, ready and failed events into notifications of an updater, e.g. the
+// Cloud Controller updater. Other events are ignored.
+type UpdaterSink struct {
+	updater bitsgo.Updater
+}
+
+func NewUpdaterSink(updater bitsgo.Updater) *UpdaterSink {
+	return &UpdaterSink{updater: updater}
+}
+
+func (sink *UpdaterSink) Send(event bitsgo.BlobEvent) error {
+	ctx := util.WithVcapRequestID(context.Background(), event.VcapRequestID)
+	var e error
+	switch event.Type {
+	case bitsgo.BlobEventProcessing:
+		e = sink.updater.NotifyProcessingUpload(ctx, event.Identifier)
+	case bitsgo.BlobEventReady:
+		e = sink.updater.NotifyUploadSucceeded(ctx, event.Identifier, event.Sha1, event.Sha256)
+	case bitsgo.BlobEventFailed:
+		e = sink.updater.NotifyUploadFailed(ctx, event.Identifier, errors.New(event.Error))
+	}
+	switch e.(type) {
+	case *bitsgo.NotFoundError, *bitsgo.StateForbiddenError:
+		// Retrying does not change the outcome
+		return backoff.Permanent(e)
+	}
+	return e
+}
+
+func (sink *UpdaterSink) Close() error { return nil }
@@ -0,0 +1,80 @@
+package events
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/pkg/errors"
+)
+
+const (
+	SignatureHeader = "X-Bits-Signature"
+	TimestampHeader = "X-Bits-Timestamp"
+)
+
+// WebhookSink POSTs each event as JSON to a URL. The request is signed with HMAC-SHA256 over
+// "<timestamp>.<body>", so that receivers can verify its origin and reject replays. The signature
+// is sent as "sha256=<hex>" in the X-Bits-Signature header and the Unix timestamp in X-Bits-Timestamp.
+type WebhookSink struct {
+	url        string
+	secret     string
+	headers    map[string]string
+	httpClient *http.Client
+}
+
+func NewWebhookSink(url string, secret string, headers map[string]string, httpClient *http.Client) *WebhookSink {
+	return &WebhookSink{url: url, secret: secret, headers: headers, httpClient: httpClient}
+}
+
+func (sink *WebhookSink) Send(event bitsgo.BlobEvent) error {
+	body, e := json.Marshal(event)
+	if e != nil {
+		return backoff.Permanent(errors.Wrap(e, "Could not marshal event"))
+	}
+	request, e := http.NewRequest("POST", sink.url, bytes.NewReader(body))
+	if e != nil {
+		return backoff.Permanent(e)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range sink.headers {
+		request.Header.Set(name, value)
+	}
+	request.Header.Set(TimestampHeader, timestamp)
+	request.Header.Set(SignatureHeader, "sha256="+Signature(sink.secret, timestamp, body))
+
+	response, e := sink.httpClient.Do(request)
+	if e != nil {
+		return e
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		return nil
+	case response.StatusCode >= 400 && response.StatusCode < 500 && response.StatusCode != http.StatusTooManyRequests:
+		return backoff.Permanent(errors.Errorf("Unexpected status code %v", response.StatusCode))
+	default:
+		return errors.Errorf("Unexpected status code %v", response.StatusCode)
+	}
+}
+
+func (sink *WebhookSink) Close() error { return nil }
+
+// Signature is the hex-encoded HMAC-SHA256 of "<timestamp>.<body>" with secret as key.
+func Signature(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,87 @@
+package bitsgo
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+)
+
+const (
+	maxIdentifierSegmentLength = 255
+
+	// InvalidIdentifierErrorCode is the code of the JSON error response for invalid identifiers.
+	InvalidIdentifierErrorCode = 290010
+)
+
+// Segments must start with a letter or digit, so that "." and ".." are never valid, and must not contain
+// separators, encoded or not.
+var identifierSegmentPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._\-]*$`)
+
+type InvalidIdentifierError struct {
+	error
+	Identifier string
+}
+
+func NewInvalidIdentifierError(identifier string, reason string) *InvalidIdentifierError {
+	return &InvalidIdentifierError{error: fmt.Errorf("Invalid identifier '%v': %v", identifier, reason), Identifier: identifier}
+}
+
+// IdentifierValidator validates identifiers before they are used as blobstore keys. Identifiers consist of
+// one or more "/"-separated segments, depending on the resource type.
+type IdentifierValidator struct {
+	resourceType string
+	maxSegments  int
+}
+
+// IdentifierValidatorFor returns the validator for resourceType. Both the resource handler's singular and
+// the route's plural resource type names are accepted.
+func IdentifierValidatorFor(resourceType string) *IdentifierValidator {
+	switch resourceType {
+	case "droplet", "droplets":
+		// <droplet guid>/<checksum>, or <app guid>/<droplet guid>/<checksum> for legacy droplets
+		return &IdentifierValidator{resourceType: resourceType, maxSegments: 3}
+	case "buildpack_cache":
+		// <app guid>/<stack>
+		return &IdentifierValidator{resourceType: resourceType, maxSegments: 2}
+	default:
+		return &IdentifierValidator{resourceType: resourceType, maxSegments: 1}
+	}
+}
+
+// Validate returns *InvalidIdentifierError if identifier is not allowed for the validator's resource type.
+func (validator *IdentifierValidator) Validate(identifier string) error {
+	if identifier == "" {
+		return NewInvalidIdentifierError(identifier, "must not be empty")
+	}
+	segments := strings.Split(identifier, "/")
+	if len(segments) > validator.maxSegments {
+		return NewInvalidIdentifierError(identifier, fmt.Sprintf("%v identifiers must consist of at most %v '/'-separated segments", validator.resourceType, validator.maxSegments))
+	}
+	for _, segment := range segments {
+		if len(segment) > maxIdentifierSegmentLength {
+			return NewInvalidIdentifierError(identifier, fmt.Sprintf("segments must not be longer than %v characters", maxIdentifierSegmentLength))
+		}
+		if !identifierSegmentPattern.MatchString(segment) {
+			return NewInvalidIdentifierError(identifier, "segments must start with a letter or digit and may only contain letters, digits, '.', '_' and '-'")
+		}
+	}
+	return nil
+}
+
+// ValidatePrefix is like Validate, but also accepts the empty prefix, which denotes all identifiers.
+func (validator *IdentifierValidator) ValidatePrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	return validator.Validate(prefix)
+}
+
+func invalidIdentifier(responseWriter http.ResponseWriter, request *http.Request, e error) {
+	logger.From(request).Infow("Invalid identifier", "error", e)
+	responseWriter.WriteHeader(http.StatusBadRequest)
+	util.FprintDescriptionAndCodeAsJSON(responseWriter, InvalidIdentifierErrorCode, "%v", e.Error())
+}
@@ -0,0 +1,32 @@
+//go:build gofuzz
+// +build gofuzz
+
+package bitsgo
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Fuzz is the entry point for go-fuzz (https://github.com/dvyukov/go-fuzz):
+//
+//	go-fuzz-build github.com/cloudfoundry-incubator/bits-service && go-fuzz -bin=bitsgo-fuzz.zip -workdir=fuzz
+//
+// It panics if an accepted identifier could escape or be normalized within the blobstore directory.
+func Fuzz(data []byte) int {
+	identifier := string(data)
+	accepted := false
+	for _, resourceType := range []string{"packages", "droplets", "buildpack_cache"} {
+		if IdentifierValidatorFor(resourceType).Validate(identifier) != nil {
+			continue
+		}
+		accepted = true
+		if filepath.Join("/blobstore", identifier) != "/blobstore/"+identifier || strings.ContainsAny(identifier, "%\\") {
+			panic("accepted unsafe identifier: " + identifier)
+		}
+	}
+	if accepted {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,66 @@
+package bitsgo_test
+
+import (
+	"math/rand"
+	"path/filepath"
+	"strings"
+
+	. "github.com/cloudfoundry-incubator/bits-service"
+)
+
+var _ = Describe("IdentifierValidator", func() {
+	It("accepts identifiers matching the resource type's grammar", func() {
+		for resourceType, identifiers := range map[string][]string{
+			"packages":        {"2f35885d-0c9d-4423-83ad-fd05066f8576", "some_guid.v2"},
+			"buildpacks":      {"2f35885d-0c9d-4423-83ad-fd05066f8576_e04c62ab0e87c29f862ee7c4e85c9fed51531dae"},
+			"droplets":        {"dropletguid", "dropletguid/e04c62ab0e87c29f862ee7c4e85c9fed51531dae", "appguid/dropletguid/sha"},
+			"buildpack_cache": {"appguid", "appguid/cflinuxfs2"},
+			"app_stash":       {"e04c62ab0e87c29f862ee7c4e85c9fed51531dae"},
+		} {
+			for _, identifier := range identifiers {
+				Expect(IdentifierValidatorFor(resourceType).Validate(identifier)).To(Succeed(), resourceType+": "+identifier)
+			}
+		}
+	})
+
+	It("rejects traversal, absolute paths, encoded separators and too many segments", func() {
+		for resourceType, identifiers := range map[string][]string{
+			"packages":        {"", "..", ".", ".hidden", "a/b", "/etc", "%2e%2e", "a%2Fb", "a\\b", "a b", "a\x00b", strings.Repeat("a", 256)},
+			"droplets":        {"guid/../../etc", "../guid", "guid/", "/guid", "guid//sha", "a/b/c/d", "guid/%2e%2e"},
+			"buildpack_cache": {"appguid/stack/extra", "appguid/..", "appguid/.."},
+		} {
+			for _, identifier := range identifiers {
+				e := IdentifierValidatorFor(resourceType).Validate(identifier)
+				Expect(e).To(HaveOccurred(), resourceType+": "+identifier)
+				Expect(e).To(BeAssignableToTypeOf(&InvalidIdentifierError{}))
+			}
+		}
+	})
+
+	It("accepts the empty prefix, but validates all other prefixes", func() {
+		Expect(IdentifierValidatorFor("buildpack_cache").ValidatePrefix("")).To(Succeed())
+		Expect(IdentifierValidatorFor("buildpack_cache").ValidatePrefix("appguid")).To(Succeed())
+		Expect(IdentifierValidatorFor("buildpack_cache").ValidatePrefix("..")).NotTo(Succeed())
+	})
+
+	It("never accepts identifiers which escape or are normalized within the blobstore directory (randomized)", func() {
+		alphabet := []byte("ab0-_./\\%:~ \x00")
+		random := rand.New(rand.NewSource(GinkgoRandomSeed()))
+		for _, resourceType := range []string{"packages", "droplets", "buildpack_cache"} {
+			validator := IdentifierValidatorFor(resourceType)
+			for i := 0; i < 20000; i++ {
+				identifier := make([]byte, random.Intn(12))
+				for j := range identifier {
+					identifier[j] = alphabet[random.Intn(len(alphabet))]
+				}
+				if validator.Validate(string(identifier)) != nil {
+					continue
+				}
+				joined := filepath.Join("/blobstore", string(identifier))
+				Expect(joined).To(Equal("/blobstore/"+string(identifier)), resourceType+": "+string(identifier))
+				Expect(string(identifier)).NotTo(ContainSubstring("%"))
+				Expect(string(identifier)).NotTo(ContainSubstring("\\"))
+			}
+		}
+	})
+})
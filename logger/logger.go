@@ -2,6 +2,7 @@ package logger
 
 import (
 	"bytes"
+	"context"
 	"log"
 	"net/http"
 
@@ -25,7 +26,11 @@ func SetLogger(logger *zap.Logger) {
 }
 
 func From(r *http.Request) *zap.SugaredLogger {
-	log := r.Context().Value("logger")
+	return FromContext(r.Context())
+}
+
+func FromContext(ctx context.Context) *zap.SugaredLogger {
+	log := ctx.Value("logger")
 	if log != nil {
 		return log.(*zap.SugaredLogger)
 	} else {
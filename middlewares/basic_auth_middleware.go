@@ -1,19 +1,49 @@
 package middlewares
 
-import "net/http"
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/passwordhash"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+)
 
 type Credential struct {
 	Username, Password string
+	// PasswordHash is a bcrypt or argon2id hash of the password. If set, Password is ignored.
+	PasswordHash string
+	// Scopes restrict the URLs the user may sign to "<resource type>:<verb>" pairs. "*" matches any resource
+	// type or verb. A user without scopes may sign any URL.
+	Scopes []string
 }
 
 type BasicAuthMiddleware struct {
 	credentials                   []Credential
 	basicAuthHeaderMissingHandler http.Handler
 	unauthorizedHandler           http.Handler
+	loginThrottle                 *LoginThrottle
+	// unknownUser is checked when no username matches, so that failed attempts take as long as for existing users.
+	unknownUser Credential
 }
 
 func NewBasicAuthMiddleWare(credentials ...Credential) *BasicAuthMiddleware {
-	return &BasicAuthMiddleware{credentials: credentials}
+	return &BasicAuthMiddleware{credentials: credentials, unknownUser: unknownUserLike(credentials)}
+}
+
+// unknownUserLike returns a credential with a dummy hash like the first hashed password of credentials.
+// Users are expected to share one algorithm and cost.
+func unknownUserLike(credentials []Credential) Credential {
+	for _, credential := range credentials {
+		if credential.PasswordHash != "" {
+			return Credential{PasswordHash: passwordhash.DummyLike(credential.PasswordHash)}
+		}
+	}
+	return Credential{}
 }
 
 func (middleware *BasicAuthMiddleware) WithBasicAuthHeaderMissingHandler(handler http.Handler) *BasicAuthMiddleware {
@@ -26,32 +56,135 @@ func (middleware *BasicAuthMiddleware) WithUnauthorizedHandler(handler http.Hand
 	return middleware
 }
 
+// WithLoginThrottle locks out client IPs after repeated failed attempts.
+func (middleware *BasicAuthMiddleware) WithLoginThrottle(loginThrottle *LoginThrottle) *BasicAuthMiddleware {
+	middleware.loginThrottle = loginThrottle
+	return middleware
+}
+
+// ForSigningResourceType returns a middleware which additionally requires the user's scopes to allow signing
+// URLs for resourceType and the verb given as query parameter.
+func (middleware *BasicAuthMiddleware) ForSigningResourceType(resourceType string) *ScopedBasicAuthMiddleware {
+	return &ScopedBasicAuthMiddleware{basicAuthMiddleware: middleware, resourceType: resourceType}
+}
+
 func (middleware *BasicAuthMiddleware) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request, next http.HandlerFunc) {
+	credential, ok := middleware.authenticate(responseWriter, request)
+	if !ok {
+		return
+	}
+	next(responseWriter, bitsgo.RequestWithSigningAuthorizer(util.RequestWithPrincipal(request, "basic_auth:"+credential.Username), credential.allowsSigning))
+}
+
+// authenticate writes the response and returns false if the request could not be authenticated.
+func (middleware *BasicAuthMiddleware) authenticate(responseWriter http.ResponseWriter, request *http.Request) (*Credential, bool) {
+	clientIP := util.RemoteIPFrom(request)
+	if middleware.loginThrottle != nil {
+		if lockedFor, locked := middleware.loginThrottle.LockedFor(clientIP); locked {
+			logger.From(request).Infow("Client is locked out after too many failed basic auth attempts", "client-ip", clientIP)
+			responseWriter.Header().Set("Retry-After", strconv.Itoa(int(lockedFor.Seconds())+1))
+			responseWriter.WriteHeader(http.StatusTooManyRequests)
+			util.FprintDescriptionAsJSON(responseWriter, "Too many failed authentication attempts")
+			return nil, false
+		}
+	}
+
 	username, password, ok := request.BasicAuth()
 	if !ok {
 		if middleware.basicAuthHeaderMissingHandler == nil {
 			responseWriter.WriteHeader(http.StatusUnauthorized)
-			return
+			return nil, false
 		}
 		middleware.basicAuthHeaderMissingHandler.ServeHTTP(responseWriter, request)
-		return
+		return nil, false
 	}
 
-	if !middleware.authorized(username, password) {
+	credential := middleware.authorized(username, password)
+	if credential == nil {
+		if middleware.loginThrottle != nil {
+			middleware.loginThrottle.RecordFailure(clientIP)
+		}
 		if middleware.unauthorizedHandler == nil {
 			responseWriter.WriteHeader(http.StatusUnauthorized)
-			return
+			return nil, false
 		}
 		middleware.unauthorizedHandler.ServeHTTP(responseWriter, request)
+		return nil, false
+	}
+	if middleware.loginThrottle != nil {
+		middleware.loginThrottle.RecordSuccess(clientIP)
+	}
+	return credential, true
+}
+
+// authorized compares against all usernames, so that the time it takes does not reveal which usernames exist.
+func (middleware *BasicAuthMiddleware) authorized(username, password string) *Credential {
+	var match *Credential
+	for i := range middleware.credentials {
+		if constantTimeEquals(username, middleware.credentials[i].Username) && match == nil {
+			match = &middleware.credentials[i]
+		}
 	}
-	next(responseWriter, request)
+	if match == nil {
+		middleware.unknownUser.matchesPassword(password)
+		return nil
+	}
+	if !match.matchesPassword(password) {
+		return nil
+	}
+	return match
 }
 
-func (middleware *BasicAuthMiddleware) authorized(username, password string) bool {
-	for _, credential := range middleware.credentials {
-		if username == credential.Username && password == credential.Password {
+func (credential *Credential) matchesPassword(password string) bool {
+	if credential.PasswordHash != "" {
+		return passwordhash.Matches(password, credential.PasswordHash)
+	}
+	return constantTimeEquals(password, credential.Password)
+}
+
+func (credential *Credential) allowsSigning(resourceType, verb string) bool {
+	if len(credential.Scopes) == 0 {
+		return true
+	}
+	verb = strings.ToLower(verb)
+	for _, scope := range credential.Scopes {
+		parts := strings.SplitN(scope, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if (parts[0] == "*" || parts[0] == resourceType) && (parts[1] == "*" || strings.ToLower(parts[1]) == verb) {
 			return true
 		}
 	}
 	return false
 }
+
+// constantTimeEquals compares digests, so that the comparison does not reveal the length of the expected value either.
+func constantTimeEquals(actual, expected string) bool {
+	actualDigest := sha256.Sum256([]byte(actual))
+	expectedDigest := sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(actualDigest[:], expectedDigest[:]) == 1
+}
+
+type ScopedBasicAuthMiddleware struct {
+	basicAuthMiddleware *BasicAuthMiddleware
+	resourceType        string
+}
+
+func (middleware *ScopedBasicAuthMiddleware) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request, next http.HandlerFunc) {
+	credential, ok := middleware.basicAuthMiddleware.authenticate(responseWriter, request)
+	if !ok {
+		return
+	}
+	verb := request.URL.Query().Get("verb")
+	if verb == "" {
+		verb = "get"
+	}
+	if !credential.allowsSigning(middleware.resourceType, verb) {
+		logger.From(request).Infow("Signing user is not allowed to sign URL", "username", credential.Username, "resource-type", middleware.resourceType, "verb", verb)
+		responseWriter.WriteHeader(http.StatusForbidden)
+		util.FprintDescriptionAsJSON(responseWriter, "Not allowed to sign %v URLs for %v", verb, middleware.resourceType)
+		return
+	}
+	next(responseWriter, bitsgo.RequestWithSigningAuthorizer(util.RequestWithPrincipal(request, "basic_auth:"+credential.Username), credential.allowsSigning))
+}
@@ -5,6 +5,9 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
 
 	"github.com/cloudfoundry-incubator/bits-service/middlewares"
 	. "github.com/cloudfoundry-incubator/bits-service/testutil"
@@ -13,6 +16,7 @@ import (
 	"github.com/petergtz/pegomock"
 	. "github.com/petergtz/pegomock"
 	"github.com/urfave/negroni"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestBasicAuthMiddleWare(t *testing.T) {
@@ -99,10 +103,11 @@ var _ = Describe("BasicAuthMiddle", func() {
 			request := newGetRequest(server.URL)
 			request.SetBasicAuth("the-username", "wrong-password")
 
-			_, e := http.DefaultClient.Do(request)
+			response, e := http.DefaultClient.Do(request)
 			Expect(e).NotTo(HaveOccurred())
 
 			mockHandler.VerifyWasCalledOnce().ServeHTTP(anyResponseWriter(), anyRequestPtr())
+			Expect(*response).To(HaveStatusCodeAndBody(Equal(http.StatusOK), BeEmpty()))
 		})
 	})
 
@@ -116,6 +121,137 @@ var _ = Describe("BasicAuthMiddle", func() {
 			Equal(http.StatusUnauthorized),
 			BeEmpty()))
 	})
+
+	Context("password hashes are configured", func() {
+		BeforeEach(func() {
+			hash, e := bcrypt.GenerateFromPassword([]byte("the-password"), bcrypt.MinCost)
+			Expect(e).NotTo(HaveOccurred())
+			middleware = middlewares.NewBasicAuthMiddleWare(middlewares.Credential{Username: "the-username", PasswordHash: string(hash)})
+		})
+
+		It("verifies the password against the hash", func() {
+			request := newGetRequest(server.URL)
+			request.SetBasicAuth("the-username", "the-password")
+			response, e := http.DefaultClient.Do(request)
+			Expect(e).NotTo(HaveOccurred())
+			Expect(response.StatusCode).To(Equal(http.StatusOK))
+
+			request = newGetRequest(server.URL)
+			request.SetBasicAuth("the-username", "wrong-password")
+			response, e = http.DefaultClient.Do(request)
+			Expect(e).NotTo(HaveOccurred())
+			Expect(response.StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Context("a login throttle is set", func() {
+		var mockClock *clock.Mock
+
+		BeforeEach(func() {
+			mockClock = clock.NewMock()
+			middleware.WithLoginThrottle(middlewares.NewLoginThrottle(3, time.Minute, 5*time.Minute, mockClock))
+		})
+
+		doRequestWithPassword := func(password string) *http.Response {
+			request := newGetRequest(server.URL)
+			request.SetBasicAuth("the-username", password)
+			response, e := http.DefaultClient.Do(request)
+			Expect(e).NotTo(HaveOccurred())
+			return response
+		}
+
+		It("locks out the client after too many failed attempts", func() {
+			for i := 0; i < 3; i++ {
+				Expect(doRequestWithPassword("wrong-password").StatusCode).To(Equal(http.StatusUnauthorized))
+			}
+
+			response := doRequestWithPassword("the-password")
+			Expect(response.StatusCode).To(Equal(http.StatusTooManyRequests))
+			Expect(response.Header.Get("Retry-After")).To(Equal("301"))
+
+			mockClock.Add(5*time.Minute + time.Second)
+
+			Expect(doRequestWithPassword("the-password").StatusCode).To(Equal(http.StatusOK))
+		})
+
+		It("does not lock out the client when failed attempts are spread beyond the window", func() {
+			for i := 0; i < 2; i++ {
+				Expect(doRequestWithPassword("wrong-password").StatusCode).To(Equal(http.StatusUnauthorized))
+			}
+			mockClock.Add(2 * time.Minute)
+			Expect(doRequestWithPassword("wrong-password").StatusCode).To(Equal(http.StatusUnauthorized))
+
+			Expect(doRequestWithPassword("the-password").StatusCode).To(Equal(http.StatusOK))
+		})
+
+		It("resets failed attempts after a successful attempt", func() {
+			for i := 0; i < 2; i++ {
+				Expect(doRequestWithPassword("wrong-password").StatusCode).To(Equal(http.StatusUnauthorized))
+			}
+			Expect(doRequestWithPassword("the-password").StatusCode).To(Equal(http.StatusOK))
+			Expect(doRequestWithPassword("wrong-password").StatusCode).To(Equal(http.StatusUnauthorized))
+
+			Expect(doRequestWithPassword("the-password").StatusCode).To(Equal(http.StatusOK))
+		})
+	})
+})
+
+var _ = Describe("ScopedBasicAuthMiddleware", func() {
+	var (
+		middleware *middlewares.BasicAuthMiddleware
+		recorder   *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		middleware = middlewares.NewBasicAuthMiddleWare(
+			middlewares.Credential{Username: "cc", Password: "cc-password", Scopes: []string{"packages:put", "droplets:*", "*:get"}},
+			middlewares.Credential{Username: "admin", Password: "admin-password"},
+		)
+		recorder = httptest.NewRecorder()
+	})
+
+	serve := func(handler negroni.Handler, url, username, password string) {
+		request := httptest.NewRequest("GET", url, nil)
+		request.SetBasicAuth(username, password)
+		negroni.New(handler, negroni.Wrap(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+			responseWriter.Write([]byte("Hello"))
+		}))).ServeHTTP(recorder, request)
+	}
+
+	It("allows signing URLs within the user's scopes", func() {
+		serve(middleware.ForSigningResourceType("packages"), "http://internal/sign/packages/guid?verb=put", "cc", "cc-password")
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Body.String()).To(Equal("Hello"))
+	})
+
+	It("matches wildcards", func() {
+		serve(middleware.ForSigningResourceType("droplets"), "http://internal/sign/droplets/guid?verb=DELETE", "cc", "cc-password")
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+
+		recorder = httptest.NewRecorder()
+		serve(middleware.ForSigningResourceType("buildpacks"), "http://internal/sign/buildpacks/guid", "cc", "cc-password")
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+	})
+
+	It("responds with 403 when the user's scopes don't allow signing the URL", func() {
+		serve(middleware.ForSigningResourceType("packages"), "http://internal/sign/packages/guid?verb=delete", "cc", "cc-password")
+
+		Expect(recorder.Code).To(Equal(http.StatusForbidden))
+		Expect(recorder.Body.String()).To(ContainSubstring("Not allowed to sign delete URLs for packages"))
+	})
+
+	It("allows users without scopes to sign any URL", func() {
+		serve(middleware.ForSigningResourceType("packages"), "http://internal/sign/packages/guid?verb=delete", "admin", "admin-password")
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+	})
+
+	It("still requires valid credentials", func() {
+		serve(middleware.ForSigningResourceType("packages"), "http://internal/sign/packages/guid", "cc", "admin-password")
+
+		Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+	})
 })
 
 func newGetRequest(url string) *http.Request {
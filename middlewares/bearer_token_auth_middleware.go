@@ -0,0 +1,214 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+	"github.com/urfave/negroni"
+)
+
+const (
+	ReadScope  = "bits.read"
+	WriteScope = "bits.write"
+	AdminScope = "bits.admin"
+)
+
+type VerificationKeyProvider interface {
+	KeyFor(keyID string) (interface{}, error)
+}
+
+// BearerTokenAuthMiddleware authenticates requests with JWT bearer tokens, e.g. as issued by UAA,
+// and authorizes them based on the token's scopes.
+type BearerTokenAuthMiddleware struct {
+	keyProvider VerificationKeyProvider
+	issuer      string
+	audience    string
+	parser      *jwt.Parser
+}
+
+func NewBearerTokenAuthMiddleware(keyProvider VerificationKeyProvider, issuer string, audience string) *BearerTokenAuthMiddleware {
+	return &BearerTokenAuthMiddleware{
+		keyProvider: keyProvider,
+		issuer:      issuer,
+		audience:    audience,
+		parser:      &jwt.Parser{ValidMethods: []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}},
+	}
+}
+
+// ForResourceType returns a middleware which requires bits.read for reading and bits.write for modifying requests.
+// Alternatively, bits.<resourceType>.read and bits.<resourceType>.write grant access to a single resource type.
+// bits.admin grants access to everything. An empty resourceType only accepts scopes which are not specific to a resource type.
+func (middleware *BearerTokenAuthMiddleware) ForResourceType(resourceType string) *ScopedBearerTokenAuthMiddleware {
+	return &ScopedBearerTokenAuthMiddleware{
+		BearerTokenAuthMiddleware: middleware,
+		resourceType:              resourceType,
+		method:                    func(request *http.Request) string { return request.Method },
+	}
+}
+
+// ForSigningResourceType is like ForResourceType, but takes the verb of the URL to be signed into account,
+// instead of the method of the signing request itself.
+func (middleware *BearerTokenAuthMiddleware) ForSigningResourceType(resourceType string) *ScopedBearerTokenAuthMiddleware {
+	return &ScopedBearerTokenAuthMiddleware{
+		BearerTokenAuthMiddleware: middleware,
+		resourceType:              resourceType,
+		method: func(request *http.Request) string {
+			if request.Method == "GET" && request.URL.Query().Get("verb") != "" {
+				return strings.ToUpper(request.URL.Query().Get("verb"))
+			}
+			return request.Method
+		},
+	}
+}
+
+type ScopedBearerTokenAuthMiddleware struct {
+	*BearerTokenAuthMiddleware
+	resourceType string
+	method       func(request *http.Request) string
+}
+
+func (middleware *ScopedBearerTokenAuthMiddleware) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request, next http.HandlerFunc) {
+	claims, ok := middleware.authenticate(responseWriter, request)
+	if !ok {
+		return
+	}
+
+	requiredScopes := scopesFor(middleware.resourceType, middleware.method(request))
+	if !containsAny(scopesFrom(claims), requiredScopes) {
+		logger.From(request).Infow("Insufficient scope", "client-id", claims["client_id"], "user-name", claims["user_name"], "required-scopes", requiredScopes)
+		responseWriter.Header().Set("WWW-Authenticate", `Bearer realm="bits-service", error="insufficient_scope", scope="`+strings.Join(requiredScopes, " ")+`"`)
+		responseWriter.WriteHeader(http.StatusForbidden)
+		util.FprintDescriptionAsJSON(responseWriter, "Insufficient scope. One of the following scopes is required: %v", strings.Join(requiredScopes, ", "))
+		return
+	}
+	next(responseWriter, util.RequestWithPrincipal(request, "token:"+principalFrom(claims)))
+}
+
+// ForSigningBatches returns a middleware which only authenticates the request. The scopes are checked per entry
+// by the BatchSignHandler, based on the resource type and verb of each entry, like ForSigningResourceType does.
+func (middleware *BearerTokenAuthMiddleware) ForSigningBatches() negroni.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request, next http.HandlerFunc) {
+		claims, ok := middleware.authenticate(responseWriter, request)
+		if !ok {
+			return
+		}
+		next(responseWriter, bitsgo.RequestWithSigningAuthorizer(
+			util.RequestWithPrincipal(request, "token:"+principalFrom(claims)),
+			func(resourceType, verb string) bool {
+				return containsAny(scopesFrom(claims), scopesFor(tokenResourceTypeOf(resourceType), verb))
+			}))
+	}
+}
+
+// authenticate writes the response and returns false if the request has no valid bearer token.
+func (middleware *BearerTokenAuthMiddleware) authenticate(responseWriter http.ResponseWriter, request *http.Request) (jwt.MapClaims, bool) {
+	authorization := request.Header.Get("Authorization")
+	if !strings.HasPrefix(strings.ToLower(authorization), "bearer ") {
+		responseWriter.Header().Set("WWW-Authenticate", `Bearer realm="bits-service"`)
+		responseWriter.WriteHeader(http.StatusUnauthorized)
+		util.FprintDescriptionAsJSON(responseWriter, "Bearer token missing")
+		return nil, false
+	}
+	claims, e := middleware.claimsFrom(strings.TrimSpace(authorization[len("bearer "):]))
+	if e != nil {
+		logger.From(request).Infow("Invalid bearer token", "error", e)
+		responseWriter.Header().Set("WWW-Authenticate", `Bearer realm="bits-service", error="invalid_token"`)
+		responseWriter.WriteHeader(http.StatusUnauthorized)
+		util.FprintDescriptionAsJSON(responseWriter, "Invalid bearer token")
+		return nil, false
+	}
+	return claims, true
+}
+
+// tokenResourceTypeOf maps the resource types of batch entries to the resource types used in scopes.
+// All app stash resource types share the bits.app_stash.* scopes.
+func tokenResourceTypeOf(resourceType string) string {
+	if strings.HasPrefix(resourceType, "app_stash_") {
+		return "app_stash"
+	}
+	return resourceType
+}
+
+// principalFrom prefers the user over the client, since client credentials tokens have no user.
+func principalFrom(claims jwt.MapClaims) string {
+	for _, claim := range []string{"user_name", "client_id", "sub"} {
+		if value, ok := claims[claim].(string); ok && value != "" {
+			return value
+		}
+	}
+	return "unknown"
+}
+
+func scopesFor(resourceType string, method string) []string {
+	scope, access := WriteScope, "write"
+	if method := strings.ToUpper(method); method == "GET" || method == "HEAD" {
+		scope, access = ReadScope, "read"
+	}
+	if resourceType == "" {
+		return []string{scope, AdminScope}
+	}
+	return []string{scope, "bits." + resourceType + "." + access, AdminScope}
+}
+
+func (middleware *BearerTokenAuthMiddleware) claimsFrom(tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, e := middleware.parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		keyID, _ := token.Header["kid"].(string)
+		return middleware.keyProvider.KeyFor(keyID)
+	})
+	if e != nil {
+		return nil, e
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, errors.New("Token has no expiration time")
+	}
+	if middleware.issuer != "" && !claims.VerifyIssuer(middleware.issuer, true) {
+		return nil, errors.Errorf("Unexpected issuer %v", claims["iss"])
+	}
+	if middleware.audience != "" && !containsAny(stringsFrom(claims["aud"]), []string{middleware.audience}) {
+		return nil, errors.Errorf("Audience %v does not contain %v", claims["aud"], middleware.audience)
+	}
+	return claims, nil
+}
+
+// scopesFrom supports both, UAA's list of scopes and OAuth2's space-separated scope string.
+func scopesFrom(claims jwt.MapClaims) []string {
+	if scope, ok := claims["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+	return stringsFrom(claims["scope"])
+}
+
+func stringsFrom(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var result []string
+		for _, element := range value {
+			if s, ok := element.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+func containsAny(values []string, candidates []string) bool {
+	for _, value := range values {
+		for _, candidate := range candidates {
+			if value == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
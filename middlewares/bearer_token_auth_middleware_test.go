@@ -0,0 +1,278 @@
+package middlewares_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/middlewares"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("BearerTokenAuthMiddleware", func() {
+	var (
+		privateKey  *rsa.PrivateKey
+		keyProvider middlewares.VerificationKeyProvider
+		middleware  *middlewares.BearerTokenAuthMiddleware
+		recorder    *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		var e error
+		privateKey, e = rsa.GenerateKey(rand.Reader, 1024)
+		Expect(e).NotTo(HaveOccurred())
+		keyProvider = middlewares.CombinedKeyProvider{&fakeKeyProvider{map[string]interface{}{"key-1": &privateKey.PublicKey}}}
+		recorder = httptest.NewRecorder()
+	})
+
+	JustBeforeEach(func() {
+		middleware = middlewares.NewBearerTokenAuthMiddleware(keyProvider, "https://uaa.example.com/oauth/token", "bits_service")
+	})
+
+	tokenWith := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "key-1"
+		signedToken, e := token.SignedString(privateKey)
+		Expect(e).NotTo(HaveOccurred())
+		return signedToken
+	}
+
+	validClaimsWithScopes := func(scopes ...interface{}) jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   "https://uaa.example.com/oauth/token",
+			"aud":   []interface{}{"bits_service", "openid"},
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"scope": scopes,
+		}
+	}
+
+	serve := func(handler negroni.Handler, method string, token string) {
+		request := httptest.NewRequest(method, "http://internal/packages/some-guid", nil)
+		if token != "" {
+			request.Header.Set("Authorization", "bearer "+token)
+		}
+		negroni.New(handler, negroni.Wrap(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+			responseWriter.Write([]byte("Hello"))
+		}))).ServeHTTP(recorder, request)
+	}
+
+	It("responds with 401 when the token is missing", func() {
+		serve(middleware.ForResourceType("packages"), "GET", "")
+
+		Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		Expect(recorder.Header().Get("WWW-Authenticate")).To(HavePrefix("Bearer"))
+	})
+
+	It("allows reading with bits.read", func() {
+		serve(middleware.ForResourceType("packages"), "GET", tokenWith(validClaimsWithScopes("bits.read")))
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Body.String()).To(Equal("Hello"))
+	})
+
+	It("allows reading with a resource type specific scope", func() {
+		serve(middleware.ForResourceType("packages"), "HEAD", tokenWith(validClaimsWithScopes("bits.packages.read")))
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+	})
+
+	It("accepts scopes as space-separated string", func() {
+		claims := validClaimsWithScopes()
+		claims["scope"] = "openid bits.write"
+		serve(middleware.ForResourceType("packages"), "PUT", tokenWith(claims))
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+	})
+
+	It("responds with 403 when writing with bits.read only", func() {
+		serve(middleware.ForResourceType("packages"), "PUT", tokenWith(validClaimsWithScopes("bits.read", "bits.droplets.write")))
+
+		Expect(recorder.Code).To(Equal(http.StatusForbidden))
+		Expect(recorder.Body.String()).To(ContainSubstring("bits.write, bits.packages.write, bits.admin"))
+	})
+
+	It("allows everything with bits.admin", func() {
+		serve(middleware.ForResourceType("packages"), "DELETE", tokenWith(validClaimsWithScopes("bits.admin")))
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+	})
+
+	It("only accepts scopes which are not specific to a resource type when no resource type is given", func() {
+		serve(middleware.ForResourceType(""), "POST", tokenWith(validClaimsWithScopes("bits.packages.write")))
+
+		Expect(recorder.Code).To(Equal(http.StatusForbidden))
+	})
+
+	Context("signing", func() {
+		It("requires scopes for the verb to be signed", func() {
+			request := httptest.NewRequest("GET", "http://internal/sign/packages/some-guid?verb=put", nil)
+			request.Header.Set("Authorization", "bearer "+tokenWith(validClaimsWithScopes("bits.read")))
+			negroni.New(middleware.ForSigningResourceType("packages"), negroni.Wrap(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))).ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusForbidden))
+		})
+
+		Context("batches", func() {
+			serveBatch := func(token string, body string) {
+				request := httptest.NewRequest("POST", "http://internal/sign", strings.NewReader(body))
+				request.Header.Set("Authorization", "bearer "+token)
+				negroni.New(middleware.ForSigningBatches(), negroni.Wrap(http.HandlerFunc(bitsgo.NewBatchSignHandler(map[string]*bitsgo.SignResourceHandler{
+					"packages":          bitsgo.NewSignResourceHandler(&fakeResourceSigner{}, &fakeResourceSigner{}),
+					"app_stash_entries": bitsgo.NewSignResourceHandler(&fakeResourceSigner{}, &fakeResourceSigner{}),
+				}).Sign))).ServeHTTP(recorder, request)
+			}
+
+			It("checks each entry against the token's scopes", func() {
+				serveBatch(tokenWith(validClaimsWithScopes("bits.read")), `[{"resource_type": "packages", "resource": "guid", "verb": "get"}]`)
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+
+				recorder = httptest.NewRecorder()
+				serveBatch(tokenWith(validClaimsWithScopes("bits.read")), `[{"resource_type": "packages", "resource": "guid", "verb": "get"}, {"resource_type": "packages", "resource": "guid", "verb": "put"}]`)
+				Expect(recorder.Code).To(Equal(http.StatusForbidden))
+				Expect(recorder.Body.String()).To(ContainSubstring("Not allowed to sign put URLs for packages"))
+			})
+
+			It("accepts resource type specific scopes", func() {
+				serveBatch(tokenWith(validClaimsWithScopes("bits.packages.write", "bits.app_stash.read")),
+					`[{"resource_type": "packages", "resource": "guid", "verb": "put"}, {"resource_type": "app_stash_entries", "resource": "sha", "verb": "get"}]`)
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+
+				recorder = httptest.NewRecorder()
+				serveBatch(tokenWith(validClaimsWithScopes("bits.packages.write")), `[{"resource_type": "app_stash_entries", "resource": "sha", "verb": "get"}]`)
+				Expect(recorder.Code).To(Equal(http.StatusForbidden))
+			})
+
+			It("responds with 401 when the token is invalid", func() {
+				serveBatch("invalid", `[{"resource_type": "packages", "resource": "guid", "verb": "get"}]`)
+
+				Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+			})
+		})
+	})
+
+	Context("invalid tokens", func() {
+		It("responds with 401 when the token has expired", func() {
+			claims := validClaimsWithScopes("bits.admin")
+			claims["exp"] = time.Now().Add(-time.Minute).Unix()
+			serve(middleware.ForResourceType("packages"), "GET", tokenWith(claims))
+
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("responds with 401 when the token has no expiration time", func() {
+			claims := validClaimsWithScopes("bits.admin")
+			delete(claims, "exp")
+			serve(middleware.ForResourceType("packages"), "GET", tokenWith(claims))
+
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("responds with 401 when the issuer does not match", func() {
+			claims := validClaimsWithScopes("bits.admin")
+			claims["iss"] = "https://evil.example.com"
+			serve(middleware.ForResourceType("packages"), "GET", tokenWith(claims))
+
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("responds with 401 when the audience does not match", func() {
+			claims := validClaimsWithScopes("bits.admin")
+			claims["aud"] = "cloud_controller"
+			serve(middleware.ForResourceType("packages"), "GET", tokenWith(claims))
+
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("responds with 401 when the token is signed with a different key", func() {
+			otherKey, e := rsa.GenerateKey(rand.Reader, 1024)
+			Expect(e).NotTo(HaveOccurred())
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaimsWithScopes("bits.admin"))
+			token.Header["kid"] = "key-1"
+			signedToken, e := token.SignedString(otherKey)
+			Expect(e).NotTo(HaveOccurred())
+
+			serve(middleware.ForResourceType("packages"), "GET", signedToken)
+
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("responds with 401 when the token uses an HMAC algorithm", func() {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaimsWithScopes("bits.admin"))
+			token.Header["kid"] = "key-1"
+			signedToken, e := token.SignedString([]byte("secret"))
+			Expect(e).NotTo(HaveOccurred())
+
+			serve(middleware.ForResourceType("packages"), "GET", signedToken)
+
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Context("JWKS", func() {
+		var (
+			jwksServer   *httptest.Server
+			jwksRequests int
+		)
+
+		BeforeEach(func() {
+			jwksRequests = 0
+			jwksServer = httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+				jwksRequests++
+				fmt.Fprintf(responseWriter, `{"keys": [{"kty": "RSA", "kid": "key-1", "use": "sig", "alg": "RS256", "n": "%v", "e": "%v"}]}`,
+					base64.RawURLEncoding.EncodeToString(privateKey.PublicKey.N.Bytes()),
+					base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privateKey.PublicKey.E)).Bytes()))
+			}))
+			keyProvider = middlewares.NewJWKSKeyProvider(jwksServer.URL, http.DefaultClient, time.Hour)
+		})
+
+		AfterEach(func() {
+			jwksServer.Close()
+		})
+
+		It("validates tokens with keys from the JWKS endpoint and caches them", func() {
+			serve(middleware.ForResourceType("packages"), "GET", tokenWith(validClaimsWithScopes("bits.read")))
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+
+			recorder = httptest.NewRecorder()
+			serve(middleware.ForResourceType("packages"), "GET", tokenWith(validClaimsWithScopes("bits.read")))
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+
+			Expect(jwksRequests).To(Equal(1))
+		})
+
+		It("does not refetch keys for unknown key IDs more often than the minimum refresh interval", func() {
+			_, e := keyProvider.KeyFor("key-1")
+			Expect(e).NotTo(HaveOccurred())
+
+			_, e = keyProvider.KeyFor("unknown-key")
+			Expect(e).To(MatchError(ContainSubstring("Unknown key ID 'unknown-key'")))
+			Expect(jwksRequests).To(Equal(1))
+		})
+	})
+})
+
+type fakeKeyProvider struct {
+	keys map[string]interface{}
+}
+
+func (provider *fakeKeyProvider) KeyFor(keyID string) (interface{}, error) {
+	key, exists := provider.keys[keyID]
+	if !exists {
+		return nil, fmt.Errorf("Unknown key ID '%v'", keyID)
+	}
+	return key, nil
+}
+
+type fakeResourceSigner struct{}
+
+func (signer *fakeResourceSigner) Sign(resource string, method string, expirationTime time.Time) (string, error) {
+	return "https://signed.example.com/" + resource, nil
+}
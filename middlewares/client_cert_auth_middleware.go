@@ -0,0 +1,51 @@
+package middlewares
+
+import (
+	"crypto/x509"
+	"net/http"
+
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+)
+
+// ClientCertAuthMiddleware requires a client certificate which has been verified against the server's client CAs
+// during the TLS handshake. If allowed identities are given, the certificate's subject common name or one of its
+// subject alternative names must match one of them.
+type ClientCertAuthMiddleware struct {
+	allowedIdentities []string
+}
+
+func NewClientCertAuthMiddleware(allowedIdentities ...string) *ClientCertAuthMiddleware {
+	return &ClientCertAuthMiddleware{allowedIdentities: allowedIdentities}
+}
+
+func (middleware *ClientCertAuthMiddleware) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request, next http.HandlerFunc) {
+	cert := VerifiedClientCertFrom(request)
+	if cert == nil {
+		responseWriter.WriteHeader(http.StatusUnauthorized)
+		util.FprintDescriptionAsJSON(responseWriter, "A verified client certificate is required")
+		return
+	}
+	if len(middleware.allowedIdentities) != 0 && !containsAny(identitiesFrom(cert), middleware.allowedIdentities) {
+		logger.From(request).Infow("Client certificate identity not allowed", "allowed-identities", middleware.allowedIdentities)
+		responseWriter.WriteHeader(http.StatusForbidden)
+		util.FprintDescriptionAsJSON(responseWriter, "Client certificate identity is not allowed")
+		return
+	}
+	next(responseWriter, util.RequestWithPrincipal(request, "client_cert:"+cert.Subject.CommonName))
+}
+
+// VerifiedClientCertFrom returns the client's leaf certificate, or nil if the client did not present a verified certificate.
+func VerifiedClientCertFrom(request *http.Request) *x509.Certificate {
+	if request.TLS == nil || len(request.TLS.VerifiedChains) == 0 || len(request.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return request.TLS.VerifiedChains[0][0]
+}
+
+func identitiesFrom(cert *x509.Certificate) []string {
+	identities := []string{cert.Subject.CommonName}
+	identities = append(identities, cert.DNSNames...)
+	identities = append(identities, cert.EmailAddresses...)
+	return identities
+}
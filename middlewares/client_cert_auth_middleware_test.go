@@ -0,0 +1,75 @@
+package middlewares_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/cloudfoundry-incubator/bits-service/middlewares"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("ClientCertAuthMiddleware", func() {
+	var recorder *httptest.ResponseRecorder
+
+	BeforeEach(func() {
+		recorder = httptest.NewRecorder()
+	})
+
+	serve := func(middleware *middlewares.ClientCertAuthMiddleware, connectionState *tls.ConnectionState) {
+		request := httptest.NewRequest("GET", "https://internal/packages/some-guid", nil)
+		request.TLS = connectionState
+		negroni.New(middleware, negroni.Wrap(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+			responseWriter.Write([]byte("Hello"))
+		}))).ServeHTTP(recorder, request)
+	}
+
+	verifiedConnectionWith := func(cert *x509.Certificate) *tls.ConnectionState {
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+
+	It("responds with 401 when the request is not using TLS", func() {
+		serve(middlewares.NewClientCertAuthMiddleware(), nil)
+
+		Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("responds with 401 when the client certificate was not verified", func() {
+		serve(middlewares.NewClientCertAuthMiddleware(), &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "cloud-controller"}}},
+		})
+
+		Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("accepts any verified client certificate when no identities are configured", func() {
+		serve(middlewares.NewClientCertAuthMiddleware(), verifiedConnectionWith(&x509.Certificate{Subject: pkix.Name{CommonName: "anyone"}}))
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Body.String()).To(Equal("Hello"))
+	})
+
+	It("accepts a client certificate with an allowed common name", func() {
+		serve(middlewares.NewClientCertAuthMiddleware("cloud-controller"),
+			verifiedConnectionWith(&x509.Certificate{Subject: pkix.Name{CommonName: "cloud-controller"}}))
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+	})
+
+	It("accepts a client certificate with an allowed DNS SAN", func() {
+		serve(middlewares.NewClientCertAuthMiddleware("cc.service.cf.internal"),
+			verifiedConnectionWith(&x509.Certificate{Subject: pkix.Name{CommonName: "other"}, DNSNames: []string{"cc.service.cf.internal"}}))
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+	})
+
+	It("responds with 403 when the client certificate's identity is not allowed", func() {
+		serve(middlewares.NewClientCertAuthMiddleware("cloud-controller"),
+			verifiedConnectionWith(&x509.Certificate{Subject: pkix.Name{CommonName: "diego-cell"}, DNSNames: []string{"cell.service.cf.internal"}}))
+
+		Expect(recorder.Code).To(Equal(http.StatusForbidden))
+		Expect(recorder.Body.String()).To(ContainSubstring("Client certificate identity is not allowed"))
+	})
+})
@@ -27,6 +27,9 @@ func (middleware *ZapLoggerMiddleware) ServeHTTP(responseWriter http.ResponseWri
 	requestLogger := middleware.logger.With(
 		"request-id", requestId,
 		"vcap-request-id", request.Header.Get("X-Vcap-Request-Id"))
+	if cert := VerifiedClientCertFrom(request); cert != nil {
+		requestLogger = requestLogger.With("client-identity", cert.Subject.CommonName)
+	}
 
 	requestLogger.Infow(
 		"HTTP Request started",
@@ -45,6 +48,7 @@ func (middleware *ZapLoggerMiddleware) ServeHTTP(responseWriter http.ResponseWri
 		"logger", requestLogger,
 		"vcap-request-id", request.Header.Get("X-Vcap-Request-Id"),
 		"request-id", requestId,
+		"trace-headers", util.TraceHeadersFrom(request),
 	))
 
 	fields := []interface{}{
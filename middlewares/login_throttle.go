@@ -0,0 +1,106 @@
+package middlewares
+
+import (
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// maxTrackedClients bounds the memory used for failed attempts. Beyond it, expired records are purged and, if that
+// does not free any space, the oldest record is evicted.
+const maxTrackedClients = 10000
+
+// LoginThrottle locks out clients which failed to authenticate maxFailedAttempts times within window.
+type LoginThrottle struct {
+	clock             clock.Clock
+	maxFailedAttempts int
+	window            time.Duration
+	lockoutDuration   time.Duration
+
+	mutex          sync.Mutex
+	failedAttempts map[string]*failedAttempts
+}
+
+type failedAttempts struct {
+	count       int
+	firstFailed time.Time
+	lockedUntil time.Time
+}
+
+func NewLoginThrottle(maxFailedAttempts int, window, lockoutDuration time.Duration, clock clock.Clock) *LoginThrottle {
+	return &LoginThrottle{
+		clock:             clock,
+		maxFailedAttempts: maxFailedAttempts,
+		window:            window,
+		lockoutDuration:   lockoutDuration,
+		failedAttempts:    make(map[string]*failedAttempts),
+	}
+}
+
+// LockedFor returns for how much longer client is locked out.
+func (throttle *LoginThrottle) LockedFor(client string) (time.Duration, bool) {
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	attempts, exists := throttle.failedAttempts[client]
+	if !exists {
+		return 0, false
+	}
+	lockedFor := attempts.lockedUntil.Sub(throttle.clock.Now())
+	return lockedFor, lockedFor > 0
+}
+
+func (throttle *LoginThrottle) RecordFailure(client string) {
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	now := throttle.clock.Now()
+	attempts, exists := throttle.failedAttempts[client]
+	if !exists || throttle.expired(attempts, now) {
+		if !exists && len(throttle.failedAttempts) >= maxTrackedClients {
+			throttle.purgeExpired(now)
+			if len(throttle.failedAttempts) >= maxTrackedClients {
+				throttle.evictOldest()
+			}
+		}
+		attempts = &failedAttempts{firstFailed: now}
+		throttle.failedAttempts[client] = attempts
+	}
+	attempts.count++
+	if attempts.count >= throttle.maxFailedAttempts {
+		attempts.lockedUntil = now.Add(throttle.lockoutDuration)
+		attempts.count = 0
+		attempts.firstFailed = now
+	}
+}
+
+func (throttle *LoginThrottle) RecordSuccess(client string) {
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	delete(throttle.failedAttempts, client)
+}
+
+func (throttle *LoginThrottle) expired(attempts *failedAttempts, now time.Time) bool {
+	return now.After(attempts.firstFailed.Add(throttle.window)) && now.After(attempts.lockedUntil)
+}
+
+func (throttle *LoginThrottle) purgeExpired(now time.Time) {
+	for client, attempts := range throttle.failedAttempts {
+		if throttle.expired(attempts, now) {
+			delete(throttle.failedAttempts, client)
+		}
+	}
+}
+
+func (throttle *LoginThrottle) evictOldest() {
+	var oldestClient string
+	var oldest *failedAttempts
+	for client, attempts := range throttle.failedAttempts {
+		if oldest == nil || attempts.firstFailed.Before(oldest.firstFailed) {
+			oldestClient, oldest = client, attempts
+		}
+	}
+	delete(throttle.failedAttempts, oldestClient)
+}
@@ -0,0 +1,209 @@
+package middlewares
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+)
+
+// StaticKeyProvider provides verification keys from configuration.
+type StaticKeyProvider struct {
+	keys map[string]interface{}
+}
+
+// NewStaticKeyProvider parses PEM-encoded RSA or ECDSA public keys by key ID.
+func NewStaticKeyProvider(pemKeys map[string]string) (*StaticKeyProvider, error) {
+	keys := make(map[string]interface{})
+	for keyID, pemKey := range pemKeys {
+		key, e := jwt.ParseRSAPublicKeyFromPEM([]byte(pemKey))
+		if e != nil {
+			key, e := jwt.ParseECPublicKeyFromPEM([]byte(pemKey))
+			if e != nil {
+				return nil, errors.Errorf("Could not parse verification key '%v' as RSA or ECDSA public key", keyID)
+			}
+			keys[keyID] = key
+			continue
+		}
+		keys[keyID] = key
+	}
+	return &StaticKeyProvider{keys: keys}, nil
+}
+
+func (provider *StaticKeyProvider) KeyFor(keyID string) (interface{}, error) {
+	if keyID == "" && len(provider.keys) == 1 {
+		for _, key := range provider.keys {
+			return key, nil
+		}
+	}
+	key, exists := provider.keys[keyID]
+	if !exists {
+		return nil, errors.Errorf("Unknown key ID '%v'", keyID)
+	}
+	return key, nil
+}
+
+// JWKSKeyProvider fetches verification keys from a JSON Web Key Set endpoint, e.g. UAA's /token_keys.
+// Keys are cached and refetched when a token refers to an unknown key ID, but not more often than minRefreshInterval.
+type JWKSKeyProvider struct {
+	url                string
+	httpClient         *http.Client
+	clock              clock.Clock
+	minRefreshInterval time.Duration
+
+	mutex     sync.Mutex
+	keys      map[string]interface{}
+	lastFetch time.Time
+}
+
+func NewJWKSKeyProvider(url string, httpClient *http.Client, minRefreshInterval time.Duration) *JWKSKeyProvider {
+	return &JWKSKeyProvider{
+		url:                url,
+		httpClient:         httpClient,
+		clock:              clock.New(),
+		minRefreshInterval: minRefreshInterval,
+		keys:               make(map[string]interface{}),
+	}
+}
+
+func (provider *JWKSKeyProvider) KeyFor(keyID string) (interface{}, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	if key, exists := provider.keyFor(keyID); exists {
+		return key, nil
+	}
+	if !provider.lastFetch.IsZero() && provider.clock.Now().Sub(provider.lastFetch) < provider.minRefreshInterval {
+		return nil, errors.Errorf("Unknown key ID '%v'", keyID)
+	}
+	provider.lastFetch = provider.clock.Now()
+	keys, e := provider.fetchKeys()
+	if e != nil {
+		return nil, e
+	}
+	provider.keys = keys
+	if key, exists := provider.keyFor(keyID); exists {
+		return key, nil
+	}
+	return nil, errors.Errorf("Unknown key ID '%v'", keyID)
+}
+
+func (provider *JWKSKeyProvider) keyFor(keyID string) (interface{}, bool) {
+	if keyID == "" && len(provider.keys) == 1 {
+		for _, key := range provider.keys {
+			return key, true
+		}
+	}
+	key, exists := provider.keys[keyID]
+	return key, exists
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (provider *JWKSKeyProvider) fetchKeys() (map[string]interface{}, error) {
+	response, e := provider.httpClient.Get(provider.url)
+	if e != nil {
+		return nil, errors.Wrapf(e, "Could not fetch JWKS from %v", provider.url)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Could not fetch JWKS from %v. Status: %v", provider.url, response.Status)
+	}
+	var keySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	e = json.NewDecoder(response.Body).Decode(&keySet)
+	if e != nil {
+		return nil, errors.Wrapf(e, "Could not decode JWKS from %v", provider.url)
+	}
+
+	keys := make(map[string]interface{})
+	for _, jwk := range keySet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, e := publicKeyFrom(jwk)
+		if e != nil {
+			return nil, errors.Wrapf(e, "Invalid key '%v' in JWKS from %v", jwk.Kid, provider.url)
+		}
+		if key != nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// publicKeyFrom returns nil for key types which are not supported.
+func publicKeyFrom(jwk jsonWebKey) (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, e := base64.RawURLEncoding.DecodeString(jwk.N)
+		if e != nil {
+			return nil, errors.Wrap(e, "Invalid modulus")
+		}
+		exponent, e := base64.RawURLEncoding.DecodeString(jwk.E)
+		if e != nil {
+			return nil, errors.Wrap(e, "Invalid exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(exponent).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("Unsupported curve %v", jwk.Crv)
+		}
+		x, e := base64.RawURLEncoding.DecodeString(jwk.X)
+		if e != nil {
+			return nil, errors.Wrap(e, "Invalid x coordinate")
+		}
+		y, e := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if e != nil {
+			return nil, errors.Wrap(e, "Invalid y coordinate")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// CombinedKeyProvider returns the key from the first provider which knows the key ID.
+type CombinedKeyProvider []VerificationKeyProvider
+
+func (providers CombinedKeyProvider) KeyFor(keyID string) (interface{}, error) {
+	var lastError error
+	for _, provider := range providers {
+		key, e := provider.KeyFor(keyID)
+		if e == nil {
+			return key, nil
+		}
+		lastError = e
+	}
+	if lastError == nil {
+		return nil, errors.Errorf("Unknown key ID '%v'", keyID)
+	}
+	return nil, lastError
+}
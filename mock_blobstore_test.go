@@ -4,6 +4,7 @@
 package bitsgo_test
 
 import (
+	context "context"
 	pegomock "github.com/petergtz/pegomock"
 	io "io"
 	"reflect"
@@ -17,11 +18,11 @@ func NewMockBlobstore() *MockBlobstore {
 	return &MockBlobstore{fail: pegomock.GlobalFailHandler}
 }
 
-func (mock *MockBlobstore) Exists(path string) (bool, error) {
+func (mock *MockBlobstore) Exists(ctx context.Context, path string) (bool, error) {
 	if mock == nil {
 		panic("mock must not be nil. Use myMock := NewMockMockBlobstore().")
 	}
-	params := []pegomock.Param{path}
+	params := []pegomock.Param{ctx, path}
 	result := pegomock.GetGenericMockFrom(mock).Invoke("Exists", params, []reflect.Type{reflect.TypeOf((*bool)(nil)).Elem(), reflect.TypeOf((*error)(nil)).Elem()})
 	var ret0 bool
 	var ret1 error
@@ -36,11 +37,11 @@ func (mock *MockBlobstore) Exists(path string) (bool, error) {
 	return ret0, ret1
 }
 
-func (mock *MockBlobstore) HeadOrRedirectAsGet(path string) (string, error) {
+func (mock *MockBlobstore) HeadOrRedirectAsGet(ctx context.Context, path string) (string, error) {
 	if mock == nil {
 		panic("mock must not be nil. Use myMock := NewMockMockBlobstore().")
 	}
-	params := []pegomock.Param{path}
+	params := []pegomock.Param{ctx, path}
 	result := pegomock.GetGenericMockFrom(mock).Invoke("HeadOrRedirectAsGet", params, []reflect.Type{reflect.TypeOf((*string)(nil)).Elem(), reflect.TypeOf((*error)(nil)).Elem()})
 	var ret0 string
 	var ret1 error
@@ -55,11 +56,11 @@ func (mock *MockBlobstore) HeadOrRedirectAsGet(path string) (string, error) {
 	return ret0, ret1
 }
 
-func (mock *MockBlobstore) GetOrRedirect(path string) (io.ReadCloser, string, error) {
+func (mock *MockBlobstore) GetOrRedirect(ctx context.Context, path string) (io.ReadCloser, string, error) {
 	if mock == nil {
 		panic("mock must not be nil. Use myMock := NewMockMockBlobstore().")
 	}
-	params := []pegomock.Param{path}
+	params := []pegomock.Param{ctx, path}
 	result := pegomock.GetGenericMockFrom(mock).Invoke("GetOrRedirect", params, []reflect.Type{reflect.TypeOf((*io.ReadCloser)(nil)).Elem(), reflect.TypeOf((*string)(nil)).Elem(), reflect.TypeOf((*error)(nil)).Elem()})
 	var ret0 io.ReadCloser
 	var ret1 string
@@ -78,11 +79,11 @@ func (mock *MockBlobstore) GetOrRedirect(path string) (io.ReadCloser, string, er
 	return ret0, ret1, ret2
 }
 
-func (mock *MockBlobstore) Get(path string) (io.ReadCloser, error) {
+func (mock *MockBlobstore) Get(ctx context.Context, path string) (io.ReadCloser, error) {
 	if mock == nil {
 		panic("mock must not be nil. Use myMock := NewMockMockBlobstore().")
 	}
-	params := []pegomock.Param{path}
+	params := []pegomock.Param{ctx, path}
 	result := pegomock.GetGenericMockFrom(mock).Invoke("Get", params, []reflect.Type{reflect.TypeOf((*io.ReadCloser)(nil)).Elem(), reflect.TypeOf((*error)(nil)).Elem()})
 	var ret0 io.ReadCloser
 	var ret1 error
@@ -97,11 +98,11 @@ func (mock *MockBlobstore) Get(path string) (io.ReadCloser, error) {
 	return ret0, ret1
 }
 
-func (mock *MockBlobstore) Put(path string, src io.ReadSeeker) error {
+func (mock *MockBlobstore) Put(ctx context.Context, path string, src io.ReadSeeker) error {
 	if mock == nil {
 		panic("mock must not be nil. Use myMock := NewMockMockBlobstore().")
 	}
-	params := []pegomock.Param{path, src}
+	params := []pegomock.Param{ctx, path, src}
 	result := pegomock.GetGenericMockFrom(mock).Invoke("Put", params, []reflect.Type{reflect.TypeOf((*error)(nil)).Elem()})
 	var ret0 error
 	if len(result) != 0 {
@@ -112,11 +113,11 @@ func (mock *MockBlobstore) Put(path string, src io.ReadSeeker) error {
 	return ret0
 }
 
-func (mock *MockBlobstore) Copy(src string, dest string) error {
+func (mock *MockBlobstore) Copy(ctx context.Context, src string, dest string) error {
 	if mock == nil {
 		panic("mock must not be nil. Use myMock := NewMockMockBlobstore().")
 	}
-	params := []pegomock.Param{src, dest}
+	params := []pegomock.Param{ctx, src, dest}
 	result := pegomock.GetGenericMockFrom(mock).Invoke("Copy", params, []reflect.Type{reflect.TypeOf((*error)(nil)).Elem()})
 	var ret0 error
 	if len(result) != 0 {
@@ -127,11 +128,11 @@ func (mock *MockBlobstore) Copy(src string, dest string) error {
 	return ret0
 }
 
-func (mock *MockBlobstore) Delete(path string) error {
+func (mock *MockBlobstore) Delete(ctx context.Context, path string) error {
 	if mock == nil {
 		panic("mock must not be nil. Use myMock := NewMockMockBlobstore().")
 	}
-	params := []pegomock.Param{path}
+	params := []pegomock.Param{ctx, path}
 	result := pegomock.GetGenericMockFrom(mock).Invoke("Delete", params, []reflect.Type{reflect.TypeOf((*error)(nil)).Elem()})
 	var ret0 error
 	if len(result) != 0 {
@@ -142,11 +143,11 @@ func (mock *MockBlobstore) Delete(path string) error {
 	return ret0
 }
 
-func (mock *MockBlobstore) DeleteDir(prefix string) error {
+func (mock *MockBlobstore) DeleteDir(ctx context.Context, prefix string) error {
 	if mock == nil {
 		panic("mock must not be nil. Use myMock := NewMockMockBlobstore().")
 	}
-	params := []pegomock.Param{prefix}
+	params := []pegomock.Param{ctx, prefix}
 	result := pegomock.GetGenericMockFrom(mock).Invoke("DeleteDir", params, []reflect.Type{reflect.TypeOf((*error)(nil)).Elem()})
 	var ret0 error
 	if len(result) != 0 {
@@ -175,8 +176,8 @@ type VerifierBlobstore struct {
 	inOrderContext         *pegomock.InOrderContext
 }
 
-func (verifier *VerifierBlobstore) Exists(path string) *Blobstore_Exists_OngoingVerification {
-	params := []pegomock.Param{path}
+func (verifier *VerifierBlobstore) Exists(ctx context.Context, path string) *Blobstore_Exists_OngoingVerification {
+	params := []pegomock.Param{ctx, path}
 	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "Exists", params)
 	return &Blobstore_Exists_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
 }
@@ -186,24 +187,28 @@ type Blobstore_Exists_OngoingVerification struct {
 	methodInvocations []pegomock.MethodInvocation
 }
 
-func (c *Blobstore_Exists_OngoingVerification) GetCapturedArguments() string {
-	path := c.GetAllCapturedArguments()
-	return path[len(path)-1]
+func (c *Blobstore_Exists_OngoingVerification) GetCapturedArguments() (context.Context, string) {
+	ctx, path := c.GetAllCapturedArguments()
+	return ctx[len(ctx)-1], path[len(path)-1]
 }
 
-func (c *Blobstore_Exists_OngoingVerification) GetAllCapturedArguments() (_param0 []string) {
+func (c *Blobstore_Exists_OngoingVerification) GetAllCapturedArguments() (_param0 []context.Context, _param1 []string) {
 	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
 	if len(params) > 0 {
-		_param0 = make([]string, len(params[0]))
+		_param0 = make([]context.Context, len(params[0]))
 		for u, param := range params[0] {
-			_param0[u] = param.(string)
+			_param0[u] = param.(context.Context)
+		}
+		_param1 = make([]string, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(string)
 		}
 	}
 	return
 }
 
-func (verifier *VerifierBlobstore) HeadOrRedirectAsGet(path string) *Blobstore_HeadOrRedirectAsGet_OngoingVerification {
-	params := []pegomock.Param{path}
+func (verifier *VerifierBlobstore) HeadOrRedirectAsGet(ctx context.Context, path string) *Blobstore_HeadOrRedirectAsGet_OngoingVerification {
+	params := []pegomock.Param{ctx, path}
 	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "HeadOrRedirectAsGet", params)
 	return &Blobstore_HeadOrRedirectAsGet_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
 }
@@ -213,24 +218,28 @@ type Blobstore_HeadOrRedirectAsGet_OngoingVerification struct {
 	methodInvocations []pegomock.MethodInvocation
 }
 
-func (c *Blobstore_HeadOrRedirectAsGet_OngoingVerification) GetCapturedArguments() string {
-	path := c.GetAllCapturedArguments()
-	return path[len(path)-1]
+func (c *Blobstore_HeadOrRedirectAsGet_OngoingVerification) GetCapturedArguments() (context.Context, string) {
+	ctx, path := c.GetAllCapturedArguments()
+	return ctx[len(ctx)-1], path[len(path)-1]
 }
 
-func (c *Blobstore_HeadOrRedirectAsGet_OngoingVerification) GetAllCapturedArguments() (_param0 []string) {
+func (c *Blobstore_HeadOrRedirectAsGet_OngoingVerification) GetAllCapturedArguments() (_param0 []context.Context, _param1 []string) {
 	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
 	if len(params) > 0 {
-		_param0 = make([]string, len(params[0]))
+		_param0 = make([]context.Context, len(params[0]))
 		for u, param := range params[0] {
-			_param0[u] = param.(string)
+			_param0[u] = param.(context.Context)
+		}
+		_param1 = make([]string, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(string)
 		}
 	}
 	return
 }
 
-func (verifier *VerifierBlobstore) GetOrRedirect(path string) *Blobstore_GetOrRedirect_OngoingVerification {
-	params := []pegomock.Param{path}
+func (verifier *VerifierBlobstore) GetOrRedirect(ctx context.Context, path string) *Blobstore_GetOrRedirect_OngoingVerification {
+	params := []pegomock.Param{ctx, path}
 	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "GetOrRedirect", params)
 	return &Blobstore_GetOrRedirect_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
 }
@@ -240,24 +249,28 @@ type Blobstore_GetOrRedirect_OngoingVerification struct {
 	methodInvocations []pegomock.MethodInvocation
 }
 
-func (c *Blobstore_GetOrRedirect_OngoingVerification) GetCapturedArguments() string {
-	path := c.GetAllCapturedArguments()
-	return path[len(path)-1]
+func (c *Blobstore_GetOrRedirect_OngoingVerification) GetCapturedArguments() (context.Context, string) {
+	ctx, path := c.GetAllCapturedArguments()
+	return ctx[len(ctx)-1], path[len(path)-1]
 }
 
-func (c *Blobstore_GetOrRedirect_OngoingVerification) GetAllCapturedArguments() (_param0 []string) {
+func (c *Blobstore_GetOrRedirect_OngoingVerification) GetAllCapturedArguments() (_param0 []context.Context, _param1 []string) {
 	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
 	if len(params) > 0 {
-		_param0 = make([]string, len(params[0]))
+		_param0 = make([]context.Context, len(params[0]))
 		for u, param := range params[0] {
-			_param0[u] = param.(string)
+			_param0[u] = param.(context.Context)
+		}
+		_param1 = make([]string, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(string)
 		}
 	}
 	return
 }
 
-func (verifier *VerifierBlobstore) Get(path string) *Blobstore_Get_OngoingVerification {
-	params := []pegomock.Param{path}
+func (verifier *VerifierBlobstore) Get(ctx context.Context, path string) *Blobstore_Get_OngoingVerification {
+	params := []pegomock.Param{ctx, path}
 	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "Get", params)
 	return &Blobstore_Get_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
 }
@@ -267,24 +280,28 @@ type Blobstore_Get_OngoingVerification struct {
 	methodInvocations []pegomock.MethodInvocation
 }
 
-func (c *Blobstore_Get_OngoingVerification) GetCapturedArguments() string {
-	path := c.GetAllCapturedArguments()
-	return path[len(path)-1]
+func (c *Blobstore_Get_OngoingVerification) GetCapturedArguments() (context.Context, string) {
+	ctx, path := c.GetAllCapturedArguments()
+	return ctx[len(ctx)-1], path[len(path)-1]
 }
 
-func (c *Blobstore_Get_OngoingVerification) GetAllCapturedArguments() (_param0 []string) {
+func (c *Blobstore_Get_OngoingVerification) GetAllCapturedArguments() (_param0 []context.Context, _param1 []string) {
 	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
 	if len(params) > 0 {
-		_param0 = make([]string, len(params[0]))
+		_param0 = make([]context.Context, len(params[0]))
 		for u, param := range params[0] {
-			_param0[u] = param.(string)
+			_param0[u] = param.(context.Context)
+		}
+		_param1 = make([]string, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(string)
 		}
 	}
 	return
 }
 
-func (verifier *VerifierBlobstore) Put(path string, src io.ReadSeeker) *Blobstore_Put_OngoingVerification {
-	params := []pegomock.Param{path, src}
+func (verifier *VerifierBlobstore) Put(ctx context.Context, path string, src io.ReadSeeker) *Blobstore_Put_OngoingVerification {
+	params := []pegomock.Param{ctx, path, src}
 	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "Put", params)
 	return &Blobstore_Put_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
 }
@@ -294,28 +311,32 @@ type Blobstore_Put_OngoingVerification struct {
 	methodInvocations []pegomock.MethodInvocation
 }
 
-func (c *Blobstore_Put_OngoingVerification) GetCapturedArguments() (string, io.ReadSeeker) {
-	path, src := c.GetAllCapturedArguments()
-	return path[len(path)-1], src[len(src)-1]
+func (c *Blobstore_Put_OngoingVerification) GetCapturedArguments() (context.Context, string, io.ReadSeeker) {
+	ctx, path, src := c.GetAllCapturedArguments()
+	return ctx[len(ctx)-1], path[len(path)-1], src[len(src)-1]
 }
 
-func (c *Blobstore_Put_OngoingVerification) GetAllCapturedArguments() (_param0 []string, _param1 []io.ReadSeeker) {
+func (c *Blobstore_Put_OngoingVerification) GetAllCapturedArguments() (_param0 []context.Context, _param1 []string, _param2 []io.ReadSeeker) {
 	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
 	if len(params) > 0 {
-		_param0 = make([]string, len(params[0]))
+		_param0 = make([]context.Context, len(params[0]))
 		for u, param := range params[0] {
-			_param0[u] = param.(string)
+			_param0[u] = param.(context.Context)
 		}
-		_param1 = make([]io.ReadSeeker, len(params[1]))
+		_param1 = make([]string, len(params[1]))
 		for u, param := range params[1] {
-			_param1[u] = param.(io.ReadSeeker)
+			_param1[u] = param.(string)
+		}
+		_param2 = make([]io.ReadSeeker, len(params[2]))
+		for u, param := range params[2] {
+			_param2[u] = param.(io.ReadSeeker)
 		}
 	}
 	return
 }
 
-func (verifier *VerifierBlobstore) Copy(src string, dest string) *Blobstore_Copy_OngoingVerification {
-	params := []pegomock.Param{src, dest}
+func (verifier *VerifierBlobstore) Copy(ctx context.Context, src string, dest string) *Blobstore_Copy_OngoingVerification {
+	params := []pegomock.Param{ctx, src, dest}
 	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "Copy", params)
 	return &Blobstore_Copy_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
 }
@@ -325,28 +346,32 @@ type Blobstore_Copy_OngoingVerification struct {
 	methodInvocations []pegomock.MethodInvocation
 }
 
-func (c *Blobstore_Copy_OngoingVerification) GetCapturedArguments() (string, string) {
-	src, dest := c.GetAllCapturedArguments()
-	return src[len(src)-1], dest[len(dest)-1]
+func (c *Blobstore_Copy_OngoingVerification) GetCapturedArguments() (context.Context, string, string) {
+	ctx, src, dest := c.GetAllCapturedArguments()
+	return ctx[len(ctx)-1], src[len(src)-1], dest[len(dest)-1]
 }
 
-func (c *Blobstore_Copy_OngoingVerification) GetAllCapturedArguments() (_param0 []string, _param1 []string) {
+func (c *Blobstore_Copy_OngoingVerification) GetAllCapturedArguments() (_param0 []context.Context, _param1 []string, _param2 []string) {
 	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
 	if len(params) > 0 {
-		_param0 = make([]string, len(params[0]))
+		_param0 = make([]context.Context, len(params[0]))
 		for u, param := range params[0] {
-			_param0[u] = param.(string)
+			_param0[u] = param.(context.Context)
 		}
 		_param1 = make([]string, len(params[1]))
 		for u, param := range params[1] {
 			_param1[u] = param.(string)
 		}
+		_param2 = make([]string, len(params[2]))
+		for u, param := range params[2] {
+			_param2[u] = param.(string)
+		}
 	}
 	return
 }
 
-func (verifier *VerifierBlobstore) Delete(path string) *Blobstore_Delete_OngoingVerification {
-	params := []pegomock.Param{path}
+func (verifier *VerifierBlobstore) Delete(ctx context.Context, path string) *Blobstore_Delete_OngoingVerification {
+	params := []pegomock.Param{ctx, path}
 	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "Delete", params)
 	return &Blobstore_Delete_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
 }
@@ -356,24 +381,28 @@ type Blobstore_Delete_OngoingVerification struct {
 	methodInvocations []pegomock.MethodInvocation
 }
 
-func (c *Blobstore_Delete_OngoingVerification) GetCapturedArguments() string {
-	path := c.GetAllCapturedArguments()
-	return path[len(path)-1]
+func (c *Blobstore_Delete_OngoingVerification) GetCapturedArguments() (context.Context, string) {
+	ctx, path := c.GetAllCapturedArguments()
+	return ctx[len(ctx)-1], path[len(path)-1]
 }
 
-func (c *Blobstore_Delete_OngoingVerification) GetAllCapturedArguments() (_param0 []string) {
+func (c *Blobstore_Delete_OngoingVerification) GetAllCapturedArguments() (_param0 []context.Context, _param1 []string) {
 	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
 	if len(params) > 0 {
-		_param0 = make([]string, len(params[0]))
+		_param0 = make([]context.Context, len(params[0]))
 		for u, param := range params[0] {
-			_param0[u] = param.(string)
+			_param0[u] = param.(context.Context)
+		}
+		_param1 = make([]string, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(string)
 		}
 	}
 	return
 }
 
-func (verifier *VerifierBlobstore) DeleteDir(prefix string) *Blobstore_DeleteDir_OngoingVerification {
-	params := []pegomock.Param{prefix}
+func (verifier *VerifierBlobstore) DeleteDir(ctx context.Context, prefix string) *Blobstore_DeleteDir_OngoingVerification {
+	params := []pegomock.Param{ctx, prefix}
 	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "DeleteDir", params)
 	return &Blobstore_DeleteDir_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
 }
@@ -383,17 +412,21 @@ type Blobstore_DeleteDir_OngoingVerification struct {
 	methodInvocations []pegomock.MethodInvocation
 }
 
-func (c *Blobstore_DeleteDir_OngoingVerification) GetCapturedArguments() string {
-	prefix := c.GetAllCapturedArguments()
-	return prefix[len(prefix)-1]
+func (c *Blobstore_DeleteDir_OngoingVerification) GetCapturedArguments() (context.Context, string) {
+	ctx, prefix := c.GetAllCapturedArguments()
+	return ctx[len(ctx)-1], prefix[len(prefix)-1]
 }
 
-func (c *Blobstore_DeleteDir_OngoingVerification) GetAllCapturedArguments() (_param0 []string) {
+func (c *Blobstore_DeleteDir_OngoingVerification) GetAllCapturedArguments() (_param0 []context.Context, _param1 []string) {
 	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
 	if len(params) > 0 {
-		_param0 = make([]string, len(params[0]))
+		_param0 = make([]context.Context, len(params[0]))
 		for u, param := range params[0] {
-			_param0[u] = param.(string)
+			_param0[u] = param.(context.Context)
+		}
+		_param1 = make([]string, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(string)
 		}
 	}
 	return
@@ -4,6 +4,7 @@
 package bitsgo_test
 
 import (
+	context "context"
 	pegomock "github.com/petergtz/pegomock"
 	io "io"
 	"reflect"
@@ -17,11 +18,11 @@ func NewMockNoRedirectBlobstore() *MockNoRedirectBlobstore {
 	return &MockNoRedirectBlobstore{fail: pegomock.GlobalFailHandler}
 }
 
-func (mock *MockNoRedirectBlobstore) Exists(path string) (bool, error) {
+func (mock *MockNoRedirectBlobstore) Exists(ctx context.Context, path string) (bool, error) {
 	if mock == nil {
 		panic("mock must not be nil. Use myMock := NewMockMockNoRedirectBlobstore().")
 	}
-	params := []pegomock.Param{path}
+	params := []pegomock.Param{ctx, path}
 	result := pegomock.GetGenericMockFrom(mock).Invoke("Exists", params, []reflect.Type{reflect.TypeOf((*bool)(nil)).Elem(), reflect.TypeOf((*error)(nil)).Elem()})
 	var ret0 bool
 	var ret1 error
@@ -36,11 +37,11 @@ func (mock *MockNoRedirectBlobstore) Exists(path string) (bool, error) {
 	return ret0, ret1
 }
 
-func (mock *MockNoRedirectBlobstore) Get(path string) (io.ReadCloser, error) {
+func (mock *MockNoRedirectBlobstore) Get(ctx context.Context, path string) (io.ReadCloser, error) {
 	if mock == nil {
 		panic("mock must not be nil. Use myMock := NewMockMockNoRedirectBlobstore().")
 	}
-	params := []pegomock.Param{path}
+	params := []pegomock.Param{ctx, path}
 	result := pegomock.GetGenericMockFrom(mock).Invoke("Get", params, []reflect.Type{reflect.TypeOf((*io.ReadCloser)(nil)).Elem(), reflect.TypeOf((*error)(nil)).Elem()})
 	var ret0 io.ReadCloser
 	var ret1 error
@@ -55,11 +56,11 @@ func (mock *MockNoRedirectBlobstore) Get(path string) (io.ReadCloser, error) {
 	return ret0, ret1
 }
 
-func (mock *MockNoRedirectBlobstore) Put(path string, src io.ReadSeeker) error {
+func (mock *MockNoRedirectBlobstore) Put(ctx context.Context, path string, src io.ReadSeeker) error {
 	if mock == nil {
 		panic("mock must not be nil. Use myMock := NewMockMockNoRedirectBlobstore().")
 	}
-	params := []pegomock.Param{path, src}
+	params := []pegomock.Param{ctx, path, src}
 	result := pegomock.GetGenericMockFrom(mock).Invoke("Put", params, []reflect.Type{reflect.TypeOf((*error)(nil)).Elem()})
 	var ret0 error
 	if len(result) != 0 {
@@ -70,11 +71,11 @@ func (mock *MockNoRedirectBlobstore) Put(path string, src io.ReadSeeker) error {
 	return ret0
 }
 
-func (mock *MockNoRedirectBlobstore) Delete(path string) error {
+func (mock *MockNoRedirectBlobstore) Delete(ctx context.Context, path string) error {
 	if mock == nil {
 		panic("mock must not be nil. Use myMock := NewMockMockNoRedirectBlobstore().")
 	}
-	params := []pegomock.Param{path}
+	params := []pegomock.Param{ctx, path}
 	result := pegomock.GetGenericMockFrom(mock).Invoke("Delete", params, []reflect.Type{reflect.TypeOf((*error)(nil)).Elem()})
 	var ret0 error
 	if len(result) != 0 {
@@ -85,11 +86,11 @@ func (mock *MockNoRedirectBlobstore) Delete(path string) error {
 	return ret0
 }
 
-func (mock *MockNoRedirectBlobstore) DeleteDir(prefix string) error {
+func (mock *MockNoRedirectBlobstore) DeleteDir(ctx context.Context, prefix string) error {
 	if mock == nil {
 		panic("mock must not be nil. Use myMock := NewMockMockNoRedirectBlobstore().")
 	}
-	params := []pegomock.Param{prefix}
+	params := []pegomock.Param{ctx, prefix}
 	result := pegomock.GetGenericMockFrom(mock).Invoke("DeleteDir", params, []reflect.Type{reflect.TypeOf((*error)(nil)).Elem()})
 	var ret0 error
 	if len(result) != 0 {
@@ -118,8 +119,8 @@ type VerifierNoRedirectBlobstore struct {
 	inOrderContext         *pegomock.InOrderContext
 }
 
-func (verifier *VerifierNoRedirectBlobstore) Exists(path string) *NoRedirectBlobstore_Exists_OngoingVerification {
-	params := []pegomock.Param{path}
+func (verifier *VerifierNoRedirectBlobstore) Exists(ctx context.Context, path string) *NoRedirectBlobstore_Exists_OngoingVerification {
+	params := []pegomock.Param{ctx, path}
 	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "Exists", params)
 	return &NoRedirectBlobstore_Exists_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
 }
@@ -129,24 +130,28 @@ type NoRedirectBlobstore_Exists_OngoingVerification struct {
 	methodInvocations []pegomock.MethodInvocation
 }
 
-func (c *NoRedirectBlobstore_Exists_OngoingVerification) GetCapturedArguments() string {
-	path := c.GetAllCapturedArguments()
-	return path[len(path)-1]
+func (c *NoRedirectBlobstore_Exists_OngoingVerification) GetCapturedArguments() (context.Context, string) {
+	ctx, path := c.GetAllCapturedArguments()
+	return ctx[len(ctx)-1], path[len(path)-1]
 }
 
-func (c *NoRedirectBlobstore_Exists_OngoingVerification) GetAllCapturedArguments() (_param0 []string) {
+func (c *NoRedirectBlobstore_Exists_OngoingVerification) GetAllCapturedArguments() (_param0 []context.Context, _param1 []string) {
 	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
 	if len(params) > 0 {
-		_param0 = make([]string, len(params[0]))
+		_param0 = make([]context.Context, len(params[0]))
 		for u, param := range params[0] {
-			_param0[u] = param.(string)
+			_param0[u] = param.(context.Context)
+		}
+		_param1 = make([]string, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(string)
 		}
 	}
 	return
 }
 
-func (verifier *VerifierNoRedirectBlobstore) Get(path string) *NoRedirectBlobstore_Get_OngoingVerification {
-	params := []pegomock.Param{path}
+func (verifier *VerifierNoRedirectBlobstore) Get(ctx context.Context, path string) *NoRedirectBlobstore_Get_OngoingVerification {
+	params := []pegomock.Param{ctx, path}
 	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "Get", params)
 	return &NoRedirectBlobstore_Get_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
 }
@@ -156,24 +161,28 @@ type NoRedirectBlobstore_Get_OngoingVerification struct {
 	methodInvocations []pegomock.MethodInvocation
 }
 
-func (c *NoRedirectBlobstore_Get_OngoingVerification) GetCapturedArguments() string {
-	path := c.GetAllCapturedArguments()
-	return path[len(path)-1]
+func (c *NoRedirectBlobstore_Get_OngoingVerification) GetCapturedArguments() (context.Context, string) {
+	ctx, path := c.GetAllCapturedArguments()
+	return ctx[len(ctx)-1], path[len(path)-1]
 }
 
-func (c *NoRedirectBlobstore_Get_OngoingVerification) GetAllCapturedArguments() (_param0 []string) {
+func (c *NoRedirectBlobstore_Get_OngoingVerification) GetAllCapturedArguments() (_param0 []context.Context, _param1 []string) {
 	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
 	if len(params) > 0 {
-		_param0 = make([]string, len(params[0]))
+		_param0 = make([]context.Context, len(params[0]))
 		for u, param := range params[0] {
-			_param0[u] = param.(string)
+			_param0[u] = param.(context.Context)
+		}
+		_param1 = make([]string, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(string)
 		}
 	}
 	return
 }
 
-func (verifier *VerifierNoRedirectBlobstore) Put(path string, src io.ReadSeeker) *NoRedirectBlobstore_Put_OngoingVerification {
-	params := []pegomock.Param{path, src}
+func (verifier *VerifierNoRedirectBlobstore) Put(ctx context.Context, path string, src io.ReadSeeker) *NoRedirectBlobstore_Put_OngoingVerification {
+	params := []pegomock.Param{ctx, path, src}
 	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "Put", params)
 	return &NoRedirectBlobstore_Put_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
 }
@@ -183,28 +192,32 @@ type NoRedirectBlobstore_Put_OngoingVerification struct {
 	methodInvocations []pegomock.MethodInvocation
 }
 
-func (c *NoRedirectBlobstore_Put_OngoingVerification) GetCapturedArguments() (string, io.ReadSeeker) {
-	path, src := c.GetAllCapturedArguments()
-	return path[len(path)-1], src[len(src)-1]
+func (c *NoRedirectBlobstore_Put_OngoingVerification) GetCapturedArguments() (context.Context, string, io.ReadSeeker) {
+	ctx, path, src := c.GetAllCapturedArguments()
+	return ctx[len(ctx)-1], path[len(path)-1], src[len(src)-1]
 }
 
-func (c *NoRedirectBlobstore_Put_OngoingVerification) GetAllCapturedArguments() (_param0 []string, _param1 []io.ReadSeeker) {
+func (c *NoRedirectBlobstore_Put_OngoingVerification) GetAllCapturedArguments() (_param0 []context.Context, _param1 []string, _param2 []io.ReadSeeker) {
 	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
 	if len(params) > 0 {
-		_param0 = make([]string, len(params[0]))
+		_param0 = make([]context.Context, len(params[0]))
 		for u, param := range params[0] {
-			_param0[u] = param.(string)
+			_param0[u] = param.(context.Context)
 		}
-		_param1 = make([]io.ReadSeeker, len(params[1]))
+		_param1 = make([]string, len(params[1]))
 		for u, param := range params[1] {
-			_param1[u] = param.(io.ReadSeeker)
+			_param1[u] = param.(string)
+		}
+		_param2 = make([]io.ReadSeeker, len(params[2]))
+		for u, param := range params[2] {
+			_param2[u] = param.(io.ReadSeeker)
 		}
 	}
 	return
 }
 
-func (verifier *VerifierNoRedirectBlobstore) Delete(path string) *NoRedirectBlobstore_Delete_OngoingVerification {
-	params := []pegomock.Param{path}
+func (verifier *VerifierNoRedirectBlobstore) Delete(ctx context.Context, path string) *NoRedirectBlobstore_Delete_OngoingVerification {
+	params := []pegomock.Param{ctx, path}
 	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "Delete", params)
 	return &NoRedirectBlobstore_Delete_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
 }
@@ -214,24 +227,28 @@ type NoRedirectBlobstore_Delete_OngoingVerification struct {
 	methodInvocations []pegomock.MethodInvocation
 }
 
-func (c *NoRedirectBlobstore_Delete_OngoingVerification) GetCapturedArguments() string {
-	path := c.GetAllCapturedArguments()
-	return path[len(path)-1]
+func (c *NoRedirectBlobstore_Delete_OngoingVerification) GetCapturedArguments() (context.Context, string) {
+	ctx, path := c.GetAllCapturedArguments()
+	return ctx[len(ctx)-1], path[len(path)-1]
 }
 
-func (c *NoRedirectBlobstore_Delete_OngoingVerification) GetAllCapturedArguments() (_param0 []string) {
+func (c *NoRedirectBlobstore_Delete_OngoingVerification) GetAllCapturedArguments() (_param0 []context.Context, _param1 []string) {
 	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
 	if len(params) > 0 {
-		_param0 = make([]string, len(params[0]))
+		_param0 = make([]context.Context, len(params[0]))
 		for u, param := range params[0] {
-			_param0[u] = param.(string)
+			_param0[u] = param.(context.Context)
+		}
+		_param1 = make([]string, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(string)
 		}
 	}
 	return
 }
 
-func (verifier *VerifierNoRedirectBlobstore) DeleteDir(prefix string) *NoRedirectBlobstore_DeleteDir_OngoingVerification {
-	params := []pegomock.Param{prefix}
+func (verifier *VerifierNoRedirectBlobstore) DeleteDir(ctx context.Context, prefix string) *NoRedirectBlobstore_DeleteDir_OngoingVerification {
+	params := []pegomock.Param{ctx, prefix}
 	methodInvocations := pegomock.GetGenericMockFrom(verifier.mock).Verify(verifier.inOrderContext, verifier.invocationCountMatcher, "DeleteDir", params)
 	return &NoRedirectBlobstore_DeleteDir_OngoingVerification{mock: verifier.mock, methodInvocations: methodInvocations}
 }
@@ -241,17 +258,21 @@ type NoRedirectBlobstore_DeleteDir_OngoingVerification struct {
 	methodInvocations []pegomock.MethodInvocation
 }
 
-func (c *NoRedirectBlobstore_DeleteDir_OngoingVerification) GetCapturedArguments() string {
-	prefix := c.GetAllCapturedArguments()
-	return prefix[len(prefix)-1]
+func (c *NoRedirectBlobstore_DeleteDir_OngoingVerification) GetCapturedArguments() (context.Context, string) {
+	ctx, prefix := c.GetAllCapturedArguments()
+	return ctx[len(ctx)-1], prefix[len(prefix)-1]
 }
 
-func (c *NoRedirectBlobstore_DeleteDir_OngoingVerification) GetAllCapturedArguments() (_param0 []string) {
+func (c *NoRedirectBlobstore_DeleteDir_OngoingVerification) GetAllCapturedArguments() (_param0 []context.Context, _param1 []string) {
 	params := pegomock.GetGenericMockFrom(c.mock).GetInvocationParams(c.methodInvocations)
 	if len(params) > 0 {
-		_param0 = make([]string, len(params[0]))
+		_param0 = make([]context.Context, len(params[0]))
 		for u, param := range params[0] {
-			_param0[u] = param.(string)
+			_param0[u] = param.(context.Context)
+		}
+		_param1 = make([]string, len(params[1]))
+		for u, param := range params[1] {
+			_param1[u] = param.(string)
 		}
 	}
 	return
@@ -2,6 +2,7 @@ package bitsgo
 
 import (
 	"archive/zip"
+	"context"
 	"crypto/sha1"
 	"encoding/hex"
 	"io"
@@ -15,13 +16,40 @@ import (
 	"github.com/cenkalti/backoff"
 )
 
-func CreateTempZipFileFrom(bundlesPayload []Fingerprint,
+func CreateTempZipFileFrom(ctx context.Context, bundlesPayload []Fingerprint,
 	zipReader *zip.Reader,
 	minimumSize, maximumSize uint64,
 	blobstore NoRedirectBlobstore,
 	metricsService MetricsService,
 ) (tempFilename string, err error) {
-	tempZipFile, e := ioutil.TempFile("", "bundles")
+	return CreateTempZipFileWithLimitsFrom(ctx, bundlesPayload, zipReader, minimumSize, maximumSize, ZipLimits{}, blobstore, metricsService)
+}
+
+// CreateTempZipFileWithLimitsFrom returns *ZipLimitError if zipReader or the resulting bundle exceed zipLimits.
+func CreateTempZipFileWithLimitsFrom(ctx context.Context, bundlesPayload []Fingerprint,
+	zipReader *zip.Reader,
+	minimumSize, maximumSize uint64,
+	zipLimits ZipLimits,
+	blobstore NoRedirectBlobstore,
+	metricsService MetricsService,
+) (tempFilename string, err error) {
+	var zipEntries []*zip.File
+	if zipReader != nil {
+		zipEntries = zipReader.File
+	}
+	e := zipLimits.ValidateEntries(zipEntries, len(bundlesPayload))
+	if e != nil {
+		return "", e
+	}
+	for _, entry := range bundlesPayload {
+		e = zipLimits.ValidateEntryName(entry.Fn)
+		if e != nil {
+			return "", e
+		}
+	}
+	sizeBudget := zipLimits.NewSizeBudget()
+
+	tempZipFile, e := ioutil.TempFile("", "bits-bundles")
 	if e != nil {
 		return "", errors.Wrap(e, "Could not create temp file")
 	}
@@ -48,7 +76,7 @@ func CreateTempZipFileFrom(bundlesPayload []Fingerprint,
 			}
 			defer zipEntryReader.Close()
 
-			tempFile, e := ioutil.TempFile("", "app-stash")
+			tempFile, e := ioutil.TempFile("", "bits-app-stash")
 			if e != nil {
 				return "", errors.Wrap(e, "Could not create tempfile")
 			}
@@ -56,7 +84,10 @@ func CreateTempZipFileFrom(bundlesPayload []Fingerprint,
 			defer tempFile.Close()
 
 			sha := sha1.New()
-			tempFileSize, e := io.Copy(io.MultiWriter(zipFileEntryWriter, tempFile, sha), zipEntryReader)
+			tempFileSize, e := io.Copy(io.MultiWriter(zipFileEntryWriter, tempFile, sha), sizeBudget.Reader(zipEntryReader))
+			if _, isZipLimitError := e.(*ZipLimitError); isZipLimitError {
+				return "", e
+			}
 			if e != nil {
 				return "", errors.Wrap(e, "Could not copy content from zip entry")
 			}
@@ -76,7 +107,7 @@ func CreateTempZipFileFrom(bundlesPayload []Fingerprint,
 				defer tempFile.Close()
 				if uint64(tempFileSize) >= minimumSize && uint64(tempFileSize) <= maximumSize {
 					sha := hex.EncodeToString(sha.Sum(nil))
-					e = blobstore.Put(sha, tempFile)
+					e = blobstore.Put(ctx, sha, tempFile)
 					if e != nil {
 						if _, ok := e.(*NoSpaceLeftError); ok {
 							return backoff.Permanent(e)
@@ -85,7 +116,7 @@ func CreateTempZipFileFrom(bundlesPayload []Fingerprint,
 					}
 				}
 				return nil
-			}, backoff.NewExponentialBackOff(), func(e error, backOffDelay time.Duration) {
+			}, backoff.WithContext(backoff.NewExponentialBackOff(), ctx), func(e error, backOffDelay time.Duration) {
 				metricsService.SendCounterMetric("appStashPutRetries", 1)
 			})
 			if e != nil {
@@ -102,7 +133,7 @@ func CreateTempZipFileFrom(bundlesPayload []Fingerprint,
 		}
 
 		e = backoff.RetryNotify(func() error {
-			b, e := blobstore.Get(entry.Sha1)
+			b, e := blobstore.Get(ctx, entry.Sha1)
 			if e != nil {
 				if _, ok := e.(*NotFoundError); ok {
 					return backoff.Permanent(NewNotFoundErrorWithKey(entry.Sha1))
@@ -111,13 +142,16 @@ func CreateTempZipFileFrom(bundlesPayload []Fingerprint,
 			}
 			defer b.Close()
 
-			_, e = io.Copy(zipEntry, b)
+			_, e = io.Copy(zipEntry, sizeBudget.Reader(b))
+			if _, isZipLimitError := e.(*ZipLimitError); isZipLimitError {
+				return backoff.Permanent(e)
+			}
 			if e != nil {
 				return errors.Wrapf(e, "Could not copy file to zip entry. SHA:", entry.Sha1)
 			}
 			return nil
 		},
-			backoff.NewExponentialBackOff(),
+			backoff.WithContext(backoff.NewExponentialBackOff(), ctx),
 			func(e error, backOffDelay time.Duration) {
 				metricsService.SendCounterMetric("appStashGetRetries", 1)
 			},
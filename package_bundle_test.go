@@ -2,6 +2,7 @@ package bitsgo_test
 
 import (
 	"archive/zip"
+	"context"
 	"io/ioutil"
 	"math"
 	"os"
@@ -24,9 +25,9 @@ var _ = Describe("CreateTempZipFileFrom", func() {
 	BeforeEach(func() { blobstore = inmemory.NewBlobstore() })
 
 	It("Creates a zip", func() {
-		Expect(blobstore.Put("abc", strings.NewReader("filename1 content"))).To(Succeed())
+		Expect(blobstore.Put(context.Background(), "abc", strings.NewReader("filename1 content"))).To(Succeed())
 
-		tempFileName, e := bitsgo.CreateTempZipFileFrom([]bitsgo.Fingerprint{
+		tempFileName, e := bitsgo.CreateTempZipFileFrom(context.Background(), []bitsgo.Fingerprint{
 			bitsgo.Fingerprint{
 				Sha1: "abc",
 				Fn:   "filename1",
@@ -50,11 +51,11 @@ var _ = Describe("CreateTempZipFileFrom", func() {
 
 		Context("Error in Blobstore.Get", func() {
 			It("Retries and creates the zip successfully", func() {
-				When(blobstore.Get("abc")).
+				When(blobstore.Get(context.Background(), "abc")).
 					ThenReturn(nil, errors.New("Some error")).
 					ThenReturn(ioutil.NopCloser(strings.NewReader("filename1 content")), nil)
 
-				tempFileName, e := bitsgo.CreateTempZipFileFrom([]bitsgo.Fingerprint{
+				tempFileName, e := bitsgo.CreateTempZipFileFrom(context.Background(), []bitsgo.Fingerprint{
 					bitsgo.Fingerprint{
 						Sha1: "abc",
 						Fn:   "filename1",
@@ -75,15 +76,15 @@ var _ = Describe("CreateTempZipFileFrom", func() {
 				readClose := NewMockReadCloser()
 				When(readClose.Read(AnySliceOfByte())).ThenReturn(1, errors.New("some random read error"))
 
-				When(blobstore.Get("abc")).
+				When(blobstore.Get(context.Background(), "abc")).
 					ThenReturn(readClose, nil).
 					ThenReturn(ioutil.NopCloser(strings.NewReader("filename1 content")), nil)
 
-				When(blobstore.Get("def")).
+				When(blobstore.Get(context.Background(), "def")).
 					ThenReturn(readClose, nil).
 					ThenReturn(ioutil.NopCloser(strings.NewReader("filename2 content")), nil)
 
-				tempFileName, e := bitsgo.CreateTempZipFileFrom([]bitsgo.Fingerprint{
+				tempFileName, e := bitsgo.CreateTempZipFileFrom(context.Background(), []bitsgo.Fingerprint{
 					bitsgo.Fingerprint{
 						Sha1: "abc",
 						Fn:   "filename1",
@@ -118,7 +119,7 @@ var _ = Describe("CreateTempZipFileFrom", func() {
 			Expect(e).NotTo(HaveOccurred())
 			defer openZipFile.Close()
 
-			tempFilename, e := bitsgo.CreateTempZipFileFrom([]bitsgo.Fingerprint{}, &openZipFile.Reader, 15, 30, blobstore, NewMockMetricsService())
+			tempFilename, e := bitsgo.CreateTempZipFileFrom(context.Background(), []bitsgo.Fingerprint{}, &openZipFile.Reader, 15, 30, blobstore, NewMockMetricsService())
 			Expect(e).NotTo(HaveOccurred())
 			os.Remove(tempFilename)
 
@@ -135,7 +136,7 @@ var _ = Describe("CreateTempZipFileFrom", func() {
 			Expect(e).NotTo(HaveOccurred())
 			defer openZipFile.Close()
 
-			tempFilename, e := bitsgo.CreateTempZipFileFrom([]bitsgo.Fingerprint{}, &openZipFile.Reader, 15, 30, blobstore, NewMockMetricsService())
+			tempFilename, e := bitsgo.CreateTempZipFileFrom(context.Background(), []bitsgo.Fingerprint{}, &openZipFile.Reader, 15, 30, blobstore, NewMockMetricsService())
 			Expect(e).NotTo(HaveOccurred(), "Error: %v", e)
 			os.Remove(tempFilename)
 		})
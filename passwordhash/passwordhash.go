@@ -0,0 +1,123 @@
+// Package passwordhash verifies passwords against bcrypt and argon2id hashes.
+package passwordhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Validate returns an error if hash is neither a bcrypt hash nor an argon2id hash in PHC string format,
+// e.g. "$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>".
+func Validate(hash string) error {
+	if isBcryptHash(hash) {
+		_, e := bcrypt.Cost([]byte(hash))
+		return e
+	}
+	if strings.HasPrefix(hash, "$argon2id$") {
+		_, e := parseArgon2idHash(hash)
+		return e
+	}
+	return errors.New("Unsupported password hash. Must be bcrypt or argon2id")
+}
+
+// Matches returns whether password matches hash. Invalid hashes match no password.
+func Matches(password, hash string) bool {
+	if isBcryptHash(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	if strings.HasPrefix(hash, "$argon2id$") {
+		parsedHash, e := parseArgon2idHash(hash)
+		if e != nil {
+			return false
+		}
+		key := argon2.IDKey([]byte(password), parsedHash.salt, parsedHash.time, parsedHash.memory, parsedHash.threads, uint32(len(parsedHash.key)))
+		return subtle.ConstantTimeCompare(key, parsedHash.key) == 1
+	}
+	return false
+}
+
+// DummyLike returns a hash of a random password with the same algorithm and parameters as hash, so that comparing
+// a password against it takes as long as comparing against hash. It returns an empty string for unsupported hashes.
+func DummyLike(hash string) string {
+	randomPassword := make([]byte, 32)
+	_, e := rand.Read(randomPassword)
+	if e != nil {
+		panic(e)
+	}
+	if isBcryptHash(hash) {
+		cost, e := bcrypt.Cost([]byte(hash))
+		if e != nil {
+			return ""
+		}
+		dummyHash, e := bcrypt.GenerateFromPassword(randomPassword, cost)
+		if e != nil {
+			return ""
+		}
+		return string(dummyHash)
+	}
+	if strings.HasPrefix(hash, "$argon2id$") {
+		parsedHash, e := parseArgon2idHash(hash)
+		if e != nil {
+			return ""
+		}
+		salt := make([]byte, len(parsedHash.salt))
+		_, e = rand.Read(salt)
+		if e != nil {
+			panic(e)
+		}
+		key := argon2.IDKey(randomPassword, salt, parsedHash.time, parsedHash.memory, parsedHash.threads, uint32(len(parsedHash.key)))
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, parsedHash.memory, parsedHash.time, parsedHash.threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+	}
+	return ""
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+type argon2idHash struct {
+	memory    uint32
+	time      uint32
+	threads   uint8
+	salt, key []byte
+}
+
+func parseArgon2idHash(hash string) (*argon2idHash, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return nil, errors.New("Invalid argon2id hash: must have format $argon2id$v=<version>$m=<memory>,t=<time>,p=<threads>$<salt>$<key>")
+	}
+	var version int
+	_, e := fmt.Sscanf(parts[2], "v=%d", &version)
+	if e != nil {
+		return nil, errors.Wrap(e, "Invalid argon2id hash version")
+	}
+	if version != argon2.Version {
+		return nil, errors.Errorf("Unsupported argon2id hash version %v", version)
+	}
+	var parsedHash argon2idHash
+	_, e = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &parsedHash.memory, &parsedHash.time, &parsedHash.threads)
+	if e != nil {
+		return nil, errors.Wrap(e, "Invalid argon2id hash parameters")
+	}
+	parsedHash.salt, e = base64.RawStdEncoding.DecodeString(parts[4])
+	if e != nil {
+		return nil, errors.Wrap(e, "Invalid argon2id hash salt")
+	}
+	parsedHash.key, e = base64.RawStdEncoding.DecodeString(parts[5])
+	if e != nil {
+		return nil, errors.Wrap(e, "Invalid argon2id hash key")
+	}
+	if len(parsedHash.key) == 0 || parsedHash.time == 0 || parsedHash.threads == 0 {
+		return nil, errors.New("Invalid argon2id hash: key, time and threads must not be empty")
+	}
+	return &parsedHash, nil
+}
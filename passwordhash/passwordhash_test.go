@@ -0,0 +1,84 @@
+package passwordhash_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	. "github.com/cloudfoundry-incubator/bits-service/passwordhash"
+	"github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHash(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "PasswordHash")
+}
+
+var _ = Describe("PasswordHash", func() {
+	Context("bcrypt", func() {
+		var hash string
+
+		BeforeEach(func() {
+			hashBytes, e := bcrypt.GenerateFromPassword([]byte("the-password"), bcrypt.MinCost)
+			Expect(e).NotTo(HaveOccurred())
+			hash = string(hashBytes)
+		})
+
+		It("matches the correct password only", func() {
+			Expect(Validate(hash)).To(Succeed())
+			Expect(Matches("the-password", hash)).To(BeTrue())
+			Expect(Matches("wrong-password", hash)).To(BeFalse())
+		})
+
+		It("creates dummy hashes with the same cost", func() {
+			dummyHash := DummyLike(hash)
+
+			Expect(Validate(dummyHash)).To(Succeed())
+			Expect(bcrypt.Cost([]byte(dummyHash))).To(Equal(bcrypt.MinCost))
+			Expect(Matches("the-password", dummyHash)).To(BeFalse())
+		})
+	})
+
+	Context("argon2id", func() {
+		var hash string
+
+		BeforeEach(func() {
+			salt := []byte("some-salt-value!")
+			key := argon2.IDKey([]byte("the-password"), salt, 1, 8*1024, 1, 32)
+			hash = fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, 8*1024, 1, 1,
+				base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+		})
+
+		It("matches the correct password only", func() {
+			Expect(Validate(hash)).To(Succeed())
+			Expect(Matches("the-password", hash)).To(BeTrue())
+			Expect(Matches("wrong-password", hash)).To(BeFalse())
+		})
+
+		It("creates dummy hashes with the same parameters", func() {
+			dummyHash := DummyLike(hash)
+
+			Expect(Validate(dummyHash)).To(Succeed())
+			Expect(dummyHash).To(HavePrefix(fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$", argon2.Version, 8*1024, 1, 1)))
+			Expect(dummyHash).NotTo(Equal(hash))
+			Expect(Matches("the-password", dummyHash)).To(BeFalse())
+		})
+
+		It("rejects malformed hashes", func() {
+			Expect(Validate("$argon2id$v=19$m=65536,t=3,p=2$c2FsdA")).To(MatchError(ContainSubstring("Invalid argon2id hash")))
+			Expect(Validate("$argon2id$v=16$m=65536,t=3,p=2$c2FsdA$a2V5")).To(MatchError(ContainSubstring("Unsupported argon2id hash version")))
+			Expect(Validate("$argon2id$v=19$m=65536,t=0,p=2$c2FsdA$a2V5")).To(MatchError(ContainSubstring("must not be empty")))
+		})
+	})
+
+	It("rejects unsupported hashes", func() {
+		Expect(Validate("5f4dcc3b5aa765d61d8327deb882cf99")).To(MatchError(ContainSubstring("Unsupported password hash")))
+		Expect(Matches("password", "password")).To(BeFalse())
+		Expect(DummyLike("password")).To(BeEmpty())
+	})
+})
@@ -0,0 +1,109 @@
+package pathsigner
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Constraints restrict how a signed URL may be used beyond method and expiration time.
+// They are part of the signature, so they cannot be removed or altered without invalidating the URL.
+// Zero values mean no restriction.
+type Constraints struct {
+	MaxContentLength int64
+	// ContentDigest is the hex-encoded SHA256 digest the request body must have.
+	ContentDigest string
+	// ClientIP is an IP address or a CIDR range the request must originate from.
+	ClientIP string
+}
+
+func ParseConstraints(maxContentLength, contentDigest, clientIP string) (Constraints, error) {
+	constraints := Constraints{ContentDigest: strings.ToLower(contentDigest), ClientIP: clientIP}
+	if maxContentLength != "" {
+		var e error
+		constraints.MaxContentLength, e = strconv.ParseInt(maxContentLength, 10, 64)
+		if e != nil || constraints.MaxContentLength <= 0 {
+			return Constraints{}, errors.Errorf("Invalid max_content_length: %v. Must be a positive number of bytes", maxContentLength)
+		}
+	}
+	e := constraints.Validate()
+	if e != nil {
+		return Constraints{}, e
+	}
+	return constraints, nil
+}
+
+func ConstraintsFrom(u *url.URL) (Constraints, error) {
+	return ParseConstraints(u.Query().Get("max_content_length"), u.Query().Get("content_digest"), u.Query().Get("client_ip"))
+}
+
+func (constraints Constraints) Validate() error {
+	if constraints.MaxContentLength < 0 {
+		return errors.Errorf("Invalid max_content_length: %v. Must be a positive number of bytes", constraints.MaxContentLength)
+	}
+	if constraints.ContentDigest != "" {
+		digest, e := hex.DecodeString(constraints.ContentDigest)
+		if e != nil || len(digest) != 32 {
+			return errors.Errorf("Invalid content_digest: %v. Must be a hex-encoded SHA256 digest", constraints.ContentDigest)
+		}
+	}
+	if constraints.ClientIP != "" && parseClientIP(constraints.ClientIP) == nil {
+		return errors.Errorf("Invalid client_ip: %v. Must be an IP address or a CIDR range", constraints.ClientIP)
+	}
+	return nil
+}
+
+func (constraints Constraints) IsEmpty() bool {
+	return constraints == Constraints{}
+}
+
+func (constraints Constraints) AllowsClientIP(ip net.IP) bool {
+	if constraints.ClientIP == "" {
+		return true
+	}
+	ipNet := parseClientIP(constraints.ClientIP)
+	return ipNet != nil && ip != nil && ipNet.Contains(ip)
+}
+
+func parseClientIP(clientIP string) *net.IPNet {
+	if strings.Contains(clientIP, "/") {
+		_, ipNet, e := net.ParseCIDR(clientIP)
+		if e != nil {
+			return nil
+		}
+		return ipNet
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return nil
+	}
+	if ip.To4() != nil {
+		return &net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+func (constraints Constraints) queryString() string {
+	var params []string
+	if constraints.MaxContentLength != 0 {
+		params = append(params, "max_content_length="+strconv.FormatInt(constraints.MaxContentLength, 10))
+	}
+	if constraints.ContentDigest != "" {
+		params = append(params, "content_digest="+strings.ToLower(constraints.ContentDigest))
+	}
+	if constraints.ClientIP != "" {
+		params = append(params, "client_ip="+url.QueryEscape(constraints.ClientIP))
+	}
+	return strings.Join(params, "&")
+}
+
+// canonical is the representation of the constraints covered by the signature.
+func (constraints Constraints) canonical() string {
+	return fmt.Sprintf("max_content_length=%v\ncontent_digest=%v\nclient_ip=%v",
+		constraints.MaxContentLength, strings.ToLower(constraints.ContentDigest), constraints.ClientIP)
+}
@@ -1,33 +1,63 @@
 package pathsigner
 
 import (
+	"crypto/hmac"
 	"crypto/md5"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"fmt"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/benbjohnson/clock"
 )
 
 type PathSigner interface {
-	Sign(path string, expires time.Time) string
+	Sign(method string, path string, expires time.Time) string
+	SignWithConstraints(method string, path string, expires time.Time, constraints Constraints) string
 }
 
 type PathSignatureValidator interface {
-	SignatureValid(u *url.URL) bool
+	SignatureValid(method string, u *url.URL) bool
 }
 
+// PathSignerValidator signs paths with HMAC-SHA256. The signature covers the HTTP method, the path and the
+// expiration time, and the URL carries the ID of the key used, so that secrets can be rotated without
+// invalidating outstanding URLs.
 type PathSignerValidator struct {
-	Secret string
-	Clock  clock.Clock
+	// Secrets maps key IDs to secrets. Signatures made with any of them are valid.
+	Secrets map[string]string
+	// ActiveKeyID identifies the secret used for signing.
+	ActiveKeyID string
+	Clock       clock.Clock
+
+	// AcceptMD5Signatures allows URLs signed by earlier versions with md5 and MD5Secret. Meant for migration only.
+	AcceptMD5Signatures bool
+	MD5Secret           string
+	// md5 signatures issued before method binding are accepted for any method until this point in time.
+	AcceptLegacySignaturesUntil time.Time
+}
+
+func (signer *PathSignerValidator) Sign(method string, path string, expires time.Time) string {
+	return signer.SignWithConstraints(method, path, expires, Constraints{})
 }
 
-func (signer *PathSignerValidator) Sign(path string, expires time.Time) string {
-	return fmt.Sprintf("%s?md5=%x&expires=%v", path, signatureFor(path, signer.Secret, expires), expires.Unix())
+func (signer *PathSignerValidator) SignWithConstraints(method string, path string, expires time.Time, constraints Constraints) string {
+	signedPath := fmt.Sprintf("%s?signature=%s&key_id=%s&expires=%v",
+		path,
+		hex.EncodeToString(hmacSignatureFor(strings.ToUpper(method), path, signer.Secrets[signer.ActiveKeyID], expires, constraints)),
+		url.QueryEscape(signer.ActiveKeyID),
+		expires.Unix())
+	if !constraints.IsEmpty() {
+		signedPath += "&" + constraints.queryString()
+	}
+	return signedPath
 }
 
-func (signer *PathSignerValidator) SignatureValid(u *url.URL) bool {
+func (signer *PathSignerValidator) SignatureValid(method string, u *url.URL) bool {
 	expires, e := strconv.ParseInt(u.Query().Get("expires"), 10, 64)
 	if e != nil {
 		return false
@@ -36,12 +66,70 @@ func (signer *PathSignerValidator) SignatureValid(u *url.URL) bool {
 		return false
 	}
 
-	if u.Query().Get("md5") != fmt.Sprintf("%x", signatureFor(u.Path, signer.Secret, time.Unix(expires, 0))) {
+	if u.Query().Get("signature") != "" {
+		constraints, e := ConstraintsFrom(u)
+		if e != nil {
+			return false
+		}
+		secret, exists := signer.Secrets[u.Query().Get("key_id")]
+		if !exists {
+			return false
+		}
+		signature, e := hex.DecodeString(u.Query().Get("signature"))
+		if e != nil {
+			return false
+		}
+		for _, acceptedMethod := range acceptedMethods(method) {
+			if hmac.Equal(signature, hmacSignatureFor(acceptedMethod, u.Path, secret, time.Unix(expires, 0), constraints)) {
+				return true
+			}
+		}
 		return false
 	}
-	return true
+
+	if u.Query().Get("md5") != "" && signer.AcceptMD5Signatures {
+		for _, acceptedMethod := range acceptedMethods(method) {
+			signature := md5SignatureFor(acceptedMethod, u.Path, signer.MD5Secret, time.Unix(expires, 0))
+			if constantTimeEqual(u.Query().Get("md5"), hex.EncodeToString(signature[:])) {
+				return true
+			}
+		}
+		if signer.Clock.Now().Before(signer.AcceptLegacySignaturesUntil) {
+			signature := legacyMD5SignatureFor(u.Path, signer.MD5Secret, time.Unix(expires, 0))
+			return constantTimeEqual(u.Query().Get("md5"), hex.EncodeToString(signature[:]))
+		}
+	}
+	return false
+}
+
+// acceptedMethods returns the methods whose signatures are valid for a request with method. HEAD requests
+// are also covered by GET signatures, because HEAD only reveals a subset of what GET does. The reverse
+// does not hold, so that a URL signed for HEAD cannot be used to download content.
+func acceptedMethods(method string) []string {
+	method = strings.ToUpper(method)
+	if method == "HEAD" {
+		return []string{"HEAD", "GET"}
+	}
+	return []string{method}
+}
+
+func hmacSignatureFor(method string, path string, secret string, expires time.Time, constraints Constraints) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%v\n%v\n%v", method, path, expires.Unix())
+	if !constraints.IsEmpty() {
+		fmt.Fprintf(mac, "\n%v", constraints.canonical())
+	}
+	return mac.Sum(nil)
 }
 
-func signatureFor(path string, secret string, expires time.Time) [16]byte {
+func md5SignatureFor(method string, path string, secret string, expires time.Time) [16]byte {
+	return md5.Sum([]byte(fmt.Sprintf("%v%v%v %v", expires.Unix(), method, path, secret)))
+}
+
+func legacyMD5SignatureFor(path string, secret string, expires time.Time) [16]byte {
 	return md5.Sum([]byte(fmt.Sprintf("%v%v %v", expires.Unix(), path, secret)))
 }
+
+func constantTimeEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -1,7 +1,12 @@
 package pathsigner_test
 
 import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
 	"fmt"
+	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -29,25 +34,29 @@ var _ = Describe("PathSigner", func() {
 
 	BeforeEach(func() {
 		clock = NewMock()
-		signer = &PathSignerValidator{"thesecret", clock}
+		signer = &PathSignerValidator{
+			Secrets:     map[string]string{"key1": "thesecret"},
+			ActiveKeyID: "key1",
+			Clock:       clock,
+		}
 	})
 
 	It("can sign a path and validate its signature", func() {
-		signedPath := signer.Sign("/some/path", time.Unix(200, 0))
+		signedPath := signer.Sign("GET", "/some/path", time.Unix(200, 0))
 
-		Expect(signer.SignatureValid(httputil.MustParse(signedPath))).To(BeTrue())
+		Expect(signer.SignatureValid("GET", httputil.MustParse(signedPath))).To(BeTrue())
 	})
 
 	It("can sign a path and will not validate a path when it has expired", func() {
-		signedPath := signer.Sign("/some/path", time.Unix(200, 0))
+		signedPath := signer.Sign("GET", "/some/path", time.Unix(200, 0))
 
 		clock.Add(time.Hour)
 
-		Expect(signer.SignatureValid(httputil.MustParse(signedPath))).To(BeFalse())
+		Expect(signer.SignatureValid("GET", httputil.MustParse(signedPath))).To(BeFalse())
 	})
 
 	It("can sign a path and will not allow to tamper with the expiration time", func() {
-		signedPath := signer.Sign("/some/path", time.Unix(200, 0))
+		signedPath := signer.Sign("GET", "/some/path", time.Unix(200, 0))
 
 		clock.Add(time.Hour)
 
@@ -56,7 +65,191 @@ var _ = Describe("PathSigner", func() {
 		q.Set("expires", fmt.Sprintf("%v", clock.Now().Add(time.Hour).Unix()))
 		u.RawQuery = q.Encode()
 
-		Expect(signer.SignatureValid(u)).To(BeFalse())
+		Expect(signer.SignatureValid("GET", u)).To(BeFalse())
 	})
+	It("binds the signature to the HTTP method", func() {
+		signedPath := signer.Sign("get", "/some/path", time.Unix(200, 0))
 
+		Expect(signer.SignatureValid("GET", httputil.MustParse(signedPath))).To(BeTrue())
+		Expect(signer.SignatureValid("HEAD", httputil.MustParse(signedPath))).To(BeTrue())
+		Expect(signer.SignatureValid("PUT", httputil.MustParse(signedPath))).To(BeFalse())
+		Expect(signer.SignatureValid("POST", httputil.MustParse(signedPath))).To(BeFalse())
+		Expect(signer.SignatureValid("DELETE", httputil.MustParse(signedPath))).To(BeFalse())
+
+		signedPath = signer.Sign("put", "/some/path", time.Unix(200, 0))
+
+		Expect(signer.SignatureValid("PUT", httputil.MustParse(signedPath))).To(BeTrue())
+		Expect(signer.SignatureValid("GET", httputil.MustParse(signedPath))).To(BeFalse())
+	})
+
+	It("does not accept HEAD signatures for GET", func() {
+		signedPath := signer.Sign("head", "/some/path", time.Unix(200, 0))
+
+		Expect(signer.SignatureValid("HEAD", httputil.MustParse(signedPath))).To(BeTrue())
+		Expect(signer.SignatureValid("GET", httputil.MustParse(signedPath))).To(BeFalse())
+	})
+
+	It("signs with HMAC-SHA256 and the active key ID", func() {
+		signedPath := signer.Sign("GET", "/some/path", time.Unix(200, 0))
+
+		mac := hmac.New(sha256.New, []byte("thesecret"))
+		mac.Write([]byte("GET\n/some/path\n200"))
+		Expect(signedPath).To(Equal(fmt.Sprintf("/some/path?signature=%x&key_id=key1&expires=200", mac.Sum(nil))))
+	})
+
+	It("will not validate a tampered signature", func() {
+		u := httputil.MustParse(signer.Sign("GET", "/some/path", time.Unix(200, 0)))
+		q := u.Query()
+		q.Set("signature", strings.Repeat("0", 64))
+		u.RawQuery = q.Encode()
+
+		Expect(signer.SignatureValid("GET", u)).To(BeFalse())
+	})
+
+	Context("constraints", func() {
+		constraints := Constraints{MaxContentLength: 1024, ContentDigest: strings.Repeat("ab", 32), ClientIP: "10.0.0.0/8"}
+
+		It("signs them together with the path", func() {
+			signedPath := signer.SignWithConstraints("PUT", "/some/path", time.Unix(200, 0), constraints)
+
+			Expect(signer.SignatureValid("PUT", httputil.MustParse(signedPath))).To(BeTrue())
+			Expect(ConstraintsFrom(httputil.MustParse(signedPath))).To(Equal(constraints))
+		})
+
+		It("will not validate a path when a constraint has been tampered with", func() {
+			for _, param := range []string{"max_content_length", "content_digest", "client_ip"} {
+				u := httputil.MustParse(signer.SignWithConstraints("PUT", "/some/path", time.Unix(200, 0), constraints))
+				q := u.Query()
+				q.Del(param)
+				u.RawQuery = q.Encode()
+				Expect(signer.SignatureValid("PUT", u)).To(BeFalse(), param)
+			}
+
+			u := httputil.MustParse(signer.SignWithConstraints("PUT", "/some/path", time.Unix(200, 0), constraints))
+			q := u.Query()
+			q.Set("max_content_length", "2048")
+			u.RawQuery = q.Encode()
+			Expect(signer.SignatureValid("PUT", u)).To(BeFalse())
+		})
+
+		It("will not validate a path when constraints have been added", func() {
+			u := httputil.MustParse(signer.Sign("PUT", "/some/path", time.Unix(200, 0)))
+			q := u.Query()
+			q.Set("client_ip", "10.0.0.1")
+			u.RawQuery = q.Encode()
+
+			Expect(signer.SignatureValid("PUT", u)).To(BeFalse())
+		})
+
+		It("parses and validates them", func() {
+			Expect(ParseConstraints("100", strings.Repeat("AB", 32), "10.0.0.1")).To(Equal(
+				Constraints{MaxContentLength: 100, ContentDigest: strings.Repeat("ab", 32), ClientIP: "10.0.0.1"}))
+
+			_, e := ParseConstraints("-1", "", "")
+			Expect(e).To(MatchError(ContainSubstring("Invalid max_content_length")))
+			_, e = ParseConstraints("", "not-hex", "")
+			Expect(e).To(MatchError(ContainSubstring("Invalid content_digest")))
+			_, e = ParseConstraints("", "", "10.0.0.0/33")
+			Expect(e).To(MatchError(ContainSubstring("Invalid client_ip")))
+		})
+
+		It("allows client IPs by address or CIDR range", func() {
+			Expect(Constraints{}.AllowsClientIP(net.ParseIP("1.2.3.4"))).To(BeTrue())
+			Expect(Constraints{ClientIP: "1.2.3.4"}.AllowsClientIP(net.ParseIP("1.2.3.4"))).To(BeTrue())
+			Expect(Constraints{ClientIP: "1.2.3.4"}.AllowsClientIP(net.ParseIP("1.2.3.5"))).To(BeFalse())
+			Expect(Constraints{ClientIP: "1.2.0.0/16"}.AllowsClientIP(net.ParseIP("1.2.3.5"))).To(BeTrue())
+			Expect(Constraints{ClientIP: "1.2.0.0/16"}.AllowsClientIP(net.ParseIP("1.3.0.1"))).To(BeFalse())
+			Expect(Constraints{ClientIP: "fd00::/8"}.AllowsClientIP(net.ParseIP("fd00::1"))).To(BeTrue())
+		})
+	})
+
+	Context("secret rotation", func() {
+		It("validates signatures made with any configured secret", func() {
+			signedPath := signer.Sign("GET", "/some/path", time.Unix(200, 0))
+
+			signer.Secrets["key2"] = "thenewsecret"
+			signer.ActiveKeyID = "key2"
+			newSignedPath := signer.Sign("GET", "/some/path", time.Unix(200, 0))
+
+			Expect(newSignedPath).To(ContainSubstring("key_id=key2"))
+			Expect(signer.SignatureValid("GET", httputil.MustParse(signedPath))).To(BeTrue())
+			Expect(signer.SignatureValid("GET", httputil.MustParse(newSignedPath))).To(BeTrue())
+		})
+
+		It("does not validate signatures made with a secret that has been removed", func() {
+			signedPath := signer.Sign("GET", "/some/path", time.Unix(200, 0))
+
+			signer.Secrets = map[string]string{"key2": "thenewsecret"}
+			signer.ActiveKeyID = "key2"
+
+			Expect(signer.SignatureValid("GET", httputil.MustParse(signedPath))).To(BeFalse())
+		})
+
+		It("does not validate signatures with a key ID pointing to a different secret", func() {
+			signer.Secrets["key2"] = "thenewsecret"
+			u := httputil.MustParse(signer.Sign("GET", "/some/path", time.Unix(200, 0)))
+			q := u.Query()
+			q.Set("key_id", "key2")
+			u.RawQuery = q.Encode()
+
+			Expect(signer.SignatureValid("GET", u)).To(BeFalse())
+		})
+	})
+
+	Context("md5 signatures", func() {
+		var md5SignedPath string
+
+		BeforeEach(func() {
+			signer.MD5Secret = "thesecret"
+			// as issued by earlier versions: md5(expires + method + path + " " + secret)
+			md5SignedPath = fmt.Sprintf("/some/path?md5=%x&expires=200", md5.Sum([]byte("200GET/some/path thesecret")))
+		})
+
+		It("rejects them by default", func() {
+			Expect(signer.SignatureValid("GET", httputil.MustParse(md5SignedPath))).To(BeFalse())
+		})
+
+		It("accepts them for the signed method when enabled", func() {
+			signer.AcceptMD5Signatures = true
+
+			Expect(signer.SignatureValid("GET", httputil.MustParse(md5SignedPath))).To(BeTrue())
+			Expect(signer.SignatureValid("PUT", httputil.MustParse(md5SignedPath))).To(BeFalse())
+		})
+	})
+
+	Context("legacy signatures without HTTP method", func() {
+		var legacySignedPath string
+
+		BeforeEach(func() {
+			signer.AcceptMD5Signatures = true
+			signer.MD5Secret = "thesecret"
+			// as issued by earlier versions: md5(expires + path + " " + secret)
+			legacySignedPath = fmt.Sprintf("/some/path?md5=%x&expires=200", md5.Sum([]byte("200/some/path thesecret")))
+		})
+
+		It("accepts them for any method during the grace period", func() {
+			signer.AcceptLegacySignaturesUntil = clock.Now().Add(time.Minute)
+
+			Expect(signer.SignatureValid("GET", httputil.MustParse(legacySignedPath))).To(BeTrue())
+			Expect(signer.SignatureValid("PUT", httputil.MustParse(legacySignedPath))).To(BeTrue())
+		})
+
+		It("rejects them after the grace period", func() {
+			signer.AcceptLegacySignaturesUntil = clock.Now().Add(time.Minute)
+			clock.Add(2 * time.Minute)
+
+			Expect(signer.SignatureValid("GET", httputil.MustParse(legacySignedPath))).To(BeFalse())
+		})
+
+		It("rejects them when no grace period is configured", func() {
+			Expect(signer.SignatureValid("GET", httputil.MustParse(legacySignedPath))).To(BeFalse())
+		})
+
+		It("rejects them when md5 signatures are not accepted", func() {
+			signer.AcceptLegacySignaturesUntil = clock.Now().Add(time.Minute)
+			signer.AcceptMD5Signatures = false
+
+			Expect(signer.SignatureValid("GET", httputil.MustParse(legacySignedPath))).To(BeFalse())
+		})
+	})
 })
@@ -0,0 +1,31 @@
+package bitsgo
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/cloudfoundry-incubator/bits-service/util"
+)
+
+// Readiness serves the readiness check, which fails once the service has started draining, so that
+// load balancers stop sending new requests.
+type Readiness struct {
+	draining int32
+}
+
+func (readiness *Readiness) StartDraining() {
+	atomic.StoreInt32(&readiness.draining, 1)
+}
+
+func (readiness *Readiness) IsDraining() bool {
+	return atomic.LoadInt32(&readiness.draining) == 1
+}
+
+func (readiness *Readiness) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	if readiness.IsDraining() {
+		responseWriter.WriteHeader(http.StatusServiceUnavailable)
+		util.FprintDescriptionAsJSON(responseWriter, "Draining")
+		return
+	}
+	responseWriter.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,25 @@
+package bitsgo_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/cloudfoundry-incubator/bits-service"
+)
+
+var _ = Describe("Readiness", func() {
+	It("succeeds until the service starts draining", func() {
+		readiness := &Readiness{}
+
+		responseWriter := httptest.NewRecorder()
+		readiness.ServeHTTP(responseWriter, httptest.NewRequest("GET", "/ready", nil))
+		Expect(responseWriter.Code).To(Equal(http.StatusOK))
+
+		readiness.StartDraining()
+
+		responseWriter = httptest.NewRecorder()
+		readiness.ServeHTTP(responseWriter, httptest.NewRequest("GET", "/ready", nil))
+		Expect(responseWriter.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(responseWriter.Body.String()).To(MatchJSON(`{"description":"Draining"}`))
+	})
+})
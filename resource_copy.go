@@ -0,0 +1,191 @@
+package bitsgo
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+	"github.com/pkg/errors"
+)
+
+// CopySource is the blobstore of a resource type which resources can be copied from. Unlike GetOrRedirect,
+// Get must always return the content, because it is streamed into the destination blobstore.
+type CopySource interface {
+	Blobstore
+	Get(ctx context.Context, path string) (body io.ReadCloser, err error)
+}
+
+// ChecksumMismatchError means that copied content does not have the expected source_checksum.
+type ChecksumMismatchError struct {
+	error
+}
+
+func newChecksumMismatchError(identifier, actualSha256, expectedSha256 string) *ChecksumMismatchError {
+	return &ChecksumMismatchError{fmt.Errorf("Content of '%v' has SHA256 %v instead of the expected %v", identifier, actualSha256, expectedSha256)}
+}
+
+// SourceTooLargeError means that the content to be copied exceeds the maximum body size of the destination.
+type SourceTooLargeError struct {
+	error
+}
+
+// WithCopySources allows copying from the resource types in copySources, which maps resource types like "package"
+// to their blobstores. The handler's own resource type should be included to verify source checksums of copies
+// within its blobstore.
+func (handler *ResourceHandler) WithCopySources(copySources map[string]CopySource) *ResourceHandler {
+	handler.copySources = copySources
+	return handler
+}
+
+// copy copies sourceGuid of sourceType to identifier and returns the checksums of the stored content. Within the
+// same resource type, the blobstore copies server-side. Otherwise, the content is streamed from the source's
+// blobstore and must not exceed the handler's maximum body size. Either way, the content is stored under
+// blobKeyFor(identifier, sha256). If sourceChecksum is not empty, the SHA256 must match it.
+func (handler *ResourceHandler) copy(ctx context.Context, sourceType, sourceGuid, identifier, sourceChecksum string) (sha1 string, sha256 string, e error) {
+	if sourceType == handler.resourceType {
+		return handler.copyWithinBlobstore(ctx, sourceGuid, identifier, sourceChecksum)
+	}
+
+	tempFilename, sha1, sha256, e := handler.download(ctx, handler.copySources[sourceType], sourceGuid, handler.maxBodySizeLimit)
+	if e != nil {
+		return "", "", e
+	}
+	defer os.Remove(tempFilename)
+	if sourceChecksum != "" && !strings.EqualFold(sha256, sourceChecksum) {
+		return "", "", newChecksumMismatchError(sourceType+":"+sourceGuid, sha256, sourceChecksum)
+	}
+	tempFile, e := os.Open(tempFilename)
+	if e != nil {
+		return "", "", errors.WithStack(e)
+	}
+	defer tempFile.Close()
+	return sha1, sha256, handler.blobstore.Put(ctx, handler.blobKeyFor(identifier, sha256), tempFile)
+}
+
+// copyWithinBlobstore reads the source before the server-side copy, because its content never passes through the
+// service, and reads the copy afterwards, because the source might have changed in between. A copy which does not
+// match the source's checksums is deleted again. Without a copy source for the handler's own resource type,
+// nothing can be read, hence the copy has no checksums and is stored under identifier.
+func (handler *ResourceHandler) copyWithinBlobstore(ctx context.Context, sourceGuid, identifier, sourceChecksum string) (sha1 string, sha256 string, e error) {
+	copySource, isCopySource := handler.copySources[handler.resourceType]
+	if !isCopySource {
+		return "", "", handler.blobstore.Copy(ctx, sourceGuid, identifier)
+	}
+	sha1, sha256, e = checksumsOf(ctx, copySource, sourceGuid)
+	if e != nil {
+		return "", "", e
+	}
+	if sourceChecksum != "" && !strings.EqualFold(sha256, sourceChecksum) {
+		return "", "", newChecksumMismatchError(sourceGuid, sha256, sourceChecksum)
+	}
+	blobKey := handler.blobKeyFor(identifier, sha256)
+	e = handler.blobstore.Copy(ctx, sourceGuid, blobKey)
+	if e != nil {
+		return "", "", e
+	}
+	copiedSha1, copiedSha256, e := checksumsOf(ctx, copySource, blobKey)
+	if e == nil && (copiedSha1 != sha1 || copiedSha256 != sha256) {
+		e = newChecksumMismatchError(blobKey, copiedSha256, sha256)
+	}
+	if e != nil {
+		if deleteErr := handler.blobstore.Delete(ctx, blobKey); deleteErr != nil {
+			logger.FromContext(ctx).Errorw("Could not delete unverified copy", "blob-key", blobKey, "error", deleteErr)
+		}
+		return "", "", e
+	}
+	return sha1, sha256, nil
+}
+
+func checksumsOf(ctx context.Context, copySource CopySource, path string) (sha1Sum string, sha256Sum string, e error) {
+	body, e := copySource.Get(ctx, path)
+	if e != nil {
+		return "", "", e
+	}
+	defer body.Close()
+	sha1Hash := sha1.New()
+	sha256Hash := sha256.New()
+	_, e = io.Copy(io.MultiWriter(sha1Hash, sha256Hash), body)
+	if e != nil {
+		return "", "", errors.Wrapf(e, "Could not read '%v'", path)
+	}
+	return hex.EncodeToString(sha1Hash.Sum(nil)), hex.EncodeToString(sha256Hash.Sum(nil)), nil
+}
+
+// download streams path from copySource into a temp file, which the caller must remove. A maxSize of 0 means unlimited.
+func (handler *ResourceHandler) download(ctx context.Context, copySource CopySource, path string, maxSize uint64) (tempFilename string, sha1Sum string, sha256Sum string, e error) {
+	body, e := copySource.Get(ctx, path)
+	if e != nil {
+		return "", "", "", e
+	}
+	defer body.Close()
+	tempFile, e := ioutil.TempFile("", "bits")
+	if e != nil {
+		return "", "", "", errors.WithStack(e)
+	}
+	defer tempFile.Close()
+	var reader io.Reader = body
+	if maxSize != 0 {
+		// Reading one more byte than allowed tells content of exactly maxSize from larger content.
+		reader = io.LimitReader(body, int64(maxSize)+1)
+	}
+	sha1Hash := sha1.New()
+	sha256Hash := sha256.New()
+	size, e := io.Copy(io.MultiWriter(tempFile, sha1Hash, sha256Hash), reader)
+	if e != nil {
+		os.Remove(tempFile.Name())
+		return "", "", "", errors.Wrapf(e, "Could not read '%v'", path)
+	}
+	if maxSize != 0 && uint64(size) > maxSize {
+		os.Remove(tempFile.Name())
+		return "", "", "", &SourceTooLargeError{fmt.Errorf("Content of '%v' exceeds the maximum size of %v bytes", path, maxSize)}
+	}
+	return tempFile.Name(), hex.EncodeToString(sha1Hash.Sum(nil)), hex.EncodeToString(sha256Hash.Sum(nil)), nil
+}
+
+// validCopySource writes a response and returns false if sourceGuid cannot be copied from sourceType.
+func (handler *ResourceHandler) validCopySource(responseWriter http.ResponseWriter, request *http.Request, sourceType, sourceGuid, sourceChecksum string) bool {
+	_, isCopySource := handler.copySources[sourceType]
+	if sourceType != handler.resourceType && !isCopySource {
+		badRequest(responseWriter, request, "Cannot copy %v from source_type '%v'", handler.resourceType, sourceType)
+		return false
+	}
+	if sourceChecksum != "" && !isCopySource {
+		badRequest(responseWriter, request, "source_checksum is not supported for copies of %v", handler.resourceType)
+		return false
+	}
+	validator := handler.identifierValidator
+	if sourceType != handler.resourceType {
+		validator = IdentifierValidatorFor(sourceType)
+	}
+	if e := validator.Validate(sourceGuid); e != nil {
+		invalidIdentifier(responseWriter, request, e)
+		return false
+	}
+	return true
+}
+
+func handleCopyError(e error, responseWriter http.ResponseWriter, request *http.Request) (wasError bool) {
+	switch e.(type) {
+	case *ChecksumMismatchError:
+		logger.From(request).Infow("Checksum mismatch", "error", e)
+		responseWriter.WriteHeader(http.StatusUnprocessableEntity)
+		util.FprintDescriptionAsJSON(responseWriter, "%v", e.Error())
+		return true
+	case *SourceTooLargeError:
+		logger.From(request).Infow("Source too large", "error", e)
+		responseWriter.WriteHeader(http.StatusRequestEntityTooLarge)
+		util.FprintDescriptionAsJSON(responseWriter, "%v", e.Error())
+		return true
+	default:
+		return false
+	}
+}
@@ -3,6 +3,7 @@ package bitsgo
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/hex"
@@ -13,8 +14,10 @@ import (
 	"math"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff"
@@ -31,27 +34,43 @@ func NewStateForbiddenError() *StateForbiddenError {
 	return &StateForbiddenError{fmt.Errorf("StateForbiddenError")}
 }
 
+// Updater notifies e.g. the Cloud Controller about the state of uploads. ctx carries the request ID and trace
+// headers of the upload request.
 type Updater interface {
-	NotifyProcessingUpload(guid string) error
-	NotifyUploadSucceeded(guid string, sha1 string, sha2 string) error
-	NotifyUploadFailed(guid string, e error) error
+	NotifyProcessingUpload(ctx context.Context, guid string) error
+	NotifyUploadSucceeded(ctx context.Context, guid string, sha1 string, sha2 string) error
+	NotifyUploadFailed(ctx context.Context, guid string, e error) error
 }
 
 type NullUpdater struct{}
 
-func (u *NullUpdater) NotifyProcessingUpload(guid string) error                          { return nil }
-func (u *NullUpdater) NotifyUploadSucceeded(guid string, sha1 string, sha2 string) error { return nil }
-func (u *NullUpdater) NotifyUploadFailed(guid string, e error) error                     { return nil }
+func (u *NullUpdater) NotifyProcessingUpload(ctx context.Context, guid string) error { return nil }
+func (u *NullUpdater) NotifyUploadSucceeded(ctx context.Context, guid string, sha1 string, sha2 string) error {
+	return nil
+}
+func (u *NullUpdater) NotifyUploadFailed(ctx context.Context, guid string, e error) error { return nil }
 
 type ResourceHandler struct {
-	blobstore         Blobstore
-	appStashBlobstore NoRedirectBlobstore
-	resourceType      string
-	metricsService    MetricsService
-	maxBodySizeLimit  uint64
-	updater           Updater
-	minimumSize       uint64
-	maximumSize       uint64
+	blobstore           Blobstore
+	appStashBlobstore   NoRedirectBlobstore
+	resourceType        string
+	metricsService      MetricsService
+	maxBodySizeLimit    uint64
+	updater             Updater
+	minimumSize         uint64
+	maximumSize         uint64
+	auditor             Auditor
+	identifierValidator *IdentifierValidator
+	zipLimits           ZipLimits
+	uploadJobs          *UploadJobRegistry
+	asyncUploads        *AsyncUploadQueue
+	events              EventPublisher
+	sourceURLFetcher    *SourceURLFetcher
+	copySources         map[string]CopySource
+	// asyncFetches tracks fetches from source_urls until they are handed to asyncUploads, see DrainAsyncUploadQueue.
+	asyncFetches sync.WaitGroup
+	// stopAsyncFetches is closed when draining times out, which cancels the fetches still in progress.
+	stopAsyncFetches chan struct{}
 }
 
 type responseBody struct {
@@ -88,20 +107,128 @@ func NewResourceHandlerWithUpdater(blobstore Blobstore, appStashBlobstore NoRedi
 
 func NewResourceHandlerWithUpdaterAndSizeThresholds(blobstore Blobstore, appStashBlobstore NoRedirectBlobstore, updater Updater, resourceType string, metricsService MetricsService, maxBodySizeLimit uint64, minimumSize, maximumSize uint64) *ResourceHandler {
 	return &ResourceHandler{
-		blobstore:         blobstore,
-		appStashBlobstore: appStashBlobstore,
-		resourceType:      resourceType,
-		metricsService:    metricsService,
-		maxBodySizeLimit:  maxBodySizeLimit,
-		updater:           updater,
-		maximumSize:       maximumSize,
-		minimumSize:       minimumSize,
+		blobstore:           blobstore,
+		appStashBlobstore:   appStashBlobstore,
+		resourceType:        resourceType,
+		metricsService:      metricsService,
+		maxBodySizeLimit:    maxBodySizeLimit,
+		updater:             updater,
+		maximumSize:         maximumSize,
+		minimumSize:         minimumSize,
+		auditor:             &NullAuditor{},
+		identifierValidator: IdentifierValidatorFor(resourceType),
+		events:              &NullEventPublisher{},
+		stopAsyncFetches:    make(chan struct{}),
+	}
+}
+
+// WithAuditor makes handler audit all mutating operations.
+func (handler *ResourceHandler) WithAuditor(auditor Auditor) *ResourceHandler {
+	handler.auditor = auditor
+	return handler
+}
+
+// WithEventPublisher makes handler publish the lifecycle events of its blobs.
+func (handler *ResourceHandler) WithEventPublisher(events EventPublisher) *ResourceHandler {
+	handler.events = events
+	return handler
+}
+
+// validIdentifier writes the response and returns false if identifier is invalid.
+func (handler *ResourceHandler) validIdentifier(responseWriter http.ResponseWriter, request *http.Request, identifier string) bool {
+	e := handler.identifierValidator.Validate(identifier)
+	if e != nil {
+		invalidIdentifier(responseWriter, request, e)
+		return false
+	}
+	return true
+}
+
+// WithZipLimits restricts uploaded packages.
+func (handler *ResourceHandler) WithZipLimits(zipLimits ZipLimits) *ResourceHandler {
+	handler.zipLimits = zipLimits
+	return handler
+}
+
+// WithUploadJobs makes handler track async uploads in uploadJobs, so that their status can be queried.
+func (handler *ResourceHandler) WithUploadJobs(uploadJobs *UploadJobRegistry) *ResourceHandler {
+	handler.uploadJobs = uploadJobs
+	return handler
+}
+
+// WithAsyncUploadQueue makes handler process async uploads with the workers of asyncUploads instead of
+// one goroutine per upload. The workers are started by StartAsyncUploadQueue.
+func (handler *ResourceHandler) WithAsyncUploadQueue(asyncUploads *AsyncUploadQueue) *ResourceHandler {
+	handler.asyncUploads = asyncUploads
+	return handler
+}
+
+// WithSourceURLFetcher allows creating resources from a source_url, see CopySourceGuid.
+func (handler *ResourceHandler) WithSourceURLFetcher(sourceURLFetcher *SourceURLFetcher) *ResourceHandler {
+	handler.sourceURLFetcher = sourceURLFetcher
+	return handler
+}
+
+// StartAsyncUploadQueue resumes the uploads which were pending when the service stopped and starts the workers.
+func (handler *ResourceHandler) StartAsyncUploadQueue() error {
+	return handler.asyncUploads.Start(handler.processAsyncUpload)
+}
+
+// DrainAsyncUploadQueue waits for async fetches from source_urls and processes pending uploads until ctx is done.
+// Fetches and uploads which cannot be resumed on the next start fail, including the ones still in progress.
+// It returns the temp files which are still being uploaded.
+func (handler *ResourceHandler) DrainAsyncUploadQueue(ctx context.Context) (tempFilesInUse []string) {
+	handler.drainAsyncFetches(ctx)
+	abandoned, inProgress := handler.asyncUploads.Drain(ctx)
+	for _, upload := range abandoned {
+		os.Remove(upload.TempFilename)
+		handler.failAsyncUploadOnShutdown(upload, errors.Errorf("Service shut down before async upload of '%v' could be processed", upload.Identifier))
+	}
+	for _, upload := range inProgress {
+		tempFilesInUse = append(tempFilesInUse, upload.TempFilename)
+		handler.failAsyncUploadOnShutdown(upload, errors.Errorf("Service shut down before async upload of '%v' could be completed", upload.Identifier))
+	}
+	return tempFilesInUse
+}
+
+// drainAsyncFetches waits for fetches from source_urls until ctx is done. Fetches still in progress then are cancelled
+// and fail. Fetches are not persisted, since their headers often contain credentials.
+func (handler *ResourceHandler) drainAsyncFetches(ctx context.Context) {
+	fetched := make(chan struct{})
+	go func() {
+		handler.asyncFetches.Wait()
+		close(fetched)
+	}()
+	select {
+	case <-fetched:
+	case <-ctx.Done():
+		logger.Log.Errorw("Async fetches from source_url still in progress after drain timeout", "resource-type", handler.resourceType)
+		close(handler.stopAsyncFetches)
+		<-fetched
 	}
 }
 
+func (handler *ResourceHandler) failAsyncUploadOnShutdown(upload *AsyncUpload, e error) {
+	handler.notifyUploadFailed(context.Background(), upload.Identifier, e)
+	upload.uploadJob.Failed(e)
+	handler.auditor.Audit(upload.AuditEvent.withOutcomeFrom(http.StatusServiceUnavailable))
+	handle(context.Background(), e, true)
+}
+
+func (handler *ResourceHandler) audited(responseWriter http.ResponseWriter, request *http.Request, operation string, identifier string) *auditedResponseWriter {
+	return newAuditedResponseWriter(responseWriter, handler.auditor, newAuditEvent(request, operation, handler.resourceType, identifier))
+}
+
 // TODO: instead of params, we could use `identifier string` to make the interface more type-safe.
 //       Here and in the other methods.
 func (handler *ResourceHandler) AddOrReplaceWithDigestInHeader(responseWriter http.ResponseWriter, request *http.Request, params map[string]string) {
+	auditedResponseWriter := handler.audited(responseWriter, request, AuditOperationPut, params["identifier"])
+	defer auditedResponseWriter.audit()
+	responseWriter = auditedResponseWriter
+
+	if !handler.validIdentifier(responseWriter, request, params["identifier"]) {
+		return
+	}
 	if !HandleBodySizeLimits(responseWriter, request, handler.maxBodySizeLimit) {
 		return
 	}
@@ -126,32 +253,33 @@ func (handler *ResourceHandler) AddOrReplaceWithDigestInHeader(responseWriter ht
 		badRequest(responseWriter, request, "Digest must have format sha256=value. Value cannot be empty")
 		return
 	}
+	if !handler.validIdentifier(responseWriter, request, params["identifier"]+"/"+value) {
+		return
+	}
+	auditedResponseWriter.event.Sha256 = value
 
-	// TODO this can cause an out of memory panic. Should be smart about writing big files to disk instead.
-	content, e := ioutil.ReadAll(request.Body)
+	tempFilename, e := CreateTempFileWithContent(request.Body)
 	util.PanicOnError(e)
+	sha1, sha256, e := ShaSums(tempFilename)
+	if e != nil {
+		os.Remove(tempFilename)
+		panic(e)
+	}
 
-	e = backoff.RetryNotify(func() error {
-		e := handler.blobstore.Put(params["identifier"]+"/"+value, bytes.NewReader(content))
-		if e != nil {
-			if _, noSpaceLeft := e.(*NoSpaceLeftError); noSpaceLeft {
-				return backoff.Permanent(e)
-			}
-			return errors.Wrap(e, "Could not upload bits to blobstore")
-		}
-		return nil
-
-	}, retryPolicy(), func(e error, delay time.Duration) {
-		handler.metricsService.SendCounterMetric("upload"+handler.resourceType, 1)
-	})
-
-	// TODO use Clock instead:
-	writeResponseBasedOn("", e, responseWriter, request, http.StatusCreated, nil, &responseBody{Guid: params["identifier"], State: "READY", Type: "bits", CreatedAt: time.Now()}, "")
+	handler.acceptUpload(responseWriter, request, auditedResponseWriter.event, params["identifier"], params["identifier"]+"/"+value,
+		tempFilename, hex.EncodeToString(sha1), hex.EncodeToString(sha256))
 }
 
 // TODO: instead of params, we could use `identifier string` to make the interface more type-safe.
 //       Here and in the other methods.
 func (handler *ResourceHandler) AddOrReplace(responseWriter http.ResponseWriter, request *http.Request, params map[string]string) {
+	auditedResponseWriter := handler.audited(responseWriter, request, AuditOperationPut, params["identifier"])
+	defer auditedResponseWriter.audit()
+	responseWriter = auditedResponseWriter
+
+	if !handler.validIdentifier(responseWriter, request, params["identifier"]) {
+		return
+	}
 	if !HandleBodySizeLimits(responseWriter, request, handler.maxBodySizeLimit) {
 		return
 	}
@@ -170,13 +298,16 @@ func (handler *ResourceHandler) AddOrReplace(responseWriter http.ResponseWriter,
 	// TODO: this if-block maybe not be necessary at all.
 	//       The reason it's necessary right now is that we need zip handling only for packages. We treat other resources opaque.
 	if handler.resourceType == "package" {
-		tempFilename, e = handler.completePackageWithResources(request.FormValue("resources"), file, fileInfo.Size)
+		tempFilename, e = handler.completePackageWithResources(request.Context(), request.FormValue("resources"), file, fileInfo.Size)
 		switch e.(type) {
 		case *inputError:
 			logger.From(request).Infow(e.Error())
 			responseWriter.WriteHeader(http.StatusUnprocessableEntity)
 			util.FprintDescriptionAsJSON(responseWriter, e.Error())
 			return
+		case *ZipLimitError:
+			zipLimitExceeded(responseWriter, request, e.(*ZipLimitError))
+			return
 		case *NoSpaceLeftError:
 			http.Error(responseWriter, util.DescriptionAndCodeAsJSON(500000, "Request Entity Too Large"), http.StatusInsufficientStorage)
 			return
@@ -190,31 +321,68 @@ func (handler *ResourceHandler) AddOrReplace(responseWriter http.ResponseWriter,
 
 	sha1, sha256, e := ShaSums(tempFilename)
 	util.PanicOnError(e)
+	auditedResponseWriter.event.Sha256 = hex.EncodeToString(sha256)
+
+	handler.acceptUpload(responseWriter, request, auditedResponseWriter.event, params["identifier"], params["identifier"],
+		tempFilename, hex.EncodeToString(sha1), hex.EncodeToString(sha256))
+}
 
-	e = handler.updater.NotifyProcessingUpload(params["identifier"])
+// acceptUpload uploads tempFilename to blobKey, synchronously or, with async=true, in the background. The updater is
+// notified about identifier, which is the resource's identifier from the request. It takes ownership of tempFilename.
+func (handler *ResourceHandler) acceptUpload(responseWriter http.ResponseWriter, request *http.Request, auditEvent AuditEvent, identifier string, blobKey string, tempFilename string, sha1 string, sha256 string) {
+	e := handler.updater.NotifyProcessingUpload(request.Context(), identifier)
+	if e != nil {
+		os.Remove(tempFilename)
+	}
 	if handleNotificationError(e, responseWriter, request) {
 		return
 	}
+	handler.events.Publish(newBlobEvent(request.Context(), BlobEventCreated, handler.resourceType, identifier).withChecksums(sha1, sha256))
 
 	if request.URL.Query().Get("async") == "true" {
-		go handler.uploadResource(tempFilename, request, params["identifier"], true, sha1, sha256)
+		upload := &AsyncUpload{
+			ResourceType: handler.resourceType,
+			Identifier:   identifier,
+			BlobKey:      blobKey,
+			TempFilename: tempFilename,
+			Sha1:         sha1,
+			Sha256:       sha256,
+			AuditEvent:   auditEvent,
+			EnqueuedAt:   time.Now().UTC(),
+			// The upload outlives the request, so it must not be cancelled when the client disconnects.
+			ctx: util.WithoutCancel(request.Context()),
+		}
+		if handler.uploadJobs != nil {
+			upload.uploadJob = handler.uploadJobs.Start(handler.resourceType, upload.Identifier, upload.Sha1, upload.Sha256)
+		}
+		if handler.asyncUploads != nil {
+			e = handler.asyncUploads.Enqueue(upload)
+			if e != nil {
+				os.Remove(tempFilename)
+				handler.notifyUploadFailed(request.Context(), upload.Identifier, e)
+				upload.uploadJob.Failed(e)
+				panic(e)
+			}
+		} else {
+			go handler.processAsyncUpload(upload)
+		}
 		writeResponseBasedOn("", nil, responseWriter, request, http.StatusAccepted, nil, &responseBody{
-			Guid:      params["identifier"],
+			Guid:      identifier,
 			State:     "PROCESSING_UPLOAD",
 			Type:      "bits",
 			CreatedAt: time.Now(),
-			Sha1:      hex.EncodeToString(sha1),
-			Sha256:    hex.EncodeToString(sha256),
+			Sha1:      sha1,
+			Sha256:    sha256,
 		}, "")
 	} else {
-		e = handler.uploadResource(tempFilename, request, params["identifier"], false, sha1, sha256)
+		e = handler.uploadResource(request.Context(), tempFilename, identifier, blobKey, false, sha1, sha256, nil)
 		writeResponseBasedOn("", e, responseWriter, request, http.StatusCreated, nil, &responseBody{
-			Guid:      params["identifier"],
+			Guid:      identifier,
 			State:     "READY",
 			Type:      "bits",
 			CreatedAt: time.Now(),
-			Sha1:      hex.EncodeToString(sha1),
-			Sha256:    hex.EncodeToString(sha256),
+			Sha1:      sha1,
+			Sha256:    sha256,
 		}, "")
 	}
 }
@@ -223,8 +391,8 @@ type inputError struct {
 	error
 }
 
-// returns inputError or NoSpaceLeftError in case of error
-func (handler *ResourceHandler) completePackageWithResources(resources string, file multipart.File, fileSize int64) (tempfileName string, err error) {
+// returns inputError, ZipLimitError or NoSpaceLeftError in case of error
+func (handler *ResourceHandler) completePackageWithResources(ctx context.Context, resources string, file multipart.File, fileSize int64) (tempfileName string, err error) {
 	var bundlesPayload []Fingerprint
 	if resources != "" {
 		e := json.Unmarshal([]byte(resources), &bundlesPayload)
@@ -234,6 +402,9 @@ func (handler *ResourceHandler) completePackageWithResources(resources string, f
 		if isMissing, key := anyKeyMissingIn(bundlesPayload); isMissing {
 			return "", &inputError{fmt.Errorf("The request is semantically invalid: key \"%v\" missing or empty", key)}
 		}
+		if e := invalidSha1In(bundlesPayload); e != nil {
+			return "", &inputError{fmt.Errorf("The request is semantically invalid: %v", e)}
+		}
 	}
 	zipReader, e := zip.NewReader(file, fileSize)
 	if e != nil && strings.Contains(e.Error(), "not a valid zip file") {
@@ -241,10 +412,13 @@ func (handler *ResourceHandler) completePackageWithResources(resources string, f
 	}
 	util.PanicOnError(e)
 
-	tempFilename, e := CreateTempZipFileFrom(bundlesPayload, zipReader, handler.minimumSize, handler.maximumSize, handler.appStashBlobstore, handler.metricsService)
+	tempFilename, e := CreateTempZipFileWithLimitsFrom(ctx, bundlesPayload, zipReader, handler.minimumSize, handler.maximumSize, handler.zipLimits, handler.appStashBlobstore, handler.metricsService)
 	if _, noSpaceLeft := e.(*NoSpaceLeftError); noSpaceLeft {
 		return "", e
 	}
+	if _, isZipLimitError := e.(*ZipLimitError); isZipLimitError {
+		return "", e
+	}
 	if notFoundErr, ok := e.(*NotFoundError); ok {
 		return "", &inputError{fmt.Errorf("The request is semantically invalid: not all specified sha1s could be found in app-stash. Missing sha1: \"%v\"", notFoundErr.MissingKey)}
 	}
@@ -267,8 +441,55 @@ func CreateTempFileWithContent(reader io.Reader) (string, error) {
 	return uploadedFile.Name(), nil
 }
 
-func (handler *ResourceHandler) uploadResource(tempFilename string, request *http.Request, identifier string, async bool, sha1Sum []byte, sha256Sum []byte) error {
+// processAsyncUpload uploads an accepted upload and audits its outcome. Uploads resumed after a restart are
+// only uploaded if their temp file is still intact. Otherwise, they fail.
+func (handler *ResourceHandler) processAsyncUpload(upload *AsyncUpload) {
+	ctx := upload.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if upload.uploadJob == nil && handler.uploadJobs != nil {
+		upload.uploadJob = handler.uploadJobs.Start(handler.resourceType, upload.Identifier, upload.Sha1, upload.Sha256)
+	}
+
+	var e error
+	if upload.Resumed {
+		logger.FromContext(ctx).Infow("Resuming async upload", "identifier", upload.Identifier, "enqueued-at", upload.EnqueuedAt)
+		e = verifyTempFile(upload)
+		if e != nil {
+			os.Remove(upload.TempFilename)
+			handler.notifyUploadFailed(ctx, upload.Identifier, e)
+			upload.uploadJob.Failed(e)
+			handle(ctx, e, true)
+		}
+	}
+	if e == nil {
+		e = handler.uploadResource(ctx, upload.TempFilename, upload.Identifier, upload.blobKey(), true, upload.Sha1, upload.Sha256, upload.uploadJob)
+	}
+
+	// The request has only been accepted. Hence, the actual outcome is audited once the upload has finished.
+	if e != nil {
+		handler.auditor.Audit(upload.AuditEvent.withOutcomeFrom(http.StatusInternalServerError))
+	} else {
+		handler.auditor.Audit(upload.AuditEvent.withOutcomeFrom(http.StatusCreated))
+	}
+}
+
+func verifyTempFile(upload *AsyncUpload) error {
+	_, sha256Sum, e := ShaSums(upload.TempFilename)
+	if e != nil {
+		return errors.Wrapf(e, "Temp file of async upload '%v' is not available anymore", upload.ID)
+	}
+	if hex.EncodeToString(sha256Sum) != upload.Sha256 {
+		return errors.Errorf("Temp file of async upload '%v' is corrupt", upload.ID)
+	}
+	return nil
+}
+
+// uploadResource reports the progress and outcome to uploadJob, which is nil for synchronous uploads.
+func (handler *ResourceHandler) uploadResource(ctx context.Context, tempFilename string, identifier string, blobKey string, async bool, sha1Sum string, sha256Sum string, uploadJob *UploadJobTracker) error {
 	defer os.Remove(tempFilename)
+	handler.events.Publish(newBlobEvent(ctx, BlobEventProcessing, handler.resourceType, identifier).withChecksums(sha1Sum, sha256Sum))
 	e := backoff.RetryNotify(func() error {
 		tempFile, e := os.Open(tempFilename)
 		if e != nil {
@@ -276,9 +497,9 @@ func (handler *ResourceHandler) uploadResource(tempFilename string, request *htt
 		}
 		defer tempFile.Close()
 
-		logger.From(request).Debugw("Starting upload to blobstore", "identifier", identifier)
-		e = handler.blobstore.Put(identifier, tempFile)
-		logger.From(request).Debugw("Completed upload to blobstore", "identifier", identifier)
+		logger.FromContext(ctx).Debugw("Starting upload to blobstore", "identifier", identifier, "blob-key", blobKey)
+		e = handler.blobstore.Put(ctx, blobKey, uploadJob.Reader(tempFile))
+		logger.FromContext(ctx).Debugw("Completed upload to blobstore", "identifier", identifier, "blob-key", blobKey)
 
 		if e != nil {
 			if _, noSpaceLeft := e.(*NoSpaceLeftError); noSpaceLeft {
@@ -288,25 +509,53 @@ func (handler *ResourceHandler) uploadResource(tempFilename string, request *htt
 			return errors.Wrapf(e, "Could not upload temporary file to blobstore", tempFilename)
 		}
 		return nil
-	}, retryPolicy(), func(e error, delay time.Duration) {
+	}, backoff.WithContext(retryPolicy(), ctx), func(e error, delay time.Duration) {
 		handler.metricsService.SendCounterMetric("upload"+handler.resourceType, 1)
 	})
 
 	if e != nil {
-		handler.notifyUploadFailed(identifier, e, request)
-		return handle(e, async, request)
+		handler.notifyUploadFailed(ctx, identifier, e)
+		uploadJob.Failed(e)
+		return handle(ctx, e, async)
 	}
-	e = handler.updater.NotifyUploadSucceeded(identifier, hex.EncodeToString(sha1Sum), hex.EncodeToString(sha256Sum))
+	handler.events.Publish(newBlobEvent(ctx, BlobEventReady, handler.resourceType, identifier).withChecksums(sha1Sum, sha256Sum))
+	e = handler.updater.NotifyUploadSucceeded(ctx, identifier, sha1Sum, sha256Sum)
 	if e != nil {
-		return handle(errors.Wrapf(e, "Could not notify Cloud Controller about successful upload"), async, request)
+		e = errors.Wrapf(e, "Could not notify Cloud Controller about successful upload")
+		uploadJob.Failed(e)
+		return handle(ctx, e, async)
 	}
+	uploadJob.Succeeded()
 	return nil
 }
 
+// GetUploadJob returns the status of the latest async upload of the resource.
+func (handler *ResourceHandler) GetUploadJob(responseWriter http.ResponseWriter, request *http.Request, params map[string]string) {
+	if !handler.validIdentifier(responseWriter, request, params["identifier"]) {
+		return
+	}
+	if handler.uploadJobs == nil {
+		uploadJobNotFound(responseWriter, request, handler.resourceType, params["identifier"])
+		return
+	}
+	job, e := handler.uploadJobs.Get(handler.resourceType, params["identifier"])
+	if _, notFound := e.(*NotFoundError); notFound {
+		uploadJobNotFound(responseWriter, request, handler.resourceType, params["identifier"])
+		return
+	}
+	util.PanicOnError(e)
+
+	respBody, e := json.Marshal(job)
+	util.PanicOnError(e)
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.WriteHeader(http.StatusOK)
+	responseWriter.Write(respBody)
+}
+
 // TODO(pego): find better name for this function
-func handle(e error, async bool, request *http.Request) error {
+func handle(ctx context.Context, e error, async bool) error {
 	if async {
-		logger.From(request).Errorw("Failure during upload", "error", e)
+		logger.FromContext(ctx).Errorw("Failure during upload", "error", e)
 	}
 	return e
 }
@@ -317,10 +566,14 @@ func retryPolicy() *backoff.ExponentialBackOff {
 	return retryPolicy
 }
 
-func (handler *ResourceHandler) notifyUploadFailed(identifier string, e error, request *http.Request) {
-	notifyErr := handler.updater.NotifyUploadFailed(identifier, e)
+func (handler *ResourceHandler) notifyUploadFailed(ctx context.Context, identifier string, e error) {
+	event := newBlobEvent(ctx, BlobEventFailed, handler.resourceType, identifier)
+	event.Error = e.Error()
+	handler.events.Publish(event)
+
+	notifyErr := handler.updater.NotifyUploadFailed(ctx, identifier, e)
 	if notifyErr != nil {
-		logger.From(request).Errorw("Failed to notifying CC about failed upload.", "error", notifyErr)
+		logger.FromContext(ctx).Errorw("Failed to notifying CC about failed upload.", "error", notifyErr)
 	}
 }
 
@@ -355,59 +608,351 @@ func handleNotificationError(e error, responseWriter http.ResponseWriter, reques
 	return false
 }
 
+// CopySourceGuid handles PUT requests with a JSON body. With source_guid, it copies the resource with that guid,
+// which is of source_type if given, see WithCopySources. With source_url, it fetches the content from there instead, see addOrReplaceFromSourceURL.
 func (handler *ResourceHandler) CopySourceGuid(responseWriter http.ResponseWriter, request *http.Request, params map[string]string) {
+	auditedResponseWriter := handler.audited(responseWriter, request, AuditOperationCopy, params["identifier"])
+	defer auditedResponseWriter.audit()
+	responseWriter = auditedResponseWriter
+
+	if !handler.validIdentifier(responseWriter, request, params["identifier"]) {
+		return
+	}
 	if !HandleBodySizeLimits(responseWriter, request, handler.maxBodySizeLimit) {
 		return
 	}
-	sourceGuid := sourceGuidFrom(request, responseWriter)
+	source := sourceFrom(request, responseWriter)
+	if source == nil {
+		return // response is already handled in sourceFrom
+	}
+	if !handler.sourceAllowedFor(responseWriter, request, source) {
+		return
+	}
+	if source.SourceURL != "" {
+		auditedResponseWriter.event.Operation = AuditOperationPut
+		auditedResponseWriter.event.SourceIdentifier = redactedURL(source.SourceURL)
+		auditedResponseWriter.event.Sha256 = source.Sha256
+		handler.addOrReplaceFromSourceURL(auditedResponseWriter, request, params["identifier"], source)
+		return
+	}
+	sourceGuid := source.SourceGuid
 	if sourceGuid == "" {
-		return // response is already handled in sourceGuidFrom
+		return
+	}
+	sourceType := source.SourceType
+	if sourceType == "" {
+		sourceType = handler.resourceType
+	}
+	auditedResponseWriter.event.SourceIdentifier = sourceGuid
+	auditedResponseWriter.event.SourceResourceType = sourceType
+	if !handler.validCopySource(responseWriter, request, sourceType, sourceGuid, source.SourceChecksum) {
+		return
+	}
+	sha1, sha256, e := handler.copy(request.Context(), sourceType, sourceGuid, params["identifier"], source.SourceChecksum)
+	if handleCopyError(e, responseWriter, request) {
+		return
+	}
+	if e == nil {
+		auditedResponseWriter.event.Sha256 = sha256
+		event := newBlobEvent(request.Context(), BlobEventCopied, handler.resourceType, params["identifier"]).withChecksums(sha1, sha256)
+		event.SourceIdentifier = sourceGuid
+		event.SourceResourceType = sourceType
+		handler.events.Publish(event)
 	}
-	e := handler.blobstore.Copy(sourceGuid, params["identifier"])
 	// TODO use Clock instead:
-	writeResponseBasedOn("", e, responseWriter, request, http.StatusCreated, nil, &responseBody{Guid: params["identifier"], State: "READY", Type: "bits", CreatedAt: time.Now()}, "")
+	writeResponseBasedOn("", e, responseWriter, request, http.StatusCreated, nil, &responseBody{Guid: params["identifier"], State: "READY", Type: "bits", CreatedAt: time.Now(), Sha1: sha1, Sha256: sha256}, "")
+}
+
+// sourceAllowedFor writes a response and returns false if source cannot be used with the request's credentials.
+// A signed URL only grants access to the resource it was signed for, so it must not be used to read other
+// resource types or to make the service fetch arbitrary URLs.
+func (handler *ResourceHandler) sourceAllowedFor(responseWriter http.ResponseWriter, request *http.Request, source *source) bool {
+	principal := util.PrincipalFrom(request.Context())
+	if principal != "signed_url" && !strings.HasPrefix(principal, "signed_url:") {
+		return true
+	}
+	if source.SourceURL != "" || (source.SourceType != "" && source.SourceType != handler.resourceType) {
+		logger.From(request).Infow("Signed URL used to copy from another resource type or source_url", "source-type", source.SourceType)
+		responseWriter.WriteHeader(http.StatusForbidden)
+		util.FprintDescriptionAsJSON(responseWriter, "Signed URLs can neither copy from other resource types nor fetch from a source_url")
+		return false
+	}
+	return true
 }
 
-func sourceGuidFrom(request *http.Request, responseWriter http.ResponseWriter) string {
+type source struct {
+	SourceGuid string `json:"source_guid"`
+	// SourceType is the resource type of SourceGuid. Defaults to the handler's resource type.
+	SourceType string `json:"source_type"`
+	// SourceChecksum is the expected SHA256 of the content of SourceGuid.
+	SourceChecksum string `json:"source_checksum"`
+	SourceURL      string `json:"source_url"`
+	// Sha256 is the expected checksum of the content at SourceURL.
+	Sha256 string `json:"sha256"`
+	// Headers are sent when fetching SourceURL, e.g. for authorization.
+	Headers map[string]string `json:"headers"`
+}
+
+func sourceFrom(request *http.Request, responseWriter http.ResponseWriter) *source {
 	content, e := ioutil.ReadAll(request.Body)
 	util.PanicOnError(e)
-	var payload struct {
-		SourceGuid string `json:"source_guid"`
-	}
+	var payload source
 	e = json.Unmarshal(content, &payload)
 	if e != nil {
 		badRequest(responseWriter, request, "Body must be valid JSON when request is not multipart/form-data. %+v", e)
+		return nil
+	}
+	return &payload
+}
+
+// addOrReplaceFromSourceURL fetches the content from source.SourceURL and uploads it like AddOrReplace does.
+// With async=true, the Cloud Controller is notified before the response, but the content is fetched in the
+// background.
+func (handler *ResourceHandler) addOrReplaceFromSourceURL(responseWriter *auditedResponseWriter, request *http.Request, identifier string, source *source) {
+	if handler.sourceURLFetcher == nil {
+		badRequest(responseWriter, request, "Uploads from source_url are not enabled")
+		return
+	}
+	if handleSourceURLError(handler.sourceURLFetcher.Validate(source.SourceURL), responseWriter, request) {
+		return
+	}
+
+	if request.URL.Query().Get("async") == "true" {
+		e := handler.updater.NotifyProcessingUpload(request.Context(), identifier)
+		if handleNotificationError(e, responseWriter, request) {
+			return
+		}
+		var uploadJob *UploadJobTracker
+		if handler.uploadJobs != nil {
+			uploadJob = handler.uploadJobs.Start(handler.resourceType, identifier, "", source.Sha256)
+		}
+		// The fetch outlives the request, so it must not be cancelled when the client disconnects.
+		handler.asyncFetches.Add(1)
+		go handler.fetchAsync(util.WithoutCancel(request.Context()), identifier, source, responseWriter.event, uploadJob)
+		writeResponseBasedOn("", nil, responseWriter, request, http.StatusAccepted, nil, &responseBody{
+			Guid:      identifier,
+			State:     "PROCESSING_UPLOAD",
+			Type:      "bits",
+			CreatedAt: time.Now(),
+			Sha256:    source.Sha256,
+		}, "")
+		return
+	}
+
+	tempFilename, sha1, sha256, e := handler.fetch(request.Context(), source)
+	if handleSourceURLError(e, responseWriter, request) {
+		return
+	}
+	responseWriter.event.Sha256 = sha256
+	handler.acceptUpload(responseWriter, request, responseWriter.event, identifier, handler.blobKeyFor(identifier, sha256),
+		tempFilename, sha1, sha256)
+}
+
+// fetchAsync fetches the content of an async upload from a source_url and hands it to the async upload queue.
+// Only the fetch itself is cancelled when draining times out.
+func (handler *ResourceHandler) fetchAsync(ctx context.Context, identifier string, source *source, auditEvent AuditEvent, uploadJob *UploadJobTracker) {
+	defer handler.asyncFetches.Done()
+
+	fetchCtx, cancelFetch := context.WithCancel(ctx)
+	defer cancelFetch()
+	go func() {
+		select {
+		case <-handler.stopAsyncFetches:
+			cancelFetch()
+		case <-fetchCtx.Done():
+		}
+	}()
+	tempFilename, sha1, sha256, e := handler.fetch(fetchCtx, source)
+	if e != nil && fetchCtx.Err() != nil {
+		e = &sourceURLError{errors.Errorf("Service shut down before source_url for '%v' could be fetched", identifier), http.StatusServiceUnavailable}
+	}
+	if e != nil {
+		handler.notifyUploadFailed(ctx, identifier, e)
+		uploadJob.Failed(e)
+		handle(ctx, e, true)
+		handler.auditor.Audit(auditEvent.withOutcomeFrom(sourceURLErrorStatusCode(e)))
+		return
+	}
+	handler.events.Publish(newBlobEvent(ctx, BlobEventCreated, handler.resourceType, identifier).withChecksums(sha1, sha256))
+
+	upload := &AsyncUpload{
+		ResourceType: handler.resourceType,
+		Identifier:   identifier,
+		BlobKey:      handler.blobKeyFor(identifier, sha256),
+		TempFilename: tempFilename,
+		Sha1:         sha1,
+		Sha256:       sha256,
+		AuditEvent:   auditEvent,
+		EnqueuedAt:   time.Now().UTC(),
+		ctx:          ctx,
+		uploadJob:    uploadJob,
+	}
+	if handler.asyncUploads == nil {
+		handler.processAsyncUpload(upload)
+		return
+	}
+	e = handler.asyncUploads.Enqueue(upload)
+	if e != nil {
+		os.Remove(tempFilename)
+		handler.notifyUploadFailed(ctx, identifier, e)
+		uploadJob.Failed(e)
+		handle(ctx, e, true)
+		handler.auditor.Audit(auditEvent.withOutcomeFrom(http.StatusServiceUnavailable))
+	}
+}
+
+// fetch downloads the content of source.SourceURL into a temp file. Packages are subject to the same zip checks and
+// limits as uploaded packages.
+func (handler *ResourceHandler) fetch(ctx context.Context, source *source) (tempFilename string, sha1 string, sha256 string, e error) {
+	tempFilename, e = handler.sourceURLFetcher.Fetch(ctx, source.SourceURL, source.Headers, source.Sha256, handler.maxBodySizeLimit)
+	if e != nil {
+		return "", "", "", e
+	}
+	if handler.resourceType == "package" {
+		tempFilename, e = handler.completeFetchedPackage(ctx, tempFilename)
+		if e != nil {
+			return "", "", "", e
+		}
+	}
+	sha1Sum, sha256Sum, e := ShaSums(tempFilename)
+	if e != nil {
+		os.Remove(tempFilename)
+		return "", "", "", e
+	}
+	return tempFilename, hex.EncodeToString(sha1Sum), hex.EncodeToString(sha256Sum), nil
+}
+
+func (handler *ResourceHandler) completeFetchedPackage(ctx context.Context, fetchedFilename string) (string, error) {
+	defer os.Remove(fetchedFilename)
+	file, e := os.Open(fetchedFilename)
+	if e != nil {
+		return "", errors.WithStack(e)
+	}
+	defer file.Close()
+	fileInfo, e := file.Stat()
+	if e != nil {
+		return "", errors.WithStack(e)
+	}
+	return handler.completePackageWithResources(ctx, "", file, fileInfo.Size())
+}
+
+// blobKeyFor stores droplets, whose identifier is only their guid, under "<guid>/<sha256>" like uploads with
+// a Digest header.
+func (handler *ResourceHandler) blobKeyFor(identifier string, sha256 string) string {
+	if handler.resourceType == "droplet" && !strings.Contains(identifier, "/") {
+		return identifier + "/" + sha256
+	}
+	return identifier
+}
+
+func handleSourceURLError(e error, responseWriter http.ResponseWriter, request *http.Request) (wasError bool) {
+	switch e := e.(type) {
+	case nil:
+		return false
+	case *sourceURLError:
+		logger.From(request).Infow("Could not upload from source_url", "error", e, "status-code", e.statusCode)
+		responseWriter.WriteHeader(e.statusCode)
+		util.FprintDescriptionAsJSON(responseWriter, "%v", e.Error())
+		return true
+	case *inputError:
+		logger.From(request).Infow(e.Error())
+		responseWriter.WriteHeader(http.StatusUnprocessableEntity)
+		util.FprintDescriptionAsJSON(responseWriter, e.Error())
+		return true
+	case *ZipLimitError:
+		zipLimitExceeded(responseWriter, request, e)
+		return true
+	case *NoSpaceLeftError:
+		http.Error(responseWriter, util.DescriptionAndCodeAsJSON(500000, "Request Entity Too Large"), http.StatusInsufficientStorage)
+		return true
+	default:
+		panic(e)
+	}
+}
+
+func sourceURLErrorStatusCode(e error) int {
+	switch e := e.(type) {
+	case *sourceURLError:
+		return e.statusCode
+	case *inputError, *ZipLimitError:
+		return http.StatusUnprocessableEntity
+	case *NoSpaceLeftError:
+		return http.StatusInsufficientStorage
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// redactedURL omits credentials and query parameters, which often contain tokens, e.g. for auditing.
+func redactedURL(rawURL string) string {
+	u, e := url.Parse(rawURL)
+	if e != nil {
 		return ""
 	}
-	return payload.SourceGuid
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
 }
 
 func (handler *ResourceHandler) HeadOrRedirectAsGet(responseWriter http.ResponseWriter, request *http.Request, params map[string]string) {
-	redirectLocation, e := handler.blobstore.HeadOrRedirectAsGet(params["identifier"])
+	if !handler.validIdentifier(responseWriter, request, params["identifier"]) {
+		return
+	}
+	redirectLocation, e := handler.blobstore.HeadOrRedirectAsGet(request.Context(), params["identifier"])
 	writeResponseBasedOn(redirectLocation, e, responseWriter, request, http.StatusOK, nil, nil, "")
 }
 
 func (handler *ResourceHandler) Get(responseWriter http.ResponseWriter, request *http.Request, params map[string]string) {
-	body, redirectLocation, e := handler.blobstore.GetOrRedirect(params["identifier"])
+	if !handler.validIdentifier(responseWriter, request, params["identifier"]) {
+		return
+	}
+	body, redirectLocation, e := handler.blobstore.GetOrRedirect(request.Context(), params["identifier"])
 	writeResponseBasedOn(redirectLocation, e, responseWriter, request, http.StatusOK, body, nil, request.Header.Get("If-None-Modify"))
 }
 
 func (handler *ResourceHandler) Delete(responseWriter http.ResponseWriter, request *http.Request, params map[string]string) {
+	auditedResponseWriter := handler.audited(responseWriter, request, AuditOperationDelete, params["identifier"])
+	defer auditedResponseWriter.audit()
+	responseWriter = auditedResponseWriter
+
+	if !handler.validIdentifier(responseWriter, request, params["identifier"]) {
+		return
+	}
+
 	// TODO nothing should be S3 specific here
 	// this check is needed, because S3 does not return a NotFound on a Delete request:
-	exists, e := handler.blobstore.Exists(params["identifier"])
+	exists, e := handler.blobstore.Exists(request.Context(), params["identifier"])
 	util.PanicOnError(e)
 	if !exists {
 		responseWriter.WriteHeader(http.StatusNotFound)
 		return
 	}
-	e = handler.blobstore.Delete(params["identifier"])
+	e = handler.blobstore.Delete(request.Context(), params["identifier"])
+	if e == nil {
+		handler.events.Publish(newBlobEvent(request.Context(), BlobEventDeleted, handler.resourceType, params["identifier"]))
+	}
 
 	writeResponseBasedOn("", e, responseWriter, request, http.StatusNoContent, nil, nil, "")
 }
 
 func (handler *ResourceHandler) DeleteDir(responseWriter http.ResponseWriter, request *http.Request, params map[string]string) {
-	e := handler.blobstore.DeleteDir(params["identifier"])
+	auditedResponseWriter := handler.audited(responseWriter, request, AuditOperationDeleteDir, params["identifier"])
+	defer auditedResponseWriter.audit()
+	responseWriter = auditedResponseWriter
+
+	// The empty identifier deletes all entries
+	e := handler.identifierValidator.ValidatePrefix(params["identifier"])
+	if e != nil {
+		invalidIdentifier(responseWriter, request, e)
+		return
+	}
+
+	e = handler.blobstore.DeleteDir(request.Context(), params["identifier"])
+	if e == nil {
+		// The identifier is the deleted prefix here
+		handler.events.Publish(newBlobEvent(request.Context(), BlobEventDeleted, handler.resourceType, params["identifier"]))
+	}
 
 	switch e.(type) {
 	case *NotFoundError:
@@ -428,6 +973,9 @@ func writeResponseBasedOn(redirectLocation string, e error, responseWriter http.
 	case *NoSpaceLeftError:
 		http.Error(responseWriter, util.DescriptionAndCodeAsJSON(500000, "Request Entity Too Large"), http.StatusInsufficientStorage)
 		return
+	case *InvalidIdentifierError:
+		invalidIdentifier(responseWriter, request, e)
+		return
 	case error:
 		panic(e)
 		return
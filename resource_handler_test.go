@@ -1,21 +1,29 @@
 package bitsgo_test
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"reflect"
 
+	"github.com/benbjohnson/clock"
 	"github.com/petergtz/pegomock"
 
 	"github.com/cloudfoundry-incubator/bits-service"
 
 	. "github.com/cloudfoundry-incubator/bits-service"
+	inmemory "github.com/cloudfoundry-incubator/bits-service/blobstores/inmemory"
 	"github.com/cloudfoundry-incubator/bits-service/httputil"
+	"github.com/cloudfoundry-incubator/bits-service/util"
 
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"io"
 
@@ -43,11 +51,11 @@ var _ = Describe("ResourceHandler", func() {
 	Context("Put", func() {
 		Context("no space left in resource blobstore", func() {
 			It("translates NoSpaceLeftError into StatusInsufficientStorage", func() {
-				When(blobstore.Put(AnyString(), anyReadSeeker())).ThenReturn(NewNoSpaceLeftError())
+				When(blobstore.Put(anyContext(), AnyString(), anyReadSeeker())).ThenReturn(NewNoSpaceLeftError())
 
 				handler.AddOrReplace(responseWriter,
 					newTestRequest("test-resource", "some-filename", CreateZip(map[string]string{"file1": "content1"}).String()),
-					map[string]string{})
+					map[string]string{"identifier": "someguid"})
 
 				Expect(responseWriter.Code).To(Equal(http.StatusInsufficientStorage))
 			})
@@ -60,11 +68,11 @@ var _ = Describe("ResourceHandler", func() {
 
 			Context("no space left in app-stash blobstore", func() {
 				It("translates NoSpaceLeftError into StatusInsufficientStorage", func() {
-					When(appStashBlobstore.Put(AnyString(), anyReadSeeker())).ThenReturn(NewNoSpaceLeftError())
+					When(appStashBlobstore.Put(anyContext(), AnyString(), anyReadSeeker())).ThenReturn(NewNoSpaceLeftError())
 
 					handler.AddOrReplace(responseWriter,
 						newTestRequest("package", "some-filename", CreateZip(map[string]string{"file1": "content1"}).String()),
-						map[string]string{})
+						map[string]string{"identifier": "someguid"})
 
 					Expect(responseWriter.Code).To(Equal(http.StatusInsufficientStorage))
 				})
@@ -79,6 +87,20 @@ var _ = Describe("ResourceHandler", func() {
 					Expect(responseWriter.Code).To(Equal(http.StatusUnprocessableEntity))
 				})
 			})
+
+			Context("package exceeds zip limits", func() {
+				It("returns a HTTP status UnprocessableEntity with the limit's error code", func() {
+					handler.WithZipLimits(ZipLimits{MaxUncompressedSize: 10})
+
+					handler.AddOrReplace(responseWriter,
+						newTestRequest("package", "some-filename", CreateZip(map[string]string{"file1": "content1", "file2": "content2"}).String()),
+						map[string]string{"identifier": "someguid"})
+
+					Expect(responseWriter.Code).To(Equal(http.StatusUnprocessableEntity))
+					Expect(responseWriter.Body.String()).To(ContainSubstring(`"code":290012`))
+					blobstore.VerifyWasCalled(Never()).Put(anyContext(), AnyString(), anyReadSeeker())
+				})
+			})
 		})
 
 		Context("async=true", func() {
@@ -86,7 +108,7 @@ var _ = Describe("ResourceHandler", func() {
 
 				synchronization := make(chan bool)
 
-				When(blobstore.Put(AnyString(), anyReadSeeker())).Then(func(params []Param) ReturnValues {
+				When(blobstore.Put(anyContext(), AnyString(), anyReadSeeker())).Then(func(params []Param) ReturnValues {
 					<-synchronization
 					return nil
 				})
@@ -97,33 +119,269 @@ var _ = Describe("ResourceHandler", func() {
 				req.URL.RawQuery = q.Encode()
 				handler.AddOrReplace(responseWriter,
 					req,
-					map[string]string{})
+					map[string]string{"identifier": "someguid"})
 
-				updater.VerifyWasCalledOnce().NotifyProcessingUpload(AnyString())
+				updater.VerifyWasCalledOnce().NotifyProcessingUpload(anyContext(), AnyString())
 
-				updater.VerifyWasCalled(Never()).NotifyUploadFailed(AnyString(), anyError())
-				updater.VerifyWasCalled(Never()).NotifyUploadSucceeded(AnyString(), AnyString(), AnyString())
+				updater.VerifyWasCalled(Never()).NotifyUploadFailed(anyContext(), AnyString(), anyError())
+				updater.VerifyWasCalled(Never()).NotifyUploadSucceeded(anyContext(), AnyString(), AnyString(), AnyString())
 				synchronization <- true
 
 				Eventually(func() []string {
 					// TODO can this be done better?
 					return interceptPegomockFailures(func() {
-						updater.VerifyWasCalled(Never()).NotifyUploadFailed(AnyString(), anyError())
-						updater.VerifyWasCalledOnce().NotifyUploadSucceeded(AnyString(), AnyString(), AnyString())
+						updater.VerifyWasCalled(Never()).NotifyUploadFailed(anyContext(), AnyString(), anyError())
+						updater.VerifyWasCalledOnce().NotifyUploadSucceeded(anyContext(), AnyString(), AnyString(), AnyString())
 					})
 				}, "2s").Should(BeEmpty())
 
 				Expect(responseWriter.Code).To(Equal(http.StatusAccepted))
 			})
+
+			Context("upload jobs are tracked", func() {
+				var uploadJobs *UploadJobRegistry
+
+				BeforeEach(func() {
+					uploadJobs = NewUploadJobRegistry(NewInMemoryUploadJobStore(), time.Hour, clock.New())
+					handler.WithUploadJobs(uploadJobs)
+				})
+
+				asyncRequest := func() *http.Request {
+					request := newTestRequest("test-resource", "some-filename", "some content")
+					request.URL.RawQuery = "async=true"
+					return request
+				}
+
+				uploadJobState := func() string {
+					job, e := uploadJobs.Get("test-resource", "someguid")
+					Expect(e).NotTo(HaveOccurred())
+					return job.State
+				}
+
+				It("records the job as processing until the upload has succeeded", func() {
+					synchronization := make(chan bool)
+					When(blobstore.Put(anyContext(), AnyString(), anyReadSeeker())).Then(func(params []Param) ReturnValues {
+						_, e := ioutil.ReadAll(params[2].(io.Reader))
+						Expect(e).NotTo(HaveOccurred())
+						<-synchronization
+						return []ReturnValue{nil}
+					})
+
+					handler.AddOrReplace(responseWriter, asyncRequest(), map[string]string{"identifier": "someguid"})
+
+					Expect(responseWriter.Code).To(Equal(http.StatusAccepted))
+					job, e := uploadJobs.Get("test-resource", "someguid")
+					Expect(e).NotTo(HaveOccurred())
+					Expect(job.State).To(Equal(UploadJobStateProcessing))
+					Expect(job.Sha1).To(Equal("94e66df8cd09d410c62d9e0dc59d3a884e458e05"))
+
+					synchronization <- true
+
+					Eventually(uploadJobState, "2s").Should(Equal(UploadJobStateReady))
+					job, e = uploadJobs.Get("test-resource", "someguid")
+					Expect(e).NotTo(HaveOccurred())
+					Expect(job.BytesTransferred).To(BeEquivalentTo(len("some content")))
+					Expect(job.CompletedAt).NotTo(BeNil())
+				})
+
+				It("records the error when the Cloud Controller cannot be notified", func() {
+					When(updater.NotifyUploadSucceeded(anyContext(), AnyString(), AnyString(), AnyString())).ThenReturn(fmt.Errorf("CC unavailable"))
+
+					handler.AddOrReplace(responseWriter, asyncRequest(), map[string]string{"identifier": "someguid"})
+
+					Eventually(uploadJobState, "2s").Should(Equal(UploadJobStateFailed))
+					job, e := uploadJobs.Get("test-resource", "someguid")
+					Expect(e).NotTo(HaveOccurred())
+					Expect(job.Error).To(ContainSubstring("CC unavailable"))
+				})
+
+				It("does not track synchronous uploads", func() {
+					handler.AddOrReplace(responseWriter, newTestRequest("test-resource", "some-filename", "some content"), map[string]string{"identifier": "someguid"})
+
+					Expect(responseWriter.Code).To(Equal(http.StatusCreated))
+					_, e := uploadJobs.Get("test-resource", "someguid")
+					Expect(e).To(BeAssignableToTypeOf(&NotFoundError{}))
+				})
+			})
+		})
+	})
+
+	Context("async upload queue", func() {
+		var (
+			queueDir string
+			queue    *AsyncUploadQueue
+		)
+
+		BeforeEach(func() {
+			var e error
+			queueDir, e = ioutil.TempDir("", "async-upload-queue")
+			Expect(e).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			queue.Stop()
+			os.RemoveAll(queueDir)
+		})
+
+		// enqueueBeforeRestart persists an upload in queueDir, like a queue of a previous process would.
+		enqueueBeforeRestart := func(content string, sha256 string) {
+			tempFile, e := ioutil.TempFile("", "bits")
+			Expect(e).NotTo(HaveOccurred())
+			_, e = tempFile.WriteString(content)
+			Expect(e).NotTo(HaveOccurred())
+			Expect(tempFile.Close()).To(Succeed())
+			previousQueue, e := NewAsyncUploadQueue(queueDir, 1)
+			Expect(e).NotTo(HaveOccurred())
+			Expect(previousQueue.Enqueue(&AsyncUpload{
+				ResourceType: "test-resource",
+				Identifier:   "someguid",
+				TempFilename: tempFile.Name(),
+				Sha1:         "some-sha1",
+				Sha256:       sha256,
+			})).To(Succeed())
+		}
+
+		startQueue := func() {
+			var e error
+			queue, e = NewAsyncUploadQueue(queueDir, 1)
+			Expect(e).NotTo(HaveOccurred())
+			handler.WithAsyncUploadQueue(queue)
+			Expect(handler.StartAsyncUploadQueue()).To(Succeed())
+		}
+
+		It("processes async uploads with the queue", func() {
+			startQueue()
+			request := newTestRequest("test-resource", "some-filename", "some content")
+			request.URL.RawQuery = "async=true"
+
+			handler.AddOrReplace(responseWriter, request, map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusAccepted))
+			Eventually(func() []string {
+				return interceptPegomockFailures(func() {
+					blobstore.VerifyWasCalledOnce().Put(anyContext(), EqString("someguid"), anyReadSeeker())
+					updater.VerifyWasCalledOnce().NotifyUploadSucceeded(anyContext(), EqString("someguid"), AnyString(), AnyString())
+				})
+			}, "2s").Should(BeEmpty())
+		})
+
+		It("fails uploads which cannot be processed before shutdown", func() {
+			var e error
+			queue, e = NewAsyncUploadQueue("", 1)
+			Expect(e).NotTo(HaveOccurred())
+			handler.WithAsyncUploadQueue(queue)
+			request := newTestRequest("test-resource", "some-filename", "some content")
+			request.URL.RawQuery = "async=true"
+			handler.AddOrReplace(responseWriter, request, map[string]string{"identifier": "someguid"})
+			Expect(responseWriter.Code).To(Equal(http.StatusAccepted))
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			// The queue has not been started, so that the upload is still pending
+			handler.DrainAsyncUploadQueue(ctx)
+
+			updater.VerifyWasCalledOnce().NotifyUploadFailed(anyContext(), EqString("someguid"), anyError())
+			blobstore.VerifyWasCalled(Never()).Put(anyContext(), AnyString(), anyReadSeeker())
+		})
+
+		It("fails uploads of a non-durable queue which are still in progress at shutdown and keeps their temp files", func() {
+			release := make(chan bool)
+			defer close(release)
+			When(blobstore.Put(anyContext(), AnyString(), anyReadSeeker())).Then(func(params []Param) ReturnValues {
+				<-release
+				return nil
+			})
+			var e error
+			queue, e = NewAsyncUploadQueue("", 1)
+			Expect(e).NotTo(HaveOccurred())
+			handler.WithAsyncUploadQueue(queue)
+			Expect(handler.StartAsyncUploadQueue()).To(Succeed())
+			request := newTestRequest("test-resource", "some-filename", "some content")
+			request.URL.RawQuery = "async=true"
+			handler.AddOrReplace(responseWriter, request, map[string]string{"identifier": "someguid"})
+			Expect(responseWriter.Code).To(Equal(http.StatusAccepted))
+			Eventually(func() []string {
+				return interceptPegomockFailures(func() {
+					blobstore.VerifyWasCalledOnce().Put(anyContext(), EqString("someguid"), anyReadSeeker())
+				})
+			}, "2s").Should(BeEmpty())
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			tempFilesInUse := handler.DrainAsyncUploadQueue(ctx)
+
+			Expect(tempFilesInUse).To(HaveLen(1))
+			Expect(tempFilesInUse[0]).To(BeAnExistingFile())
+			updater.VerifyWasCalledOnce().NotifyUploadFailed(anyContext(), EqString("someguid"), anyError())
+		})
+
+		It("resumes uploads which were pending before a restart", func() {
+			// sha256 of "some content"
+			enqueueBeforeRestart("some content", "290f493c44f5d63d06b374d0a5abd292fae38b92cab2fae5efefe1b0e9347f56")
+
+			startQueue()
+
+			Eventually(func() []string {
+				return interceptPegomockFailures(func() {
+					blobstore.VerifyWasCalledOnce().Put(anyContext(), EqString("someguid"), anyReadSeeker())
+					updater.VerifyWasCalledOnce().NotifyUploadSucceeded(anyContext(), EqString("someguid"), EqString("some-sha1"), EqString("290f493c44f5d63d06b374d0a5abd292fae38b92cab2fae5efefe1b0e9347f56"))
+				})
+			}, "2s").Should(BeEmpty())
+		})
+
+		It("fails resumed uploads whose temp file is corrupt", func() {
+			enqueueBeforeRestart("truncated", "290f493c44f5d63d06b374d0a5abd292fae38b92cab2fae5efefe1b0e9347f56")
+
+			startQueue()
+
+			Eventually(func() []string {
+				return interceptPegomockFailures(func() {
+					updater.VerifyWasCalledOnce().NotifyUploadFailed(anyContext(), EqString("someguid"), anyError())
+				})
+			}, "2s").Should(BeEmpty())
+			blobstore.VerifyWasCalled(Never()).Put(anyContext(), AnyString(), anyReadSeeker())
+			Eventually(func() ([]string, error) { return filepath.Glob(filepath.Join(queueDir, "*")) }).Should(BeEmpty())
+		})
+	})
+
+	Context("GetUploadJob", func() {
+		It("returns the job as JSON", func() {
+			uploadJobs := NewUploadJobRegistry(NewInMemoryUploadJobStore(), time.Hour, clock.New())
+			uploadJobs.Start("test-resource", "someguid", "some-sha1", "some-sha256").Failed(fmt.Errorf("some error"))
+			handler.WithUploadJobs(uploadJobs)
+
+			handler.GetUploadJob(responseWriter, httptest.NewRequest("GET", "http://example.com/test-resource/someguid/upload", nil), map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusOK))
+			Expect(responseWriter.Body.String()).To(SatisfyAll(
+				ContainSubstring(`"guid":"someguid"`),
+				ContainSubstring(`"state":"FAILED"`),
+				ContainSubstring(`"sha256":"some-sha256"`),
+				ContainSubstring(`"error":"some error"`),
+			))
+		})
+
+		It("returns StatusNotFound when there is no such job", func() {
+			handler.WithUploadJobs(NewUploadJobRegistry(NewInMemoryUploadJobStore(), time.Hour, clock.New()))
+
+			handler.GetUploadJob(responseWriter, httptest.NewRequest("GET", "http://example.com/test-resource/someguid/upload", nil), map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("returns StatusNotFound when upload jobs are not tracked", func() {
+			handler.GetUploadJob(responseWriter, httptest.NewRequest("GET", "http://example.com/test-resource/someguid/upload", nil), map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusNotFound))
 		})
 	})
 
 	Context("Get", func() {
 		Context("No If-None-Modify	 provided in request", func() {
 			It("returns a response with body and StatusOK", func() {
-				When(blobstore.GetOrRedirect(AnyString())).ThenReturn(ioutil.NopCloser(strings.NewReader("hello")), "", nil)
+				When(blobstore.GetOrRedirect(anyContext(), AnyString())).ThenReturn(ioutil.NopCloser(strings.NewReader("hello")), "", nil)
 
-				handler.Get(responseWriter, newGetRequestWithOptionalIfNoneModify(""), nil)
+				handler.Get(responseWriter, newGetRequestWithOptionalIfNoneModify(""), map[string]string{"identifier": "someguid"})
 
 				Expect(responseWriter.Code).To(Equal(http.StatusOK))
 				Expect(responseWriter.Body.String()).To(Equal("hello"))
@@ -132,23 +390,23 @@ var _ = Describe("ResourceHandler", func() {
 
 		Context("If-None-Modify provided in request", func() {
 			BeforeEach(func() {
-				When(blobstore.GetOrRedirect(AnyString())).ThenReturn(ioutil.NopCloser(strings.NewReader("hello")), "", nil)
+				When(blobstore.GetOrRedirect(anyContext(), AnyString())).ThenReturn(ioutil.NopCloser(strings.NewReader("hello")), "", nil)
 
-				handler.Get(responseWriter, newGetRequestWithOptionalIfNoneModify(""), nil)
+				handler.Get(responseWriter, newGetRequestWithOptionalIfNoneModify(""), map[string]string{"identifier": "someguid"})
 
 				Expect(responseWriter.Code).To(Equal(http.StatusOK))
 			})
 
 			Context("matches ETag", func() {
 				It("returns a response with empty body and StatusNotModified", func() {
-					When(blobstore.GetOrRedirect(AnyString())).ThenReturn(ioutil.NopCloser(strings.NewReader("hello")), "", nil)
+					When(blobstore.GetOrRedirect(anyContext(), AnyString())).ThenReturn(ioutil.NopCloser(strings.NewReader("hello")), "", nil)
 
 					responseWriterFollowUpRequest := httptest.NewRecorder()
 
 					handler.Get(
 						responseWriterFollowUpRequest,
 						newGetRequestWithOptionalIfNoneModify(responseWriter.HeaderMap.Get("ETag")),
-						nil)
+						map[string]string{"identifier": "someguid"})
 
 					Expect(responseWriterFollowUpRequest.Code).To(Equal(http.StatusNotModified))
 					Expect(responseWriterFollowUpRequest.Body.String()).To(BeEmpty())
@@ -156,7 +414,7 @@ var _ = Describe("ResourceHandler", func() {
 			})
 			Context("does not match ETag because content of blob has changed", func() {
 				It("returns a response with body and StatusOK", func() {
-					When(blobstore.GetOrRedirect(AnyString())).
+					When(blobstore.GetOrRedirect(anyContext(), AnyString())).
 						ThenReturn(ioutil.NopCloser(strings.NewReader("hello - the content has changed")), "", nil)
 
 					r, e := http.NewRequest("GET", "irrelevant", nil)
@@ -168,7 +426,7 @@ var _ = Describe("ResourceHandler", func() {
 					handler.Get(
 						responseWriterFollowUpRequest,
 						newGetRequestWithOptionalIfNoneModify(responseWriter.HeaderMap.Get("ETag")),
-						nil)
+						map[string]string{"identifier": "someguid"})
 
 					Expect(responseWriter.Code).To(Equal(http.StatusOK))
 					Expect(responseWriter.Body.String()).To(Equal("hello"))
@@ -185,9 +443,10 @@ var _ = Describe("ResourceHandler", func() {
 					map[string]string{"identifier": "someguid"})
 
 				inOrderContext := new(InOrderContext)
-				updater.VerifyWasCalledInOrder(Once(), inOrderContext).NotifyProcessingUpload("someguid")
-				blobstore.VerifyWasCalledInOrder(Once(), inOrderContext).Put(EqString("someguid"), anyReadSeeker())
-				_, sha1, sha256 := updater.VerifyWasCalledInOrder(Once(), inOrderContext).NotifyUploadSucceeded(
+				updater.VerifyWasCalledInOrder(Once(), inOrderContext).NotifyProcessingUpload(anyContext(), EqString("someguid"))
+				blobstore.VerifyWasCalledInOrder(Once(), inOrderContext).Put(anyContext(), EqString("someguid"), anyReadSeeker())
+				_, _, sha1, sha256 := updater.VerifyWasCalledInOrder(Once(), inOrderContext).NotifyUploadSucceeded(
+					anyContext(),
 					EqString("someguid"),
 					AnyString(),
 					AnyString()).GetCapturedArguments()
@@ -197,18 +456,30 @@ var _ = Describe("ResourceHandler", func() {
 			})
 		})
 
+		It("passes on the request's context, so that notifications can be correlated with the upload", func() {
+			request := newTestRequest("test-resource", "some-filename", CreateZip(map[string]string{"file1": "content1"}).String())
+			request = request.WithContext(util.WithVcapRequestID(request.Context(), "some-request-id"))
+
+			handler.AddOrReplace(responseWriter, request, map[string]string{"identifier": "someguid"})
+
+			ctx, _ := updater.VerifyWasCalledOnce().NotifyProcessingUpload(anyContext(), EqString("someguid")).GetCapturedArguments()
+			Expect(util.VcapRequestIDFrom(ctx)).To(Equal("some-request-id"))
+			ctx, _, _, _ = updater.VerifyWasCalledOnce().NotifyUploadSucceeded(anyContext(), EqString("someguid"), AnyString(), AnyString()).GetCapturedArguments()
+			Expect(util.VcapRequestIDFrom(ctx)).To(Equal("some-request-id"))
+		})
+
 		Context("Rejects an update", func() {
 			Context("NotifyProcessingUpload returns NewStateForbiddenError", func() {
 				It("does not upload the resource, returns BadRequest", func() {
-					When(updater.NotifyProcessingUpload(AnyString())).ThenReturn(NewStateForbiddenError())
+					When(updater.NotifyProcessingUpload(anyContext(), AnyString())).ThenReturn(NewStateForbiddenError())
 
 					handler.AddOrReplace(responseWriter,
 						newTestRequest("test-resource", "some-filename", CreateZip(map[string]string{"file1": "content1"}).String()),
 						map[string]string{"identifier": "someguid"})
 
-					updater.VerifyWasCalled(Never()).NotifyUploadFailed(AnyString(), anyError())
-					updater.VerifyWasCalled(Never()).NotifyUploadSucceeded(AnyString(), AnyString(), AnyString())
-					blobstore.VerifyWasCalled(Never()).Put(AnyString(), anyReadSeeker())
+					updater.VerifyWasCalled(Never()).NotifyUploadFailed(anyContext(), AnyString(), anyError())
+					updater.VerifyWasCalled(Never()).NotifyUploadSucceeded(anyContext(), AnyString(), AnyString(), AnyString())
+					blobstore.VerifyWasCalled(Never()).Put(anyContext(), AnyString(), anyReadSeeker())
 
 					Expect(responseWriter.Code).To(Equal(http.StatusBadRequest))
 					Expect(responseWriter.Body.String()).To(Equal(`{"description":"Cannot update an existing package.","code":290008}`))
@@ -217,7 +488,7 @@ var _ = Describe("ResourceHandler", func() {
 
 			Context("NotifyUploadSucceeded returns an error", func() {
 				It("has uploaded the resource, panics", func() {
-					When(updater.NotifyUploadSucceeded(AnyString(), AnyString(), AnyString())).ThenReturn(fmt.Errorf("Some error"))
+					When(updater.NotifyUploadSucceeded(anyContext(), AnyString(), AnyString(), AnyString())).ThenReturn(fmt.Errorf("Some error"))
 
 					Expect(func() {
 						handler.AddOrReplace(responseWriter,
@@ -225,15 +496,15 @@ var _ = Describe("ResourceHandler", func() {
 							map[string]string{"identifier": "someguid"})
 					}).To(Panic())
 
-					updater.VerifyWasCalled(Never()).NotifyUploadFailed(AnyString(), anyError())
-					blobstore.VerifyWasCalledOnce().Put(EqString("someguid"), anyReadSeeker())
+					updater.VerifyWasCalled(Never()).NotifyUploadFailed(anyContext(), AnyString(), anyError())
+					blobstore.VerifyWasCalledOnce().Put(anyContext(), EqString("someguid"), anyReadSeeker())
 				})
 			})
 
 			Context("NotifyUploadFailed returns an error", func() {
 				It("panics", func() {
-					When(blobstore.Put(AnyString(), anyReadSeeker())).ThenReturn(fmt.Errorf("Some blobstore error"))
-					When(updater.NotifyUploadFailed(AnyString(), anyError())).ThenReturn(fmt.Errorf("Some error"))
+					When(blobstore.Put(anyContext(), AnyString(), anyReadSeeker())).ThenReturn(fmt.Errorf("Some blobstore error"))
+					When(updater.NotifyUploadFailed(anyContext(), AnyString(), anyError())).ThenReturn(fmt.Errorf("Some error"))
 
 					Expect(func() {
 						handler.AddOrReplace(responseWriter,
@@ -242,9 +513,9 @@ var _ = Describe("ResourceHandler", func() {
 					}).To(Panic())
 
 					inOrderContext := new(InOrderContext)
-					updater.VerifyWasCalledInOrder(Once(), inOrderContext).NotifyProcessingUpload("someguid")
-					blobstore.VerifyWasCalledInOrder(AtLeast(2), inOrderContext).Put(EqString("someguid"), anyReadSeeker())
-					updater.VerifyWasCalledInOrder(Once(), inOrderContext).NotifyUploadFailed(EqString("someguid"), anyError())
+					updater.VerifyWasCalledInOrder(Once(), inOrderContext).NotifyProcessingUpload(anyContext(), EqString("someguid"))
+					blobstore.VerifyWasCalledInOrder(AtLeast(2), inOrderContext).Put(anyContext(), EqString("someguid"), anyReadSeeker())
+					updater.VerifyWasCalledInOrder(Once(), inOrderContext).NotifyUploadFailed(anyContext(), EqString("someguid"), anyError())
 				})
 			})
 
@@ -253,7 +524,7 @@ var _ = Describe("ResourceHandler", func() {
 		Context("replies with an unexpected error", func() {
 			Context("NotifyProcessingUpload returns unexpected error", func() {
 				It("does not upload the resource, panics", func() {
-					When(updater.NotifyProcessingUpload(AnyString())).ThenReturn(fmt.Errorf("Unexpected error"))
+					When(updater.NotifyProcessingUpload(anyContext(), AnyString())).ThenReturn(fmt.Errorf("Unexpected error"))
 
 					Expect(func() {
 						handler.AddOrReplace(responseWriter,
@@ -261,9 +532,9 @@ var _ = Describe("ResourceHandler", func() {
 							map[string]string{"identifier": "someguid"})
 					}).To(Panic())
 
-					updater.VerifyWasCalled(Never()).NotifyUploadFailed(AnyString(), anyError())
-					updater.VerifyWasCalled(Never()).NotifyUploadSucceeded(AnyString(), AnyString(), AnyString())
-					blobstore.VerifyWasCalled(Never()).Put(AnyString(), anyReadSeeker())
+					updater.VerifyWasCalled(Never()).NotifyUploadFailed(anyContext(), AnyString(), anyError())
+					updater.VerifyWasCalled(Never()).NotifyUploadSucceeded(anyContext(), AnyString(), AnyString(), AnyString())
+					blobstore.VerifyWasCalled(Never()).Put(anyContext(), AnyString(), anyReadSeeker())
 
 				})
 			})
@@ -272,28 +543,623 @@ var _ = Describe("ResourceHandler", func() {
 		Context("replies with guid not found", func() {
 			Context("NotifyProcessingUpload returns guid not found", func() {
 				It("does not upload the resource, returns ResourceNotFound", func() {
-					When(updater.NotifyProcessingUpload(AnyString())).ThenReturn(bitsgo.NewNotFoundError())
+					When(updater.NotifyProcessingUpload(anyContext(), AnyString())).ThenReturn(bitsgo.NewNotFoundError())
 
 					handler.AddOrReplace(responseWriter,
 						newTestRequest("test-resource", "some-filename", CreateZip(map[string]string{"file1": "content1"}).String()),
 						map[string]string{"identifier": "someguid"})
 
-					updater.VerifyWasCalled(Never()).NotifyUploadFailed(AnyString(), anyError())
-					updater.VerifyWasCalled(Never()).NotifyUploadSucceeded(AnyString(), AnyString(), AnyString())
-					blobstore.VerifyWasCalled(Never()).Put(AnyString(), anyReadSeeker())
+					updater.VerifyWasCalled(Never()).NotifyUploadFailed(anyContext(), AnyString(), anyError())
+					updater.VerifyWasCalled(Never()).NotifyUploadSucceeded(anyContext(), AnyString(), AnyString(), AnyString())
+					blobstore.VerifyWasCalled(Never()).Put(anyContext(), AnyString(), anyReadSeeker())
 
 					Expect(responseWriter.Code).To(Equal(http.StatusNotFound))
 				})
 			})
 		})
 	})
+
+	Context("Digest in header", func() {
+		BeforeEach(func() {
+			handler = NewResourceHandlerWithUpdater(blobstore, appStashBlobstore, updater, "droplet", NewMockMetricsService(), 0)
+		})
+
+		newDigestRequest := func() *http.Request {
+			request := httptest.NewRequest("PUT", "http://internal/droplets/someguid", strings.NewReader("droplet content"))
+			request.Header.Set("Digest", "sha256=somedigest")
+			return request
+		}
+
+		It("notifies the updater and stores the blob under its digest", func() {
+			handler.AddOrReplaceWithDigestInHeader(responseWriter, newDigestRequest(), map[string]string{"identifier": "someguid"})
+
+			inOrderContext := new(InOrderContext)
+			updater.VerifyWasCalledInOrder(Once(), inOrderContext).NotifyProcessingUpload(anyContext(), EqString("someguid"))
+			blobstore.VerifyWasCalledInOrder(Once(), inOrderContext).Put(anyContext(), EqString("someguid/somedigest"), anyReadSeeker())
+			updater.VerifyWasCalledInOrder(Once(), inOrderContext).NotifyUploadSucceeded(anyContext(), EqString("someguid"), AnyString(), AnyString())
+			Expect(responseWriter.Code).To(Equal(http.StatusCreated))
+		})
+
+		It("does not upload the resource when the CC rejects it", func() {
+			When(updater.NotifyProcessingUpload(anyContext(), AnyString())).ThenReturn(NewStateForbiddenError())
+
+			handler.AddOrReplaceWithDigestInHeader(responseWriter, newDigestRequest(), map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusBadRequest))
+			blobstore.VerifyWasCalled(Never()).Put(anyContext(), AnyString(), anyReadSeeker())
+		})
+
+		It("uploads asynchronously with async=true", func() {
+			request := newDigestRequest()
+			request.URL.RawQuery = "async=true"
+
+			handler.AddOrReplaceWithDigestInHeader(responseWriter, request, map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusAccepted))
+			Eventually(func() []string {
+				return interceptPegomockFailures(func() {
+					blobstore.VerifyWasCalledOnce().Put(anyContext(), EqString("someguid/somedigest"), anyReadSeeker())
+					updater.VerifyWasCalledOnce().NotifyUploadSucceeded(anyContext(), EqString("someguid"), AnyString(), AnyString())
+				})
+			}, "2s").Should(BeEmpty())
+		})
+	})
+
+	Context("Source URL", func() {
+		var (
+			server  *httptest.Server
+			content string
+		)
+
+		BeforeEach(func() {
+			content = "buildpack content"
+			server = httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+				if request.Header.Get("Authorization") != "token some-token" {
+					responseWriter.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				fmt.Fprint(responseWriter, content)
+			}))
+			handler = NewResourceHandlerWithUpdater(blobstore, appStashBlobstore, updater, "buildpack", NewMockMetricsService(), 0).
+				WithSourceURLFetcher(NewSourceURLFetcher([]string{"127.0.0.1"}, 1024, time.Second, true))
+		})
+
+		AfterEach(func() { server.Close() })
+
+		newSourceURLRequest := func(body string) *http.Request {
+			request := httptest.NewRequest("PUT", "http://internal/buildpacks/someguid", strings.NewReader(body))
+			request.Header.Set("Content-Type", "application/json")
+			return request
+		}
+
+		sourceURLBody := func(sha256 string) string {
+			return fmt.Sprintf(`{"source_url": "%v/buildpack.zip", "sha256": "%v", "headers": {"Authorization": "token some-token"}}`, server.URL, sha256)
+		}
+
+		It("fetches the content, stores it and notifies the updater", func() {
+			var storedContent []byte
+			When(blobstore.Put(anyContext(), AnyString(), anyReadSeeker())).Then(func(params []Param) ReturnValues {
+				storedContent, _ = ioutil.ReadAll(params[2].(io.ReadSeeker))
+				return []ReturnValue{nil}
+			})
+
+			handler.CopySourceGuid(responseWriter,
+				newSourceURLRequest(sourceURLBody("7e570172a4de3de4fed716888af9088e7df57d90056d98c2c93c095eabe23f98")),
+				map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusCreated))
+			blobstore.VerifyWasCalledOnce().Put(anyContext(), EqString("someguid"), anyReadSeeker())
+			Expect(string(storedContent)).To(Equal(content))
+			updater.VerifyWasCalledOnce().NotifyProcessingUpload(anyContext(), EqString("someguid"))
+			updater.VerifyWasCalledOnce().NotifyUploadSucceeded(anyContext(), EqString("someguid"), AnyString(), AnyString())
+		})
+
+		It("rejects content with an unexpected SHA256", func() {
+			handler.CopySourceGuid(responseWriter, newSourceURLRequest(sourceURLBody("0000")), map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusUnprocessableEntity))
+			updater.VerifyWasCalled(Never()).NotifyProcessingUpload(anyContext(), AnyString())
+			blobstore.VerifyWasCalled(Never()).Put(anyContext(), AnyString(), anyReadSeeker())
+		})
+
+		It("rejects content which exceeds the maximum size", func() {
+			content = strings.Repeat("x", 1025)
+
+			handler.CopySourceGuid(responseWriter, newSourceURLRequest(sourceURLBody("")), map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusRequestEntityTooLarge))
+			blobstore.VerifyWasCalled(Never()).Put(anyContext(), AnyString(), anyReadSeeker())
+		})
+
+		It("answers with StatusBadGateway when the source responds with an error", func() {
+			handler.CopySourceGuid(responseWriter,
+				newSourceURLRequest(fmt.Sprintf(`{"source_url": "%v/buildpack.zip"}`, server.URL)),
+				map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusBadGateway))
+		})
+
+		It("rejects hosts which are not allowed before notifying the updater", func() {
+			handler.CopySourceGuid(responseWriter,
+				newSourceURLRequest(`{"source_url": "https://example.com/buildpack.zip"}`),
+				map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusBadRequest))
+			Expect(responseWriter.Body.String()).To(ContainSubstring("Host 'example.com' of source_url is not allowed"))
+			updater.VerifyWasCalled(Never()).NotifyProcessingUpload(anyContext(), AnyString())
+		})
+
+		It("rejects source URLs when no fetcher is configured", func() {
+			handler = NewResourceHandlerWithUpdater(blobstore, appStashBlobstore, updater, "buildpack", NewMockMetricsService(), 0)
+
+			handler.CopySourceGuid(responseWriter, newSourceURLRequest(sourceURLBody("")), map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("fetches asynchronously with async=true", func() {
+			request := newSourceURLRequest(sourceURLBody(""))
+			request.URL.RawQuery = "async=true"
+
+			handler.CopySourceGuid(responseWriter, request, map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusAccepted))
+			updater.VerifyWasCalledOnce().NotifyProcessingUpload(anyContext(), EqString("someguid"))
+			Eventually(func() []string {
+				return interceptPegomockFailures(func() {
+					blobstore.VerifyWasCalledOnce().Put(anyContext(), EqString("someguid"), anyReadSeeker())
+					updater.VerifyWasCalledOnce().NotifyUploadSucceeded(anyContext(), EqString("someguid"), AnyString(), AnyString())
+				})
+			}, "2s").Should(BeEmpty())
+		})
+
+		It("notifies the updater when an async fetch fails", func() {
+			request := newSourceURLRequest(sourceURLBody("0000"))
+			request.URL.RawQuery = "async=true"
+
+			handler.CopySourceGuid(responseWriter, request, map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusAccepted))
+			Eventually(func() []string {
+				return interceptPegomockFailures(func() {
+					updater.VerifyWasCalledOnce().NotifyUploadFailed(anyContext(), EqString("someguid"), anyError())
+				})
+			}, "2s").Should(BeEmpty())
+			blobstore.VerifyWasCalled(Never()).Put(anyContext(), AnyString(), anyReadSeeker())
+		})
+
+		Context("draining", func() {
+			var release chan bool
+
+			BeforeEach(func() {
+				release = make(chan bool)
+				server.Config.Handler = http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+					select {
+					case <-release:
+						fmt.Fprint(responseWriter, content)
+					case <-request.Context().Done():
+					}
+				})
+				queue, e := NewAsyncUploadQueue("", 1)
+				Expect(e).NotTo(HaveOccurred())
+				handler.WithAsyncUploadQueue(queue)
+				Expect(handler.StartAsyncUploadQueue()).To(Succeed())
+			})
+
+			fetchAsync := func() {
+				request := newSourceURLRequest(sourceURLBody(""))
+				request.URL.RawQuery = "async=true"
+				handler.CopySourceGuid(responseWriter, request, map[string]string{"identifier": "someguid"})
+				Expect(responseWriter.Code).To(Equal(http.StatusAccepted))
+			}
+
+			It("waits for async fetches and uploads their content", func() {
+				fetchAsync()
+				time.AfterFunc(50*time.Millisecond, func() { close(release) })
+
+				handler.DrainAsyncUploadQueue(context.Background())
+
+				blobstore.VerifyWasCalledOnce().Put(anyContext(), EqString("someguid"), anyReadSeeker())
+				updater.VerifyWasCalledOnce().NotifyUploadSucceeded(anyContext(), EqString("someguid"), AnyString(), AnyString())
+			})
+
+			It("fails async fetches which are still in progress when draining times out", func() {
+				fetchAsync()
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				defer cancel()
+
+				handler.DrainAsyncUploadQueue(ctx)
+
+				updater.VerifyWasCalledOnce().NotifyUploadFailed(anyContext(), EqString("someguid"), anyError())
+				blobstore.VerifyWasCalled(Never()).Put(anyContext(), AnyString(), anyReadSeeker())
+			})
+		})
+
+		It("stores droplets under their SHA256", func() {
+			handler = NewResourceHandlerWithUpdater(blobstore, appStashBlobstore, updater, "droplet", NewMockMetricsService(), 0).
+				WithSourceURLFetcher(NewSourceURLFetcher([]string{"127.0.0.1"}, 0, time.Second, true))
+
+			handler.CopySourceGuid(responseWriter, newSourceURLRequest(sourceURLBody("")), map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusCreated))
+			blobstore.VerifyWasCalledOnce().Put(anyContext(), EqString("someguid/7e570172a4de3de4fed716888af9088e7df57d90056d98c2c93c095eabe23f98"), anyReadSeeker())
+		})
+	})
+
+	Context("Copy", func() {
+		const contentSha256 = "830df696604d16c1966d36f166b8635aa0788f09af6df4cc8ba9976d1a1c5dd9"
+
+		var (
+			packages *inmemory.Blobstore
+			droplets *inmemory.Blobstore
+		)
+
+		BeforeEach(func() {
+			packages = inmemory.NewBlobstoreWithEntries(map[string][]byte{"packageguid": []byte("package content")})
+			droplets = inmemory.NewBlobstore()
+			handler = NewResourceHandlerWithUpdater(droplets, appStashBlobstore, updater, "droplet", NewMockMetricsService(), 0).
+				WithCopySources(map[string]CopySource{"package": packages, "droplet": droplets})
+		})
+
+		newCopyRequest := func(body string) *http.Request {
+			request := httptest.NewRequest("PUT", "http://internal/droplets/dropletguid", strings.NewReader(body))
+			request.Header.Set("Content-Type", "application/json")
+			return request
+		}
+
+		It("streams the content from the source type's blobstore", func() {
+			handler.CopySourceGuid(responseWriter,
+				newCopyRequest(`{"source_guid": "packageguid", "source_type": "package", "source_checksum": "`+contentSha256+`"}`),
+				map[string]string{"identifier": "dropletguid/somechecksum"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusCreated))
+			Expect(responseWriter.Body.String()).To(ContainSubstring(`"sha1":"48e7717bb0ef42f6c41389d19c30ed91534accfb"`))
+			Expect(droplets.Entries).To(HaveKeyWithValue("dropletguid/somechecksum", []byte("package content")))
+		})
+
+		It("stores droplets which are only identified by their guid under their SHA256", func() {
+			handler.CopySourceGuid(responseWriter, newCopyRequest(`{"source_guid": "packageguid", "source_type": "package"}`),
+				map[string]string{"identifier": "dropletguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusCreated))
+			Expect(droplets.Entries).To(HaveKey("dropletguid/" + contentSha256))
+		})
+
+		It("rejects content with an unexpected checksum", func() {
+			handler.CopySourceGuid(responseWriter,
+				newCopyRequest(`{"source_guid": "packageguid", "source_type": "package", "source_checksum": "0000"}`),
+				map[string]string{"identifier": "dropletguid/somechecksum"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(droplets.Entries).To(BeEmpty())
+		})
+
+		It("verifies the source of copies within the same blobstore before copying", func() {
+			droplets.Entries["otherguid/somechecksum"] = []byte("package content")
+
+			handler.CopySourceGuid(responseWriter,
+				newCopyRequest(`{"source_guid": "otherguid/somechecksum", "source_checksum": "`+contentSha256+`"}`),
+				map[string]string{"identifier": "dropletguid/somechecksum"})
+			Expect(responseWriter.Code).To(Equal(http.StatusCreated))
+			Expect(droplets.Entries).To(HaveKey("dropletguid/somechecksum"))
+
+			responseWriter = httptest.NewRecorder()
+			droplets.Entries["thirdguid/somechecksum"] = []byte("existing content")
+			handler.CopySourceGuid(responseWriter,
+				newCopyRequest(`{"source_guid": "otherguid/somechecksum", "source_checksum": "0000"}`),
+				map[string]string{"identifier": "thirdguid/somechecksum"})
+			Expect(responseWriter.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(droplets.Entries).To(HaveKeyWithValue("thirdguid/somechecksum", []byte("existing content")))
+		})
+
+		It("returns the checksums and uses the same blob keys for copies within the same blobstore", func() {
+			droplets.Entries["otherguid/somechecksum"] = []byte("package content")
+
+			handler.CopySourceGuid(responseWriter, newCopyRequest(`{"source_guid": "otherguid/somechecksum"}`),
+				map[string]string{"identifier": "dropletguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusCreated))
+			Expect(responseWriter.Body.String()).To(ContainSubstring(`"sha1":"48e7717bb0ef42f6c41389d19c30ed91534accfb"`))
+			Expect(responseWriter.Body.String()).To(ContainSubstring(`"sha256":"` + contentSha256 + `"`))
+			Expect(droplets.Entries).To(HaveKeyWithValue("dropletguid/"+contentSha256, []byte("package content")))
+		})
+
+		It("deletes copies within the same blobstore which do not match their source", func() {
+			droplets.Entries["otherguid/somechecksum"] = []byte("package content")
+			handler.WithCopySources(map[string]CopySource{"droplet": inmemory.NewBlobstoreWithEntries(map[string][]byte{
+				"otherguid/somechecksum":   []byte("package content"),
+				"dropletguid/somechecksum": []byte("changed content"),
+			})})
+
+			handler.CopySourceGuid(responseWriter, newCopyRequest(`{"source_guid": "otherguid/somechecksum"}`),
+				map[string]string{"identifier": "dropletguid/somechecksum"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(droplets.Entries).NotTo(HaveKey("dropletguid/somechecksum"))
+		})
+
+		It("rejects content from other resource types which exceeds the maximum body size", func() {
+			handler = NewResourceHandlerWithUpdater(droplets, appStashBlobstore, updater, "droplet", NewMockMetricsService(), 10).
+				WithCopySources(map[string]CopySource{"package": packages})
+
+			handler.CopySourceGuid(responseWriter, newCopyRequest(`{"source_guid": "packageguid", "source_type": "package"}`),
+				map[string]string{"identifier": "dropletguid/somechecksum"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusRequestEntityTooLarge))
+			Expect(droplets.Entries).To(BeEmpty())
+		})
+
+		Context("with a signed URL", func() {
+			newSignedCopyRequest := func(body string) *http.Request {
+				return util.RequestWithPrincipal(newCopyRequest(body), "signed_url:key-1")
+			}
+
+			It("rejects copies from other resource types", func() {
+				handler.CopySourceGuid(responseWriter, newSignedCopyRequest(`{"source_guid": "packageguid", "source_type": "package"}`),
+					map[string]string{"identifier": "dropletguid/somechecksum"})
+
+				Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+				Expect(droplets.Entries).To(BeEmpty())
+			})
+
+			It("rejects source URLs", func() {
+				handler.CopySourceGuid(responseWriter, newSignedCopyRequest(`{"source_url": "https://example.com/droplet.tgz"}`),
+					map[string]string{"identifier": "dropletguid/somechecksum"})
+
+				Expect(responseWriter.Code).To(Equal(http.StatusForbidden))
+			})
+
+			It("allows copies within the same resource type", func() {
+				droplets.Entries["otherguid/somechecksum"] = []byte("droplet content")
+
+				handler.CopySourceGuid(responseWriter, newSignedCopyRequest(`{"source_guid": "otherguid/somechecksum", "source_type": "droplet"}`),
+					map[string]string{"identifier": "dropletguid/somechecksum"})
+
+				Expect(responseWriter.Code).To(Equal(http.StatusCreated))
+			})
+		})
+
+		It("responds with StatusNotFound when the source does not exist", func() {
+			handler.CopySourceGuid(responseWriter, newCopyRequest(`{"source_guid": "otherguid", "source_type": "package"}`),
+				map[string]string{"identifier": "dropletguid/somechecksum"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("rejects source types which are not copy sources", func() {
+			handler.CopySourceGuid(responseWriter, newCopyRequest(`{"source_guid": "packageguid", "source_type": "buildpack"}`),
+				map[string]string{"identifier": "dropletguid/somechecksum"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusBadRequest))
+			Expect(responseWriter.Body.String()).To(ContainSubstring("Cannot copy droplet from source_type 'buildpack'"))
+		})
+
+		It("validates source guids according to the source type", func() {
+			handler.CopySourceGuid(responseWriter, newCopyRequest(`{"source_guid": "packageguid/somechecksum", "source_type": "package"}`),
+				map[string]string{"identifier": "dropletguid/somechecksum"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusBadRequest))
+			Expect(responseWriter.Body.String()).To(ContainSubstring("package identifiers must consist of at most 1 '/'-separated segments"))
+		})
+	})
+
+	Context("invalid identifiers", func() {
+		It("rejects them with StatusBadRequest before accessing the blobstore", func() {
+			handler.AddOrReplace(responseWriter,
+				newTestRequest("test-resource", "some-filename", "content"),
+				map[string]string{"identifier": "../../etc/passwd"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusBadRequest))
+			Expect(responseWriter.Body.String()).To(MatchJSON(`{"code": 290010, "description": "Invalid identifier '../../etc/passwd': test-resource identifiers must consist of at most 1 '/'-separated segments"}`))
+			blobstore.VerifyWasCalled(Never()).Put(anyContext(), AnyString(), anyReadSeeker())
+		})
+
+		It("rejects copies from an invalid source guid", func() {
+			handler.CopySourceGuid(responseWriter,
+				httptest.NewRequest("PUT", "http://internal/test-resource/someguid", strings.NewReader(`{"source_guid": "../otherguid"}`)),
+				map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusBadRequest))
+			blobstore.VerifyWasCalled(Never()).Copy(anyContext(), AnyString(), AnyString())
+		})
+
+		It("rejects digests which are not valid identifier segments", func() {
+			request := httptest.NewRequest("PUT", "http://internal/test-resource/someguid", strings.NewReader("content"))
+			request.Header.Set("Digest", "sha256=../../someotherguid")
+
+			handler.AddOrReplaceWithDigestInHeader(responseWriter, request, map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusBadRequest))
+			blobstore.VerifyWasCalled(Never()).Put(anyContext(), AnyString(), anyReadSeeker())
+		})
+
+		It("translates InvalidIdentifierErrors from the blobstore into StatusBadRequest", func() {
+			When(blobstore.GetOrRedirect(anyContext(), AnyString())).ThenReturn(nil, "", bitsgo.NewInvalidIdentifierError("someguid", "some reason"))
+
+			handler.Get(responseWriter, httptest.NewRequest("GET", "http://internal/test-resource/someguid", nil), map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusBadRequest))
+			Expect(responseWriter.Body.String()).To(ContainSubstring(`"code":290010`))
+		})
+	})
+
+	Context("Audit", func() {
+		var auditor *MockAuditor
+
+		BeforeEach(func() {
+			auditor = NewMockAuditor()
+			handler.WithAuditor(auditor)
+		})
+
+		It("audits uploads with their principal, source IP and sha256", func() {
+			request := util.RequestWithPrincipal(
+				newTestRequest("test-resource", "some-filename", "content"),
+				"basic_auth:cc")
+			request.RemoteAddr = "10.0.0.1:12345"
+			request.Header.Set("X-Vcap-Request-Id", "some-vcap-request-id")
+			request = util.RequestWithContextValues(request, "vcap-request-id", "some-vcap-request-id")
+
+			handler.AddOrReplace(responseWriter, request, map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusCreated))
+			event := auditor.VerifyWasCalledOnce().Audit(anyAuditEvent()).GetCapturedArguments()
+			Expect(event.Operation).To(Equal("put"))
+			Expect(event.ResourceType).To(Equal("test-resource"))
+			Expect(event.Identifier).To(Equal("someguid"))
+			Expect(event.Principal).To(Equal("basic_auth:cc"))
+			Expect(event.SourceIP).To(Equal("10.0.0.1"))
+			Expect(event.Sha256).To(Equal("ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73"))
+			Expect(event.Outcome).To(Equal("success"))
+			Expect(event.StatusCode).To(Equal(http.StatusCreated))
+			Expect(event.VcapRequestID).To(Equal("some-vcap-request-id"))
+		})
+
+		It("audits failed deletes", func() {
+			When(blobstore.Exists(anyContext(), AnyString())).ThenReturn(false, nil)
+
+			handler.Delete(responseWriter, httptest.NewRequest("DELETE", "http://internal/test-resource/someguid", nil), map[string]string{"identifier": "someguid"})
+
+			event := auditor.VerifyWasCalledOnce().Audit(anyAuditEvent()).GetCapturedArguments()
+			Expect(event.Operation).To(Equal("delete"))
+			Expect(event.Principal).To(Equal("anonymous"))
+			Expect(event.Outcome).To(Equal("failure"))
+			Expect(event.StatusCode).To(Equal(http.StatusNotFound))
+		})
+
+		It("audits copies with their source", func() {
+			handler.CopySourceGuid(responseWriter,
+				httptest.NewRequest("PUT", "http://internal/test-resource/someguid", strings.NewReader(`{"source_guid": "sourceguid"}`)),
+				map[string]string{"identifier": "someguid"})
+
+			event := auditor.VerifyWasCalledOnce().Audit(anyAuditEvent()).GetCapturedArguments()
+			Expect(event.Operation).To(Equal("copy"))
+			Expect(event.SourceIdentifier).To(Equal("sourceguid"))
+			Expect(event.Outcome).To(Equal("success"))
+		})
+
+		It("audits DeleteDir", func() {
+			handler.DeleteDir(responseWriter, httptest.NewRequest("DELETE", "http://internal/buildpack_cache/entries/app", nil), map[string]string{"identifier": "app"})
+
+			event := auditor.VerifyWasCalledOnce().Audit(anyAuditEvent()).GetCapturedArguments()
+			Expect(event.Operation).To(Equal("delete_dir"))
+			Expect(event.Identifier).To(Equal("app"))
+			Expect(event.StatusCode).To(Equal(http.StatusNoContent))
+		})
+	})
+
+	Context("Events", func() {
+		var events *recordingEventPublisher
+
+		BeforeEach(func() {
+			events = &recordingEventPublisher{}
+			handler.WithEventPublisher(events)
+		})
+
+		It("publishes the lifecycle of a successful upload", func() {
+			request := util.RequestWithContextValues(newTestRequest("test-resource", "some-filename", "content"), "vcap-request-id", "some-vcap-request-id")
+
+			handler.AddOrReplace(responseWriter, request, map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusCreated))
+			Expect(events.types()).To(Equal([]string{BlobEventCreated, BlobEventProcessing, BlobEventReady}))
+			ready := events.published()[2]
+			Expect(ready.ResourceType).To(Equal("test-resource"))
+			Expect(ready.Identifier).To(Equal("someguid"))
+			Expect(ready.Sha1).To(Equal("040f06fd774092478d450774f5ba30c5da78acc8"))
+			Expect(ready.Sha256).To(Equal("ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73"))
+			Expect(ready.VcapRequestID).To(Equal("some-vcap-request-id"))
+		})
+
+		It("publishes failed async uploads", func() {
+			When(blobstore.Put(anyContext(), AnyString(), anyReadSeeker())).ThenReturn(NewNoSpaceLeftError())
+
+			request := newTestRequest("test-resource", "some-filename", "content")
+			request.URL.RawQuery = "async=true"
+
+			handler.AddOrReplace(responseWriter, request, map[string]string{"identifier": "someguid"})
+
+			Expect(responseWriter.Code).To(Equal(http.StatusAccepted))
+			Eventually(events.types).Should(Equal([]string{BlobEventCreated, BlobEventProcessing, BlobEventFailed}))
+			Expect(events.published()[2].Error).NotTo(BeEmpty())
+		})
+
+		It("does not publish rejected uploads", func() {
+			When(updater.NotifyProcessingUpload(anyContext(), AnyString())).ThenReturn(NewStateForbiddenError())
+
+			handler.AddOrReplace(responseWriter, newTestRequest("test-resource", "some-filename", "content"), map[string]string{"identifier": "someguid"})
+
+			Expect(events.published()).To(BeEmpty())
+		})
+
+		It("publishes copies with their source", func() {
+			handler.CopySourceGuid(responseWriter,
+				httptest.NewRequest("PUT", "http://internal/test-resource/someguid", strings.NewReader(`{"source_guid": "sourceguid"}`)),
+				map[string]string{"identifier": "someguid"})
+
+			Expect(events.published()).To(HaveLen(1))
+			Expect(events.published()[0].Type).To(Equal(BlobEventCopied))
+			Expect(events.published()[0].SourceIdentifier).To(Equal("sourceguid"))
+		})
+
+		It("publishes deletes", func() {
+			When(blobstore.Exists(anyContext(), AnyString())).ThenReturn(true, nil)
+
+			handler.Delete(responseWriter, httptest.NewRequest("DELETE", "http://internal/test-resource/someguid", nil), map[string]string{"identifier": "someguid"})
+
+			Expect(events.types()).To(Equal([]string{BlobEventDeleted}))
+			Expect(events.published()[0].Identifier).To(Equal("someguid"))
+		})
+
+		It("does not publish deletes of blobs which do not exist", func() {
+			When(blobstore.Exists(anyContext(), AnyString())).ThenReturn(false, nil)
+
+			handler.Delete(responseWriter, httptest.NewRequest("DELETE", "http://internal/test-resource/someguid", nil), map[string]string{"identifier": "someguid"})
+
+			Expect(events.published()).To(BeEmpty())
+		})
+	})
 })
 
+type recordingEventPublisher struct {
+	mutex  sync.Mutex
+	events []bitsgo.BlobEvent
+}
+
+func (publisher *recordingEventPublisher) Publish(event bitsgo.BlobEvent) {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	publisher.events = append(publisher.events, event)
+}
+
+func (publisher *recordingEventPublisher) published() []bitsgo.BlobEvent {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	return append([]bitsgo.BlobEvent{}, publisher.events...)
+}
+
+func (publisher *recordingEventPublisher) types() []string {
+	var types []string
+	for _, event := range publisher.published() {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func anyAuditEvent() bitsgo.AuditEvent {
+	RegisterMatcher(NewAnyMatcher(reflect.TypeOf(bitsgo.AuditEvent{})))
+	return bitsgo.AuditEvent{}
+}
+
 func anyReadSeeker() io.ReadSeeker {
 	RegisterMatcher(NewAnyMatcher(reflect.TypeOf((*io.ReadSeeker)(nil)).Elem()))
 	return nil
 }
 
+func anyContext() context.Context {
+	RegisterMatcher(NewAnyMatcher(reflect.TypeOf((*context.Context)(nil)).Elem()))
+	return nil
+}
+
 func anyError() error {
 	RegisterMatcher(NewAnyMatcher(reflect.TypeOf((*error)(nil)).Elem()))
 	return nil
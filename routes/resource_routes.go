@@ -11,47 +11,160 @@ import (
 	"github.com/urfave/negroni"
 )
 
+// TokenAuth configures which routers on the private host require bearer tokens.
+// A nil Middleware disables token authentication.
+type TokenAuth struct {
+	Middleware *middlewares.BearerTokenAuthMiddleware
+	// InternalRouter protects the resource routes on the private host.
+	InternalRouter bool
+	// SignRoutes protects the /sign routes. Tokens replace basic auth for these routes.
+	SignRoutes bool
+}
+
+func (tokenAuth TokenAuth) forResourceType(resourceType string) negroni.Handler {
+	if tokenAuth.Middleware == nil || !tokenAuth.InternalRouter {
+		return nil
+	}
+	return tokenAuth.Middleware.ForResourceType(resourceType)
+}
+
+func (tokenAuth TokenAuth) forSigning(resourceType string, basicAuthMiddleware negroni.Handler) negroni.Handler {
+	if tokenAuth.Middleware == nil || !tokenAuth.SignRoutes {
+		return basicAuthMiddleware
+	}
+	return tokenAuth.Middleware.ForSigningResourceType(resourceType)
+}
+
+func (tokenAuth TokenAuth) forBatchSigning(basicAuthMiddleware negroni.Handler) negroni.Handler {
+	if tokenAuth.Middleware == nil || !tokenAuth.SignRoutes {
+		return basicAuthMiddleware
+	}
+	return tokenAuth.Middleware.ForSigningBatches()
+}
+
+// ClientCertAuth configures whether the private host requires verified client certificates.
+type ClientCertAuth struct {
+	Enabled bool
+	// AllowedIdentities restricts the subject CNs and SANs per route group. Route groups without entries accept
+	// any verified client certificate.
+	AllowedIdentities map[string][]string
+}
+
+func (clientCertAuth ClientCertAuth) forRouteGroup(routeGroup string) negroni.Handler {
+	if !clientCertAuth.Enabled {
+		return nil
+	}
+	return middlewares.NewClientCertAuthMiddleware(clientCertAuth.AllowedIdentities[routeGroup]...)
+}
+
+// SetUpAllRoutes serves the private and the public routes on one handler, distinguished by their hosts.
 func SetUpAllRoutes(privateHost, publicHost string, basicAuthMiddleware *middlewares.BasicAuthMiddleware,
 	signatureVerificationMiddleware *local.SignatureVerificationMiddleware,
+	tokenAuth TokenAuth,
+	clientCertAuth ClientCertAuth,
 	signPackageURLHandler,
 	signDropletURLHandler,
 	signBuildpackURLHandler,
 	signBuildpackCacheURLHandler,
-	signAppStashURLHandler *bitsgo.SignResourceHandler,
+	signAppStashURLHandler,
+	signAppStashEntriesURLHandler,
+	signAppStashBundlesURLHandler *bitsgo.SignResourceHandler,
 	appstashHandler *bitsgo.AppStashHandler,
 	packageHandler, buildpackHandler, dropletHandler, buildpackCacheHandler *bitsgo.ResourceHandler) http.Handler {
 
 	rootRouter := mux.NewRouter()
 
+	rootRouter.Host(privateHost).Handler(SetUpPrivateRoutes(basicAuthMiddleware, tokenAuth, clientCertAuth,
+		signPackageURLHandler, signDropletURLHandler, signBuildpackURLHandler, signBuildpackCacheURLHandler,
+		signAppStashURLHandler, signAppStashEntriesURLHandler, signAppStashBundlesURLHandler,
+		appstashHandler, packageHandler, buildpackHandler, dropletHandler, buildpackCacheHandler))
+
+	rootRouter.Host(publicHost).Handler(SetUpPublicRoutes(signatureVerificationMiddleware,
+		appstashHandler, packageHandler, buildpackHandler, dropletHandler, buildpackCacheHandler))
+
+	rootRouter.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		util.FprintDescriptionAsJSON(w, "Invalid host '%v'. External clients should use hostname '%v.'", r.Host, publicHost)
+	})
+
+	return rootRouter
+}
+
+// SetUpPrivateRoutes returns the handler for the private endpoint, i.e. the unsigned resource routes and the sign routes.
+func SetUpPrivateRoutes(basicAuthMiddleware *middlewares.BasicAuthMiddleware,
+	tokenAuth TokenAuth,
+	clientCertAuth ClientCertAuth,
+	signPackageURLHandler,
+	signDropletURLHandler,
+	signBuildpackURLHandler,
+	signBuildpackCacheURLHandler,
+	signAppStashURLHandler,
+	signAppStashEntriesURLHandler,
+	signAppStashBundlesURLHandler *bitsgo.SignResourceHandler,
+	appstashHandler *bitsgo.AppStashHandler,
+	packageHandler, buildpackHandler, dropletHandler, buildpackCacheHandler *bitsgo.ResourceHandler) http.Handler {
+
 	internalRouter := mux.NewRouter()
-	rootRouter.Host(privateHost).Handler(internalRouter)
 
-	SetUpSignRoute(internalRouter, basicAuthMiddleware,
-		signPackageURLHandler, signDropletURLHandler, signBuildpackURLHandler, signBuildpackCacheURLHandler, signAppStashURLHandler)
+	SetUpSignRoute(withAuth(internalRouter, "/sign", clientCertAuth.forRouteGroup("sign")), basicAuthMiddleware, tokenAuth,
+		signPackageURLHandler, signDropletURLHandler, signBuildpackURLHandler, signBuildpackCacheURLHandler,
+		signAppStashURLHandler, signAppStashEntriesURLHandler, signAppStashBundlesURLHandler)
 
-	SetUpAppStashRoutes(internalRouter, appstashHandler)
-	SetUpPackageRoutes(internalRouter, packageHandler)
-	SetUpBuildpackRoutes(internalRouter, buildpackHandler)
-	SetUpDropletRoutes(internalRouter, dropletHandler)
-	SetUpBuildpackCacheRoutes(internalRouter, buildpackCacheHandler)
+	SetUpAppStashRoutes(withAuth(internalRouter, "/app_stash/", clientCertAuth.forRouteGroup("app_stash"), tokenAuth.forResourceType("app_stash")), appstashHandler)
+	SetUpPackageRoutes(withAuth(internalRouter, "/packages/", clientCertAuth.forRouteGroup("packages"), tokenAuth.forResourceType("packages")), packageHandler)
+	SetUpBuildpackRoutes(withAuth(internalRouter, "/buildpacks/", clientCertAuth.forRouteGroup("buildpacks"), tokenAuth.forResourceType("buildpacks")), buildpackHandler)
+	SetUpDropletRoutes(withAuth(internalRouter, "/droplets/", clientCertAuth.forRouteGroup("droplets"), tokenAuth.forResourceType("droplets")), dropletHandler)
+	SetUpBuildpackCacheRoutes(withAuth(internalRouter, "/buildpack_cache/", clientCertAuth.forRouteGroup("buildpack_cache"), tokenAuth.forResourceType("buildpack_cache")), buildpackCacheHandler)
+
+	return internalRouter
+}
+
+// SetUpPublicRoutes returns the handler for the public endpoint, which only serves signed URLs.
+func SetUpPublicRoutes(signatureVerificationMiddleware *local.SignatureVerificationMiddleware,
+	appstashHandler *bitsgo.AppStashHandler,
+	packageHandler, buildpackHandler, dropletHandler, buildpackCacheHandler *bitsgo.ResourceHandler) http.Handler {
 
 	publicRouter := mux.NewRouter()
-	rootRouter.Host(publicHost).Handler(negroni.New(
-		signatureVerificationMiddleware,
-		negroni.Wrap(publicRouter),
-	))
 	SetUpAppStashRoutes(publicRouter, appstashHandler)
 	SetUpPackageRoutes(publicRouter, packageHandler)
 	SetUpBuildpackRoutes(publicRouter, buildpackHandler)
 	SetUpDropletRoutes(publicRouter, dropletHandler)
 	SetUpBuildpackCacheRoutes(publicRouter, buildpackCacheHandler)
 
-	rootRouter.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusBadRequest)
-		util.FprintDescriptionAsJSON(w, "Invalid host '%v'. External clients should use hostname '%v.'", r.Host, publicHost)
-	})
+	return negroni.New(
+		signatureVerificationMiddleware,
+		negroni.Wrap(publicRouter),
+	)
+}
 
-	return rootRouter
+// WithReadinessRoute serves readiness on /ready in addition to handler. The route does not require authentication.
+func WithReadinessRoute(handler http.Handler, readiness *bitsgo.Readiness) http.Handler {
+	router := mux.NewRouter()
+	router.Path("/ready").Methods("GET").Handler(readiness)
+	router.PathPrefix("/").Handler(handler)
+	return router
+}
+
+// withAuth returns a router for all routes below pathPrefix, which are protected by authMiddlewares.
+// nil middlewares are ignored.
+func withAuth(router *mux.Router, pathPrefix string, authMiddlewares ...negroni.Handler) *mux.Router {
+	handlers := nonNil(authMiddlewares)
+	if len(handlers) == 0 {
+		return router
+	}
+	protectedRouter := mux.NewRouter()
+	router.PathPrefix(pathPrefix).Handler(negroni.New(append(handlers, negroni.Wrap(protectedRouter))...))
+	return protectedRouter
+}
+
+func nonNil(handlers []negroni.Handler) []negroni.Handler {
+	var result []negroni.Handler
+	for _, handler := range handlers {
+		if handler != nil {
+			result = append(result, handler)
+		}
+	}
+	return result
 }
 
 func SetUpAppStashRoutes(router *mux.Router, appStashHandler *bitsgo.AppStashHandler) {
@@ -61,15 +174,21 @@ func SetUpAppStashRoutes(router *mux.Router, appStashHandler *bitsgo.AppStashHan
 }
 
 func SetUpPackageRoutes(router *mux.Router, resourceHandler *bitsgo.ResourceHandler) {
+	router.Path("/packages/{identifier}/upload").Methods("GET").HandlerFunc(delegateTo(resourceHandler.GetUploadJob))
 	setUpDefaultMethodRoutes(router.Path("/packages/{identifier}").Subrouter(), resourceHandler)
 }
 
 func SetUpBuildpackRoutes(router *mux.Router, resourceHandler *bitsgo.ResourceHandler) {
+	router.Path("/buildpacks/{identifier}/upload").Methods("GET").HandlerFunc(delegateTo(resourceHandler.GetUploadJob))
 	setUpDefaultMethodRoutes(router.Path("/buildpacks/{identifier}").Subrouter(), resourceHandler)
 }
 
 func SetUpDropletRoutes(router *mux.Router, resourceHandler *bitsgo.ResourceHandler) {
+	// Uploads from a source_url have a JSON body and no Digest header.
+	router.Path("/droplets/{identifier:[a-z0-9\\-]+}").Methods("PUT").HeadersRegexp("Content-Type", "application/json").HandlerFunc(delegateTo(resourceHandler.CopySourceGuid))
 	router.Path("/droplets/{identifier:[a-z0-9\\-]+}").Methods("PUT").HandlerFunc(delegateTo(resourceHandler.AddOrReplaceWithDigestInHeader))
+	// Must precede the default routes, which would otherwise treat "upload" as part of the identifier.
+	router.Path("/droplets/{identifier:.*}/upload").Methods("GET").HandlerFunc(delegateTo(resourceHandler.GetUploadJob))
 	setUpDefaultMethodRoutes(
 		router.Path("/droplets/{identifier:.*}").Subrouter(), // TODO we could probably be more specific in the regex
 		resourceHandler)
@@ -78,6 +197,7 @@ func SetUpDropletRoutes(router *mux.Router, resourceHandler *bitsgo.ResourceHand
 func SetUpBuildpackCacheRoutes(router *mux.Router, resourceHandler *bitsgo.ResourceHandler) {
 	router.Path("/buildpack_cache/entries").Methods("DELETE").HandlerFunc(delegateTo(resourceHandler.DeleteDir))
 	router.Path("/buildpack_cache/entries/{identifier}").Methods("DELETE").HandlerFunc(delegateTo(resourceHandler.DeleteDir))
+	router.Path("/buildpack_cache/entries/{identifier:.*}/upload").Methods("GET").HandlerFunc(delegateTo(resourceHandler.GetUploadJob))
 	setUpDefaultMethodRoutes(router.Path("/buildpack_cache/entries/{identifier:.*}").Subrouter(), resourceHandler)
 }
 
@@ -92,21 +212,39 @@ func setUpDefaultMethodRoutes(router *mux.Router, handler *bitsgo.ResourceHandle
 
 func SetUpSignRoute(router *mux.Router,
 	basicAuthMiddleware *middlewares.BasicAuthMiddleware,
+	tokenAuth TokenAuth,
 	signPackageURLHandler,
 	signDropletURLHandler,
 	signBuildpackURLHandler,
 	signBuildpackCacheURLHandler,
-	signAppStashURLHandler *bitsgo.SignResourceHandler) {
-	router.Path("/sign/packages/{resource}").Methods("GET").Handler(wrapWith(basicAuthMiddleware, signPackageURLHandler))
-	router.Path("/sign/droplets/{resource:.*}").Methods("GET").Handler(wrapWith(basicAuthMiddleware, signDropletURLHandler))
-	router.Path("/sign/buildpacks/{resource}").Methods("GET").Handler(wrapWith(basicAuthMiddleware, signBuildpackURLHandler))
-	router.Path("/sign/buildpack_cache/entries/{resource:.*}").Methods("GET").Handler(wrapWith(basicAuthMiddleware, signBuildpackCacheURLHandler))
-	router.Path("/sign/app_stash/matches").Methods("GET").Handler(wrapWith(basicAuthMiddleware, signAppStashURLHandler))
+	signAppStashURLHandler,
+	signAppStashEntriesURLHandler,
+	signAppStashBundlesURLHandler *bitsgo.SignResourceHandler) {
+	router.Path("/sign/packages/{resource}").Methods("GET").Handler(wrapWith(tokenAuth.forSigning("packages", basicAuthMiddleware.ForSigningResourceType("packages")), signPackageURLHandler))
+	router.Path("/sign/droplets/{resource:.*}").Methods("GET").Handler(wrapWith(tokenAuth.forSigning("droplets", basicAuthMiddleware.ForSigningResourceType("droplets")), signDropletURLHandler))
+	router.Path("/sign/buildpacks/{resource}").Methods("GET").Handler(wrapWith(tokenAuth.forSigning("buildpacks", basicAuthMiddleware.ForSigningResourceType("buildpacks")), signBuildpackURLHandler))
+	router.Path("/sign/buildpack_cache/entries/{resource:.*}").Methods("GET").Handler(wrapWith(tokenAuth.forSigning("buildpack_cache", basicAuthMiddleware.ForSigningResourceType("buildpack_cache")), signBuildpackCacheURLHandler))
+	router.Path("/sign/app_stash/matches").Methods("GET").Handler(wrapWith(tokenAuth.forSigning("app_stash", basicAuthMiddleware.ForSigningResourceType("app_stash_matches")), signAppStashURLHandler))
+	router.Path("/sign/app_stash/entries").Methods("GET").Handler(wrapWith(tokenAuth.forSigning("app_stash", basicAuthMiddleware.ForSigningResourceType("app_stash_entries")), signAppStashEntriesURLHandler))
+	router.Path("/sign/app_stash/bundles").Methods("GET").Handler(wrapWith(tokenAuth.forSigning("app_stash", basicAuthMiddleware.ForSigningResourceType("app_stash_bundles")), signAppStashBundlesURLHandler))
+	router.Path("/sign").Methods("POST").Handler(negroni.New(
+		// Batches can contain any resource type. Hence, token scopes and signing users' scopes are checked per entry by the BatchSignHandler.
+		tokenAuth.forBatchSigning(basicAuthMiddleware),
+		negroni.Wrap(http.HandlerFunc(bitsgo.NewBatchSignHandler(map[string]*bitsgo.SignResourceHandler{
+			"packages":          signPackageURLHandler,
+			"droplets":          signDropletURLHandler,
+			"buildpacks":        signBuildpackURLHandler,
+			"buildpack_cache":   signBuildpackCacheURLHandler,
+			"app_stash_matches": signAppStashURLHandler,
+			"app_stash_entries": signAppStashEntriesURLHandler,
+			"app_stash_bundles": signAppStashBundlesURLHandler,
+		}).Sign)),
+	))
 }
 
-func wrapWith(basicAuthMiddleware *middlewares.BasicAuthMiddleware, handler *bitsgo.SignResourceHandler) http.Handler {
+func wrapWith(authMiddleware negroni.Handler, handler *bitsgo.SignResourceHandler) http.Handler {
 	return negroni.New(
-		basicAuthMiddleware,
+		authMiddleware,
 		negroni.Wrap(http.HandlerFunc(delegateWithQueryParamsExtractedTo(handler.Sign))),
 	)
 }
@@ -125,8 +263,9 @@ func delegateTo(delegate func(http.ResponseWriter, *http.Request, map[string]str
 
 func delegateWithQueryParamsExtractedTo(delegate func(http.ResponseWriter, *http.Request, map[string]string)) func(http.ResponseWriter, *http.Request) {
 	return func(responseWriter http.ResponseWriter, request *http.Request) {
-		// TODO: make this more generic
-		mux.Vars(request)["verb"] = request.URL.Query().Get("verb")
+		for _, param := range []string{"verb", "expires_in", "max_content_length", "content_digest", "client_ip"} {
+			mux.Vars(request)[param] = request.URL.Query().Get(param)
+		}
 		delegate(responseWriter, request, mux.Vars(request))
 	}
 }
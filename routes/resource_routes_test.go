@@ -11,11 +11,13 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"archive/zip"
 
 	"io/ioutil"
 
+	"github.com/benbjohnson/clock"
 	"github.com/cloudfoundry-incubator/bits-service"
 	"github.com/cloudfoundry-incubator/bits-service/blobstores/decorator"
 	"github.com/cloudfoundry-incubator/bits-service/blobstores/inmemory"
@@ -182,6 +184,41 @@ var _ = Describe("routes", func() {
 				Expect(blobstoreEntries).To(HaveKeyWithValue("th/eg/theguid/checksum", []byte("My test string")))
 			})
 		})
+
+		Context("Upload status (/droplets/{guid}/{checksum}/upload)", func() {
+			It("returns the upload job instead of a droplet", func() {
+				uploadJobs := bitsgo.NewUploadJobRegistry(bitsgo.NewInMemoryUploadJobStore(), time.Hour, clock.New())
+				uploadJobs.Start("droplet", "theguid/checksum", "some-sha1", "some-sha256")
+				router = mux.NewRouter()
+				SetUpDropletRoutes(
+					router,
+					bitsgo.NewResourceHandler(decorator.ForBlobstoreWithPathPartitioning(blobstore), appstashBlobstore, "droplet", statsd.NewMetricsService(), 0).
+						WithUploadJobs(uploadJobs))
+
+				router.ServeHTTP(responseWriter, httptest.NewRequest("GET", "/droplets/theguid/checksum/upload", nil))
+
+				Expect(*responseWriter).To(HaveStatusCodeAndBody(
+					Equal(http.StatusOK),
+					SatisfyAll(
+						ContainSubstring(`"guid":"theguid/checksum"`),
+						ContainSubstring(`"state":"PROCESSING_UPLOAD"`),
+					)))
+			})
+		})
+	})
+
+	Describe("/packages/{guid}/upload", func() {
+		It("returns StatusNotFound when there is no upload job", func() {
+			SetUpPackageRoutes(
+				router,
+				bitsgo.NewResourceHandler(decorator.ForBlobstoreWithPathPartitioning(blobstore), appstashBlobstore, "package", statsd.NewMetricsService(), 0).
+					WithUploadJobs(bitsgo.NewUploadJobRegistry(bitsgo.NewInMemoryUploadJobStore(), time.Hour, clock.New())))
+
+			router.ServeHTTP(responseWriter, httptest.NewRequest("GET", "/packages/theguid/upload", nil))
+
+			Expect(responseWriter.Code).To(Equal(http.StatusNotFound))
+			Expect(responseWriter.Body.String()).To(ContainSubstring("No upload of package 'theguid' found"))
+		})
 	})
 
 	Describe("/buildpacks/{guid}", func() {
@@ -218,6 +255,27 @@ var _ = Describe("routes", func() {
 		})
 	})
 
+	Describe("/ready", func() {
+		It("serves the readiness check next to the other routes", func() {
+			readiness := &bitsgo.Readiness{}
+			SetUpPackageRoutes(router, bitsgo.NewResourceHandler(blobstore, appstashBlobstore, "package", statsd.NewMetricsService(), 0))
+			blobstoreEntries["theguid"] = []byte("thecontent")
+			handler := WithReadinessRoute(router, readiness)
+
+			handler.ServeHTTP(responseWriter, httptest.NewRequest("GET", "/ready", nil))
+			Expect(responseWriter.Code).To(Equal(http.StatusOK))
+
+			responseWriter = httptest.NewRecorder()
+			handler.ServeHTTP(responseWriter, httptest.NewRequest("GET", "/packages/theguid", nil))
+			Expect(*responseWriter).To(HaveStatusCodeAndBody(Equal(http.StatusOK), Equal("thecontent")))
+
+			readiness.StartDraining()
+			responseWriter = httptest.NewRecorder()
+			handler.ServeHTTP(responseWriter, httptest.NewRequest("GET", "/ready", nil))
+			Expect(responseWriter.Code).To(Equal(http.StatusServiceUnavailable))
+		})
+	})
+
 	Describe("/app_stash", func() {
 		BeforeEach(func() {
 			SetUpAppStashRoutes(router, bitsgo.NewAppStashHandlerWithSizeThresholds(blobstore, 0, 0, math.MaxUint64, NewMockMetricsService()))
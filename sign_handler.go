@@ -1,49 +1,349 @@
 package bitsgo
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/pathsigner"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultSignedURLExpiration = 1 * time.Hour
+	MaxBatchSignEntries        = 1000
+	// MaxBatchSignBodySize leaves room for MaxBatchSignEntries entries with long resource names and constraints.
+	MaxBatchSignBodySize = 1 << 20
 )
 
 type ResourceSigner interface {
-	Sign(resource string, method string, expirationTime time.Time) (signedURL string)
+	Sign(resource string, method string, expirationTime time.Time) (signedURL string, err error)
+}
+
+// UnsupportedMethodError means that a ResourceSigner cannot sign URLs for the requested method.
+type UnsupportedMethodError struct {
+	error
+}
+
+func NewUnsupportedMethodError(method string, supportedMethods ...string) *UnsupportedMethodError {
+	return &UnsupportedMethodError{fmt.Errorf("Unsupported verb '%v'. Supported verbs are: %v", method, strings.Join(supportedMethods, ", "))}
+}
+
+// ConstrainedResourceSigner signs URLs which are served by bits-service itself, so that
+// constraints can be enforced by local.SignatureVerificationMiddleware.
+type ConstrainedResourceSigner interface {
+	SignWithConstraints(resource string, method string, expirationTime time.Time, constraints pathsigner.Constraints) (signedURL string, err error)
 }
 
 type SignResourceHandler struct {
 	clock                                clock.Clock
 	putResourceSigner, getResourceSigner ResourceSigner
+	maxExpiration                        time.Duration
+	auditor                              Auditor
+	resourceType                         string
 }
 
 func NewSignResourceHandler(getResourceSigner, putResourceSigner ResourceSigner) *SignResourceHandler {
+	return NewSignResourceHandlerWithMaxExpiration(getResourceSigner, putResourceSigner, DefaultSignedURLExpiration)
+}
+
+// NewSignResourceHandlerWithMaxExpiration creates a SignResourceHandler. The putResourceSigner must sign URLs that are served
+// by bits-service itself. It is also used for HEAD and DELETE, which blobstores cannot sign, and for URLs with constraints.
+func NewSignResourceHandlerWithMaxExpiration(getResourceSigner, putResourceSigner ResourceSigner, maxExpiration time.Duration) *SignResourceHandler {
 	return &SignResourceHandler{
 		getResourceSigner: getResourceSigner,
 		putResourceSigner: putResourceSigner,
 		clock:             clock.New(),
+		maxExpiration:     maxExpiration,
+		auditor:           &NullAuditor{},
 	}
 }
 
+// WithAuditor makes handler audit signing requests as operations on resourceType.
+func (handler *SignResourceHandler) WithAuditor(auditor Auditor, resourceType string) *SignResourceHandler {
+	handler.auditor = auditor
+	handler.resourceType = resourceType
+	return handler
+}
+
+func (handler *SignResourceHandler) newAuditEvent(request *http.Request, resource string, verb string) AuditEvent {
+	event := newAuditEvent(request, AuditOperationSign, handler.resourceType, resource)
+	event.Verb = verb
+	return event
+}
+
 func (handler *SignResourceHandler) Sign(responseWriter http.ResponseWriter, request *http.Request, params map[string]string) {
 	method := params["verb"]
-	var signer ResourceSigner
-
 	if method == "" {
 		method = "get"
 	}
+	auditedResponseWriter := newAuditedResponseWriter(responseWriter, handler.auditor, handler.newAuditEvent(request, params["resource"], method))
+	defer auditedResponseWriter.audit()
+	responseWriter = auditedResponseWriter
 
+	constraints, e := pathsigner.ParseConstraints(params["max_content_length"], params["content_digest"], params["client_ip"])
+	if e != nil {
+		responseWriter.WriteHeader(http.StatusBadRequest)
+		responseWriter.Write([]byte(e.Error()))
+		return
+	}
+	signer, e := handler.signerFor(method, constraints)
+	if e != nil {
+		responseWriter.WriteHeader(http.StatusBadRequest)
+		responseWriter.Write([]byte(e.Error()))
+		return
+	}
+	expiresIn, e := handler.expiresInFrom(params["expires_in"])
+	if e != nil {
+		responseWriter.WriteHeader(http.StatusBadRequest)
+		responseWriter.Write([]byte(e.Error()))
+		return
+	}
+
+	signature, e := signer.Sign(params["resource"], method, handler.clock.Now().Add(expiresIn))
+	if _, isUnsupportedMethod := e.(*UnsupportedMethodError); isUnsupportedMethod {
+		responseWriter.WriteHeader(http.StatusBadRequest)
+		responseWriter.Write([]byte(e.Error()))
+		return
+	}
+	if e != nil {
+		logger.From(request).Errorw("Could not sign URL", "resource", params["resource"], "verb", method, "error", e)
+		responseWriter.WriteHeader(http.StatusInternalServerError)
+		util.FprintDescriptionAndCodeAsJSON(responseWriter, 290009, "Could not sign URL for resource %v", params["resource"])
+		return
+	}
+	fmt.Fprint(responseWriter, signature)
+}
+
+func (handler *SignResourceHandler) signerFor(method string, constraints pathsigner.Constraints) (ResourceSigner, error) {
+	var signer ResourceSigner
 	switch method {
 	case "get":
 		signer = handler.getResourceSigner
-	case "put", "post":
+	case "put", "post", "head", "delete":
 		signer = handler.putResourceSigner
-	default:
-		responseWriter.WriteHeader(http.StatusBadRequest)
-		responseWriter.Write([]byte("Invalid verb: " + method))
+	}
+	if signer == nil {
+		return nil, errors.New("Invalid verb: " + method)
+	}
+	if constraints.IsEmpty() {
+		return signer, nil
+	}
+
+	if (constraints.MaxContentLength != 0 || constraints.ContentDigest != "") && method != "put" && method != "post" {
+		return nil, errors.New("max_content_length and content_digest can only be used with verbs put and post")
+	}
+	constrainedSigner, ok := handler.putResourceSigner.(ConstrainedResourceSigner)
+	if !ok {
+		return nil, errors.New("Constraints are not supported for this resource type")
+	}
+	return &constrainingResourceSigner{constrainedSigner, constraints}, nil
+}
+
+type constrainingResourceSigner struct {
+	delegate    ConstrainedResourceSigner
+	constraints pathsigner.Constraints
+}
+
+func (signer *constrainingResourceSigner) Sign(resource string, method string, expirationTime time.Time) (string, error) {
+	return signer.delegate.SignWithConstraints(resource, method, expirationTime, signer.constraints)
+}
+
+func (handler *SignResourceHandler) expiresInFrom(expiresIn string) (time.Duration, error) {
+	if expiresIn == "" {
+		return handler.boundedExpiresIn(0)
+	}
+	seconds, e := strconv.ParseInt(expiresIn, 10, 64)
+	if e != nil || seconds <= 0 {
+		return 0, errors.New("Invalid expires_in: " + expiresIn + ". Must be a positive number of seconds")
+	}
+	return handler.boundedExpiresIn(seconds)
+}
+
+// boundedExpiresIn returns how long a signed URL should be valid for. When seconds is 0, it defaults to
+// DefaultSignedURLExpiration, or the maximum expiration if that is shorter.
+func (handler *SignResourceHandler) boundedExpiresIn(seconds int64) (time.Duration, error) {
+	if seconds == 0 {
+		if handler.maxExpiration < DefaultSignedURLExpiration {
+			return handler.maxExpiration, nil
+		}
+		return DefaultSignedURLExpiration, nil
+	}
+	if seconds < 0 {
+		return 0, errors.Errorf("Invalid expires_in: %v. Must be a positive number of seconds", seconds)
+	}
+	if time.Duration(seconds)*time.Second > handler.maxExpiration {
+		return 0, errors.Errorf("Invalid expires_in: %v. Must not be greater than %v", seconds, int64(handler.maxExpiration/time.Second))
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+type SignRequest struct {
+	ResourceType string `json:"resource_type"`
+	Resource     string `json:"resource"`
+	Verb         string `json:"verb"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+
+	MaxContentLength int64  `json:"max_content_length,omitempty"`
+	ContentDigest    string `json:"content_digest,omitempty"`
+	ClientIP         string `json:"client_ip,omitempty"`
+}
+
+type SignedURL struct {
+	ResourceType string    `json:"resource_type"`
+	Resource     string    `json:"resource"`
+	Verb         string    `json:"verb"`
+	URL          string    `json:"url"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// SigningAuthorizer decides whether the authenticated client may sign URLs for resourceType and verb.
+type SigningAuthorizer func(resourceType, verb string) bool
+
+// RequestWithSigningAuthorizer attaches authorizer to request, so that BatchSignHandler can check each entry.
+func RequestWithSigningAuthorizer(request *http.Request, authorizer SigningAuthorizer) *http.Request {
+	return util.RequestWithContextValues(request, "signing-authorizer", authorizer)
+}
+
+func signingAuthorizerFrom(request *http.Request) SigningAuthorizer {
+	if authorizer, ok := request.Context().Value("signing-authorizer").(SigningAuthorizer); ok {
+		return authorizer
+	}
+	return nil
+}
+
+// BatchSignHandler signs URLs for many resources in a single request, so that clients don't need to
+// make one round-trip per resource.
+type BatchSignHandler struct {
+	signResourceHandlers map[string]*SignResourceHandler
+}
+
+// NewBatchSignHandler creates a BatchSignHandler that dispatches to the SignResourceHandler registered for each resource_type.
+func NewBatchSignHandler(signResourceHandlers map[string]*SignResourceHandler) *BatchSignHandler {
+	return &BatchSignHandler{signResourceHandlers: signResourceHandlers}
+}
+
+func (handler *BatchSignHandler) Sign(responseWriter http.ResponseWriter, request *http.Request) {
+	// Reading one more byte than allowed tells bodies of exactly MaxBatchSignBodySize from larger ones.
+	body, e := ioutil.ReadAll(io.LimitReader(request.Body, MaxBatchSignBodySize+1))
+	util.PanicOnError(e)
+	if len(body) > MaxBatchSignBodySize {
+		responseWriter.WriteHeader(http.StatusRequestEntityTooLarge)
+		util.FprintDescriptionAsJSON(responseWriter, "The request body must not exceed %v bytes", MaxBatchSignBodySize)
 		return
 	}
 
-	signature := signer.Sign(params["resource"], method, handler.clock.Now().Add(1*time.Hour))
-	fmt.Fprint(responseWriter, signature)
+	var signRequests []SignRequest
+	e = json.Unmarshal(body, &signRequests)
+	if e != nil {
+		logger.From(request).Debugw("Invalid body", "body", string(body), "error", e)
+		responseWriter.WriteHeader(http.StatusUnprocessableEntity)
+		util.FprintDescriptionAsJSON(responseWriter, "Invalid body %s", body)
+		return
+	}
+	if len(signRequests) == 0 {
+		responseWriter.WriteHeader(http.StatusUnprocessableEntity)
+		util.FprintDescriptionAsJSON(responseWriter, "The request is semantically invalid: must be a non-empty array.")
+		return
+	}
+	if len(signRequests) > MaxBatchSignEntries {
+		responseWriter.WriteHeader(http.StatusUnprocessableEntity)
+		util.FprintDescriptionAsJSON(responseWriter, "The request is semantically invalid: must not contain more than %v entries.", MaxBatchSignEntries)
+		return
+	}
+
+	signedURLs := make([]SignedURL, len(signRequests))
+	// Signed URLs are only audited once the whole batch succeeded, since the response does not contain them otherwise.
+	auditors := make([]Auditor, len(signRequests))
+	auditEvents := make([]AuditEvent, len(signRequests))
+	for i, signRequest := range signRequests {
+		signResourceHandler, exists := handler.signResourceHandlers[signRequest.ResourceType]
+		if !exists {
+			responseWriter.WriteHeader(http.StatusBadRequest)
+			util.FprintDescriptionAsJSON(responseWriter, "Invalid resource_type: %v", signRequest.ResourceType)
+			return
+		}
+		// Verbs are case-insensitive, like the verb query parameter of the single URL routes.
+		signRequest.Verb = strings.ToLower(signRequest.Verb)
+		if signRequest.Verb == "" {
+			signRequest.Verb = "get"
+		}
+		auditedResponseWriter := newAuditedResponseWriter(responseWriter, signResourceHandler.auditor,
+			signResourceHandler.newAuditEvent(request, signRequest.Resource, signRequest.Verb))
+		if !handler.signEntry(auditedResponseWriter, request, signResourceHandler, signRequest, &signedURLs[i]) {
+			auditedResponseWriter.audit()
+			return
+		}
+		auditors[i] = signResourceHandler.auditor
+		auditEvents[i] = auditedResponseWriter.event
+	}
+	response, e := json.Marshal(&signedURLs)
+	util.PanicOnError(e)
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.Write(response)
+	for i := range auditEvents {
+		auditors[i].Audit(auditEvents[i].withOutcomeFrom(http.StatusOK))
+	}
+}
+
+// signEntry writes an error response and returns false if signRequest cannot be signed.
+func (handler *BatchSignHandler) signEntry(responseWriter http.ResponseWriter, request *http.Request, signResourceHandler *SignResourceHandler, signRequest SignRequest, signedURL *SignedURL) bool {
+	if authorizer := signingAuthorizerFrom(request); authorizer != nil && !authorizer(signRequest.ResourceType, signRequest.Verb) {
+		responseWriter.WriteHeader(http.StatusForbidden)
+		util.FprintDescriptionAsJSON(responseWriter, "Not allowed to sign %v URLs for %v", signRequest.Verb, signRequest.ResourceType)
+		return false
+	}
+	constraints := pathsigner.Constraints{
+		MaxContentLength: signRequest.MaxContentLength,
+		ContentDigest:    signRequest.ContentDigest,
+		ClientIP:         signRequest.ClientIP,
+	}
+	e := constraints.Validate()
+	if e != nil {
+		responseWriter.WriteHeader(http.StatusBadRequest)
+		util.FprintDescriptionAsJSON(responseWriter, "%v", e)
+		return false
+	}
+	signer, e := signResourceHandler.signerFor(signRequest.Verb, constraints)
+	if e != nil {
+		responseWriter.WriteHeader(http.StatusBadRequest)
+		util.FprintDescriptionAsJSON(responseWriter, "%v", e)
+		return false
+	}
+	expiresIn, e := signResourceHandler.boundedExpiresIn(signRequest.ExpiresIn)
+	if e != nil {
+		responseWriter.WriteHeader(http.StatusBadRequest)
+		util.FprintDescriptionAsJSON(responseWriter, "%v", e)
+		return false
+	}
+
+	expiresAt := signResourceHandler.clock.Now().Add(expiresIn)
+	url, e := signer.Sign(signRequest.Resource, signRequest.Verb, expiresAt)
+	if _, isUnsupportedMethod := e.(*UnsupportedMethodError); isUnsupportedMethod {
+		responseWriter.WriteHeader(http.StatusBadRequest)
+		util.FprintDescriptionAsJSON(responseWriter, "%v", e)
+		return false
+	}
+	if e != nil {
+		logger.From(request).Errorw("Could not sign URL", "resource-type", signRequest.ResourceType, "resource", signRequest.Resource, "verb", signRequest.Verb, "error", e)
+		responseWriter.WriteHeader(http.StatusInternalServerError)
+		util.FprintDescriptionAndCodeAsJSON(responseWriter, 290009, "Could not sign URL for resource %v", signRequest.Resource)
+		return false
+	}
+	*signedURL = SignedURL{
+		ResourceType: signRequest.ResourceType,
+		Resource:     signRequest.Resource,
+		Verb:         signRequest.Verb,
+		URL:          url,
+		ExpiresAt:    expiresAt.UTC(),
+	}
+	return true
 }
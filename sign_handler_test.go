@@ -1,13 +1,19 @@
 package bitsgo_test
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"time"
 
+	"github.com/benbjohnson/clock"
 	"github.com/cloudfoundry-incubator/bits-service"
+	"github.com/cloudfoundry-incubator/bits-service/blobstores/local"
 	"github.com/cloudfoundry-incubator/bits-service/httputil"
+	"github.com/cloudfoundry-incubator/bits-service/pathsigner"
 	. "github.com/petergtz/pegomock"
 )
 
@@ -30,7 +36,7 @@ var _ = Describe("SignResourceHandler", func() {
 	})
 
 	It("Signs a GET URL", func() {
-		When(getSigner.Sign(AnyString(), AnyString(), AnyTime())).ThenReturn("Some get signature")
+		When(getSigner.Sign(AnyString(), AnyString(), AnyTime())).ThenReturn("Some get signature", nil)
 		handler := bitsgo.NewSignResourceHandler(getSigner, putSigner)
 		request := httputil.NewRequest("GET", "/foo", nil).Build()
 
@@ -51,7 +57,7 @@ var _ = Describe("SignResourceHandler", func() {
 	})
 
 	It("Signs a PUT URL", func() {
-		When(putSigner.Sign(AnyString(), AnyString(), AnyTime())).ThenReturn("Some put signature")
+		When(putSigner.Sign(AnyString(), AnyString(), AnyTime())).ThenReturn("Some put signature", nil)
 
 		handler := bitsgo.NewSignResourceHandler(getSigner, putSigner)
 		request := httputil.NewRequest("PUT", "/bar", nil).Build()
@@ -60,4 +66,337 @@ var _ = Describe("SignResourceHandler", func() {
 		Expect(recorder.Code).To(Equal(http.StatusOK))
 		Expect(recorder.Body.String()).To(Equal("Some put signature"))
 	})
+
+	Context("Signer returns an error", func() {
+		It("Responds with 500 and a JSON error", func() {
+			When(getSigner.Sign(AnyString(), AnyString(), AnyTime())).ThenReturn("", errors.New("some signing error"))
+
+			handler := bitsgo.NewSignResourceHandler(getSigner, putSigner)
+			request := httputil.NewRequest("GET", "/foo", nil).Build()
+
+			handler.Sign(recorder, request, map[string]string{"verb": "get", "resource": "bar"})
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+			Expect(recorder.Body.String()).To(MatchJSON(`{"description":"Could not sign URL for resource bar","code":290009}`))
+			Expect(recorder.Body.String()).NotTo(ContainSubstring("some signing error"))
+		})
+	})
+
+	Context("Signer does not support the verb", func() {
+		It("Responds with 400", func() {
+			When(putSigner.Sign(AnyString(), AnyString(), AnyTime())).ThenReturn("", bitsgo.NewUnsupportedMethodError("delete", "get", "put"))
+
+			handler := bitsgo.NewSignResourceHandler(getSigner, putSigner)
+			request := httputil.NewRequest("GET", "/foo", nil).Build()
+
+			handler.Sign(recorder, request, map[string]string{"verb": "delete", "resource": "bar"})
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(recorder.Body.String()).To(Equal("Unsupported verb 'delete'. Supported verbs are: get, put"))
+		})
+	})
+
+	It("Signs HEAD and DELETE URLs with the put signer", func() {
+		When(putSigner.Sign(AnyString(), AnyString(), AnyTime())).ThenReturn("Some local signature", nil)
+		handler := bitsgo.NewSignResourceHandler(getSigner, putSigner)
+
+		handler.Sign(recorder, httputil.NewRequest("GET", "/foo", nil).Build(), map[string]string{"verb": "head", "resource": "bar"})
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Body.String()).To(Equal("Some local signature"))
+
+		recorder = httptest.NewRecorder()
+		handler.Sign(recorder, httputil.NewRequest("GET", "/foo", nil).Build(), map[string]string{"verb": "delete", "resource": "bar"})
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Body.String()).To(Equal("Some local signature"))
+
+		putSigner.VerifyWasCalledOnce().Sign(EqString("bar"), EqString("head"), AnyTime())
+		putSigner.VerifyWasCalledOnce().Sign(EqString("bar"), EqString("delete"), AnyTime())
+		getSigner.VerifyWasCalled(Never()).Sign(AnyString(), AnyString(), AnyTime())
+	})
+
+	Context("constraints", func() {
+		var (
+			pathSignerValidator *pathsigner.PathSignerValidator
+			handler             *bitsgo.SignResourceHandler
+		)
+
+		BeforeEach(func() {
+			pathSignerValidator = &pathsigner.PathSignerValidator{Secrets: map[string]string{"key1": "geheim"}, ActiveKeyID: "key1", Clock: clock.NewMock()}
+			localResourceSigner := &local.LocalResourceSigner{Signer: pathSignerValidator, ResourcePathPrefix: "/packages/", DelegateEndpoint: "https://public"}
+			handler = bitsgo.NewSignResourceHandler(getSigner, localResourceSigner)
+		})
+
+		It("embeds them in the signed URL", func() {
+			handler.Sign(recorder, httputil.NewRequest("GET", "/foo", nil).Build(), map[string]string{
+				"verb": "put", "resource": "bar", "max_content_length": "1024", "client_ip": "10.0.0.0/8"})
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			signedURL := httputil.MustParse(recorder.Body.String())
+			Expect(signedURL.Path).To(Equal("/packages/bar"))
+			Expect(pathsigner.ConstraintsFrom(signedURL)).To(Equal(pathsigner.Constraints{MaxContentLength: 1024, ClientIP: "10.0.0.0/8"}))
+			Expect(pathSignerValidator.SignatureValid("PUT", signedURL)).To(BeTrue())
+		})
+
+		It("signs constrained GET URLs with the local signer", func() {
+			handler.Sign(recorder, httputil.NewRequest("GET", "/foo", nil).Build(), map[string]string{"verb": "get", "resource": "bar", "client_ip": "10.0.0.1"})
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(HavePrefix("https://public/packages/bar?"))
+			getSigner.VerifyWasCalled(Never()).Sign(AnyString(), AnyString(), AnyTime())
+		})
+
+		It("responds with 400 when a constraint is invalid", func() {
+			handler.Sign(recorder, httputil.NewRequest("GET", "/foo", nil).Build(), map[string]string{"verb": "put", "resource": "bar", "client_ip": "not-an-ip"})
+
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(recorder.Body.String()).To(ContainSubstring("Invalid client_ip"))
+		})
+
+		It("responds with 400 when a content constraint is used with a verb without body", func() {
+			handler.Sign(recorder, httputil.NewRequest("GET", "/foo", nil).Build(), map[string]string{"verb": "get", "resource": "bar", "max_content_length": "10"})
+
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("responds with 400 when the signer does not support constraints", func() {
+			handler = bitsgo.NewSignResourceHandler(getSigner, putSigner)
+
+			handler.Sign(recorder, httputil.NewRequest("GET", "/foo", nil).Build(), map[string]string{"verb": "put", "resource": "bar", "client_ip": "10.0.0.1"})
+
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(recorder.Body.String()).To(Equal("Constraints are not supported for this resource type"))
+		})
+	})
+
+	Context("expires_in", func() {
+		var handler *bitsgo.SignResourceHandler
+
+		BeforeEach(func() {
+			When(getSigner.Sign(AnyString(), AnyString(), AnyTime())).ThenReturn("Some get signature", nil)
+			handler = bitsgo.NewSignResourceHandlerWithMaxExpiration(getSigner, putSigner, 24*time.Hour)
+		})
+
+		It("signs for the requested duration", func() {
+			handler.Sign(recorder, httputil.NewRequest("GET", "/foo", nil).Build(), map[string]string{"verb": "get", "resource": "bar", "expires_in": "7200"})
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			_, _, expirationTime := getSigner.VerifyWasCalledOnce().Sign(AnyString(), AnyString(), AnyTime()).GetCapturedArguments()
+			Expect(expirationTime).To(BeTemporally("~", time.Now().Add(2*time.Hour), time.Minute))
+		})
+
+		It("defaults to 1 hour", func() {
+			handler.Sign(recorder, httputil.NewRequest("GET", "/foo", nil).Build(), map[string]string{"verb": "get", "resource": "bar"})
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			_, _, expirationTime := getSigner.VerifyWasCalledOnce().Sign(AnyString(), AnyString(), AnyTime()).GetCapturedArguments()
+			Expect(expirationTime).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+		})
+
+		It("defaults to the maximum when it is shorter than 1 hour", func() {
+			handler = bitsgo.NewSignResourceHandlerWithMaxExpiration(getSigner, putSigner, 10*time.Minute)
+
+			handler.Sign(recorder, httputil.NewRequest("GET", "/foo", nil).Build(), map[string]string{"verb": "get", "resource": "bar"})
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			_, _, expirationTime := getSigner.VerifyWasCalledOnce().Sign(AnyString(), AnyString(), AnyTime()).GetCapturedArguments()
+			Expect(expirationTime).To(BeTemporally("~", time.Now().Add(10*time.Minute), time.Minute))
+		})
+
+		It("responds with 400 when it exceeds the maximum", func() {
+			handler.Sign(recorder, httputil.NewRequest("GET", "/foo", nil).Build(), map[string]string{"verb": "get", "resource": "bar", "expires_in": "86401"})
+
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(recorder.Body.String()).To(Equal("Invalid expires_in: 86401. Must not be greater than 86400"))
+			getSigner.VerifyWasCalled(Never()).Sign(AnyString(), AnyString(), AnyTime())
+		})
+
+		It("responds with 400 when it is not a positive number", func() {
+			handler.Sign(recorder, httputil.NewRequest("GET", "/foo", nil).Build(), map[string]string{"verb": "get", "resource": "bar", "expires_in": "-5"})
+
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(recorder.Body.String()).To(ContainSubstring("Invalid expires_in: -5"))
+		})
+	})
+
+	Context("No signer for verb", func() {
+		It("Responds with 400 instead of panicking", func() {
+			handler := bitsgo.NewSignResourceHandler(nil, putSigner)
+
+			handler.Sign(recorder, httputil.NewRequest("GET", "/foo", nil).Build(), map[string]string{"verb": "get", "resource": "bar"})
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(recorder.Body.String()).To(Equal("Invalid verb: get"))
+		})
+	})
+})
+
+var _ = Describe("BatchSignHandler", func() {
+	var (
+		packageSigner *MockResourceSigner
+		dropletSigner *MockResourceSigner
+		handler       *bitsgo.BatchSignHandler
+		recorder      *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		packageSigner = NewMockResourceSigner()
+		dropletSigner = NewMockResourceSigner()
+		handler = bitsgo.NewBatchSignHandler(map[string]*bitsgo.SignResourceHandler{
+			"packages": bitsgo.NewSignResourceHandlerWithMaxExpiration(packageSigner, packageSigner, 24*time.Hour),
+			"droplets": bitsgo.NewSignResourceHandlerWithMaxExpiration(dropletSigner, dropletSigner, 24*time.Hour),
+		})
+		recorder = httptest.NewRecorder()
+	})
+
+	It("signs all resources and returns them with their expiry", func() {
+		When(packageSigner.Sign(AnyString(), AnyString(), AnyTime())).ThenReturn("https://signed/package", nil)
+		When(dropletSigner.Sign(AnyString(), AnyString(), AnyTime())).ThenReturn("https://signed/droplet", nil)
+
+		handler.Sign(recorder, httputil.NewRequest("POST", "/sign", strings.NewReader(`[
+			{"resource_type": "packages", "resource": "pguid", "verb": "put"},
+			{"resource_type": "droplets", "resource": "dguid/sha", "expires_in": 7200}
+		]`)).Build())
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		var signedURLs []bitsgo.SignedURL
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &signedURLs)).To(Succeed())
+		Expect(signedURLs).To(HaveLen(2))
+
+		Expect(signedURLs[0].ResourceType).To(Equal("packages"))
+		Expect(signedURLs[0].Resource).To(Equal("pguid"))
+		Expect(signedURLs[0].Verb).To(Equal("put"))
+		Expect(signedURLs[0].URL).To(Equal("https://signed/package"))
+		Expect(signedURLs[0].ExpiresAt).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+
+		Expect(signedURLs[1].Verb).To(Equal("get"))
+		Expect(signedURLs[1].URL).To(Equal("https://signed/droplet"))
+		Expect(signedURLs[1].ExpiresAt).To(BeTemporally("~", time.Now().Add(2*time.Hour), time.Minute))
+
+		resource, verb, _ := dropletSigner.VerifyWasCalledOnce().Sign(AnyString(), AnyString(), AnyTime()).GetCapturedArguments()
+		Expect(resource).To(Equal("dguid/sha"))
+		Expect(verb).To(Equal("get"))
+	})
+
+	It("responds with 400 when a resource_type is unknown", func() {
+		handler.Sign(recorder, httputil.NewRequest("POST", "/sign", strings.NewReader(
+			`[{"resource_type": "packages", "resource": "pguid"}, {"resource_type": "unknown", "resource": "guid"}]`)).Build())
+
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		Expect(recorder.Body.String()).To(MatchJSON(`{"description":"Invalid resource_type: unknown"}`))
+	})
+
+	It("responds with 400 when expires_in exceeds the maximum", func() {
+		handler.Sign(recorder, httputil.NewRequest("POST", "/sign", strings.NewReader(
+			`[{"resource_type": "packages", "resource": "pguid", "expires_in": 86401}]`)).Build())
+
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		Expect(recorder.Body.String()).To(ContainSubstring("Must not be greater than 86400"))
+	})
+
+	It("responds with 400 when a signer does not support a verb", func() {
+		When(dropletSigner.Sign(AnyString(), AnyString(), AnyTime())).ThenReturn("", bitsgo.NewUnsupportedMethodError("head", "get", "put"))
+
+		handler.Sign(recorder, httputil.NewRequest("POST", "/sign", strings.NewReader(
+			`[{"resource_type": "droplets", "resource": "dguid", "verb": "head"}]`)).Build())
+
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		Expect(recorder.Body.String()).To(MatchJSON(`{"description":"Unsupported verb 'head'. Supported verbs are: get, put"}`))
+	})
+
+	It("treats verbs case-insensitively", func() {
+		When(packageSigner.Sign(AnyString(), AnyString(), AnyTime())).ThenReturn("https://signed/package", nil)
+		var authorizedVerb string
+		request := bitsgo.RequestWithSigningAuthorizer(
+			httputil.NewRequest("POST", "/sign", strings.NewReader(`[{"resource_type": "packages", "resource": "pguid", "verb": "PUT"}]`)).Build(),
+			func(resourceType, verb string) bool {
+				authorizedVerb = verb
+				return true
+			})
+
+		handler.Sign(recorder, request)
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(authorizedVerb).To(Equal("put"))
+		_, verb, _ := packageSigner.VerifyWasCalledOnce().Sign(AnyString(), AnyString(), AnyTime()).GetCapturedArguments()
+		Expect(verb).To(Equal("put"))
+	})
+
+	It("responds with 413 when the body is too large", func() {
+		handler.Sign(recorder, httputil.NewRequest("POST", "/sign", strings.NewReader(
+			`[{"resource_type": "packages", "resource": "`+strings.Repeat("x", bitsgo.MaxBatchSignBodySize)+`"}]`)).Build())
+
+		Expect(recorder.Code).To(Equal(http.StatusRequestEntityTooLarge))
+		packageSigner.VerifyWasCalled(Never()).Sign(AnyString(), AnyString(), AnyTime())
+	})
+
+	It("responds with 403 when the signing authorizer does not allow an entry", func() {
+		request := bitsgo.RequestWithSigningAuthorizer(
+			httputil.NewRequest("POST", "/sign", strings.NewReader(
+				`[{"resource_type": "packages", "resource": "pguid", "verb": "put"}, {"resource_type": "droplets", "resource": "dguid", "verb": "put"}]`)).Build(),
+			func(resourceType, verb string) bool { return resourceType == "packages" })
+
+		handler.Sign(recorder, request)
+
+		Expect(recorder.Code).To(Equal(http.StatusForbidden))
+		Expect(recorder.Body.String()).To(MatchJSON(`{"description":"Not allowed to sign put URLs for droplets"}`))
+		dropletSigner.VerifyWasCalled(Never()).Sign(AnyString(), AnyString(), AnyTime())
+	})
+
+	Context("auditing", func() {
+		var auditor *MockAuditor
+
+		BeforeEach(func() {
+			auditor = NewMockAuditor()
+			handler = bitsgo.NewBatchSignHandler(map[string]*bitsgo.SignResourceHandler{
+				"packages": bitsgo.NewSignResourceHandlerWithMaxExpiration(packageSigner, packageSigner, 24*time.Hour).WithAuditor(auditor, "packages"),
+			})
+		})
+
+		It("audits every signed URL", func() {
+			When(packageSigner.Sign(AnyString(), AnyString(), AnyTime())).ThenReturn("https://signed/package", nil)
+
+			handler.Sign(recorder, httputil.NewRequest("POST", "/sign", strings.NewReader(
+				`[{"resource_type": "packages", "resource": "pguid1", "verb": "put"}, {"resource_type": "packages", "resource": "pguid2"}]`)).Build())
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			events := auditor.VerifyWasCalled(Times(2)).Audit(anyAuditEvent()).GetAllCapturedArguments()
+			Expect(events[0].Operation).To(Equal("sign"))
+			Expect(events[0].ResourceType).To(Equal("packages"))
+			Expect(events[0].Identifier).To(Equal("pguid1"))
+			Expect(events[0].Verb).To(Equal("put"))
+			Expect(events[0].Outcome).To(Equal("success"))
+			Expect(events[1].Identifier).To(Equal("pguid2"))
+			Expect(events[1].Verb).To(Equal("get"))
+		})
+
+		It("only audits the failing entry when an entry cannot be signed", func() {
+			handler.Sign(recorder, httputil.NewRequest("POST", "/sign", strings.NewReader(
+				`[{"resource_type": "packages", "resource": "pguid1"}, {"resource_type": "packages", "resource": "pguid2", "verb": "patch"}]`)).Build())
+
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			event := auditor.VerifyWasCalledOnce().Audit(anyAuditEvent()).GetCapturedArguments()
+			Expect(event.Identifier).To(Equal("pguid2"))
+			Expect(event.Outcome).To(Equal("failure"))
+			Expect(event.StatusCode).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	It("responds with 422 when the body is not a JSON array", func() {
+		handler.Sign(recorder, httputil.NewRequest("POST", "/sign", strings.NewReader(`{"resource_type": "packages"}`)).Build())
+
+		Expect(recorder.Code).To(Equal(http.StatusUnprocessableEntity))
+	})
+
+	It("responds with 422 when the array is empty", func() {
+		handler.Sign(recorder, httputil.NewRequest("POST", "/sign", strings.NewReader(`[]`)).Build())
+
+		Expect(recorder.Code).To(Equal(http.StatusUnprocessableEntity))
+		Expect(recorder.Body.String()).To(ContainSubstring("must be a non-empty array"))
+	})
+
+	It("responds with 500 and a JSON error when signing fails", func() {
+		When(packageSigner.Sign(AnyString(), AnyString(), AnyTime())).ThenReturn("", errors.New("some signing error"))
+
+		handler.Sign(recorder, httputil.NewRequest("POST", "/sign", strings.NewReader(`[{"resource_type": "packages", "resource": "pguid"}]`)).Build())
+
+		Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+		Expect(recorder.Body.String()).To(MatchJSON(`{"description":"Could not sign URL for resource pguid","code":290009}`))
+	})
 })
@@ -0,0 +1,200 @@
+package bitsgo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SourceURLFetcher downloads the content of uploads from a source_url. It only fetches from hosts on its allowlist
+// and, unless private networks are allowed, never connects to loopback, link-local or private addresses. This
+// prevents clients from making the service request internal endpoints on their behalf.
+type SourceURLFetcher struct {
+	allowedHosts []string
+	maxSize      uint64
+	httpClient   *http.Client
+}
+
+// NewSourceURLFetcher creates a fetcher for allowedHosts, which are host names like "github.com" or wildcards like
+// "*.githubusercontent.com". Content larger than maxSize is rejected, unless maxSize is 0.
+func NewSourceURLFetcher(allowedHosts []string, maxSize uint64, timeout time.Duration, allowPrivateNetworks bool) *SourceURLFetcher {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivateNetworks {
+		dialer.Control = denyPrivateAddresses
+	}
+	fetcher := &SourceURLFetcher{allowedHosts: allowedHosts, maxSize: maxSize}
+	fetcher.httpClient = &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		Timeout:       timeout,
+		CheckRedirect: fetcher.checkRedirect,
+	}
+	return fetcher
+}
+
+// sourceURLError carries the status code with which the request for the upload should be answered.
+type sourceURLError struct {
+	error
+	statusCode int
+}
+
+// Validate returns an error if sourceURL is not an http(s) URL on an allowed host.
+func (fetcher *SourceURLFetcher) Validate(sourceURL string) error {
+	u, e := url.Parse(sourceURL)
+	if e != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return &sourceURLError{fmt.Errorf("source_url must be an http or https URL"), http.StatusBadRequest}
+	}
+	if !fetcher.allowed(u.Hostname()) {
+		return &sourceURLError{fmt.Errorf("Host '%v' of source_url is not allowed", u.Hostname()), http.StatusBadRequest}
+	}
+	return nil
+}
+
+func (fetcher *SourceURLFetcher) allowed(host string) bool {
+	host = strings.ToLower(host)
+	for _, allowedHost := range fetcher.allowedHosts {
+		allowedHost = strings.ToLower(allowedHost)
+		if host == allowedHost ||
+			(strings.HasPrefix(allowedHost, "*.") && strings.HasSuffix(host, allowedHost[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+func (fetcher *SourceURLFetcher) checkRedirect(request *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return &sourceURLError{fmt.Errorf("source_url redirected too often"), http.StatusBadGateway}
+	}
+	return fetcher.Validate(request.URL.String())
+}
+
+// Fetch downloads sourceURL into a temp file, which the caller must remove. It fails if the content is larger than
+// maxSize or, if expectedSha256 is not empty, if its SHA256 does not match.
+func (fetcher *SourceURLFetcher) Fetch(ctx context.Context, sourceURL string, headers map[string]string, expectedSha256 string, maxSize uint64) (tempFilename string, e error) {
+	e = fetcher.Validate(sourceURL)
+	if e != nil {
+		return "", e
+	}
+	if fetcher.maxSize != 0 && (maxSize == 0 || fetcher.maxSize < maxSize) {
+		maxSize = fetcher.maxSize
+	}
+
+	request, e := http.NewRequest("GET", sourceURL, nil)
+	if e != nil {
+		return "", &sourceURLError{errors.Wrap(e, "Invalid source_url"), http.StatusBadRequest}
+	}
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	response, e := fetcher.httpClient.Do(request.WithContext(ctx))
+	if e != nil {
+		if sourceURLErr := asSourceURLError(e); sourceURLErr != nil {
+			return "", sourceURLErr
+		}
+		return "", &sourceURLError{errors.Wrap(e, "Could not fetch source_url"), http.StatusBadGateway}
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, response.Body)
+		return "", &sourceURLError{fmt.Errorf("source_url responded with status code %v", response.StatusCode), http.StatusBadGateway}
+	}
+	if maxSize != 0 && response.ContentLength > int64(maxSize) {
+		return "", sourceTooLarge(maxSize)
+	}
+
+	tempFile, e := ioutil.TempFile("", "bits")
+	if e != nil {
+		return "", errors.WithStack(e)
+	}
+	defer tempFile.Close()
+	sha256Hash := sha256.New()
+	body := io.Reader(response.Body)
+	if maxSize != 0 {
+		body = io.LimitReader(response.Body, int64(maxSize)+1)
+	}
+	size, e := io.Copy(io.MultiWriter(tempFile, sha256Hash), body)
+	switch {
+	case e != nil:
+		e = &sourceURLError{errors.Wrap(e, "Could not read content of source_url"), http.StatusBadGateway}
+	case maxSize != 0 && uint64(size) > maxSize:
+		e = sourceTooLarge(maxSize)
+	case expectedSha256 != "" && !strings.EqualFold(hex.EncodeToString(sha256Hash.Sum(nil)), expectedSha256):
+		e = &sourceURLError{fmt.Errorf("Content of source_url has SHA256 %v instead of the expected %v",
+			hex.EncodeToString(sha256Hash.Sum(nil)), expectedSha256), http.StatusUnprocessableEntity}
+	}
+	if e != nil {
+		os.Remove(tempFile.Name())
+		return "", e
+	}
+	return tempFile.Name(), nil
+}
+
+func sourceTooLarge(maxSize uint64) error {
+	return &sourceURLError{fmt.Errorf("Content of source_url exceeds the maximum size of %v bytes", maxSize), http.StatusRequestEntityTooLarge}
+}
+
+// asSourceURLError finds errors of CheckRedirect and the dialer's Control, which the http client wraps.
+func asSourceURLError(e error) *sourceURLError {
+	for {
+		switch wrapped := e.(type) {
+		case *sourceURLError:
+			return wrapped
+		case *url.Error:
+			e = wrapped.Err
+		case *net.OpError:
+			e = wrapped.Err
+		default:
+			return nil
+		}
+	}
+}
+
+var privateNetworks = mustParseCIDRs(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12", "192.168.0.0/16",
+	"::/128", "::1/128", "fc00::/7", "fe80::/10")
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, e := net.ParseCIDR(cidr)
+		if e != nil {
+			panic(e)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// denyPrivateAddresses checks the resolved address, so that allowed host names which resolve to internal addresses
+// cannot be used either.
+func denyPrivateAddresses(network string, address string, _ syscall.RawConn) error {
+	host, _, e := net.SplitHostPort(address)
+	if e != nil {
+		return e
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errors.Errorf("Unexpected address %v", address)
+	}
+	for _, privateNetwork := range privateNetworks {
+		if privateNetwork.Contains(ip) {
+			return &sourceURLError{fmt.Errorf("source_url resolves to the private address %v, which is not allowed", host), http.StatusBadRequest}
+		}
+	}
+	return nil
+}
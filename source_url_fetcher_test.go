@@ -0,0 +1,54 @@
+package bitsgo_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/cloudfoundry-incubator/bits-service"
+)
+
+var _ = Describe("SourceURLFetcher", func() {
+	It("only allows http(s) URLs on allowed hosts", func() {
+		fetcher := NewSourceURLFetcher([]string{"github.com", "*.githubusercontent.com"}, 0, time.Second, false)
+
+		Expect(fetcher.Validate("https://github.com/cloudfoundry/buildpack.zip")).To(Succeed())
+		Expect(fetcher.Validate("https://objects.GitHubUserContent.com/buildpack.zip")).To(Succeed())
+		Expect(fetcher.Validate("https://githubusercontent.com/buildpack.zip")).NotTo(Succeed())
+		Expect(fetcher.Validate("https://github.com.evil.com/buildpack.zip")).NotTo(Succeed())
+		Expect(fetcher.Validate("file:///etc/passwd")).NotTo(Succeed())
+		Expect(fetcher.Validate("ftp://github.com/buildpack.zip")).NotTo(Succeed())
+	})
+
+	Context("private networks are not allowed", func() {
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+				fmt.Fprint(responseWriter, "content")
+			}))
+		})
+
+		AfterEach(func() { server.Close() })
+
+		It("refuses to connect to allowed hosts which resolve to loopback addresses", func() {
+			fetcher := NewSourceURLFetcher([]string{"127.0.0.1"}, 0, time.Second, false)
+
+			_, e := fetcher.Fetch(context.Background(), server.URL, nil, "", 0)
+
+			Expect(e).To(MatchError(ContainSubstring("private address 127.0.0.1")))
+		})
+
+		It("refuses redirects to hosts which are not allowed", func() {
+			redirectingServer := httptest.NewServer(http.RedirectHandler("http://localhost:1234/content", http.StatusFound))
+			defer redirectingServer.Close()
+			fetcher := NewSourceURLFetcher([]string{"127.0.0.1"}, 0, time.Second, true)
+
+			_, e := fetcher.Fetch(context.Background(), redirectingServer.URL, nil, "", 0)
+
+			Expect(e).To(MatchError(ContainSubstring("Host 'localhost' of source_url is not allowed")))
+		})
+	})
+})
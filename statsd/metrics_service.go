@@ -32,3 +32,9 @@ func (service *MetricsService) SendGaugeMetric(name string, value int64) {
 func (service *MetricsService) SendCounterMetric(name string, value int64) {
 	service.statsdClient.Count(service.prefix+name, value)
 }
+
+// Close sends buffered metrics.
+func (service *MetricsService) Close() {
+	service.statsdClient.Flush()
+	service.statsdClient.Close()
+}
@@ -0,0 +1,271 @@
+package bitsgo
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+)
+
+const (
+	UploadJobStateProcessing = "PROCESSING_UPLOAD"
+	UploadJobStateReady      = "READY"
+	UploadJobStateFailed     = "FAILED"
+)
+
+// UploadJob is the status of an async upload.
+type UploadJob struct {
+	Guid             string     `json:"guid"`
+	ResourceType     string     `json:"resource_type"`
+	State            string     `json:"state"`
+	BytesTransferred int64      `json:"bytes_transferred"`
+	Sha1             string     `json:"sha1"`
+	Sha256           string     `json:"sha256"`
+	Error            string     `json:"error,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	CompletedAt      *time.Time `json:"completed_at,omitempty"`
+}
+
+// UploadJobStore persists upload jobs. Implementations must be safe for concurrent use.
+type UploadJobStore interface {
+	Save(job UploadJob) error
+	// Load returns *NotFoundError if there is no job for resourceType and guid.
+	Load(resourceType string, guid string) (UploadJob, error)
+	Delete(resourceType string, guid string) error
+	List() ([]UploadJob, error)
+}
+
+type InMemoryUploadJobStore struct {
+	mutex sync.RWMutex
+	jobs  map[string]UploadJob
+}
+
+func NewInMemoryUploadJobStore() *InMemoryUploadJobStore {
+	return &InMemoryUploadJobStore{jobs: make(map[string]UploadJob)}
+}
+
+func (store *InMemoryUploadJobStore) Save(job UploadJob) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.jobs[uploadJobKey(job.ResourceType, job.Guid)] = job
+	return nil
+}
+
+func (store *InMemoryUploadJobStore) Load(resourceType string, guid string) (UploadJob, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	job, exists := store.jobs[uploadJobKey(resourceType, guid)]
+	if !exists {
+		return UploadJob{}, NewNotFoundErrorWithKey(uploadJobKey(resourceType, guid))
+	}
+	return job, nil
+}
+
+func (store *InMemoryUploadJobStore) Delete(resourceType string, guid string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.jobs, uploadJobKey(resourceType, guid))
+	return nil
+}
+
+func (store *InMemoryUploadJobStore) List() ([]UploadJob, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	jobs := make([]UploadJob, 0, len(store.jobs))
+	for _, job := range store.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs, nil
+}
+
+func uploadJobKey(resourceType string, guid string) string {
+	return resourceType + "/" + guid
+}
+
+// UploadJobRegistry tracks async uploads of all resource types. Completed jobs are removed once they
+// are older than the retention.
+type UploadJobRegistry struct {
+	store     UploadJobStore
+	retention time.Duration
+	clock     clock.Clock
+
+	mutex    sync.Mutex
+	progress map[string]*int64
+}
+
+func NewUploadJobRegistry(store UploadJobStore, retention time.Duration, clock clock.Clock) *UploadJobRegistry {
+	return &UploadJobRegistry{
+		store:     store,
+		retention: retention,
+		clock:     clock,
+		progress:  make(map[string]*int64),
+	}
+}
+
+// Start records a new job in state PROCESSING_UPLOAD, replacing any previous job for the same resource.
+func (registry *UploadJobRegistry) Start(resourceType, guid, sha1, sha256 string) *UploadJobTracker {
+	now := registry.clock.Now().UTC()
+	job := UploadJob{
+		Guid:         guid,
+		ResourceType: resourceType,
+		State:        UploadJobStateProcessing,
+		Sha1:         sha1,
+		Sha256:       sha256,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	tracker := &UploadJobTracker{registry: registry, job: job}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	registry.progress[uploadJobKey(resourceType, guid)] = &tracker.bytesTransferred
+	e := registry.store.Save(job)
+	if e != nil {
+		logger.Log.Errorw("Could not save upload job", "resource-type", resourceType, "guid", guid, "error", e)
+	}
+	return tracker
+}
+
+// Get returns the job with the bytes transferred so far. It returns *NotFoundError if there is no such job.
+func (registry *UploadJobRegistry) Get(resourceType, guid string) (UploadJob, error) {
+	job, e := registry.store.Load(resourceType, guid)
+	if e != nil {
+		return UploadJob{}, e
+	}
+	registry.mutex.Lock()
+	bytesTransferred, inProgress := registry.progress[uploadJobKey(resourceType, guid)]
+	registry.mutex.Unlock()
+	if inProgress && job.State == UploadJobStateProcessing {
+		job.BytesTransferred = atomic.LoadInt64(bytesTransferred)
+	}
+	return job, nil
+}
+
+// RemoveExpired deletes completed jobs which completed longer than the retention ago.
+// Jobs which are still processing are kept.
+func (registry *UploadJobRegistry) RemoveExpired() {
+	jobs, e := registry.store.List()
+	if e != nil {
+		logger.Log.Errorw("Could not list upload jobs", "error", e)
+		return
+	}
+	expiry := registry.clock.Now().Add(-registry.retention)
+	for _, job := range jobs {
+		if job.CompletedAt == nil || job.CompletedAt.After(expiry) {
+			continue
+		}
+		e = registry.store.Delete(job.ResourceType, job.Guid)
+		if e != nil {
+			logger.Log.Errorw("Could not delete upload job", "resource-type", job.ResourceType, "guid", job.Guid, "error", e)
+		}
+	}
+}
+
+// RemoveExpiredRegularly calls RemoveExpired every interval until stop is closed.
+func (registry *UploadJobRegistry) RemoveExpiredRegularly(interval time.Duration, stop <-chan struct{}) {
+	ticker := registry.clock.Ticker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			registry.RemoveExpired()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (registry *UploadJobRegistry) complete(tracker *UploadJobTracker, state string, e error) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	key := uploadJobKey(tracker.job.ResourceType, tracker.job.Guid)
+	if registry.progress[key] != &tracker.bytesTransferred {
+		// A newer upload of the same resource has replaced this job already.
+		return
+	}
+	delete(registry.progress, key)
+
+	now := registry.clock.Now().UTC()
+	job := tracker.job
+	job.State = state
+	job.BytesTransferred = atomic.LoadInt64(&tracker.bytesTransferred)
+	job.UpdatedAt = now
+	job.CompletedAt = &now
+	if e != nil {
+		job.Error = e.Error()
+	}
+	e = registry.store.Save(job)
+	if e != nil {
+		logger.Log.Errorw("Could not save upload job", "resource-type", job.ResourceType, "guid", job.Guid, "error", e)
+	}
+}
+
+// UploadJobTracker reports the progress and outcome of one job. A nil tracker ignores all calls,
+// so that synchronous uploads can use the same code path.
+type UploadJobTracker struct {
+	registry         *UploadJobRegistry
+	job              UploadJob
+	bytesTransferred int64
+}
+
+// Reader counts the bytes read from reader. Seeking back, e.g. when an upload is retried, resets the count.
+func (tracker *UploadJobTracker) Reader(reader io.ReadSeeker) io.ReadSeeker {
+	if tracker == nil {
+		return reader
+	}
+	atomic.StoreInt64(&tracker.bytesTransferred, 0)
+	return &progressReader{reader, &tracker.bytesTransferred}
+}
+
+func (tracker *UploadJobTracker) Succeeded() {
+	if tracker == nil {
+		return
+	}
+	tracker.registry.complete(tracker, UploadJobStateReady, nil)
+}
+
+func (tracker *UploadJobTracker) Failed(e error) {
+	if tracker == nil {
+		return
+	}
+	tracker.registry.complete(tracker, UploadJobStateFailed, e)
+}
+
+type progressReader struct {
+	delegate         io.ReadSeeker
+	bytesTransferred *int64
+}
+
+func (reader *progressReader) Read(p []byte) (int, error) {
+	n, e := reader.delegate.Read(p)
+	atomic.AddInt64(reader.bytesTransferred, int64(n))
+	return n, e
+}
+
+func (reader *progressReader) Seek(offset int64, whence int) (int64, error) {
+	position, e := reader.delegate.Seek(offset, whence)
+	if e == nil {
+		atomic.StoreInt64(reader.bytesTransferred, position)
+	}
+	return position, e
+}
+
+func uploadJobNotFound(responseWriter http.ResponseWriter, request *http.Request, resourceType, guid string) {
+	logger.From(request).Debugw("Upload job not found", "resource-type", resourceType, "guid", guid)
+	responseWriter.WriteHeader(http.StatusNotFound)
+	util.FprintDescriptionAsJSON(responseWriter, "No upload of %v '%v' found", resourceType, guid)
+}
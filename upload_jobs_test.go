@@ -0,0 +1,126 @@
+package bitsgo_test
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	. "github.com/cloudfoundry-incubator/bits-service"
+)
+
+var _ = Describe("UploadJobRegistry", func() {
+	var (
+		mockClock  *clock.Mock
+		uploadJobs *UploadJobRegistry
+	)
+
+	BeforeEach(func() {
+		mockClock = clock.NewMock()
+		mockClock.Set(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		uploadJobs = NewUploadJobRegistry(NewInMemoryUploadJobStore(), time.Hour, mockClock)
+	})
+
+	It("returns NotFoundError for unknown jobs", func() {
+		_, e := uploadJobs.Get("package", "someguid")
+
+		Expect(e).To(BeAssignableToTypeOf(&NotFoundError{}))
+	})
+
+	It("reports the bytes transferred while processing", func() {
+		tracker := uploadJobs.Start("package", "someguid", "some-sha1", "some-sha256")
+		reader := tracker.Reader(strings.NewReader("0123456789"))
+
+		_, e := io.CopyN(ioutil.Discard, reader, 4)
+		Expect(e).NotTo(HaveOccurred())
+
+		job, e := uploadJobs.Get("package", "someguid")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(job.State).To(Equal(UploadJobStateProcessing))
+		Expect(job.BytesTransferred).To(BeEquivalentTo(4))
+		Expect(job.CreatedAt).To(Equal(mockClock.Now().UTC()))
+
+		By("resetting the count when a retry seeks back")
+		_, e = reader.Seek(0, io.SeekStart)
+		Expect(e).NotTo(HaveOccurred())
+		job, e = uploadJobs.Get("package", "someguid")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(job.BytesTransferred).To(BeEquivalentTo(0))
+	})
+
+	It("records the outcome", func() {
+		tracker := uploadJobs.Start("package", "someguid", "some-sha1", "some-sha256")
+		_, e := ioutil.ReadAll(tracker.Reader(strings.NewReader("0123456789")))
+		Expect(e).NotTo(HaveOccurred())
+		mockClock.Add(time.Minute)
+
+		tracker.Failed(fmt.Errorf("some error"))
+
+		job, e := uploadJobs.Get("package", "someguid")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(job).To(Equal(UploadJob{
+			Guid:             "someguid",
+			ResourceType:     "package",
+			State:            UploadJobStateFailed,
+			BytesTransferred: 10,
+			Sha1:             "some-sha1",
+			Sha256:           "some-sha256",
+			Error:            "some error",
+			CreatedAt:        time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			UpdatedAt:        time.Date(2020, 1, 1, 0, 1, 0, 0, time.UTC),
+			CompletedAt:      &job.UpdatedAt,
+		}))
+	})
+
+	It("keeps jobs of different resource types apart", func() {
+		uploadJobs.Start("package", "someguid", "", "").Succeeded()
+		uploadJobs.Start("buildpack", "someguid", "", "")
+
+		packageJob, e := uploadJobs.Get("package", "someguid")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(packageJob.State).To(Equal(UploadJobStateReady))
+		buildpackJob, e := uploadJobs.Get("buildpack", "someguid")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(buildpackJob.State).To(Equal(UploadJobStateProcessing))
+	})
+
+	It("ignores the outcome of a job which has been replaced by a newer upload", func() {
+		previous := uploadJobs.Start("package", "someguid", "previous-sha1", "")
+		uploadJobs.Start("package", "someguid", "current-sha1", "")
+
+		previous.Failed(fmt.Errorf("some error"))
+
+		job, e := uploadJobs.Get("package", "someguid")
+		Expect(e).NotTo(HaveOccurred())
+		Expect(job.State).To(Equal(UploadJobStateProcessing))
+		Expect(job.Sha1).To(Equal("current-sha1"))
+	})
+
+	It("removes completed jobs after the retention", func() {
+		uploadJobs.Start("package", "completed", "", "").Succeeded()
+		uploadJobs.Start("package", "processing", "", "")
+
+		mockClock.Add(59 * time.Minute)
+		uploadJobs.Start("package", "recently-completed", "", "").Succeeded()
+		mockClock.Add(2 * time.Minute)
+		uploadJobs.RemoveExpired()
+
+		_, e := uploadJobs.Get("package", "completed")
+		Expect(e).To(BeAssignableToTypeOf(&NotFoundError{}))
+		_, e = uploadJobs.Get("package", "processing")
+		Expect(e).NotTo(HaveOccurred())
+		_, e = uploadJobs.Get("package", "recently-completed")
+		Expect(e).NotTo(HaveOccurred())
+	})
+
+	It("ignores calls on a nil tracker", func() {
+		var tracker *UploadJobTracker
+		reader := strings.NewReader("content")
+
+		Expect(tracker.Reader(reader)).To(BeIdenticalTo(reader))
+		tracker.Succeeded()
+		tracker.Failed(fmt.Errorf("some error"))
+	})
+})
@@ -0,0 +1,87 @@
+package util
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrAsyncSenderClosed    = errors.New("Sender is closed")
+	ErrAsyncSenderQueueFull = errors.New("Sender queue is full")
+)
+
+// AsyncSender sends items asynchronously and in order, so that a slow receiver does not slow down the caller.
+// Failed sends are retried as long as the back-off allows it and send does not return a *backoff.PermanentError.
+// If queueSize items are pending, new items are rejected.
+type AsyncSender struct {
+	send       func(item interface{}) error
+	newBackOff func() backoff.BackOff
+	notify     backoff.Notify
+	sent       func(item interface{}, e error)
+
+	mutex  sync.RWMutex
+	closed bool
+	queue  chan interface{}
+	done   sync.WaitGroup
+}
+
+// NewAsyncSender calls notify before each retry and sent with the final result of each item. Both may be nil.
+func NewAsyncSender(queueSize int, send func(item interface{}) error, newBackOff func() backoff.BackOff,
+	notify backoff.Notify, sent func(item interface{}, e error)) *AsyncSender {
+	sender := &AsyncSender{
+		send:       send,
+		newBackOff: newBackOff,
+		notify:     notify,
+		sent:       sent,
+		queue:      make(chan interface{}, queueSize),
+	}
+	sender.done.Add(1)
+	go sender.sendQueuedItems()
+	return sender
+}
+
+// Enqueue returns ErrAsyncSenderClosed or ErrAsyncSenderQueueFull if the item is not going to be sent.
+func (sender *AsyncSender) Enqueue(item interface{}) error {
+	sender.mutex.RLock()
+	defer sender.mutex.RUnlock()
+
+	if sender.closed {
+		return ErrAsyncSenderClosed
+	}
+	select {
+	case sender.queue <- item:
+		return nil
+	default:
+		return ErrAsyncSenderQueueFull
+	}
+}
+
+// Close sends all pending items before it returns.
+func (sender *AsyncSender) Close() {
+	sender.mutex.Lock()
+	if !sender.closed {
+		sender.closed = true
+		close(sender.queue)
+	}
+	sender.mutex.Unlock()
+
+	sender.done.Wait()
+}
+
+func (sender *AsyncSender) sendQueuedItems() {
+	defer sender.done.Done()
+	for item := range sender.queue {
+		e := backoff.RetryNotify(func() error { return sender.send(item) }, sender.newBackOff(),
+			func(e error, backOffDelay time.Duration) {
+				if sender.notify != nil {
+					sender.notify(e, backOffDelay)
+				}
+			})
+		if sender.sent != nil {
+			sender.sent(item, e)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package util
 
 import (
 	"context"
+	"net"
 	"net/http"
+	"time"
 )
 
 func RequestWithContextValues(r *http.Request, keysAndValues ...interface{}) *http.Request {
@@ -16,3 +18,82 @@ func RequestWithContextValues(r *http.Request, keysAndValues ...interface{}) *ht
 	}
 	return r.WithContext(c)
 }
+
+// VcapRequestIDFrom returns the vcap-request-id stored in ctx by the logger middleware or "" if there is none.
+func VcapRequestIDFrom(ctx context.Context) string {
+	if vcapRequestID, ok := ctx.Value("vcap-request-id").(string); ok {
+		return vcapRequestID
+	}
+	return ""
+}
+
+// WithVcapRequestID returns a copy of ctx which carries vcapRequestID, e.g. to correlate work outside of a request.
+func WithVcapRequestID(ctx context.Context, vcapRequestID string) context.Context {
+	return context.WithValue(ctx, "vcap-request-id", vcapRequestID)
+}
+
+// TraceHeaderNames are the B3 and W3C Trace Context headers which are passed on to other services.
+var TraceHeaderNames = []string{"X-B3-TraceId", "X-B3-SpanId", "X-B3-ParentSpanId", "X-B3-Sampled", "X-B3-Flags", "B3", "Traceparent", "Tracestate"}
+
+// TraceHeadersFrom returns the trace headers of request, or nil if there are none.
+func TraceHeadersFrom(request *http.Request) http.Header {
+	var traceHeaders http.Header
+	for _, name := range TraceHeaderNames {
+		if value := request.Header.Get(name); value != "" {
+			if traceHeaders == nil {
+				traceHeaders = make(http.Header)
+			}
+			traceHeaders.Set(name, value)
+		}
+	}
+	return traceHeaders
+}
+
+// WithTraceHeaders returns a copy of ctx which carries traceHeaders, see TraceHeadersFrom.
+func WithTraceHeaders(ctx context.Context, traceHeaders http.Header) context.Context {
+	return context.WithValue(ctx, "trace-headers", traceHeaders)
+}
+
+// TraceHeadersFromContext returns the trace headers stored in ctx by the logger middleware or nil if there are none.
+func TraceHeadersFromContext(ctx context.Context) http.Header {
+	if traceHeaders, ok := ctx.Value("trace-headers").(http.Header); ok {
+		return traceHeaders
+	}
+	return nil
+}
+
+// RequestWithPrincipal stores the authenticated principal, e.g. "basic_auth:cc", for auditing.
+func RequestWithPrincipal(r *http.Request, principal string) *http.Request {
+	return RequestWithContextValues(r, "principal", principal)
+}
+
+// PrincipalFrom returns the principal stored in ctx by the authentication middlewares or "anonymous" if there is none.
+func PrincipalFrom(ctx context.Context) string {
+	if principal, ok := ctx.Value("principal").(string); ok {
+		return principal
+	}
+	return "anonymous"
+}
+
+// RemoteIPFrom returns the IP address of the client connection.
+func RemoteIPFrom(r *http.Request) string {
+	host, _, e := net.SplitHostPort(r.RemoteAddr)
+	if e != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// WithoutCancel returns a context that carries all values of parent, but is never cancelled and has no deadline.
+// It is meant for work that outlives the request, e.g. asynchronous uploads.
+func WithoutCancel(parent context.Context) context.Context {
+	return valuesOnlyContext{parent}
+}
+
+type valuesOnlyContext struct {
+	context.Context
+}
+
+func (valuesOnlyContext) Deadline() (deadline time.Time, ok bool) { return }
+func (valuesOnlyContext) Done() <-chan struct{}                   { return nil }
+func (valuesOnlyContext) Err() error                              { return nil }
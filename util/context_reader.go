@@ -0,0 +1,24 @@
+package util
+
+import (
+	"context"
+	"io"
+)
+
+type contextReader struct {
+	ctx      context.Context
+	delegate io.Reader
+}
+
+// NewContextReader returns a reader that stops reading from delegate as soon as ctx is done.
+// This allows aborting long-running copies, e.g. when a client disconnects.
+func NewContextReader(ctx context.Context, delegate io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, delegate: delegate}
+}
+
+func (reader *contextReader) Read(p []byte) (n int, err error) {
+	if e := reader.ctx.Err(); e != nil {
+		return 0, e
+	}
+	return reader.delegate.Read(p)
+}
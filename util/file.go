@@ -0,0 +1,16 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// WriteFileAtomically writes to a temporary name first and then renames the file, so that readers, e.g. after
+// a crash, either see the complete new content or the previous one.
+func WriteFileAtomically(filename string, data []byte, perm os.FileMode) error {
+	e := ioutil.WriteFile(filename+".tmp", data, perm)
+	if e != nil {
+		return e
+	}
+	return os.Rename(filename+".tmp", filename)
+}
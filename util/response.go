@@ -7,7 +7,7 @@ import (
 )
 
 func FprintDescriptionAndCodeAsJSON(responseWriter http.ResponseWriter, code int, description string, a ...interface{}) {
-	fmt.Fprintf(responseWriter, DescriptionAndCodeAsJSON(code, description, a...))
+	fmt.Fprint(responseWriter, DescriptionAndCodeAsJSON(code, description, a...))
 }
 
 func DescriptionAndCodeAsJSON(code int, description string, a ...interface{}) string {
@@ -24,7 +24,7 @@ func DescriptionAndCodeAsJSON(code int, description string, a ...interface{}) st
 }
 
 func FprintDescriptionAsJSON(responseWriter http.ResponseWriter, description string, a ...interface{}) {
-	fmt.Fprintf(responseWriter, DescriptionAsJSON(description, a...))
+	fmt.Fprint(responseWriter, DescriptionAsJSON(description, a...))
 }
 
 func DescriptionAsJSON(description string, a ...interface{}) string {
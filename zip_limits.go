@@ -0,0 +1,133 @@
+package bitsgo
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/bits-service/logger"
+	"github.com/cloudfoundry-incubator/bits-service/util"
+)
+
+const (
+	ZipEntryCountExceededErrorCode       = 290011
+	ZipUncompressedSizeExceededErrorCode = 290012
+	ZipCompressionRatioExceededErrorCode = 290013
+	ZipPathDepthExceededErrorCode        = 290014
+	ZipInvalidEntryNameErrorCode         = 290015
+
+	// minSizeForCompressionRatioCheck avoids rejecting small, but highly compressible files.
+	minSizeForCompressionRatioCheck = 1024 * 1024
+)
+
+// ZipLimits restricts zip files uploaded as packages or app stash entries, and the bundles created from them.
+// Zero values mean no limit.
+type ZipLimits struct {
+	MaxUncompressedSize uint64
+	MaxEntries          int
+	MaxCompressionRatio uint64
+	MaxPathDepth        int
+}
+
+type ZipLimitError struct {
+	error
+	Code int
+}
+
+func newZipLimitError(code int, format string, a ...interface{}) *ZipLimitError {
+	return &ZipLimitError{error: fmt.Errorf(format, a...), Code: code}
+}
+
+// ValidateEntries checks the entries' headers. Since headers can understate uncompressed sizes,
+// entries must also be read through a ZipSizeBudget.
+func (limits ZipLimits) ValidateEntries(entries []*zip.File, additionalEntries int) error {
+	if limits.MaxEntries > 0 && len(entries)+additionalEntries > limits.MaxEntries {
+		return newZipLimitError(ZipEntryCountExceededErrorCode, "The zip file must not contain more than %v entries", limits.MaxEntries)
+	}
+	var totalUncompressedSize uint64
+	for _, entry := range entries {
+		e := limits.ValidateEntryName(entry.Name)
+		if e != nil {
+			return e
+		}
+		totalUncompressedSize += entry.UncompressedSize64
+		if limits.MaxUncompressedSize > 0 && totalUncompressedSize > limits.MaxUncompressedSize {
+			return newZipLimitError(ZipUncompressedSizeExceededErrorCode, "The zip file's uncompressed size must not exceed %v bytes", limits.MaxUncompressedSize)
+		}
+		if limits.MaxCompressionRatio > 0 && entry.UncompressedSize64 >= minSizeForCompressionRatioCheck &&
+			(entry.CompressedSize64 == 0 || entry.UncompressedSize64/entry.CompressedSize64 > limits.MaxCompressionRatio) {
+			return newZipLimitError(ZipCompressionRatioExceededErrorCode, "Zip entry '%v' exceeds the maximum compression ratio of %v", entry.Name, limits.MaxCompressionRatio)
+		}
+	}
+	return nil
+}
+
+// ValidateEntryName rejects names which could be extracted outside of the target directory.
+func (limits ZipLimits) ValidateEntryName(name string) error {
+	if name == "" || strings.ContainsRune(name, 0) {
+		return newZipLimitError(ZipInvalidEntryNameErrorCode, "Zip entry name '%v' is invalid", name)
+	}
+	if strings.HasPrefix(name, "/") || strings.HasPrefix(name, "\\") || (len(name) >= 2 && name[1] == ':') {
+		return newZipLimitError(ZipInvalidEntryNameErrorCode, "Zip entry name '%v' must not be an absolute path", name)
+	}
+	depth := 0
+	for _, segment := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if segment == ".." {
+			return newZipLimitError(ZipInvalidEntryNameErrorCode, "Zip entry name '%v' must not contain '..'", name)
+		}
+		if segment != "." {
+			depth++
+		}
+	}
+	if limits.MaxPathDepth > 0 && depth > limits.MaxPathDepth {
+		return newZipLimitError(ZipPathDepthExceededErrorCode, "Zip entry name '%v' must not be nested deeper than %v levels", name, limits.MaxPathDepth)
+	}
+	return nil
+}
+
+// ZipSizeBudget tracks the uncompressed bytes read from all entries of a zip file.
+type ZipSizeBudget struct {
+	limits   ZipLimits
+	read     uint64
+	exceeded *ZipLimitError
+}
+
+func (limits ZipLimits) NewSizeBudget() *ZipSizeBudget {
+	return &ZipSizeBudget{limits: limits}
+}
+
+// Reader fails with *ZipLimitError once the total uncompressed size exceeds the limit.
+func (budget *ZipSizeBudget) Reader(reader io.Reader) io.Reader {
+	return &budgetReader{reader, budget}
+}
+
+type budgetReader struct {
+	delegate io.Reader
+	budget   *ZipSizeBudget
+}
+
+func (reader *budgetReader) Read(p []byte) (int, error) {
+	n, e := reader.delegate.Read(p)
+	reader.budget.read += uint64(n)
+	if reader.budget.limits.MaxUncompressedSize > 0 && reader.budget.read > reader.budget.limits.MaxUncompressedSize {
+		reader.budget.exceeded = newZipLimitError(ZipUncompressedSizeExceededErrorCode, "The zip file's uncompressed size must not exceed %v bytes", reader.budget.limits.MaxUncompressedSize)
+		return n, reader.budget.exceeded
+	}
+	return n, e
+}
+
+// Err returns *ZipLimitError if the budget has been exceeded, also when the reader's error has been wrapped since.
+func (budget *ZipSizeBudget) Err() error {
+	if budget.exceeded == nil {
+		return nil
+	}
+	return budget.exceeded
+}
+
+func zipLimitExceeded(responseWriter http.ResponseWriter, request *http.Request, e *ZipLimitError) {
+	logger.From(request).Infow("Zip limit exceeded", "error", e, "code", e.Code)
+	responseWriter.WriteHeader(http.StatusUnprocessableEntity)
+	util.FprintDescriptionAndCodeAsJSON(responseWriter, e.Code, "%v", e.Error())
+}
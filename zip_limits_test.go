@@ -0,0 +1,90 @@
+package bitsgo_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	. "github.com/cloudfoundry-incubator/bits-service"
+	. "github.com/cloudfoundry-incubator/bits-service/testutil"
+)
+
+var _ = Describe("ZipLimits", func() {
+	zipEntriesOf := func(buffer *bytes.Buffer) []*zip.File {
+		zipReader, e := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+		Expect(e).NotTo(HaveOccurred())
+		return zipReader.File
+	}
+
+	expectZipLimitError := func(e error, code int) {
+		Expect(e).To(BeAssignableToTypeOf(&ZipLimitError{}))
+		Expect(e.(*ZipLimitError).Code).To(Equal(code), e.Error())
+	}
+
+	Describe("ValidateEntryName", func() {
+		It("accepts relative names within the limits", func() {
+			limits := ZipLimits{MaxPathDepth: 3}
+			for _, name := range []string{"file", "folder/file", "./folder/file", "a/b/c", "a..b/c", "folder/"} {
+				Expect(limits.ValidateEntryName(name)).To(Succeed(), name)
+			}
+		})
+
+		It("rejects names which escape the target directory", func() {
+			for _, name := range []string{"", "../file", "folder/../../file", "..", "folder\\..\\..\\file", "/etc/passwd", "\\file", "C:\\file", "file\x00"} {
+				expectZipLimitError(ZipLimits{}.ValidateEntryName(name), ZipInvalidEntryNameErrorCode)
+			}
+		})
+
+		It("rejects names nested too deeply", func() {
+			expectZipLimitError(ZipLimits{MaxPathDepth: 2}.ValidateEntryName("a/b/c"), ZipPathDepthExceededErrorCode)
+		})
+	})
+
+	Describe("ValidateEntries", func() {
+		It("accepts zip files within the limits", func() {
+			entries := zipEntriesOf(CreateZip(map[string]string{"file1": "content1", "file2": "content2"}))
+
+			Expect(ZipLimits{MaxEntries: 3, MaxUncompressedSize: 16, MaxCompressionRatio: 10, MaxPathDepth: 1}.ValidateEntries(entries, 1)).To(Succeed())
+		})
+
+		It("rejects too many entries, including additional ones", func() {
+			entries := zipEntriesOf(CreateZip(map[string]string{"file1": "content1", "file2": "content2"}))
+
+			expectZipLimitError(ZipLimits{MaxEntries: 2}.ValidateEntries(entries, 1), ZipEntryCountExceededErrorCode)
+		})
+
+		It("rejects a total uncompressed size above the limit", func() {
+			entries := zipEntriesOf(CreateZip(map[string]string{"file1": "content1", "file2": "content2"}))
+
+			expectZipLimitError(ZipLimits{MaxUncompressedSize: 15}.ValidateEntries(entries, 0), ZipUncompressedSizeExceededErrorCode)
+		})
+
+		It("rejects entries with a compression ratio above the limit", func() {
+			entries := zipEntriesOf(CreateZip(map[string]string{"zeros": strings.Repeat("0", 2*1024*1024)}))
+
+			expectZipLimitError(ZipLimits{MaxCompressionRatio: 100}.ValidateEntries(entries, 0), ZipCompressionRatioExceededErrorCode)
+		})
+
+		It("rejects entries with invalid names", func() {
+			entries := zipEntriesOf(CreateZip(map[string]string{"../evil": "content"}))
+
+			expectZipLimitError(ZipLimits{}.ValidateEntries(entries, 0), ZipInvalidEntryNameErrorCode)
+		})
+	})
+
+	Describe("ZipSizeBudget", func() {
+		It("fails once the readers together have read more than the limit, regardless of declared sizes", func() {
+			budget := ZipLimits{MaxUncompressedSize: 10}.NewSizeBudget()
+
+			_, e := io.Copy(ioutil.Discard, budget.Reader(strings.NewReader("123456")))
+			Expect(e).NotTo(HaveOccurred())
+			Expect(budget.Err()).NotTo(HaveOccurred())
+
+			_, e = io.Copy(ioutil.Discard, budget.Reader(strings.NewReader("123456")))
+			expectZipLimitError(e, ZipUncompressedSizeExceededErrorCode)
+			expectZipLimitError(budget.Err(), ZipUncompressedSizeExceededErrorCode)
+		})
+	})
+})